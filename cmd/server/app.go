@@ -1,14 +1,16 @@
 package main
 
 import (
-	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/diewo77/go-invoices/auth"
 	"github.com/diewo77/go-gate"
 	"github.com/diewo77/go-invoices/i18n"
+	"github.com/diewo77/go-invoices/internal/handlers"
 	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/openapi"
 	"github.com/diewo77/go-invoices/internal/policy"
 	"github.com/diewo77/go-invoices/view"
 	"gorm.io/gorm"
@@ -94,6 +96,8 @@ func (a *App) setupRoutes() {
 	ph := a.routerCfg.ProductHandler
 	ch := a.routerCfg.ClientHandler
 	ih := a.routerCfg.InvoiceHandler
+	pih := a.routerCfg.ProductImportHandler
+	cih := a.routerCfg.ClientImportHandler
 
 	// Products - require product:list, product:create, etc.
 	a.mux.Handle("GET /products",
@@ -110,6 +114,14 @@ func (a *App) setupRoutes() {
 		a.requireAuth(a.requirePermission("product", gate.ActionUpdate)(http.HandlerFunc(ph.Update))))
 	a.mux.Handle("POST /products/{id}/delete",
 		a.requireAuth(a.requirePermission("product", gate.ActionDelete)(http.HandlerFunc(ph.Delete))))
+	a.mux.Handle("GET /products/import",
+		a.requireAuth(a.requirePermission("product", gate.ActionCreate)(http.HandlerFunc(pih.Form))))
+	a.mux.Handle("POST /products/import/upload",
+		a.requireAuth(a.requirePermission("product", gate.ActionCreate)(http.HandlerFunc(pih.Upload))))
+	a.mux.Handle("POST /products/import/preview",
+		a.requireAuth(a.requirePermission("product", gate.ActionCreate)(http.HandlerFunc(pih.Preview))))
+	a.mux.Handle("POST /products/import",
+		a.requireAuth(a.requirePermission("product", gate.ActionCreate)(http.HandlerFunc(pih.Import))))
 
 	// Clients - require client:list, client:create, etc.
 	a.mux.Handle("GET /clients",
@@ -126,6 +138,14 @@ func (a *App) setupRoutes() {
 		a.requireAuth(a.requirePermission("client", gate.ActionUpdate)(http.HandlerFunc(ch.Update))))
 	a.mux.Handle("POST /clients/{id}/delete",
 		a.requireAuth(a.requirePermission("client", gate.ActionDelete)(http.HandlerFunc(ch.Delete))))
+	a.mux.Handle("GET /clients/import",
+		a.requireAuth(a.requirePermission("client", gate.ActionCreate)(http.HandlerFunc(cih.Form))))
+	a.mux.Handle("POST /clients/import/upload",
+		a.requireAuth(a.requirePermission("client", gate.ActionCreate)(http.HandlerFunc(cih.Upload))))
+	a.mux.Handle("POST /clients/import/preview",
+		a.requireAuth(a.requirePermission("client", gate.ActionCreate)(http.HandlerFunc(cih.Preview))))
+	a.mux.Handle("POST /clients/import",
+		a.requireAuth(a.requirePermission("client", gate.ActionCreate)(http.HandlerFunc(cih.Import))))
 
 	// Invoices - require invoice:list, invoice:create, etc.
 	a.mux.Handle("GET /invoices",
@@ -134,6 +154,8 @@ func (a *App) setupRoutes() {
 		a.requireAuth(a.requirePermission("invoice", gate.ActionCreate)(http.HandlerFunc(ih.New))))
 	a.mux.Handle("POST /invoices",
 		a.requireAuth(a.requirePermission("invoice", gate.ActionCreate)(http.HandlerFunc(ih.Create))))
+	a.mux.Handle("GET /invoices/integrity",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionView)(http.HandlerFunc(a.routerCfg.SealHandler.Integrity))))
 	a.mux.Handle("GET /invoices/{id}",
 		a.requireAuth(a.requirePermission("invoice", gate.ActionView)(http.HandlerFunc(ih.View))))
 	a.mux.Handle("GET /invoices/{id}/edit",
@@ -146,19 +168,159 @@ func (a *App) setupRoutes() {
 		a.requireAuth(a.requirePermission("invoice", "finalize")(http.HandlerFunc(ih.Finalize))))
 	a.mux.Handle("GET /invoices/{id}/pdf",
 		a.requireAuth(a.requirePermission("invoice", gate.ActionView)(http.HandlerFunc(ih.PDF))))
+	a.mux.Handle("GET /invoices/{id}/facturx",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionView)(http.HandlerFunc(ih.FacturX))))
+	a.mux.Handle("POST /invoices/{id}/send",
+		a.requireAuth(a.requirePermission("invoice", "send")(http.HandlerFunc(ih.Send))))
+
+	// UBL (Peppol BIS) export and import
+	eh := a.routerCfg.EInvoiceHandler
+	a.mux.Handle("GET /invoices/{id}/ubl",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionView)(http.HandlerFunc(eh.UBL))))
+	a.mux.Handle("GET /invoices/import",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionCreate)(http.HandlerFunc(eh.ImportForm))))
+	a.mux.Handle("POST /invoices/import",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionCreate)(http.HandlerFunc(eh.Import))))
+
+	// Credit notes
+	a.mux.Handle("GET /invoices/{id}/credit-notes/new",
+		a.requireAuth(a.requirePermission("invoice", "credit")(http.HandlerFunc(ih.NewCreditNote))))
+	a.mux.Handle("POST /invoices/{id}/credit-notes",
+		a.requireAuth(a.requirePermission("invoice", "credit")(http.HandlerFunc(ih.CreateCreditNote))))
+
+	// Payments
+	pay := a.routerCfg.PaymentHandler
+	a.mux.Handle("GET /invoices/{id}/payments",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionView)(http.HandlerFunc(pay.List))))
+	a.mux.Handle("POST /invoices/{id}/payments",
+		a.requireAuth(a.requirePermission("invoice", "payment")(http.HandlerFunc(pay.Create))))
+	a.mux.Handle("POST /invoices/{id}/payments/{payment_id}/delete",
+		a.requireAuth(a.requirePermission("invoice", "payment")(http.HandlerFunc(pay.Delete))))
+
+	// Deposit invoices
+	a.mux.Handle("POST /invoices/{id}/deposits",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionCreate)(http.HandlerFunc(ih.CreateDeposit))))
+
+	// Late-payment penalty invoices
+	a.mux.Handle("POST /invoices/{id}/penalties",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionCreate)(http.HandlerFunc(ih.CreatePenalty))))
 
 	// Invoice Items
 	a.mux.Handle("POST /invoices/{id}/items",
 		a.requireAuth(a.requirePermission("invoice", gate.ActionUpdate)(http.HandlerFunc(ih.AddItem))))
+	a.mux.Handle("POST /invoices/{id}/items/reorder",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionUpdate)(http.HandlerFunc(ih.ReorderItems))))
+	a.mux.Handle("POST /invoices/{id}/items/{item_id}/update",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionUpdate)(http.HandlerFunc(ih.UpdateItem))))
 	a.mux.Handle("POST /invoices/{id}/items/{item_id}/delete",
 		a.requireAuth(a.requirePermission("invoice", gate.ActionUpdate)(http.HandlerFunc(ih.RemoveItem))))
 
+	// Recurring invoices
+	rh := a.routerCfg.RecurringInvoiceHandler
+	a.mux.Handle("GET /invoices/recurring",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionList)(http.HandlerFunc(rh.List))))
+	a.mux.Handle("GET /invoices/recurring/new",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionCreate)(http.HandlerFunc(rh.New))))
+	a.mux.Handle("POST /invoices/recurring",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionCreate)(http.HandlerFunc(rh.Create))))
+	a.mux.Handle("GET /invoices/recurring/{id}/edit",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionUpdate)(http.HandlerFunc(rh.Edit))))
+	a.mux.Handle("POST /invoices/recurring/{id}/update",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionUpdate)(http.HandlerFunc(rh.Update))))
+	a.mux.Handle("POST /invoices/recurring/{id}/delete",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionDelete)(http.HandlerFunc(rh.Delete))))
+	a.mux.Handle("POST /invoices/recurring/{id}/items",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionUpdate)(http.HandlerFunc(rh.AddItem))))
+	a.mux.Handle("POST /invoices/recurring/{id}/items/{item_id}/delete",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionUpdate)(http.HandlerFunc(rh.RemoveItem))))
+
+	// Quotes
+	qh := a.routerCfg.QuoteHandler
+	a.mux.Handle("GET /quotes",
+		a.requireAuth(a.requirePermission("quote", gate.ActionList)(http.HandlerFunc(qh.List))))
+	a.mux.Handle("GET /quotes/new",
+		a.requireAuth(a.requirePermission("quote", gate.ActionCreate)(http.HandlerFunc(qh.New))))
+	a.mux.Handle("POST /quotes",
+		a.requireAuth(a.requirePermission("quote", gate.ActionCreate)(http.HandlerFunc(qh.Create))))
+	a.mux.Handle("GET /quotes/{id}",
+		a.requireAuth(a.requirePermission("quote", gate.ActionView)(http.HandlerFunc(qh.View))))
+	a.mux.Handle("GET /quotes/{id}/edit",
+		a.requireAuth(a.requirePermission("quote", gate.ActionUpdate)(http.HandlerFunc(qh.Edit))))
+	a.mux.Handle("POST /quotes/{id}",
+		a.requireAuth(a.requirePermission("quote", gate.ActionUpdate)(http.HandlerFunc(qh.Update))))
+	a.mux.Handle("POST /quotes/{id}/delete",
+		a.requireAuth(a.requirePermission("quote", gate.ActionDelete)(http.HandlerFunc(qh.Delete))))
+	a.mux.Handle("POST /quotes/{id}/send",
+		a.requireAuth(a.requirePermission("quote", "send")(http.HandlerFunc(qh.Send))))
+	a.mux.Handle("POST /quotes/{id}/accept",
+		a.requireAuth(a.requirePermission("quote", gate.ActionUpdate)(http.HandlerFunc(qh.Accept))))
+	a.mux.Handle("POST /quotes/{id}/refuse",
+		a.requireAuth(a.requirePermission("quote", gate.ActionUpdate)(http.HandlerFunc(qh.Refuse))))
+	a.mux.Handle("POST /quotes/{id}/deposits",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionCreate)(http.HandlerFunc(qh.CreateDeposit))))
+	a.mux.Handle("POST /quotes/{id}/convert",
+		a.requireAuth(a.requirePermission("quote", "convert")(http.HandlerFunc(qh.Convert))))
+	a.mux.Handle("GET /quotes/{id}/pdf",
+		a.requireAuth(a.requirePermission("quote", gate.ActionView)(http.HandlerFunc(qh.PDF))))
+	a.mux.Handle("POST /quotes/{id}/items",
+		a.requireAuth(a.requirePermission("quote", gate.ActionUpdate)(http.HandlerFunc(qh.AddItem))))
+	a.mux.Handle("POST /quotes/{id}/items/{item_id}/delete",
+		a.requireAuth(a.requirePermission("quote", gate.ActionUpdate)(http.HandlerFunc(qh.RemoveItem))))
+
+	// Revenue and VAT reports
+	rp := a.routerCfg.ReportHandler
+	a.mux.Handle("GET /reports",
+		a.requireAuth(a.requirePermission("report", gate.ActionView)(http.HandlerFunc(rp.Index))))
+	a.mux.Handle("GET /reports/{report}/csv",
+		a.requireAuth(a.requirePermission("report", gate.ActionView)(http.HandlerFunc(rp.Export))))
+	a.mux.Handle("GET /reports/fec",
+		a.requireAuth(a.requirePermission("report", "export")(http.HandlerFunc(rp.FEC))))
+
+	// Archived invoices
+	ar := a.routerCfg.ArchiveHandler
+	a.mux.Handle("GET /reports/retention",
+		a.requireAuth(a.requirePermission("report", gate.ActionView)(http.HandlerFunc(ar.Retention))))
+	a.mux.Handle("GET /reports/retention/csv",
+		a.requireAuth(a.requirePermission("report", gate.ActionView)(http.HandlerFunc(ar.RetentionCSV))))
+	a.mux.Handle("POST /reports/retention/archive",
+		a.requireAuth(a.requirePermission("invoice", gate.ActionUpdate)(http.HandlerFunc(ar.ArchiveMissing))))
+
 	// Company Settings
 	sh := a.routerCfg.CompanyHandler
 	a.mux.Handle("GET /settings",
 		a.requireAuth(http.HandlerFunc(sh.Edit)))
 	a.mux.Handle("POST /settings",
 		a.requireAuth(http.HandlerFunc(sh.Update)))
+	nh := a.routerCfg.NumberingHandler
+	a.mux.Handle("GET /settings/numbering",
+		a.requireAuth(a.requirePermission("numbering", gate.ActionView)(http.HandlerFunc(nh.Edit))))
+	a.mux.Handle("POST /settings/numbering",
+		a.requireAuth(a.requirePermission("numbering", gate.ActionUpdate)(http.HandlerFunc(nh.Update))))
+	th := a.routerCfg.APITokenHandler
+	a.mux.Handle("GET /settings/api-tokens",
+		a.requireAuth(a.requirePermission("api_token", gate.ActionList)(http.HandlerFunc(th.List))))
+	a.mux.Handle("POST /settings/api-tokens",
+		a.requireAuth(a.requirePermission("api_token", gate.ActionCreate)(http.HandlerFunc(th.Create))))
+	a.mux.Handle("POST /settings/api-tokens/{id}/revoke",
+		a.requireAuth(a.requirePermission("api_token", gate.ActionDelete)(http.HandlerFunc(th.Revoke))))
+	wh := a.routerCfg.WebhookHandler
+	a.mux.Handle("GET /settings/webhooks",
+		a.requireAuth(a.requirePermission("webhook", gate.ActionList)(http.HandlerFunc(wh.List))))
+	a.mux.Handle("POST /settings/webhooks",
+		a.requireAuth(a.requirePermission("webhook", gate.ActionCreate)(http.HandlerFunc(wh.Create))))
+	a.mux.Handle("POST /settings/webhooks/{id}/delete",
+		a.requireAuth(a.requirePermission("webhook", gate.ActionDelete)(http.HandlerFunc(wh.Delete))))
+	a.mux.Handle("GET /settings/webhooks/deliveries",
+		a.requireAuth(a.requirePermission("webhook", gate.ActionList)(http.HandlerFunc(wh.Deliveries))))
+	a.mux.Handle("POST /settings/webhooks/deliveries/{id}/redeliver",
+		a.requireAuth(a.requirePermission("webhook", gate.ActionUpdate)(http.HandlerFunc(wh.Redeliver))))
+	xh := a.routerCfg.ExchangeRateHandler
+	a.mux.Handle("GET /settings/exchange-rates",
+		a.requireAuth(a.requirePermission("exchange_rate", gate.ActionList)(http.HandlerFunc(xh.List))))
+	a.mux.Handle("POST /settings/exchange-rates",
+		a.requireAuth(a.requirePermission("exchange_rate", gate.ActionCreate)(http.HandlerFunc(xh.Create))))
+	a.mux.Handle("POST /settings/exchange-rates/{id}/delete",
+		a.requireAuth(a.requirePermission("exchange_rate", gate.ActionDelete)(http.HandlerFunc(xh.Delete))))
 	a.mux.HandleFunc("GET /setup", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/settings", http.StatusMovedPermanently)
 	})
@@ -193,12 +355,120 @@ func (a *App) setupRoutes() {
 	a.mux.Handle("POST /admin/users/{id}/profile",
 		a.requireAdmin(http.HandlerFunc(auph.AssignProfile)))
 
+	// Audit log
+	audh := a.routerCfg.AuditHandler
+	a.mux.Handle("GET /admin/audit",
+		a.requireAdmin(http.HandlerFunc(audh.List)))
+	a.mux.Handle("POST /admin/audit/verify",
+		a.requireAdmin(http.HandlerFunc(audh.Verify)))
+
+	// ─────────────────────────────────────────────────────────────────────────
+	// JSON API (API token + specific permissions, scoped by the token)
+	// ─────────────────────────────────────────────────────────────────────────
+	a.setupAPIRoutes()
+
 	// ─────────────────────────────────────────────────────────────────────────
 	// Static files
 	// ─────────────────────────────────────────────────────────────────────────
 	a.mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 }
 
+// apiRoute is a route of the JSON API, with its description in the
+// OpenAPI document. Routes with a resource require an API token and the
+// permission resource:action.
+type apiRoute struct {
+	Pattern  string
+	Resource string
+	Action   gate.Action
+	Handler  http.HandlerFunc
+	Doc      apiDoc
+}
+
+// apiRoutes is the route table of the JSON API. Every route registered
+// under /api must be in it, described.
+func (a *App) apiRoutes() []apiRoute {
+	ac := a.routerCfg.APIClientHandler
+	ap := a.routerCfg.APIProductHandler
+	ai := a.routerCfg.APIInvoiceHandler
+
+	return []apiRoute{
+		{"GET /api/openapi.json", "", "", a.openAPI, apiDoc{
+			ID: "getOpenAPI", Summary: "This OpenAPI document", Response: map[string]any{}}},
+
+		// Clients
+		{"GET /api/v1/clients", "client", gate.ActionList, ac.List, apiDoc{
+			ID: "listClients", Summary: "List clients", Response: models.Client{}, List: true,
+			Query: []openapi.Parameter{queryParam("q", "Filter on name, company or email")}}},
+		{"POST /api/v1/clients", "client", gate.ActionCreate, ac.Create, apiDoc{
+			ID: "createClient", Summary: "Create a client", Request: handlers.APIClientInput{}, Response: models.Client{}, Status: http.StatusCreated}},
+		{"GET /api/v1/clients/{id}", "client", gate.ActionView, ac.Get, apiDoc{
+			ID: "getClient", Summary: "Get a client", Response: models.Client{}}},
+		{"PATCH /api/v1/clients/{id}", "client", gate.ActionUpdate, ac.Update, apiDoc{
+			ID: "updateClient", Summary: "Update a client", Request: handlers.APIClientInput{}, Response: models.Client{}}},
+		{"DELETE /api/v1/clients/{id}", "client", gate.ActionDelete, ac.Delete, apiDoc{
+			ID: "deleteClient", Summary: "Delete a client"}},
+
+		// Products
+		{"GET /api/v1/products", "product", gate.ActionList, ap.List, apiDoc{
+			ID: "listProducts", Summary: "List products", Response: models.Product{}, List: true,
+			Query: []openapi.Parameter{queryParam("q", "Filter on code or name")}}},
+		{"POST /api/v1/products", "product", gate.ActionCreate, ap.Create, apiDoc{
+			ID: "createProduct", Summary: "Create a product", Request: handlers.APIProductInput{}, Response: models.Product{}, Status: http.StatusCreated,
+			Errors: []int{http.StatusConflict}}},
+		{"GET /api/v1/products/{id}", "product", gate.ActionView, ap.Get, apiDoc{
+			ID: "getProduct", Summary: "Get a product", Response: models.Product{}}},
+		{"PATCH /api/v1/products/{id}", "product", gate.ActionUpdate, ap.Update, apiDoc{
+			ID: "updateProduct", Summary: "Update a product", Request: handlers.APIProductInput{}, Response: models.Product{},
+			Errors: []int{http.StatusConflict}}},
+		{"DELETE /api/v1/products/{id}", "product", gate.ActionDelete, ap.Delete, apiDoc{
+			ID: "deleteProduct", Summary: "Delete a product"}},
+
+		// Invoices
+		{"GET /api/v1/invoices", "invoice", gate.ActionList, ai.List, apiDoc{
+			ID: "listInvoices", Summary: "List invoices", Response: handlers.APIInvoice{}, List: true,
+			Query: []openapi.Parameter{
+				queryParam("status", "Filter on status: draft, final, paid or cancelled"),
+				queryParam("client_id", "Filter on client")}}},
+		{"POST /api/v1/invoices", "invoice", gate.ActionCreate, ai.Create, apiDoc{
+			ID: "createInvoice", Summary: "Create a draft invoice", Request: handlers.APIInvoiceInput{}, Response: handlers.APIInvoice{}, Status: http.StatusCreated}},
+		{"GET /api/v1/invoices/{id}", "invoice", gate.ActionView, ai.Get, apiDoc{
+			ID: "getInvoice", Summary: "Get an invoice with its items", Response: handlers.APIInvoice{}}},
+		{"PATCH /api/v1/invoices/{id}", "invoice", gate.ActionUpdate, ai.Update, apiDoc{
+			ID: "updateInvoice", Summary: "Update a draft invoice", Request: handlers.APIInvoiceInput{}, Response: handlers.APIInvoice{},
+			Errors: []int{http.StatusConflict}}},
+		{"DELETE /api/v1/invoices/{id}", "invoice", gate.ActionDelete, ai.Delete, apiDoc{
+			ID: "deleteInvoice", Summary: "Delete a draft invoice", Errors: []int{http.StatusConflict}}},
+		{"POST /api/v1/invoices/{id}/finalize", "invoice", "finalize", ai.Finalize, apiDoc{
+			ID: "finalizeInvoice", Summary: "Finalize a draft invoice", Response: handlers.APIInvoice{},
+			Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity}}},
+		{"GET /api/v1/invoices/{id}/pdf", "invoice", gate.ActionView, ai.PDF, apiDoc{
+			ID: "getInvoicePDF", Summary: "Download an invoice as PDF", File: "application/pdf"}},
+
+		// Invoice items
+		{"GET /api/v1/invoices/{id}/items", "invoice", gate.ActionView, ai.ListItems, apiDoc{
+			ID: "listInvoiceItems", Summary: "List the items of an invoice", Response: models.InvoiceItem{}, List: true, Unpaged: true}},
+		{"POST /api/v1/invoices/{id}/items", "invoice", gate.ActionUpdate, ai.CreateItem, apiDoc{
+			ID: "createInvoiceItem", Summary: "Add an item to a draft invoice", Request: handlers.APIItemInput{}, Response: models.InvoiceItem{}, Status: http.StatusCreated,
+			Errors: []int{http.StatusConflict}}},
+		{"PATCH /api/v1/invoices/{id}/items/{item_id}", "invoice", gate.ActionUpdate, ai.UpdateItem, apiDoc{
+			ID: "updateInvoiceItem", Summary: "Update an item of a draft invoice", Request: handlers.APIItemInput{}, Response: models.InvoiceItem{},
+			Errors: []int{http.StatusConflict}}},
+		{"DELETE /api/v1/invoices/{id}/items/{item_id}", "invoice", gate.ActionUpdate, ai.DeleteItem, apiDoc{
+			ID: "deleteInvoiceItem", Summary: "Remove an item from a draft invoice", Errors: []int{http.StatusConflict}}},
+	}
+}
+
+// setupAPIRoutes registers the API route table.
+func (a *App) setupAPIRoutes() {
+	for _, route := range a.apiRoutes() {
+		var handler http.Handler = route.Handler
+		if route.Resource != "" {
+			handler = a.requireToken(a.requirePermission(route.Resource, route.Action)(handler))
+		}
+		a.mux.Handle(route.Pattern, handler)
+	}
+}
+
 // ─────────────────────────────────────────────────────────────────────────────
 // Middleware
 // ─────────────────────────────────────────────────────────────────────────────
@@ -216,6 +486,11 @@ func (a *App) requireAuth(next http.Handler) http.Handler {
 	})
 }
 
+// requireToken wraps an API handler to require a valid API token.
+func (a *App) requireToken(next http.Handler) http.Handler {
+	return a.routerCfg.AuthGate.RequireAPIToken(a.routerCfg.APITokenService)(next)
+}
+
 // requireAdmin wraps a handler to require admin permissions.
 // Uses the AuthGate to check for profile:* or *:* permission.
 func (a *App) requireAdmin(next http.Handler) http.Handler {
@@ -292,15 +567,19 @@ func (a *App) dashboard(w http.ResponseWriter, r *http.Request) {
 	// Get revenue
 	revenue, _ := a.routerCfg.InvoiceService.GetRevenue(userID)
 
+	// Get overdue invoices, most late first
+	overdue, _ := a.routerCfg.ReminderService.Overdue(userID, time.Now())
+
 	view.Render(w, r, "dashboard.html", map[string]any{
 		"User": user,
 		"Stats": map[string]any{
 			"Products": productCount,
 			"Clients":  clientCount,
 			"Invoices": invoiceCount,
-			"Revenue":  fmt.Sprintf("€%.2f", revenue),
+			"Revenue":  a.routerCfg.InvoiceService.BaseCurrency(userID).Format(revenue),
 		},
 		"RecentProducts": recentProducts,
 		"RecentInvoices": recentInvoices,
+		"Overdue":        overdue,
 	})
 }
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/diewo77/go-invoices/internal/policy"
+)
+
+// TestSetupRoutes_NoConflicts registers every route: the mux panics on
+// conflicting patterns.
+func TestSetupRoutes_NoConflicts(t *testing.T) {
+	app := &App{mux: http.NewServeMux(), routerCfg: &policy.RouterConfig{}}
+	app.setupRoutes()
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -13,8 +15,11 @@ import (
 	"github.com/diewo77/go-invoices/auth"
 	"github.com/diewo77/go-invoices/internal/config"
 	"github.com/diewo77/go-invoices/internal/db"
+	"github.com/diewo77/go-invoices/internal/mail"
 	"github.com/diewo77/go-invoices/internal/models"
 	"github.com/diewo77/go-invoices/internal/policy"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/internal/storage"
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -23,6 +28,16 @@ import (
 var (
 	migrateOnlyFlag = flag.Bool("migrate-only", false, "Run DB migrations and exit")
 	seedOnlyFlag    = flag.Bool("seed-only", false, "Run DB seed and exit")
+
+	// FEC export: go run ./cmd/server -export-fec -user 1 -from 2025-01-01 -to 2025-12-31
+	exportFECFlag = flag.Bool("export-fec", false, "Export the accounting entries (FEC) of -user and exit")
+	userFlag      = flag.Uint("user", 0, "User whose entries are exported or seals verified")
+	fromFlag      = flag.String("from", "", "First day of the export, YYYY-MM-DD (default: January 1st)")
+	toFlag        = flag.String("to", "", "Last day of the export, YYYY-MM-DD (default: December 31st)")
+	outputFlag    = flag.String("output", "", "File to write the export to (default: the FEC file name)")
+
+	verifyAuditFlag = flag.Bool("verify-audit", false, "Verify the audit log hash chain and exit")
+	verifySealsFlag = flag.Bool("verify-seals", false, "Verify the seals of the finalized invoices of -user (default: all users) and exit")
 )
 
 func main() {
@@ -40,6 +55,11 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// Record changes to invoices, clients, products and settings
+	if err := services.RegisterAudit(dbConn); err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+
 	// Handle migrate-only flag
 	if *migrateOnlyFlag {
 		if err := db.Migrate(dbConn); err != nil {
@@ -58,6 +78,34 @@ func main() {
 		return
 	}
 
+	// Handle export-fec flag
+	if *exportFECFlag {
+		path, err := exportFEC(dbConn)
+		if err != nil {
+			log.Fatalf("FEC export failed: %v", err)
+		}
+		log.Printf("FEC exported to %s", path)
+		return
+	}
+
+	// Handle verify-audit flag
+	if *verifyAuditFlag {
+		n, err := services.NewAuditService(dbConn).Verify()
+		if err != nil {
+			log.Fatalf("Audit verification failed after %d entries: %v", n, err)
+		}
+		log.Printf("Audit chain verified: %d entries", n)
+		return
+	}
+
+	// Handle verify-seals flag
+	if *verifySealsFlag {
+		if !verifySeals(dbConn) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Run migrations on startup if enabled
 	if cfg.App.Migrations {
 		if err := db.Migrate(dbConn); err != nil {
@@ -79,11 +127,19 @@ func main() {
 	})
 
 	// Create router config with authorization
-	routerCfg := policy.NewRouterConfig(dbConn)
+	routerCfg := policy.NewRouterConfig(dbConn, newMailer(cfg.Mail), cfg.Mail.From, newStore(cfg.Storage))
 
 	// Create application handler
 	appHandler := NewApp(dbConn, routerCfg)
 
+	// Background workers stop with the server
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go routerCfg.WebhookService.Run(workers, 30*time.Second)
+	go routerCfg.RecurringInvoiceService.Run(workers, time.Hour)
+	go routerCfg.ReminderService.Run(workers, time.Hour)
+	go routerCfg.QuoteService.Run(workers, time.Hour)
+
 	// Create server with config timeouts
 	srv := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
@@ -106,6 +162,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutdown signal received")
+	stopWorkers()
 
 	// Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -116,6 +173,72 @@ func main() {
 	log.Println("Server stopped gracefully")
 }
 
+// exportFEC writes the FEC of the user and period set by the flags, and
+// returns the path of the file.
+func exportFEC(dbConn *gorm.DB) (string, error) {
+	if *userFlag == 0 {
+		return "", errors.New("-user is required")
+	}
+	year := time.Now().Year()
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)
+	var err error
+	if *fromFlag != "" {
+		if from, err = time.Parse("2006-01-02", *fromFlag); err != nil {
+			return "", fmt.Errorf("invalid -from: %w", err)
+		}
+	}
+	if *toFlag != "" {
+		if last, err = time.Parse("2006-01-02", *toFlag); err != nil {
+			return "", fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+
+	fec := services.NewFECService(dbConn)
+	path := *outputFlag
+	if path == "" {
+		path = fec.FileName(uint(*userFlag), last)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := fec.Export(f, uint(*userFlag), from, last.AddDate(0, 0, 1)); err != nil {
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// verifySeals walks the seal chains of the user set by the flag, or of
+// every user, logs the broken seals and returns true if there is none.
+func verifySeals(dbConn *gorm.DB) bool {
+	seals := services.NewSealService(dbConn)
+	var reports []*services.SealReport
+	if *userFlag != 0 {
+		report, err := seals.Verify(uint(*userFlag))
+		if err != nil {
+			log.Fatalf("Seal verification failed: %v", err)
+		}
+		reports = append(reports, report)
+	} else {
+		var err error
+		if reports, err = seals.VerifyAll(); err != nil {
+			log.Fatalf("Seal verification failed: %v", err)
+		}
+	}
+
+	valid := true
+	for _, report := range reports {
+		for _, b := range report.Broken {
+			log.Printf("user %d: seal %d broken (invoice %d %s): %s", report.UserID, b.Sequence, b.InvoiceID, b.Number, b.Reason)
+		}
+		log.Printf("user %d: %d sealed invoices, %d broken seals", report.UserID, report.Sealed, len(report.Broken))
+		valid = valid && report.Valid()
+	}
+	return valid
+}
+
 // connectDB establishes a connection to the PostgreSQL database using config.
 func connectDB(dbCfg config.DatabaseConfig) (*gorm.DB, error) {
 	dsn := dbCfg.DSN()
@@ -124,6 +247,27 @@ func connectDB(dbCfg config.DatabaseConfig) (*gorm.DB, error) {
 	return gorm.Open(postgres.Open(dsn), &gorm.Config{})
 }
 
+// newMailer returns the SMTP mailer configured by mailCfg, or a mailer
+// writing emails to files when no SMTP host is set.
+func newMailer(mailCfg config.MailConfig) mail.Mailer {
+	if mailCfg.Host == "" {
+		log.Printf("SMTP_HOST not set: emails are written to %s", mailCfg.Dir)
+		return mail.NewFileMailer(mailCfg.Dir)
+	}
+	return mail.NewSMTPMailer(mailCfg.Host, mailCfg.Port, mailCfg.Username, mailCfg.Password)
+}
+
+// newStore returns the S3 store configured by storageCfg, or a store
+// writing documents to files when no bucket is set.
+func newStore(storageCfg config.StorageConfig) storage.Store {
+	if storageCfg.S3Bucket == "" {
+		log.Printf("S3_BUCKET not set: archived documents are stored in %s", storageCfg.Dir)
+		return storage.NewFileStore(storageCfg.Dir)
+	}
+	return storage.NewS3Store(storageCfg.S3Endpoint, storageCfg.S3Region, storageCfg.S3Bucket,
+		storageCfg.S3AccessKey, storageCfg.S3SecretKey)
+}
+
 // withLogging adds request logging middleware.
 func withLogging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
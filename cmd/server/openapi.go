@@ -0,0 +1,211 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/diewo77/go-invoices/httpx"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/openapi"
+	"gorm.io/gorm"
+)
+
+// apiDoc describes an API route in the OpenAPI document.
+type apiDoc struct {
+	ID      string // operationId
+	Summary string
+	// Request is a value of the request body type, nil when there is none.
+	Request any
+	// Query lists the query parameters, besides the pagination ones.
+	Query []openapi.Parameter
+	// Response is a value of the response body type, nil for 204 No Content.
+	Response any
+	// List wraps Response in a page: {"data": [...], "next_cursor": "..."}.
+	// Unpaged lists return all their rows and take no cursor.
+	List    bool
+	Unpaged bool
+	// File is the content type of a binary response.
+	File string
+	// Status is the success status, 200 by default.
+	Status int
+	// Errors lists the error statuses specific to the route; the common ones
+	// (bad request, unauthorized, forbidden, not found) are added from the
+	// route itself.
+	Errors []int
+}
+
+func queryParam(name, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: &openapi.Schema{Type: "string"}}
+}
+
+// openAPI serves the OpenAPI document of the API.
+func (a *App) openAPI(w http.ResponseWriter, r *http.Request) {
+	httpx.JSON(w, http.StatusOK, buildOpenAPI(a.apiRoutes()))
+}
+
+// buildOpenAPI generates the OpenAPI document of the route table. Schemas
+// come from the models and the handlers' input types.
+func buildOpenAPI(routes []apiRoute) *openapi.Document {
+	reg := openapi.NewRegistry()
+	reg.Define(models.Money(0), &openapi.Schema{Type: "number", MultipleOf: 0.01, Description: "Amount in euros"})
+	reg.Define(gorm.DeletedAt{}, &openapi.Schema{Type: []string{"string", "null"}, Format: "date-time"})
+	reg.Define(models.InvoiceStatus(""), enum(models.InvoiceStatusDraft, models.InvoiceStatusFinal, models.InvoiceStatusPaid, models.InvoiceStatusCancelled))
+	reg.Define(models.InvoiceType(""), enum(models.InvoiceTypeInvoice, models.InvoiceTypeCreditNote, models.InvoiceTypeDeposit))
+	reg.Define(models.RoundingPolicy(""), enum(models.RoundingPerRate, models.RoundingPerLine))
+	reg.Define(models.PaymentMethod(""), enum(models.PaymentMethods...))
+
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:   "Go Invoices API",
+			Version: "1.0.0",
+			Description: "Tokens are created in the settings, and carry permission scopes. " +
+				"A request needs both the scope and the permission in the user's profile.",
+		},
+		Paths:    map[string]openapi.PathItem{},
+		Security: []map[string][]string{{"bearer": {}}},
+		Components: openapi.Components{
+			Responses: map[string]openapi.Response{},
+			SecuritySchemes: map[string]openapi.SecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer", BearerFormat: "API token"},
+			},
+		},
+	}
+
+	errorSchema := &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"error":   {Type: "string", Description: "Error code"},
+			"details": {Description: "Error details, such as the violations of a validation_failed error"},
+		},
+		Required: []string{"error"},
+	}
+	errorDescriptions := map[int]string{
+		http.StatusBadRequest:          "Invalid request",
+		http.StatusUnauthorized:        "Missing or invalid token",
+		http.StatusForbidden:           "Permission denied",
+		http.StatusNotFound:            "Not found",
+		http.StatusConflict:            "Conflicts with the current state",
+		http.StatusUnprocessableEntity: "Not compliant",
+	}
+
+	tags := map[string]bool{}
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route.Pattern, " ")
+		d := route.Doc
+
+		op := &openapi.Operation{
+			OperationID: d.ID,
+			Summary:     d.Summary,
+			Responses:   map[string]openapi.Response{},
+		}
+		if route.Resource != "" {
+			op.Tags = []string{route.Resource}
+			op.Permission = route.Resource + ":" + string(route.Action)
+			tags[route.Resource] = true
+		} else {
+			op.Security = &[]map[string][]string{}
+		}
+
+		errs := append([]int(nil), d.Errors...)
+		if route.Resource != "" {
+			errs = append(errs, http.StatusUnauthorized, http.StatusForbidden)
+		}
+		for _, name := range pathParams(path) {
+			op.Parameters = append(op.Parameters, openapi.Parameter{
+				Name: name, In: "path", Required: true, Schema: &openapi.Schema{Type: "integer"},
+			})
+			errs = append(errs, http.StatusNotFound)
+		}
+		op.Parameters = append(op.Parameters, d.Query...)
+		if d.List && !d.Unpaged {
+			op.Parameters = append(op.Parameters,
+				queryParam("cursor", "next_cursor of the previous page"),
+				openapi.Parameter{Name: "limit", In: "query", Description: "Page size, 20 by default, at most 100", Schema: &openapi.Schema{Type: "integer"}})
+			errs = append(errs, http.StatusBadRequest)
+		}
+
+		if d.Request != nil {
+			op.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content:  map[string]openapi.MediaType{"application/json": {Schema: reg.Schema(d.Request)}},
+			}
+			errs = append(errs, http.StatusBadRequest)
+		}
+
+		status := d.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		switch {
+		case d.File != "":
+			op.Responses[strconv.Itoa(status)] = openapi.Response{
+				Description: http.StatusText(status),
+				Content:     map[string]openapi.MediaType{d.File: {Schema: &openapi.Schema{Type: "string", Format: "binary"}}},
+			}
+		case d.Response == nil:
+			op.Responses[strconv.Itoa(http.StatusNoContent)] = openapi.Response{Description: http.StatusText(http.StatusNoContent)}
+		default:
+			schema := reg.Schema(d.Response)
+			if d.List {
+				schema = &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"data":        {Type: "array", Items: schema},
+						"next_cursor": {Type: "string", Description: "Cursor of the next page, absent on the last page"},
+					},
+					Required: []string{"data"},
+				}
+			}
+			op.Responses[strconv.Itoa(status)] = openapi.Response{
+				Description: http.StatusText(status),
+				Content:     map[string]openapi.MediaType{"application/json": {Schema: schema}},
+			}
+		}
+
+		for _, code := range errs {
+			name := strings.ReplaceAll(http.StatusText(code), " ", "")
+			doc.Components.Responses[name] = openapi.Response{
+				Description: errorDescriptions[code],
+				Content:     map[string]openapi.MediaType{"application/json": {Schema: openapi.RefTo("Error")}},
+			}
+			op.Responses[strconv.Itoa(code)] = openapi.Response{Ref: "#/components/responses/" + name}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = openapi.PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(method)] = op
+	}
+
+	doc.Components.Schemas = reg.Schemas()
+	doc.Components.Schemas["Error"] = errorSchema
+
+	for tag := range tags {
+		doc.Tags = append(doc.Tags, openapi.Tag{Name: tag})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+
+	return doc
+}
+
+// pathParams returns the wildcard names of a route path, in order.
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.TrimSuffix(strings.Trim(segment, "{}"), "..."))
+		}
+	}
+	return names
+}
+
+func enum[T ~string](values ...T) *openapi.Schema {
+	s := &openapi.Schema{Type: "string"}
+	for _, v := range values {
+		s.Enum = append(s.Enum, string(v))
+	}
+	return s
+}
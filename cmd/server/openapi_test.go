@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/diewo77/go-invoices/internal/policy"
+)
+
+func testAPIRoutes() []apiRoute {
+	return (&App{routerCfg: &policy.RouterConfig{}}).apiRoutes()
+}
+
+// registeredAPIPatterns returns the /api patterns registered directly on
+// the mux in the sources of this package, outside the route table.
+func registeredAPIPatterns(t *testing.T) []string {
+	t.Helper()
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patterns []string
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || (sel.Sel.Name != "Handle" && sel.Sel.Name != "HandleFunc") {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			pattern, _ := strconv.Unquote(lit.Value)
+			if _, path, _ := strings.Cut(pattern, " "); strings.HasPrefix(path, "/api") {
+				patterns = append(patterns, pattern)
+			}
+			return true
+		})
+	}
+	return patterns
+}
+
+func TestOpenAPI_DescribesEveryRoute(t *testing.T) {
+	routes := testAPIRoutes()
+	doc := buildOpenAPI(routes)
+
+	// Routes outside the table have no description
+	for _, pattern := range registeredAPIPatterns(t) {
+		t.Errorf("route %q is registered outside the API route table", pattern)
+	}
+
+	ids := map[string]bool{}
+	for _, route := range routes {
+		method, path, ok := strings.Cut(route.Pattern, " ")
+		if !ok {
+			t.Errorf("route %q has no method", route.Pattern)
+			continue
+		}
+		op := doc.Paths[path][strings.ToLower(method)]
+		if op == nil {
+			t.Errorf("route %q is missing from the document", route.Pattern)
+			continue
+		}
+		if op.OperationID == "" || op.Summary == "" {
+			t.Errorf("route %q has no operationId or summary", route.Pattern)
+		}
+		if ids[op.OperationID] {
+			t.Errorf("route %q: duplicate operationId %q", route.Pattern, op.OperationID)
+		}
+		ids[op.OperationID] = true
+		if route.Handler == nil {
+			t.Errorf("route %q has no handler", route.Pattern)
+		}
+		if (method == http.MethodPost || method == http.MethodPatch) && route.Doc.Request == nil && route.Doc.Response == nil {
+			t.Errorf("route %q has neither request nor response body", route.Pattern)
+		}
+		for _, name := range pathParams(path) {
+			found := false
+			for _, p := range op.Parameters {
+				found = found || (p.In == "path" && p.Name == name)
+			}
+			if !found {
+				t.Errorf("route %q: path parameter %q is not described", route.Pattern, name)
+			}
+		}
+	}
+}
+
+func TestOpenAPI_Schemas(t *testing.T) {
+	doc := buildOpenAPI(testAPIRoutes())
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q", doc.OpenAPI)
+	}
+
+	client := doc.Components.Schemas["Client"]
+	if client == nil || client.Properties["name"] == nil || client.Properties["user"] != nil {
+		t.Fatalf("Client schema = %+v", client)
+	}
+	product := doc.Components.Schemas["Product"]
+	if product == nil || product.Properties["unit_price"].Type != "number" {
+		t.Fatalf("Product schema = %+v", product)
+	}
+	invoice := doc.Components.Schemas["APIInvoice"]
+	if invoice == nil || invoice.Properties["number"] == nil || invoice.Properties["total_ttc"] == nil {
+		t.Fatalf("APIInvoice schema = %+v", invoice)
+	}
+	if items := invoice.Properties["items"]; items == nil || items.Items == nil || items.Items.Ref != "#/components/schemas/InvoiceItem" {
+		t.Errorf("APIInvoice.items = %+v", items)
+	}
+
+	// Every reference resolves
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var walk func(any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+				var found bool
+				switch parts[0] {
+				case "schemas":
+					found = doc.Components.Schemas[parts[1]] != nil
+				case "responses":
+					_, found = doc.Components.Responses[parts[1]]
+				}
+				if !found {
+					t.Errorf("unresolved reference %q", ref)
+				}
+			}
+			for _, e := range v {
+				walk(e)
+			}
+		case []any:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	var generic any
+	json.Unmarshal(raw, &generic)
+	walk(generic)
+}
+
+func TestOpenAPI_Served(t *testing.T) {
+	app := &App{mux: http.NewServeMux(), routerCfg: &policy.RouterConfig{}}
+	app.setupAPIRoutes()
+
+	rr := httptest.NewRecorder()
+	app.mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var doc struct {
+		Paths map[string]any `json:"paths"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Paths["/api/v1/invoices/{id}/finalize"] == nil {
+		t.Errorf("finalize route missing from %v", doc.Paths)
+	}
+}
@@ -11,6 +11,8 @@ import (
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
+	Mail     MailConfig
+	Storage  StorageConfig
 	App      AppConfig
 }
 
@@ -32,6 +34,28 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// MailConfig holds outgoing email settings. Without an SMTP host, emails
+// are written to Dir instead of being sent.
+type MailConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Dir      string
+}
+
+// StorageConfig holds the storage of archived documents. Without an S3
+// bucket, documents are stored as files in Dir.
+type StorageConfig struct {
+	Dir         string
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+}
+
 // AppConfig holds application-level settings.
 type AppConfig struct {
 	Dev        bool
@@ -72,6 +96,22 @@ func Load() *Config {
 			DBName:   getEnv("DB_NAME", "invoices"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
+		Mail: MailConfig{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnvInt("SMTP_PORT", 587),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("MAIL_FROM", "Billing App <no-reply@localhost>"),
+			Dir:      getEnv("MAIL_DIR", "tmp/mail"),
+		},
+		Storage: StorageConfig{
+			Dir:         getEnv("ARCHIVE_DIR", "data/archive"),
+			S3Endpoint:  getEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+			S3Region:    getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:    getEnv("S3_BUCKET", ""),
+			S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+		},
 		App: AppConfig{
 			Dev:        getEnvBool("DEV", true),
 			Migrations: getEnvBool("MIGRATIONS", false),
@@ -8,18 +8,47 @@ import (
 // Migrate runs AutoMigrate for all models.
 // Call this at application startup or as part of a migration step.
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := db.AutoMigrate(
 		// Auth & Authorization
 		&models.User{},
 		&models.Profile{},
 		&models.Permission{},
+		&models.APIToken{},
 		// Business entities
 		&models.CompanySettings{},
 		&models.Client{},
 		&models.Product{},
 		&models.Invoice{},
 		&models.InvoiceItem{},
-	)
+		&models.NumberingSequence{},
+		&models.NumberingCounter{},
+		&models.Payment{},
+		&models.WebhookEndpoint{},
+		&models.WebhookDelivery{},
+		&models.RecurringInvoice{},
+		&models.RecurringInvoiceItem{},
+		&models.Quote{},
+		&models.QuoteItem{},
+		&models.Reminder{},
+		&models.InvoiceEmail{},
+		&models.ExchangeRate{},
+		&models.AuditEntry{},
+		&models.AuditHead{},
+		&models.InvoiceSealHead{},
+		&models.ArchivedDocument{},
+	); err != nil {
+		return err
+	}
+
+	// Invoice numbers used to be globally unique; they are now unique per user.
+	if db.Migrator().HasIndex(&models.Invoice{}, "idx_invoices_number") {
+		if err := db.Migrator().DropIndex(&models.Invoice{}, "idx_invoices_number"); err != nil {
+			return err
+		}
+	}
+
+	// The audit chain head is locked by every writer, so it must exist.
+	return db.FirstOrCreate(&models.AuditHead{ID: 1}).Error
 }
 
 // Seed initializes the database with required seed data.
@@ -31,6 +31,18 @@ func SeedPermissions(db *gorm.DB) error {
 		{"invoice", "update", "Edit invoices"},
 		{"invoice", "delete", "Delete invoices"},
 		{"invoice", "finalize", "Finalize invoices"},
+		{"invoice", "credit", "Issue credit notes"},
+		{"invoice", "payment", "Record payments"},
+		{"invoice", "send", "Email invoices to clients"},
+		// Quote permissions
+		{"quote", "*", "All quote actions"},
+		{"quote", "list", "List quotes"},
+		{"quote", "view", "View quote details"},
+		{"quote", "create", "Create quotes"},
+		{"quote", "update", "Edit quotes and record answers"},
+		{"quote", "delete", "Delete quotes"},
+		{"quote", "send", "Send quotes"},
+		{"quote", "convert", "Convert quotes into invoices"},
 		// Client permissions
 		{"client", "*", "All client actions"},
 		{"client", "list", "List clients"},
@@ -38,10 +50,34 @@ func SeedPermissions(db *gorm.DB) error {
 		{"client", "create", "Create clients"},
 		{"client", "update", "Edit clients"},
 		{"client", "delete", "Delete clients"},
+		// Revenue and VAT reports
+		{"report", "*", "All reports"},
+		{"report", "view", "View revenue and VAT reports"},
+		{"report", "export", "Export accounting entries (FEC)"},
 		// Company settings
 		{"company", "*", "All company settings"},
 		{"company", "view", "View company settings"},
 		{"company", "update", "Edit company settings"},
+		// Numbering sequences
+		{"numbering", "*", "All numbering settings"},
+		{"numbering", "view", "View numbering sequences"},
+		{"numbering", "update", "Edit numbering sequences and their reset policy"},
+		// API tokens
+		{"api_token", "*", "All API token actions"},
+		{"api_token", "list", "List API tokens"},
+		{"api_token", "create", "Create API tokens"},
+		{"api_token", "delete", "Revoke API tokens"},
+		// Webhooks, which send invoice data to outside URLs
+		{"webhook", "*", "All webhook actions"},
+		{"webhook", "list", "List webhooks and their deliveries"},
+		{"webhook", "create", "Create webhooks"},
+		{"webhook", "update", "Redeliver webhook events"},
+		{"webhook", "delete", "Delete webhooks"},
+		// Exchange rates
+		{"exchange_rate", "*", "All exchange rate actions"},
+		{"exchange_rate", "list", "List exchange rates"},
+		{"exchange_rate", "create", "Enter exchange rates"},
+		{"exchange_rate", "delete", "Delete exchange rates"},
 		// User management
 		{"user", "*", "All user management"},
 		{"user", "list", "List users"},
@@ -114,9 +150,14 @@ func SeedProfiles(db *gorm.DB) error {
 				"product:view",
 				"invoice:list",
 				"invoice:view",
+				"quote:list",
+				"quote:view",
 				"client:list",
 				"client:view",
 				"company:view",
+				"report:view",
+				"exchange_rate:list",
+				"numbering:view",
 				"product_type:list",
 				"product_type:view",
 				"unit_type:list",
@@ -125,14 +166,18 @@ func SeedProfiles(db *gorm.DB) error {
 		},
 		{
 			Name:        "accountant",
-			Description: "Manage invoices and clients, view products",
+			Description: "Manage invoices, quotes and clients, view products",
 			IsSystem:    true,
 			Permissions: []string{
 				"invoice:*",
+				"quote:*",
 				"client:*",
 				"product:list",
 				"product:view",
 				"company:view",
+				"report:*",
+				"exchange_rate:*",
+				"numbering:view",
 			},
 		},
 	}
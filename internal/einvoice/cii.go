@@ -0,0 +1,378 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+)
+
+// CII namespaces (UN/CEFACT Cross Industry Invoice D16B).
+const (
+	NamespaceRSM = "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+	NamespaceRAM = "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100"
+	NamespaceUDT = "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100"
+	NamespaceQDT = "urn:un:unece:uncefact:data:standard:QualifiedDataType:100"
+)
+
+// GuidelineEN16931 identifies the EN 16931 (COMFORT) profile of Factur-X.
+const GuidelineEN16931 = "urn:cen.eu:en16931:2017"
+
+// CII renders an invoice or credit note as Cross Industry Invoice XML,
+// EN 16931 profile. The invoice must have Client, Items and, for credit
+// notes, OriginalInvoice loaded. It is validated first.
+func CII(invoice *models.Invoice, company *models.CompanySettings) ([]byte, error) {
+	if err := Validate(invoice, company); err != nil {
+		return nil, err
+	}
+
+	out, err := xml.MarshalIndent(buildCII(invoice, company), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// The CII structures below use prefixed element names; encoding/xml writes
+// them verbatim, and the root declares the prefixes. Field order follows
+// the XSD sequences.
+
+type ciiInvoice struct {
+	XMLName     xml.Name       `xml:"rsm:CrossIndustryInvoice"`
+	RSM         string         `xml:"xmlns:rsm,attr"`
+	RAM         string         `xml:"xmlns:ram,attr"`
+	UDT         string         `xml:"xmlns:udt,attr"`
+	QDT         string         `xml:"xmlns:qdt,attr"`
+	Context     ciiContext     `xml:"rsm:ExchangedDocumentContext"`
+	Document    ciiDocument    `xml:"rsm:ExchangedDocument"`
+	Transaction ciiTransaction `xml:"rsm:SupplyChainTradeTransaction"`
+}
+
+type ciiContext struct {
+	Guideline string `xml:"ram:GuidelineSpecifiedDocumentContextParameter>ram:ID"`
+}
+
+type ciiDocument struct {
+	ID        string    `xml:"ram:ID"`
+	TypeCode  string    `xml:"ram:TypeCode"`
+	IssueDate ciiDate   `xml:"ram:IssueDateTime"`
+	Notes     []ciiNote `xml:"ram:IncludedNote,omitempty"`
+}
+
+type ciiNote struct {
+	Content string `xml:"ram:Content"`
+}
+
+type ciiDate struct {
+	Value ciiDateString `xml:"udt:DateTimeString"`
+}
+
+type ciiQualifiedDate struct {
+	Value ciiDateString `xml:"qdt:DateTimeString"`
+}
+
+type ciiDateString struct {
+	Format string `xml:"format,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type ciiTransaction struct {
+	Lines      []ciiLine           `xml:"ram:IncludedSupplyChainTradeLineItem"`
+	Agreement  ciiAgreement        `xml:"ram:ApplicableHeaderTradeAgreement"`
+	Delivery   struct{}            `xml:"ram:ApplicableHeaderTradeDelivery"`
+	Settlement ciiHeaderSettlement `xml:"ram:ApplicableHeaderTradeSettlement"`
+}
+
+type ciiLine struct {
+	LineID     string            `xml:"ram:AssociatedDocumentLineDocument>ram:LineID"`
+	Product    ciiProduct        `xml:"ram:SpecifiedTradeProduct"`
+	NetPrice   string            `xml:"ram:SpecifiedLineTradeAgreement>ram:NetPriceProductTradePrice>ram:ChargeAmount"`
+	Quantity   ciiQuantity       `xml:"ram:SpecifiedLineTradeDelivery>ram:BilledQuantity"`
+	Settlement ciiLineSettlement `xml:"ram:SpecifiedLineTradeSettlement"`
+}
+
+type ciiProduct struct {
+	SellerID string `xml:"ram:SellerAssignedID,omitempty"`
+	Name     string `xml:"ram:Name"`
+}
+
+type ciiQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ciiLineSettlement struct {
+	Tax        ciiLineTax     `xml:"ram:ApplicableTradeTax"`
+	Allowances []ciiAllowance `xml:"ram:SpecifiedTradeAllowanceCharge,omitempty"`
+	LineTotal  string         `xml:"ram:SpecifiedTradeSettlementLineMonetarySummation>ram:LineTotalAmount"`
+}
+
+// ciiAllowance is a line allowance (BG-27), the discount of the line.
+type ciiAllowance struct {
+	Indicator  bool   `xml:"ram:ChargeIndicator>udt:Indicator"`
+	Percent    string `xml:"ram:CalculationPercent,omitempty"`
+	Basis      string `xml:"ram:BasisAmount,omitempty"`
+	Amount     string `xml:"ram:ActualAmount"`
+	ReasonCode string `xml:"ram:ReasonCode"`
+	Reason     string `xml:"ram:Reason"`
+}
+
+type ciiLineTax struct {
+	TypeCode     string `xml:"ram:TypeCode"`
+	CategoryCode string `xml:"ram:CategoryCode"`
+	Rate         string `xml:"ram:RateApplicablePercent,omitempty"`
+}
+
+type ciiAgreement struct {
+	BuyerReference string   `xml:"ram:BuyerReference,omitempty"`
+	Seller         ciiParty `xml:"ram:SellerTradeParty"`
+	Buyer          ciiParty `xml:"ram:BuyerTradeParty"`
+}
+
+type ciiParty struct {
+	Name            string     `xml:"ram:Name"`
+	LegalOrg        *ciiID     `xml:"ram:SpecifiedLegalOrganization>ram:ID,omitempty"`
+	Address         ciiAddress `xml:"ram:PostalTradeAddress"`
+	Email           *ciiID     `xml:"ram:URIUniversalCommunication>ram:URIID,omitempty"`
+	TaxRegistration *ciiID     `xml:"ram:SpecifiedTaxRegistration>ram:ID,omitempty"`
+}
+
+type ciiID struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type ciiAddress struct {
+	PostcodeCode string `xml:"ram:PostcodeCode,omitempty"`
+	LineOne      string `xml:"ram:LineOne,omitempty"`
+	CityName     string `xml:"ram:CityName,omitempty"`
+	CountryID    string `xml:"ram:CountryID"`
+}
+
+type ciiHeaderSettlement struct {
+	Currency     string            `xml:"ram:InvoiceCurrencyCode"`
+	Taxes        []ciiHeaderTax    `xml:"ram:ApplicableTradeTax"`
+	PaymentTerms *ciiPaymentTerms  `xml:"ram:SpecifiedTradePaymentTerms,omitempty"`
+	Summation    ciiSummation      `xml:"ram:SpecifiedTradeSettlementHeaderMonetarySummation"`
+	Preceding    *ciiReferencedDoc `xml:"ram:InvoiceReferencedDocument,omitempty"`
+}
+
+type ciiHeaderTax struct {
+	CalculatedAmount string `xml:"ram:CalculatedAmount"`
+	TypeCode         string `xml:"ram:TypeCode"`
+	ExemptionReason  string `xml:"ram:ExemptionReason,omitempty"`
+	BasisAmount      string `xml:"ram:BasisAmount"`
+	CategoryCode     string `xml:"ram:CategoryCode"`
+	Rate             string `xml:"ram:RateApplicablePercent,omitempty"`
+}
+
+type ciiPaymentTerms struct {
+	Description string   `xml:"ram:Description,omitempty"`
+	DueDate     *ciiDate `xml:"ram:DueDateDateTime,omitempty"`
+}
+
+type ciiSummation struct {
+	LineTotal     string    `xml:"ram:LineTotalAmount"`
+	TaxBasisTotal string    `xml:"ram:TaxBasisTotalAmount"`
+	TaxTotal      ciiAmount `xml:"ram:TaxTotalAmount"`
+	GrandTotal    string    `xml:"ram:GrandTotalAmount"`
+	TotalPrepaid  string    `xml:"ram:TotalPrepaidAmount,omitempty"`
+	DuePayable    string    `xml:"ram:DuePayableAmount"`
+}
+
+type ciiAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
+
+type ciiReferencedDoc struct {
+	IssuerAssignedID string            `xml:"ram:IssuerAssignedID"`
+	IssueDate        *ciiQualifiedDate `xml:"ram:FormattedIssueDateTime,omitempty"`
+}
+
+func buildCII(invoice *models.Invoice, company *models.CompanySettings) *ciiInvoice {
+	s := sign(invoice)
+
+	doc := &ciiInvoice{
+		RSM:     NamespaceRSM,
+		RAM:     NamespaceRAM,
+		UDT:     NamespaceUDT,
+		QDT:     NamespaceQDT,
+		Context: ciiContext{Guideline: GuidelineEN16931},
+		Document: ciiDocument{
+			ID:        invoice.Number,
+			TypeCode:  TypeCode(invoice),
+			IssueDate: date(invoice.IssueDate),
+		},
+	}
+	if notes := strings.TrimSpace(invoice.Notes); notes != "" {
+		doc.Document.Notes = append(doc.Document.Notes, ciiNote{Content: notes})
+	}
+
+	tx := &doc.Transaction
+	for n, item := range lines(invoice) {
+		line := ciiLine{
+			LineID:   strconv.Itoa(n + 1),
+			Product:  ciiProduct{Name: item.Description},
+			NetPrice: item.UnitPrice.String(),
+			Quantity: ciiQuantity{UnitCode: UnitCode(item.Unit), Value: formatDecimal(item.Quantity * s)},
+			Settlement: ciiLineSettlement{
+				Tax: ciiLineTax{
+					TypeCode:     "VAT",
+					CategoryCode: VATCategory(item.VATRate, invoice, company),
+					Rate:         formatDecimal(models.VATLine{Rate: item.VATRate}.RatePercent()),
+				},
+				LineTotal: signed(item.TotalHT(), s).String(),
+			},
+		}
+		if line.Settlement.Tax.CategoryCode == VATCategoryOutOfScope {
+			// BR-O-05: no rate outside the scope of VAT
+			line.Settlement.Tax.Rate = ""
+		}
+		if item.Product != nil {
+			line.Product.SellerID = item.Product.Code
+		}
+		if item.HasDiscount() {
+			allowance := ciiAllowance{
+				Amount:     signed(item.Discount(), s).String(),
+				ReasonCode: ReasonCodeDiscount,
+				Reason:     "Remise",
+			}
+			if item.DiscountRate != 0 {
+				allowance.Percent = formatDecimal(item.DiscountPercent())
+				allowance.Basis = signed(item.GrossHT(), s).String()
+			}
+			line.Settlement.Allowances = append(line.Settlement.Allowances, allowance)
+		}
+		tx.Lines = append(tx.Lines, line)
+	}
+
+	tx.Agreement = ciiAgreement{
+		BuyerReference: invoice.Reference,
+		Seller:         sellerParty(company),
+		Buyer:          buyerParty(invoice.Client),
+	}
+	if invoice.IsPenalty() {
+		// BR-O-02, BR-O-04: no VAT identifiers outside the scope of VAT
+		for _, party := range []*ciiParty{&tx.Agreement.Seller, &tx.Agreement.Buyer} {
+			if party.TaxRegistration != nil && party.TaxRegistration.SchemeID == "VA" {
+				party.TaxRegistration = nil
+			}
+		}
+	}
+	if invoice.IsCreditNote() {
+		// On credit notes Reference holds the original invoice number
+		tx.Agreement.BuyerReference = ""
+	}
+
+	settlement := &tx.Settlement
+	settlement.Currency = string(invoice.Currency.OrDefault())
+	for _, line := range invoice.VATBreakdown() {
+		tax := ciiHeaderTax{
+			CalculatedAmount: signed(line.VAT, s).String(),
+			TypeCode:         "VAT",
+			BasisAmount:      signed(line.Base, s).String(),
+			CategoryCode:     VATCategory(line.Rate, invoice, company),
+			Rate:             formatDecimal(line.RatePercent()),
+		}
+		switch tax.CategoryCode {
+		case VATCategoryExempt:
+			tax.ExemptionReason = models.VATExemptionMention
+		case VATCategoryOutOfScope:
+			// BR-O-09, BR-O-10
+			tax.Rate = ""
+			tax.ExemptionReason = ExemptionReasonOutOfScope
+		}
+		settlement.Taxes = append(settlement.Taxes, tax)
+	}
+
+	if !invoice.IsCreditNote() {
+		terms := &ciiPaymentTerms{Description: strings.TrimSpace(invoice.PaymentTerms)}
+		if !invoice.DueDate.IsZero() {
+			due := date(invoice.DueDate)
+			terms.DueDate = &due
+		}
+		settlement.PaymentTerms = terms
+	}
+
+	ht := signed(invoice.TotalHT(), s).String()
+	ttc := signed(invoice.TotalTTC(), s).String()
+	settlement.Summation = ciiSummation{
+		LineTotal:     ht,
+		TaxBasisTotal: ht,
+		TaxTotal:      ciiAmount{CurrencyID: settlement.Currency, Value: signed(invoice.TotalVAT(), s).String()},
+		GrandTotal:    ttc,
+		DuePayable:    ttc,
+	}
+
+	if invoice.IsCreditNote() && invoice.OriginalInvoice != nil {
+		issued := ciiQualifiedDate{Value: dateString(invoice.OriginalInvoice.IssueDate)}
+		settlement.Preceding = &ciiReferencedDoc{
+			IssuerAssignedID: invoice.OriginalInvoice.Number,
+			IssueDate:        &issued,
+		}
+	}
+	return doc
+}
+
+func sellerParty(company *models.CompanySettings) ciiParty {
+	party := ciiParty{
+		Name: company.Name,
+		Address: ciiAddress{
+			PostcodeCode: company.PostalCode,
+			LineOne:      company.Address,
+			CityName:     company.City,
+			CountryID:    partyCountry(company.CountryCode, company.Country),
+		},
+	}
+	if scheme := siretScheme(company.SIRET); scheme != "" {
+		party.LegalOrg = &ciiID{SchemeID: scheme, Value: strings.ReplaceAll(company.SIRET, " ", "")}
+	}
+	if company.Email != "" {
+		party.Email = &ciiID{SchemeID: "EM", Value: company.Email}
+	}
+	if company.VATNumber != "" {
+		party.TaxRegistration = &ciiID{SchemeID: "VA", Value: company.VATNumber}
+	} else if company.VATExempt && party.LegalOrg != nil {
+		// Exempt sellers have no VAT number: give their tax registration
+		party.TaxRegistration = &ciiID{SchemeID: "FC", Value: party.LegalOrg.Value}
+	}
+	return party
+}
+
+func buyerParty(client *models.Client) ciiParty {
+	name := client.Name
+	if client.Company != "" {
+		name = client.Company
+	}
+	party := ciiParty{
+		Name: name,
+		Address: ciiAddress{
+			PostcodeCode: client.PostalCode,
+			LineOne:      client.Address,
+			CityName:     client.City,
+			CountryID:    partyCountry(client.CountryCode, client.Country),
+		},
+	}
+	if scheme := siretScheme(client.SIRET); scheme != "" {
+		party.LegalOrg = &ciiID{SchemeID: scheme, Value: strings.ReplaceAll(client.SIRET, " ", "")}
+	}
+	if client.Email != "" {
+		party.Email = &ciiID{SchemeID: "EM", Value: client.Email}
+	}
+	if client.VATNumber != "" {
+		party.TaxRegistration = &ciiID{SchemeID: "VA", Value: client.VATNumber}
+	}
+	return party
+}
+
+func date(t time.Time) ciiDate {
+	return ciiDate{Value: dateString(t)}
+}
+
+// dateString formats a date as CCYYMMDD (format 102).
+func dateString(t time.Time) ciiDateString {
+	return ciiDateString{Format: "102", Value: t.Format("20060102")}
+}
@@ -0,0 +1,300 @@
+// Package einvoice converts invoices to and from the structured formats of
+// the European e-invoicing standard EN 16931.
+package einvoice
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/validation"
+)
+
+// Currency is the only currency of imported documents. Exported ones are
+// in the currency of the invoice.
+const Currency = "EUR"
+
+// Document type codes (UNTDID 1001).
+const (
+	TypeCodeInvoice    = "380"
+	TypeCodeCreditNote = "381"
+	TypeCodePrepayment = "386"
+)
+
+// VAT category codes (UNTDID 5305).
+const (
+	VATCategoryStandard   = "S"
+	VATCategoryZero       = "Z"
+	VATCategoryExempt     = "E"
+	VATCategoryOutOfScope = "O"
+)
+
+// ExemptionReasonOutOfScope is the VAT exemption reason of lines outside
+// the scope of VAT (BR-O-10).
+const ExemptionReasonOutOfScope = "Pénalités de retard, hors du champ d'application de la TVA"
+
+// Electronic address and identifier schemes (ISO 6523 ICD).
+const (
+	SchemeSIREN = "0002"
+	SchemeSIRET = "0009"
+)
+
+// ValidationError lists the fields an invoice is missing to be EN 16931
+// compliant, keyed by "party.field".
+type ValidationError struct {
+	Violations validation.Violations
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Violations))
+	for field := range e.Violations {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return "e-invoice is not compliant: missing or invalid " + strings.Join(fields, ", ")
+}
+
+// Validate checks that an invoice carries every field EN 16931 makes
+// mandatory. Drafts are checked without their number, which is only
+// assigned at finalization. The invoice must have Client and Items loaded.
+func Validate(invoice *models.Invoice, company *models.CompanySettings) error {
+	v := make(validation.Violations)
+
+	if !invoice.IsDraft() {
+		validation.Required("invoice.number", invoice.Number, v)
+	}
+	if invoice.IssueDate.IsZero() {
+		v["invoice.issue_date"] = "required"
+	}
+	if !invoice.HasLines() {
+		v["invoice.items"] = "required"
+	}
+	// BR-CO-25: a due date or payment terms when an amount is due
+	if invoice.DueDate.IsZero() && strings.TrimSpace(invoice.PaymentTerms) == "" && !invoice.IsCreditNote() {
+		v["invoice.due_date"] = "required"
+	}
+	if invoice.IsCreditNote() && invoice.OriginalInvoice == nil {
+		v["invoice.original_invoice"] = "required"
+	}
+	for n, item := range lines(invoice) {
+		if strings.TrimSpace(item.Description) == "" {
+			v[fmt.Sprintf("items.%d.description", n+1)] = "required"
+		}
+		// BR-O-11: a document outside the scope of VAT has no taxed line
+		if invoice.IsPenalty() && item.VATRate != 0 {
+			v[fmt.Sprintf("items.%d.vat_rate", n+1)] = "invalid"
+		}
+	}
+
+	// Seller
+	validation.Required("company.name", company.Name, v)
+	if partyCountry(company.CountryCode, company.Country) == "" {
+		v["company.country_code"] = "required"
+	}
+	if company.VATExempt || invoice.IsPenalty() {
+		// BR-E-02, BR-O-02: sellers that give no VAT number are identified
+		// by their registration
+		if siretScheme(company.SIRET) == "" {
+			v["company.siret"] = "invalid"
+		}
+	} else if strings.TrimSpace(company.VATNumber) == "" {
+		v["company.vat_number"] = "required"
+	}
+
+	// Buyer
+	if invoice.Client == nil {
+		v["client"] = "required"
+	} else {
+		validation.Required("client.name", invoice.Client.Name, v)
+		if partyCountry(invoice.Client.CountryCode, invoice.Client.Country) == "" {
+			v["client.country_code"] = "required"
+		}
+		if invoice.Client.SIRET != "" && siretScheme(invoice.Client.SIRET) == "" {
+			v["client.siret"] = "invalid"
+		}
+	}
+
+	if !v.Empty() {
+		return &ValidationError{Violations: v}
+	}
+	return nil
+}
+
+// TypeCode returns the UNTDID 1001 code of a document.
+func TypeCode(invoice *models.Invoice) string {
+	switch {
+	case invoice.IsCreditNote():
+		return TypeCodeCreditNote
+	case invoice.IsDeposit():
+		return TypeCodePrepayment
+	}
+	return TypeCodeInvoice
+}
+
+// VATCategory returns the VAT category of a line rate. Late-payment
+// penalties are damages rather than the price of a supply: they are
+// outside the scope of VAT.
+func VATCategory(rate float64, invoice *models.Invoice, company *models.CompanySettings) string {
+	switch {
+	case rate > 0:
+		return VATCategoryStandard
+	case invoice.IsPenalty():
+		return VATCategoryOutOfScope
+	case company.VATExempt:
+		return VATCategoryExempt
+	default:
+		return VATCategoryZero
+	}
+}
+
+// sign is -1 for credit notes: they store negative quantities, while
+// EN 16931 expects positive amounts on a 381 document.
+func sign(invoice *models.Invoice) float64 {
+	if invoice.IsCreditNote() {
+		return -1
+	}
+	return 1
+}
+
+func signed(m models.Money, s float64) models.Money {
+	if s < 0 {
+		return -m
+	}
+	return m
+}
+
+// lines returns the priced lines of an invoice: section titles and
+// subtotals have no counterpart in EN 16931.
+func lines(invoice *models.Invoice) []models.InvoiceItem {
+	lines := make([]models.InvoiceItem, 0, len(invoice.Items))
+	for _, item := range invoice.Items {
+		if item.IsLine() {
+			lines = append(lines, item)
+		}
+	}
+	return lines
+}
+
+// ReasonCodeDiscount is the UNTDID 5189 code of a discount, the reason of
+// line allowances.
+const ReasonCodeDiscount = "95"
+
+// countries maps the country names users type to ISO 3166-1 alpha-2 codes.
+var countries = map[string]string{
+	"france":         "FR",
+	"belgique":       "BE",
+	"belgium":        "BE",
+	"luxembourg":     "LU",
+	"suisse":         "CH",
+	"switzerland":    "CH",
+	"allemagne":      "DE",
+	"germany":        "DE",
+	"deutschland":    "DE",
+	"espagne":        "ES",
+	"spain":          "ES",
+	"italie":         "IT",
+	"italy":          "IT",
+	"pays-bas":       "NL",
+	"netherlands":    "NL",
+	"portugal":       "PT",
+	"royaume-uni":    "GB",
+	"united kingdom": "GB",
+	"irlande":        "IE",
+	"ireland":        "IE",
+	"autriche":       "AT",
+	"austria":        "AT",
+	"monaco":         "MC",
+	"états-unis":     "US",
+	"etats-unis":     "US",
+	"united states":  "US",
+	"usa":            "US",
+	"canada":         "CA",
+}
+
+// CountryCode returns the ISO 3166-1 alpha-2 code of a country name or
+// code. An empty country defaults to France; an unknown one returns "".
+func CountryCode(country string) string {
+	country = strings.TrimSpace(country)
+	if country == "" {
+		return "FR"
+	}
+	if code, ok := countries[strings.ToLower(country)]; ok {
+		return code
+	}
+	if len(country) == 2 && isLetters(country) {
+		return strings.ToUpper(country)
+	}
+	return ""
+}
+
+// partyCountry returns the country code of a party: its ISO code when set,
+// else the code of its country name.
+func partyCountry(code, name string) string {
+	if code != "" {
+		return strings.ToUpper(code)
+	}
+	return CountryCode(name)
+}
+
+// unitCodes maps our units to UN/ECE Recommendation 20 codes.
+var unitCodes = map[string]string{
+	"unit":  "C62",
+	"hour":  "HUR",
+	"day":   "DAY",
+	"month": "MON",
+	"kg":    "KGM",
+	"m":     "MTR",
+	"m2":    "MTK",
+	"l":     "LTR",
+}
+
+// UnitCode returns the UN/ECE Rec 20 code of a unit, "C62" (one) by default.
+func UnitCode(unit string) string {
+	if code, ok := unitCodes[strings.ToLower(strings.TrimSpace(unit))]; ok {
+		return code
+	}
+	return "C62"
+}
+
+// siretScheme returns the identifier scheme of a SIREN or SIRET, or "" if
+// the value is neither.
+func siretScheme(id string) string {
+	id = strings.ReplaceAll(id, " ", "")
+	if !isDigits(id) {
+		return ""
+	}
+	switch len(id) {
+	case 9:
+		return SchemeSIREN
+	case 14:
+		return SchemeSIRET
+	}
+	return ""
+}
+
+func formatDecimal(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetters(s string) bool {
+	for _, r := range strings.ToUpper(s) {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
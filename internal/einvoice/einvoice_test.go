@@ -0,0 +1,301 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+)
+
+func testCompany() *models.CompanySettings {
+	return &models.CompanySettings{
+		Name:       "Acme SARL",
+		Email:      "billing@acme.test",
+		Address:    "1 rue de la Paix",
+		PostalCode: "75002",
+		City:       "Paris",
+		Country:    "France",
+		SIRET:      "12345678900012",
+		VATNumber:  "FR12345678900",
+	}
+}
+
+func testInvoice() *models.Invoice {
+	return &models.Invoice{
+		Number:    "FA-2025-00001",
+		Status:    models.InvoiceStatusFinal,
+		IssueDate: time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC),
+		DueDate:   time.Date(2025, time.April, 9, 0, 0, 0, 0, time.UTC),
+		Client: &models.Client{
+			Name:      "Jane Doe",
+			Company:   "Globex",
+			Address:   "10 avenue Foch",
+			City:      "Lyon",
+			Country:   "FR",
+			SIRET:     "98765432100017",
+			VATNumber: "FR98765432100",
+		},
+		Items: []models.InvoiceItem{
+			{Description: "Consulting", Quantity: 2, UnitPrice: 50000, Unit: "day", VATRate: 0.20},
+			{Description: "Book", Quantity: 1, UnitPrice: 1990, VATRate: 0.055},
+		},
+	}
+}
+
+// parsed mirrors the parts of a CII document the tests check, with full
+// namespaces so the prefixes written by CII are checked too.
+type parsed struct {
+	XMLName  xml.Name `xml:"urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100 CrossIndustryInvoice"`
+	Guide    string   `xml:"ExchangedDocumentContext>GuidelineSpecifiedDocumentContextParameter>ID"`
+	ID       string   `xml:"ExchangedDocument>ID"`
+	TypeCode string   `xml:"ExchangedDocument>TypeCode"`
+	Issued   string   `xml:"ExchangedDocument>IssueDateTime>DateTimeString"`
+	Lines    []struct {
+		Quantity  string `xml:"SpecifiedLineTradeDelivery>BilledQuantity"`
+		Category  string `xml:"SpecifiedLineTradeSettlement>ApplicableTradeTax>CategoryCode"`
+		LineTotal string `xml:"SpecifiedLineTradeSettlement>SpecifiedTradeSettlementLineMonetarySummation>LineTotalAmount"`
+	} `xml:"SupplyChainTradeTransaction>IncludedSupplyChainTradeLineItem"`
+	SellerVAT  string `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeAgreement>SellerTradeParty>SpecifiedTaxRegistration>ID"`
+	BuyerName  string `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeAgreement>BuyerTradeParty>Name"`
+	Settlement struct {
+		Currency string `xml:"InvoiceCurrencyCode"`
+		Taxes    []struct {
+			Amount   string `xml:"CalculatedAmount"`
+			Reason   string `xml:"ExemptionReason"`
+			Basis    string `xml:"BasisAmount"`
+			Category string `xml:"CategoryCode"`
+			Rate     string `xml:"RateApplicablePercent"`
+		} `xml:"ApplicableTradeTax"`
+		Due       string `xml:"SpecifiedTradePaymentTerms>DueDateDateTime>DateTimeString"`
+		LineTotal string `xml:"SpecifiedTradeSettlementHeaderMonetarySummation>LineTotalAmount"`
+		TaxTotal  string `xml:"SpecifiedTradeSettlementHeaderMonetarySummation>TaxTotalAmount"`
+		Grand     string `xml:"SpecifiedTradeSettlementHeaderMonetarySummation>GrandTotalAmount"`
+		Preceding string `xml:"InvoiceReferencedDocument>IssuerAssignedID"`
+	} `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeSettlement"`
+}
+
+func parseCII(t *testing.T, invoice *models.Invoice, company *models.CompanySettings) parsed {
+	t.Helper()
+	out, err := CII(invoice, company)
+	if err != nil {
+		t.Fatalf("CII() error: %v", err)
+	}
+	var doc parsed
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("generated XML does not parse: %v\n%s", err, out)
+	}
+	return doc
+}
+
+func TestCII_Invoice(t *testing.T) {
+	doc := parseCII(t, testInvoice(), testCompany())
+
+	if doc.Guide != GuidelineEN16931 {
+		t.Errorf("guideline = %q", doc.Guide)
+	}
+	if doc.ID != "FA-2025-00001" || doc.TypeCode != "380" || doc.Issued != "20250310" {
+		t.Errorf("document = %q %q %q", doc.ID, doc.TypeCode, doc.Issued)
+	}
+	if len(doc.Lines) != 2 || doc.Lines[0].LineTotal != "1000.00" || doc.Lines[1].Category != "S" {
+		t.Errorf("lines = %+v", doc.Lines)
+	}
+	if doc.SellerVAT != "FR12345678900" || doc.BuyerName != "Globex" {
+		t.Errorf("parties = %q %q", doc.SellerVAT, doc.BuyerName)
+	}
+
+	s := doc.Settlement
+	if s.Currency != "EUR" || s.Due != "20250409" {
+		t.Errorf("settlement = %q %q", s.Currency, s.Due)
+	}
+	if len(s.Taxes) != 2 || s.Taxes[0].Rate != "20" || s.Taxes[0].Amount != "200.00" ||
+		s.Taxes[1].Rate != "5.5" || s.Taxes[1].Basis != "19.90" || s.Taxes[1].Amount != "1.09" {
+		t.Errorf("taxes = %+v", s.Taxes)
+	}
+	if s.LineTotal != "1019.90" || s.TaxTotal != "201.09" || s.Grand != "1220.99" {
+		t.Errorf("totals = %q %q %q", s.LineTotal, s.TaxTotal, s.Grand)
+	}
+}
+
+func TestCII_DiscountsAndSections(t *testing.T) {
+	invoice := testInvoice()
+	invoice.Items[0].DiscountRate = 0.1
+	invoice.Items[1].DiscountAmount = 190
+	invoice.Items = append([]models.InvoiceItem{{Kind: models.ItemKindSection, Description: "Phase 1"}},
+		append(invoice.Items, models.InvoiceItem{Kind: models.ItemKindSubtotal})...)
+
+	out, err := CII(invoice, testCompany())
+	if err != nil {
+		t.Fatalf("CII() error: %v", err)
+	}
+	var doc struct {
+		Lines []struct {
+			ID         string `xml:"AssociatedDocumentLineDocument>LineID"`
+			Allowances []struct {
+				Indicator string `xml:"ChargeIndicator>Indicator"`
+				Percent   string `xml:"CalculationPercent"`
+				Basis     string `xml:"BasisAmount"`
+				Amount    string `xml:"ActualAmount"`
+				Code      string `xml:"ReasonCode"`
+			} `xml:"SpecifiedLineTradeSettlement>SpecifiedTradeAllowanceCharge"`
+			LineTotal string `xml:"SpecifiedLineTradeSettlement>SpecifiedTradeSettlementLineMonetarySummation>LineTotalAmount"`
+		} `xml:"SupplyChainTradeTransaction>IncludedSupplyChainTradeLineItem"`
+		LineTotal string `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeSettlement>SpecifiedTradeSettlementHeaderMonetarySummation>LineTotalAmount"`
+	}
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("generated XML does not parse: %v\n%s", err, out)
+	}
+
+	// Section titles and subtotals are left out, lines numbered without them
+	if len(doc.Lines) != 2 || doc.Lines[0].ID != "1" || doc.Lines[1].ID != "2" {
+		t.Fatalf("lines = %+v", doc.Lines)
+	}
+	rate, amount := doc.Lines[0].Allowances, doc.Lines[1].Allowances
+	if len(rate) != 1 || rate[0].Indicator != "false" || rate[0].Percent != "10" || rate[0].Basis != "1000.00" ||
+		rate[0].Amount != "100.00" || rate[0].Code != ReasonCodeDiscount || doc.Lines[0].LineTotal != "900.00" {
+		t.Errorf("rate discount line = %+v", doc.Lines[0])
+	}
+	if len(amount) != 1 || amount[0].Percent != "" || amount[0].Amount != "1.90" || doc.Lines[1].LineTotal != "18.00" {
+		t.Errorf("amount discount line = %+v", doc.Lines[1])
+	}
+	if doc.LineTotal != "918.00" {
+		t.Errorf("line total = %q, want 918.00", doc.LineTotal)
+	}
+}
+
+func TestCII_CreditNoteAmountsArePositive(t *testing.T) {
+	original := testInvoice()
+	creditNote := testInvoice()
+	creditNote.Number = "AV-2025-00001"
+	creditNote.Type = models.InvoiceTypeCreditNote
+	creditNote.OriginalInvoice = original
+	creditNote.Items = []models.InvoiceItem{
+		{Description: "Consulting", Quantity: -1, UnitPrice: 50000, Unit: "day", VATRate: 0.20},
+	}
+
+	doc := parseCII(t, creditNote, testCompany())
+	if doc.TypeCode != "381" || doc.Settlement.Preceding != "FA-2025-00001" {
+		t.Errorf("document = %q, preceding %q", doc.TypeCode, doc.Settlement.Preceding)
+	}
+	if doc.Lines[0].Quantity != "1" || doc.Lines[0].LineTotal != "500.00" {
+		t.Errorf("line = %+v", doc.Lines[0])
+	}
+	if doc.Settlement.Grand != "600.00" {
+		t.Errorf("grand total = %q, want 600.00", doc.Settlement.Grand)
+	}
+}
+
+func TestCII_VATExempt(t *testing.T) {
+	company := testCompany()
+	company.VATExempt = true
+	company.VATNumber = ""
+	invoice := testInvoice()
+	for n := range invoice.Items {
+		invoice.Items[n].VATRate = 0
+	}
+
+	doc := parseCII(t, invoice, company)
+	if len(doc.Settlement.Taxes) != 1 {
+		t.Fatalf("taxes = %+v", doc.Settlement.Taxes)
+	}
+	tax := doc.Settlement.Taxes[0]
+	if tax.Category != "E" || tax.Reason != models.VATExemptionMention || tax.Amount != "0.00" {
+		t.Errorf("tax = %+v", tax)
+	}
+	if doc.SellerVAT != company.SIRET {
+		t.Errorf("seller tax registration = %q, want SIRET", doc.SellerVAT)
+	}
+}
+
+func TestCII_Penalty(t *testing.T) {
+	invoice := testInvoice()
+	penalized := uint(1)
+	invoice.PenalizedInvoiceID = &penalized
+	invoice.Items = []models.InvoiceItem{{Description: "Pénalités de retard", Quantity: 1, UnitPrice: 4200}}
+
+	doc := parseCII(t, invoice, testCompany())
+	if len(doc.Lines) != 1 || doc.Lines[0].Category != "O" {
+		t.Fatalf("lines = %+v", doc.Lines)
+	}
+	if len(doc.Settlement.Taxes) != 1 {
+		t.Fatalf("taxes = %+v", doc.Settlement.Taxes)
+	}
+	tax := doc.Settlement.Taxes[0]
+	if tax.Category != "O" || tax.Reason != ExemptionReasonOutOfScope || tax.Rate != "" || tax.Amount != "0.00" {
+		t.Errorf("tax = %+v", tax)
+	}
+	// BR-O-02: the seller is identified by its SIRET, not its VAT number
+	if doc.SellerVAT != "" {
+		t.Errorf("seller tax registration = %q, want none", doc.SellerVAT)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*models.Invoice, *models.CompanySettings)
+		missing []string
+	}{
+		{"complete", func(*models.Invoice, *models.CompanySettings) {}, nil},
+		{"draft without number", func(i *models.Invoice, _ *models.CompanySettings) {
+			i.Status = models.InvoiceStatusDraft
+			i.Number = ""
+		}, nil},
+		{"final without number", func(i *models.Invoice, _ *models.CompanySettings) { i.Number = "" }, []string{"invoice.number"}},
+		{"seller without VAT number", func(_ *models.Invoice, c *models.CompanySettings) { c.VATNumber = "" }, []string{"company.vat_number"}},
+		{"exempt seller without SIRET", func(_ *models.Invoice, c *models.CompanySettings) {
+			c.VATExempt = true
+			c.SIRET = "123"
+		}, []string{"company.siret"}},
+		{"unknown buyer country", func(i *models.Invoice, _ *models.CompanySettings) { i.Client.Country = "Atlantis" }, []string{"client.country_code"}},
+		{"buyer country code", func(i *models.Invoice, _ *models.CompanySettings) {
+			i.Client.Country, i.Client.CountryCode = "Atlantis", "us"
+		}, nil},
+		{"taxed penalty", func(i *models.Invoice, _ *models.CompanySettings) {
+			penalized := uint(1)
+			i.PenalizedInvoiceID = &penalized
+			i.Items[1].VATRate = 0
+		}, []string{"items.1.vat_rate"}},
+		{"no items", func(i *models.Invoice, _ *models.CompanySettings) { i.Items = nil }, []string{"invoice.items"}},
+		{"credit note without original", func(i *models.Invoice, _ *models.CompanySettings) {
+			i.Type = models.InvoiceTypeCreditNote
+		}, []string{"invoice.original_invoice"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice, company := testInvoice(), testCompany()
+			tt.mutate(invoice, company)
+
+			err := Validate(invoice, company)
+			if len(tt.missing) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("Validate() = %v, want *ValidationError", err)
+			}
+			for _, field := range tt.missing {
+				if _, ok := invalid.Violations[field]; !ok {
+					t.Errorf("Violations = %v, missing %q", invalid.Violations, field)
+				}
+			}
+			if len(invalid.Violations) != len(tt.missing) {
+				t.Errorf("Violations = %v, want only %v", invalid.Violations, tt.missing)
+			}
+		})
+	}
+}
+
+func TestCountryCode(t *testing.T) {
+	tests := map[string]string{"": "FR", "France": "FR", " belgique ": "BE", "de": "DE", "Atlantis": "", "F1": "", "United States": "US"}
+	for in, want := range tests {
+		if got := CountryCode(in); got != want {
+			t.Errorf("CountryCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
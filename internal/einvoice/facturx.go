@@ -0,0 +1,74 @@
+package einvoice
+
+import "github.com/diewo77/go-invoices/internal/models"
+
+// Factur-X embeds the CII XML in a PDF/A-3 under a fixed name, declared
+// with the "Data" relationship (the XML is authoritative in EN 16931
+// profile) and described in the XMP metadata.
+const (
+	FacturXFilename     = "factur-x.xml"
+	FacturXRelationship = "Data"
+	FacturXConformance  = "EN 16931"
+	FacturXNamespace    = "urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#"
+)
+
+// FacturX returns the XML to embed in the PDF of a document, together with
+// the XMP metadata to merge in the PDF/A-3 metadata stream.
+func FacturX(invoice *models.Invoice, company *models.CompanySettings) (xml []byte, xmp string, err error) {
+	xml, err = CII(invoice, company)
+	if err != nil {
+		return nil, "", err
+	}
+	return xml, facturXMetadata, nil
+}
+
+// facturXMetadata declares the Factur-X properties and, as PDF/A requires
+// for any custom namespace, their extension schema.
+const facturXMetadata = `<rdf:Description rdf:about="" xmlns:fx="` + FacturXNamespace + `">
+  <fx:DocumentType>INVOICE</fx:DocumentType>
+  <fx:DocumentFileName>` + FacturXFilename + `</fx:DocumentFileName>
+  <fx:Version>1.0</fx:Version>
+  <fx:ConformanceLevel>` + FacturXConformance + `</fx:ConformanceLevel>
+</rdf:Description>
+<rdf:Description rdf:about=""
+  xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/"
+  xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#"
+  xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+  <pdfaExtension:schemas>
+    <rdf:Bag>
+      <rdf:li rdf:parseType="Resource">
+        <pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>
+        <pdfaSchema:namespaceURI>` + FacturXNamespace + `</pdfaSchema:namespaceURI>
+        <pdfaSchema:prefix>fx</pdfaSchema:prefix>
+        <pdfaSchema:property>
+          <rdf:Seq>
+            <rdf:li rdf:parseType="Resource">
+              <pdfaProperty:name>DocumentFileName</pdfaProperty:name>
+              <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+              <pdfaProperty:category>external</pdfaProperty:category>
+              <pdfaProperty:description>name of the embedded XML invoice file</pdfaProperty:description>
+            </rdf:li>
+            <rdf:li rdf:parseType="Resource">
+              <pdfaProperty:name>DocumentType</pdfaProperty:name>
+              <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+              <pdfaProperty:category>external</pdfaProperty:category>
+              <pdfaProperty:description>INVOICE</pdfaProperty:description>
+            </rdf:li>
+            <rdf:li rdf:parseType="Resource">
+              <pdfaProperty:name>Version</pdfaProperty:name>
+              <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+              <pdfaProperty:category>external</pdfaProperty:category>
+              <pdfaProperty:description>The actual version of the Factur-X XML schema</pdfaProperty:description>
+            </rdf:li>
+            <rdf:li rdf:parseType="Resource">
+              <pdfaProperty:name>ConformanceLevel</pdfaProperty:name>
+              <pdfaProperty:valueType>Text</pdfaProperty:valueType>
+              <pdfaProperty:category>external</pdfaProperty:category>
+              <pdfaProperty:description>The conformance level of the embedded Factur-X data</pdfaProperty:description>
+            </rdf:li>
+          </rdf:Seq>
+        </pdfaSchema:property>
+      </rdf:li>
+    </rdf:Bag>
+  </pdfaExtension:schemas>
+</rdf:Description>`
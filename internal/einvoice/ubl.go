@@ -0,0 +1,698 @@
+package einvoice
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+)
+
+// UBL 2.1 namespaces.
+const (
+	NamespaceUBLInvoice    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	NamespaceUBLCreditNote = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	NamespaceCAC           = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	NamespaceCBC           = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// Peppol BIS Billing 3.0 identifiers.
+const (
+	PeppolCustomizationID = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+	PeppolProfileID       = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+)
+
+// Electronic address schemes (Peppol EAS) used for endpoints.
+const (
+	SchemeFrenchVAT = "9957"
+	SchemeEmail     = "EM"
+)
+
+// ErrNotUBL is returned when a document is neither a UBL Invoice nor a UBL CreditNote.
+var ErrNotUBL = errors.New("not a UBL invoice or credit note")
+
+// The ubl* structures use local names only: they decode documents whatever
+// prefixes they use, and UBL encodes the cac/cbc prefixes, which depend only
+// on whether an element is an aggregate (see writePrefixed).
+
+type ublDocument struct {
+	XMLName         xml.Name         `xml:""`
+	CustomizationID string           `xml:"CustomizationID"`
+	ProfileID       string           `xml:"ProfileID"`
+	ID              string           `xml:"ID"`
+	IssueDate       string           `xml:"IssueDate"`
+	DueDate         string           `xml:"DueDate,omitempty"`
+	InvoiceType     string           `xml:"InvoiceTypeCode,omitempty"`
+	CreditNoteType  string           `xml:"CreditNoteTypeCode,omitempty"`
+	Notes           []string         `xml:"Note,omitempty"`
+	Currency        string           `xml:"DocumentCurrencyCode"`
+	BuyerReference  string           `xml:"BuyerReference,omitempty"`
+	Billing         *ublBilling      `xml:"BillingReference,omitempty"`
+	Supplier        ublParty         `xml:"AccountingSupplierParty>Party"`
+	Customer        ublParty         `xml:"AccountingCustomerParty>Party"`
+	PaymentMeans    *ublPaymentMeans `xml:"PaymentMeans,omitempty"`
+	PaymentTerms    string           `xml:"PaymentTerms>Note,omitempty"`
+	TaxTotal        ublTaxTotal      `xml:"TaxTotal"`
+	Totals          ublMonetaryTotal `xml:"LegalMonetaryTotal"`
+	InvoiceLines    []ublLine        `xml:"InvoiceLine,omitempty"`
+	CreditNoteLines []ublLine        `xml:"CreditNoteLine,omitempty"`
+}
+
+type ublBilling struct {
+	ID        string `xml:"InvoiceDocumentReference>ID"`
+	IssueDate string `xml:"InvoiceDocumentReference>IssueDate,omitempty"`
+}
+
+type ublPaymentMeans struct {
+	Code    string `xml:"PaymentMeansCode"`
+	DueDate string `xml:"PaymentDueDate,omitempty"`
+}
+
+type ublParty struct {
+	Endpoint  ublID          `xml:"EndpointID"`
+	Name      string         `xml:"PartyName>Name,omitempty"`
+	Address   ublAddress     `xml:"PostalAddress"`
+	TaxScheme []ublPartyTax  `xml:"PartyTaxScheme,omitempty"`
+	Legal     ublLegalEntity `xml:"PartyLegalEntity"`
+	Email     string         `xml:"Contact>ElectronicMail,omitempty"`
+}
+
+type ublID struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type ublAddress struct {
+	Street     string `xml:"StreetName,omitempty"`
+	City       string `xml:"CityName,omitempty"`
+	PostalZone string `xml:"PostalZone,omitempty"`
+	Country    string `xml:"Country>IdentificationCode"`
+}
+
+type ublPartyTax struct {
+	CompanyID string `xml:"CompanyID"`
+	TaxScheme string `xml:"TaxScheme>ID"`
+}
+
+type ublLegalEntity struct {
+	Name      string `xml:"RegistrationName"`
+	CompanyID *ublID `xml:"CompanyID,omitempty"`
+}
+
+type ublAmount struct {
+	Currency string `xml:"currencyID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublTaxTotal struct {
+	Amount    ublAmount        `xml:"TaxAmount"`
+	Subtotals []ublTaxSubtotal `xml:"TaxSubtotal"`
+}
+
+type ublTaxSubtotal struct {
+	Taxable  ublAmount      `xml:"TaxableAmount"`
+	Amount   ublAmount      `xml:"TaxAmount"`
+	Category ublTaxCategory `xml:"TaxCategory"`
+}
+
+type ublTaxCategory struct {
+	ID              string `xml:"ID"`
+	Percent         string `xml:"Percent,omitempty"`
+	ExemptionReason string `xml:"TaxExemptionReason,omitempty"`
+	TaxScheme       string `xml:"TaxScheme>ID"`
+}
+
+type ublMonetaryTotal struct {
+	LineExtension ublAmount  `xml:"LineExtensionAmount"`
+	TaxExclusive  ublAmount  `xml:"TaxExclusiveAmount"`
+	TaxInclusive  ublAmount  `xml:"TaxInclusiveAmount"`
+	Prepaid       *ublAmount `xml:"PrepaidAmount,omitempty"`
+	Payable       ublAmount  `xml:"PayableAmount"`
+}
+
+type ublLine struct {
+	ID               string         `xml:"ID"`
+	InvoicedQuantity *ublQuantity   `xml:"InvoicedQuantity,omitempty"`
+	CreditedQuantity *ublQuantity   `xml:"CreditedQuantity,omitempty"`
+	LineExtension    ublAmount      `xml:"LineExtensionAmount"`
+	Allowances       []ublAllowance `xml:"AllowanceCharge,omitempty"`
+	Item             ublItem        `xml:"Item"`
+	Price            ublPrice       `xml:"Price"`
+}
+
+// ublAllowance is a line allowance (BG-27), the discount of the line.
+type ublAllowance struct {
+	ChargeIndicator bool       `xml:"ChargeIndicator"`
+	ReasonCode      string     `xml:"AllowanceChargeReasonCode,omitempty"`
+	Reason          string     `xml:"AllowanceChargeReason,omitempty"`
+	Percent         string     `xml:"MultiplierFactorNumeric,omitempty"`
+	Amount          ublAmount  `xml:"Amount"`
+	Base            *ublAmount `xml:"BaseAmount,omitempty"`
+}
+
+type ublQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublItem struct {
+	Name        string         `xml:"Name"`
+	SellersID   string         `xml:"SellersItemIdentification>ID,omitempty"`
+	TaxCategory ublTaxCategory `xml:"ClassifiedTaxCategory"`
+}
+
+type ublPrice struct {
+	Amount       ublAmount    `xml:"PriceAmount"`
+	BaseQuantity *ublQuantity `xml:"BaseQuantity,omitempty"`
+}
+
+// ValidatePeppol runs Validate and the Peppol BIS rules on top of EN 16931:
+// both parties need an electronic address.
+func ValidatePeppol(invoice *models.Invoice, company *models.CompanySettings) error {
+	err := Validate(invoice, company)
+	var invalid *ValidationError
+	if err != nil && !errors.As(err, &invalid) {
+		return err
+	}
+	if invalid == nil {
+		invalid = &ValidationError{Violations: map[string]string{}}
+	}
+
+	if sellerEndpoint(company).Value == "" {
+		invalid.Violations["company.endpoint"] = "SIRET, VAT number or email required"
+	}
+	if invoice.Client != nil && buyerEndpoint(invoice.Client).Value == "" {
+		invalid.Violations["client.endpoint"] = "SIRET, VAT number or email required"
+	}
+
+	if !invalid.Violations.Empty() {
+		return invalid
+	}
+	return nil
+}
+
+// UBL renders an invoice as a UBL 2.1 Invoice, or a credit note as a UBL
+// 2.1 CreditNote, following Peppol BIS Billing 3.0. The invoice must have
+// Client, Items and, for credit notes, OriginalInvoice loaded.
+func UBL(invoice *models.Invoice, company *models.CompanySettings) ([]byte, error) {
+	if err := ValidatePeppol(invoice, company); err != nil {
+		return nil, err
+	}
+
+	raw, err := xml.Marshal(buildUBL(invoice, company))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := writePrefixed(&buf, raw); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func buildUBL(invoice *models.Invoice, company *models.CompanySettings) *ublDocument {
+	s := sign(invoice)
+	currency := string(invoice.Currency.OrDefault())
+	amount := func(m models.Money) ublAmount {
+		return ublAmount{Currency: currency, Value: signed(m, s).String()}
+	}
+
+	doc := &ublDocument{
+		CustomizationID: PeppolCustomizationID,
+		ProfileID:       PeppolProfileID,
+		ID:              invoice.Number,
+		IssueDate:       invoice.IssueDate.Format(time.DateOnly),
+		Currency:        currency,
+		BuyerReference:  invoice.Reference,
+		Supplier:        ublSupplier(company),
+		Customer:        ublCustomer(invoice.Client),
+	}
+	if invoice.IsPenalty() {
+		// BR-O-02, BR-O-04: no VAT identifiers outside the scope of VAT
+		doc.Supplier.TaxScheme = slices.DeleteFunc(doc.Supplier.TaxScheme, isVATIdentifier)
+		doc.Customer.TaxScheme = slices.DeleteFunc(doc.Customer.TaxScheme, isVATIdentifier)
+	}
+	if notes := strings.TrimSpace(invoice.Notes); notes != "" {
+		doc.Notes = []string{notes}
+	}
+
+	if invoice.IsCreditNote() {
+		doc.XMLName = xml.Name{Local: "CreditNote"}
+		doc.CreditNoteType = TypeCodeCreditNote
+		doc.BuyerReference = ""
+		if original := invoice.OriginalInvoice; original != nil {
+			doc.Billing = &ublBilling{ID: original.Number, IssueDate: original.IssueDate.Format(time.DateOnly)}
+		}
+	} else {
+		doc.XMLName = xml.Name{Local: "Invoice"}
+		doc.InvoiceType = TypeCode(invoice)
+		if !invoice.DueDate.IsZero() {
+			doc.DueDate = invoice.DueDate.Format(time.DateOnly)
+		}
+		doc.PaymentTerms = strings.TrimSpace(invoice.PaymentTerms)
+	}
+	if doc.BuyerReference == "" {
+		// BT-10 or an order reference is mandatory in Peppol; the invoice number will do
+		doc.BuyerReference = invoice.Number
+	}
+
+	for _, line := range invoice.VATBreakdown() {
+		doc.TaxTotal.Subtotals = append(doc.TaxTotal.Subtotals, ublTaxSubtotal{
+			Taxable:  amount(line.Base),
+			Amount:   amount(line.VAT),
+			Category: ublCategory(line.Rate, invoice, company),
+		})
+	}
+	doc.TaxTotal.Amount = amount(invoice.TotalVAT())
+	doc.Totals = ublMonetaryTotal{
+		LineExtension: amount(invoice.TotalHT()),
+		TaxExclusive:  amount(invoice.TotalHT()),
+		TaxInclusive:  amount(invoice.TotalTTC()),
+		Payable:       amount(invoice.TotalTTC()),
+	}
+
+	for n, item := range lines(invoice) {
+		category := ublCategory(item.VATRate, invoice, company)
+		category.ExemptionReason = ""
+		line := ublLine{
+			ID:            strconv.Itoa(n + 1),
+			LineExtension: amount(item.TotalHT()),
+			Item:          ublItem{Name: item.Description, TaxCategory: category},
+			Price:         ublPrice{Amount: ublAmount{Currency: currency, Value: item.UnitPrice.String()}},
+		}
+		if item.Product != nil {
+			line.Item.SellersID = item.Product.Code
+		}
+		if item.HasDiscount() {
+			allowance := ublAllowance{ReasonCode: ReasonCodeDiscount, Reason: "Remise", Amount: amount(item.Discount())}
+			if item.DiscountRate != 0 {
+				base := amount(item.GrossHT())
+				allowance.Percent = formatDecimal(item.DiscountPercent())
+				allowance.Base = &base
+			}
+			line.Allowances = append(line.Allowances, allowance)
+		}
+		quantity := &ublQuantity{UnitCode: UnitCode(item.Unit), Value: formatDecimal(item.Quantity * s)}
+		if invoice.IsCreditNote() {
+			line.CreditedQuantity = quantity
+			doc.CreditNoteLines = append(doc.CreditNoteLines, line)
+		} else {
+			line.InvoicedQuantity = quantity
+			doc.InvoiceLines = append(doc.InvoiceLines, line)
+		}
+	}
+	return doc
+}
+
+func ublCategory(rate float64, invoice *models.Invoice, company *models.CompanySettings) ublTaxCategory {
+	category := ublTaxCategory{
+		ID:        VATCategory(rate, invoice, company),
+		Percent:   formatDecimal(models.VATLine{Rate: rate}.RatePercent()),
+		TaxScheme: "VAT",
+	}
+	switch category.ID {
+	case VATCategoryExempt:
+		category.ExemptionReason = models.VATExemptionMention
+	case VATCategoryOutOfScope:
+		// BR-O-05, BR-O-09: no rate outside the scope of VAT
+		category.Percent = ""
+		category.ExemptionReason = ExemptionReasonOutOfScope
+	}
+	return category
+}
+
+func ublSupplier(company *models.CompanySettings) ublParty {
+	party := ublParty{
+		Endpoint: sellerEndpoint(company),
+		Name:     company.Name,
+		Address: ublAddress{
+			Street:     company.Address,
+			City:       company.City,
+			PostalZone: company.PostalCode,
+			Country:    partyCountry(company.CountryCode, company.Country),
+		},
+		Legal: ublLegalEntity{Name: company.Name},
+		Email: company.Email,
+	}
+	siret := strings.ReplaceAll(company.SIRET, " ", "")
+	if scheme := siretScheme(siret); scheme != "" {
+		party.Legal.CompanyID = &ublID{SchemeID: scheme, Value: siret}
+	}
+	if company.VATNumber != "" {
+		party.TaxScheme = append(party.TaxScheme, ublPartyTax{CompanyID: company.VATNumber, TaxScheme: "VAT"})
+	} else if company.VATExempt && siret != "" {
+		// BT-32 tax registration of sellers without a VAT number
+		party.TaxScheme = append(party.TaxScheme, ublPartyTax{CompanyID: siret, TaxScheme: "TAX"})
+	}
+	return party
+}
+
+func ublCustomer(client *models.Client) ublParty {
+	name := client.Name
+	if client.Company != "" {
+		name = client.Company
+	}
+	party := ublParty{
+		Endpoint: buyerEndpoint(client),
+		Name:     name,
+		Address: ublAddress{
+			Street:     client.Address,
+			City:       client.City,
+			PostalZone: client.PostalCode,
+			Country:    partyCountry(client.CountryCode, client.Country),
+		},
+		Legal: ublLegalEntity{Name: name},
+		Email: client.Email,
+	}
+	siret := strings.ReplaceAll(client.SIRET, " ", "")
+	if scheme := siretScheme(siret); scheme != "" {
+		party.Legal.CompanyID = &ublID{SchemeID: scheme, Value: siret}
+	}
+	if client.VATNumber != "" {
+		party.TaxScheme = append(party.TaxScheme, ublPartyTax{CompanyID: client.VATNumber, TaxScheme: "VAT"})
+	}
+	return party
+}
+
+func isVATIdentifier(tax ublPartyTax) bool {
+	return tax.TaxScheme == "VAT"
+}
+
+// endpoint picks the Peppol electronic address of a party: its SIRET/SIREN,
+// else its French VAT number, else its email.
+func endpoint(siret, vatNumber, email string) ublID {
+	siret = strings.ReplaceAll(siret, " ", "")
+	if scheme := siretScheme(siret); scheme != "" {
+		return ublID{SchemeID: scheme, Value: siret}
+	}
+	if strings.HasPrefix(strings.ToUpper(vatNumber), "FR") {
+		return ublID{SchemeID: SchemeFrenchVAT, Value: vatNumber}
+	}
+	if email != "" {
+		return ublID{SchemeID: SchemeEmail, Value: email}
+	}
+	return ublID{}
+}
+
+func sellerEndpoint(company *models.CompanySettings) ublID {
+	return endpoint(company.SIRET, company.VATNumber, company.Email)
+}
+
+func buyerEndpoint(client *models.Client) ublID {
+	return endpoint(client.SIRET, client.VATNumber, client.Email)
+}
+
+// writePrefixed re-encodes a UBL document marshaled with local names only,
+// declaring the namespaces on the root and prefixing every other element:
+// cac: for aggregates (elements with child elements), cbc: for the rest.
+func writePrefixed(w io.Writer, raw []byte) error {
+	root, err := parseNode(xml.NewDecoder(bytes.NewReader(raw)))
+	if err != nil {
+		return err
+	}
+
+	ns := NamespaceUBLInvoice
+	if root.name == "CreditNote" {
+		ns = NamespaceUBLCreditNote
+	}
+	root.attrs = append([]xml.Attr{
+		{Name: xml.Name{Local: "xmlns"}, Value: ns},
+		{Name: xml.Name{Local: "xmlns:cac"}, Value: NamespaceCAC},
+		{Name: xml.Name{Local: "xmlns:cbc"}, Value: NamespaceCBC},
+	}, root.attrs...)
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := root.encode(enc, ""); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+type node struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []*node
+}
+
+func parseNode(dec *xml.Decoder) (*node, error) {
+	var stack []*node
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("re-encode UBL: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name.Local}
+			for _, a := range t.Attr {
+				n.attrs = append(n.attrs, xml.Attr{Name: xml.Name{Local: a.Name.Local}, Value: a.Value})
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return n, nil
+			}
+		}
+	}
+}
+
+func (n *node) encode(enc *xml.Encoder, prefix string) error {
+	start := xml.StartElement{Name: xml.Name{Local: prefix + n.name}, Attr: n.attrs}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if len(n.children) == 0 {
+		if err := enc.EncodeToken(xml.CharData(n.text)); err != nil {
+			return err
+		}
+	}
+	for _, child := range n.children {
+		childPrefix := "cbc:"
+		if len(child.children) > 0 {
+			childPrefix = "cac:"
+		}
+		if err := child.encode(enc, childPrefix); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// Party is a trading party read from an imported document.
+type Party struct {
+	Name       string
+	Email      string
+	Address    string
+	City       string
+	PostalCode string
+	Country    string
+	SIRET      string
+	VATNumber  string
+}
+
+// Imported is a document read by ParseUBL. Invoice has Items set; its
+// client is described by Customer, for the caller to match or create.
+type Imported struct {
+	Invoice  *models.Invoice
+	Customer Party
+	Supplier Party
+	// Number is the document number given by its issuer
+	Number string
+}
+
+// ParseUBL reads a UBL 2.1 Invoice or CreditNote. Credit note lines come
+// back with negative quantities, as CreditNoteService issues them.
+func ParseUBL(data []byte) (*Imported, error) {
+	var doc ublDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse UBL: %w", err)
+	}
+	ns := doc.XMLName.Space
+	isCreditNote := doc.XMLName.Local == "CreditNote" && ns == NamespaceUBLCreditNote
+	if !isCreditNote && (doc.XMLName.Local != "Invoice" || ns != NamespaceUBLInvoice) {
+		return nil, ErrNotUBL
+	}
+	if doc.Currency != "" && doc.Currency != Currency {
+		return nil, fmt.Errorf("parse UBL: unsupported currency %q", doc.Currency)
+	}
+
+	issued, err := parseDate(doc.IssueDate)
+	if err != nil {
+		return nil, err
+	}
+	invoice := &models.Invoice{
+		Type:         models.InvoiceTypeInvoice,
+		Status:       models.InvoiceStatusDraft,
+		IssueDate:    issued,
+		DueDate:      issued,
+		Reference:    doc.BuyerReference,
+		Notes:        strings.Join(doc.Notes, "\n"),
+		PaymentTerms: doc.PaymentTerms,
+	}
+	due := doc.DueDate
+	if due == "" && doc.PaymentMeans != nil {
+		due = doc.PaymentMeans.DueDate
+	}
+	if due != "" {
+		if invoice.DueDate, err = parseDate(due); err != nil {
+			return nil, err
+		}
+	}
+
+	lines, s := doc.InvoiceLines, 1.0
+	if isCreditNote {
+		invoice.Type = models.InvoiceTypeCreditNote
+		lines, s = doc.CreditNoteLines, -1
+	}
+	for n, line := range lines {
+		item, err := parseUBLLine(line, s)
+		if err != nil {
+			return nil, fmt.Errorf("parse UBL line %d: %w", n+1, err)
+		}
+		item.Position = n
+		invoice.Items = append(invoice.Items, item)
+	}
+
+	return &Imported{
+		Invoice:  invoice,
+		Customer: ublPartyOf(doc.Customer),
+		Supplier: ublPartyOf(doc.Supplier),
+		Number:   doc.ID,
+	}, nil
+}
+
+// parseNumber parses a decimal of the document. strconv.ParseFloat also
+// reads "NaN" and "Inf", which UBL numbers cannot be.
+func parseNumber(value string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return f, err
+}
+
+func parseUBLLine(line ublLine, s float64) (models.InvoiceItem, error) {
+	quantity := line.InvoicedQuantity
+	if quantity == nil {
+		quantity = line.CreditedQuantity
+	}
+	if quantity == nil {
+		return models.InvoiceItem{}, errors.New("missing quantity")
+	}
+	qty, err := parseNumber(quantity.Value)
+	if err != nil {
+		return models.InvoiceItem{}, fmt.Errorf("quantity: %w", err)
+	}
+	price, err := models.ParseMoney(line.Price.Amount.Value)
+	if err != nil {
+		return models.InvoiceItem{}, fmt.Errorf("price: %w", err)
+	}
+	if base := line.Price.BaseQuantity; base != nil && strings.TrimSpace(base.Value) != "" {
+		// Prices may be given for a base quantity (e.g. per 100 units)
+		b, err := parseNumber(base.Value)
+		if err != nil || b <= 0 {
+			return models.InvoiceItem{}, fmt.Errorf("base quantity: invalid %q", base.Value)
+		}
+		if b != 1 {
+			price = price.Mul(1 / b)
+		}
+	}
+	rate := 0.0
+	if p := strings.TrimSpace(line.Item.TaxCategory.Percent); p != "" {
+		if rate, err = parseNumber(p); err != nil {
+			return models.InvoiceItem{}, fmt.Errorf("VAT rate: %w", err)
+		}
+	}
+
+	// Line allowances are discounts; the discount of a credit note line
+	// is negative like its quantity
+	var discount models.Money
+	for _, allowance := range line.Allowances {
+		if allowance.ChargeIndicator {
+			continue
+		}
+		amount, err := models.ParseMoney(allowance.Amount.Value)
+		if err != nil {
+			return models.InvoiceItem{}, fmt.Errorf("allowance: %w", err)
+		}
+		discount += amount
+	}
+	if s < 0 {
+		discount = -discount
+	}
+
+	return models.InvoiceItem{
+		Description:    line.Item.Name,
+		Quantity:       qty * s,
+		UnitPrice:      price,
+		Unit:           unitName(quantity.UnitCode),
+		VATRate:        rate / 100,
+		DiscountAmount: discount,
+	}, nil
+}
+
+func ublPartyOf(p ublParty) Party {
+	party := Party{
+		Name:       p.Legal.Name,
+		Email:      p.Email,
+		Address:    p.Address.Street,
+		City:       p.Address.City,
+		PostalCode: p.Address.PostalZone,
+		Country:    p.Address.Country,
+	}
+	if party.Name == "" {
+		party.Name = p.Name
+	}
+	for _, tax := range p.TaxScheme {
+		if tax.TaxScheme == "VAT" {
+			party.VATNumber = tax.CompanyID
+		}
+	}
+	if id := p.Legal.CompanyID; id != nil && siretScheme(id.Value) != "" {
+		party.SIRET = strings.ReplaceAll(id.Value, " ", "")
+	} else if siretScheme(p.Endpoint.Value) != "" {
+		party.SIRET = strings.ReplaceAll(p.Endpoint.Value, " ", "")
+	}
+	if party.Email == "" && p.Endpoint.SchemeID == SchemeEmail {
+		party.Email = p.Endpoint.Value
+	}
+	return party
+}
+
+// unitName maps a UN/ECE Rec 20 code back to our units, "unit" by default.
+func unitName(code string) string {
+	for unit, c := range unitCodes {
+		if c == code {
+			return unit
+		}
+	}
+	return "unit"
+}
+
+func parseDate(s string) (time.Time, error) {
+	t, err := time.Parse(time.DateOnly, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse UBL date %q: %w", s, err)
+	}
+	return t, nil
+}
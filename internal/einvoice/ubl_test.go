@@ -0,0 +1,271 @@
+package einvoice
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+)
+
+// ublParsed checks the namespaces written by UBL; prefixes are checked on
+// the raw output.
+type ublParsed struct {
+	XMLName       xml.Name
+	Customization string `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2 CustomizationID"`
+	SellerID      struct {
+		Scheme string `xml:"schemeID,attr"`
+		Value  string `xml:",chardata"`
+	} `xml:"AccountingSupplierParty>Party>EndpointID"`
+	Payable string `xml:"LegalMonetaryTotal>PayableAmount"`
+}
+
+func encodeUBL(t *testing.T, invoice *models.Invoice, company *models.CompanySettings) []byte {
+	t.Helper()
+	out, err := UBL(invoice, company)
+	if err != nil {
+		t.Fatalf("UBL() error: %v", err)
+	}
+	return out
+}
+
+func TestUBL_Namespaces(t *testing.T) {
+	out := encodeUBL(t, testInvoice(), testCompany())
+
+	var doc ublParsed
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("generated XML does not parse: %v\n%s", err, out)
+	}
+	if doc.XMLName.Space != NamespaceUBLInvoice || doc.XMLName.Local != "Invoice" {
+		t.Errorf("root = %v", doc.XMLName)
+	}
+	if doc.Customization != PeppolCustomizationID {
+		t.Errorf("customization = %q", doc.Customization)
+	}
+	if doc.SellerID.Scheme != SchemeSIRET || doc.SellerID.Value != "12345678900012" {
+		t.Errorf("seller endpoint = %+v", doc.SellerID)
+	}
+	if doc.Payable != "1220.99" {
+		t.Errorf("payable = %q, want 1220.99", doc.Payable)
+	}
+	for _, tag := range []string{"<cac:AccountingSupplierParty>", "<cbc:EndpointID ", "<cac:TaxSubtotal>", "<cbc:TaxAmount "} {
+		if !bytes.Contains(out, []byte(tag)) {
+			t.Errorf("output has no %s", tag)
+		}
+	}
+}
+
+func TestUBL_RoundTrip(t *testing.T) {
+	invoice := testInvoice()
+	invoice.Reference = "PO-42"
+	invoice.PaymentTerms = "30 days"
+
+	imported, err := ParseUBL(encodeUBL(t, invoice, testCompany()))
+	if err != nil {
+		t.Fatalf("ParseUBL() error: %v", err)
+	}
+
+	got := imported.Invoice
+	if imported.Number != invoice.Number || got.Reference != "PO-42" || got.PaymentTerms != "30 days" {
+		t.Errorf("header = %q %q %q", imported.Number, got.Reference, got.PaymentTerms)
+	}
+	if !got.IssueDate.Equal(invoice.IssueDate) || !got.DueDate.Equal(invoice.DueDate) {
+		t.Errorf("dates = %v %v", got.IssueDate, got.DueDate)
+	}
+	if !got.IsDraft() || got.IsCreditNote() {
+		t.Errorf("status = %q, type = %q", got.Status, got.Type)
+	}
+	if len(got.Items) != len(invoice.Items) {
+		t.Fatalf("items = %+v", got.Items)
+	}
+	for n, want := range invoice.Items {
+		item := got.Items[n]
+		if item.Description != want.Description || item.Quantity != want.Quantity ||
+			item.UnitPrice != want.UnitPrice || item.VATRate != want.VATRate || item.Unit != unitName(UnitCode(want.Unit)) {
+			t.Errorf("item %d = %+v, want %+v", n, item, want)
+		}
+	}
+	if got.TotalTTC() != invoice.TotalTTC() {
+		t.Errorf("total = %s, want %s", got.TotalTTC(), invoice.TotalTTC())
+	}
+
+	c := imported.Customer
+	if c.Name != "Globex" || c.SIRET != "98765432100017" || c.VATNumber != "FR98765432100" || c.Country != "FR" {
+		t.Errorf("customer = %+v", c)
+	}
+	if s := imported.Supplier; s.SIRET != "12345678900012" || s.VATNumber != "FR12345678900" {
+		t.Errorf("supplier = %+v", s)
+	}
+}
+
+func TestParseUBL_RejectsNonFiniteNumbers(t *testing.T) {
+	out := encodeUBL(t, testInvoice(), testCompany())
+	for _, tc := range []struct{ old, new string }{
+		{`unitCode="DAY">2<`, `unitCode="DAY">NaN<`},
+		{`unitCode="DAY">2<`, `unitCode="DAY">+Inf<`},
+		{`<cbc:Percent>5.5</cbc:Percent>`, `<cbc:Percent>NaN</cbc:Percent>`},
+	} {
+		doc := bytes.ReplaceAll(out, []byte(tc.old), []byte(tc.new))
+		if bytes.Equal(doc, out) {
+			t.Fatalf("%q not found in the UBL", tc.old)
+		}
+		if _, err := ParseUBL(doc); err == nil {
+			t.Errorf("ParseUBL() with %s succeeded", tc.new)
+		}
+	}
+}
+
+func TestUBL_CreditNoteRoundTrip(t *testing.T) {
+	creditNote := testInvoice()
+	creditNote.Number = "AV-2025-00001"
+	creditNote.Type = models.InvoiceTypeCreditNote
+	creditNote.OriginalInvoice = testInvoice()
+	creditNote.Items = []models.InvoiceItem{
+		{Description: "Consulting", Quantity: -1, UnitPrice: 50000, Unit: "day", VATRate: 0.20},
+	}
+
+	out := encodeUBL(t, creditNote, testCompany())
+	var doc ublParsed
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("generated XML does not parse: %v", err)
+	}
+	if doc.XMLName.Space != NamespaceUBLCreditNote || doc.Payable != "600.00" {
+		t.Errorf("root = %v, payable = %q", doc.XMLName, doc.Payable)
+	}
+
+	imported, err := ParseUBL(out)
+	if err != nil {
+		t.Fatalf("ParseUBL() error: %v", err)
+	}
+	if !imported.Invoice.IsCreditNote() || imported.Invoice.Items[0].Quantity != -1 {
+		t.Errorf("credit note = %+v", imported.Invoice)
+	}
+}
+
+func TestUBL_DiscountRoundTrip(t *testing.T) {
+	invoice := testInvoice()
+	invoice.Items[0].DiscountRate = 0.1
+	invoice.Items[1].DiscountAmount = 190
+	invoice.Items = append(invoice.Items, models.InvoiceItem{Kind: models.ItemKindSubtotal})
+
+	out := encodeUBL(t, invoice, testCompany())
+	for _, tag := range []string{"<cac:AllowanceCharge>", "<cbc:ChargeIndicator>false</cbc:ChargeIndicator>", "<cbc:MultiplierFactorNumeric>10<"} {
+		if !bytes.Contains(out, []byte(tag)) {
+			t.Errorf("output has no %s", tag)
+		}
+	}
+	imported, err := ParseUBL(out)
+	if err != nil {
+		t.Fatalf("ParseUBL() error: %v", err)
+	}
+	got := imported.Invoice
+	if len(got.Items) != 2 || got.Items[0].Discount() != 10000 || got.Items[1].Discount() != 190 {
+		t.Fatalf("items = %+v", got.Items)
+	}
+	if got.TotalTTC() != invoice.TotalTTC() {
+		t.Errorf("total = %s, want %s", got.TotalTTC(), invoice.TotalTTC())
+	}
+}
+
+func TestUBL_VATExempt(t *testing.T) {
+	company := testCompany()
+	company.VATExempt = true
+	company.VATNumber = ""
+	invoice := testInvoice()
+	for n := range invoice.Items {
+		invoice.Items[n].VATRate = 0
+	}
+
+	var doc struct {
+		Categories []struct {
+			ID     string `xml:"ID"`
+			Reason string `xml:"TaxExemptionReason"`
+		} `xml:"TaxTotal>TaxSubtotal>TaxCategory"`
+		TaxScheme string `xml:"AccountingSupplierParty>Party>PartyTaxScheme>TaxScheme>ID"`
+	}
+	if err := xml.Unmarshal(encodeUBL(t, invoice, company), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Categories) != 1 || doc.Categories[0].ID != "E" || doc.Categories[0].Reason != models.VATExemptionMention {
+		t.Errorf("categories = %+v", doc.Categories)
+	}
+	if doc.TaxScheme != "TAX" {
+		t.Errorf("seller tax scheme = %q, want TAX", doc.TaxScheme)
+	}
+}
+
+func TestValidatePeppol_Endpoints(t *testing.T) {
+	company := testCompany()
+	company.SIRET, company.VATNumber, company.Email = "", "DE123456789", ""
+	invoice := testInvoice()
+	invoice.Client.SIRET, invoice.Client.VATNumber = "", ""
+
+	var invalid *ValidationError
+	if err := ValidatePeppol(invoice, company); !errors.As(err, &invalid) {
+		t.Fatalf("ValidatePeppol() = %v, want *ValidationError", err)
+	}
+	for _, field := range []string{"company.endpoint", "client.endpoint"} {
+		if _, ok := invalid.Violations[field]; !ok {
+			t.Errorf("Violations = %v, missing %q", invalid.Violations, field)
+		}
+	}
+}
+
+func TestParseUBL_Sample(t *testing.T) {
+	data, err := os.ReadFile("testdata/peppol-invoice.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ParseUBL(data)
+	if err != nil {
+		t.Fatalf("ParseUBL() error: %v", err)
+	}
+
+	invoice := imported.Invoice
+	if imported.Number != "INV-4711" || invoice.Reference != "PO-2025-118" || invoice.Notes != "Delivered on site" {
+		t.Errorf("header = %q %q %q", imported.Number, invoice.Reference, invoice.Notes)
+	}
+	if want := time.Date(2025, time.March, 16, 0, 0, 0, 0, time.UTC); !invoice.DueDate.Equal(want) {
+		t.Errorf("due date = %v", invoice.DueDate)
+	}
+	if len(invoice.Items) != 2 {
+		t.Fatalf("items = %+v", invoice.Items)
+	}
+	if item := invoice.Items[0]; item.Unit != "hour" || item.Quantity != 16 || item.UnitPrice != 7500 || item.VATRate != 0.20 {
+		t.Errorf("item 0 = %+v", item)
+	}
+	// 37.00 per 100 units
+	if item := invoice.Items[1]; item.UnitPrice != 37 || item.TotalHT() != 11100 || item.VATRate != 0.10 {
+		t.Errorf("item 1 = %+v", item)
+	}
+	if invoice.TotalVAT() != 25110 || invoice.TotalTTC() != 156210 {
+		t.Errorf("totals = %s %s, want 251.10 1562.10", invoice.TotalVAT(), invoice.TotalTTC())
+	}
+
+	if c := imported.Customer; c.Name != "Acme SARL" || c.VATNumber != "FR12345678900" || c.SIRET != "" || c.Email != "billing@acme.test" {
+		t.Errorf("customer = %+v", c)
+	}
+	if s := imported.Supplier; s.Name != "Initech SAS" || s.SIRET != "11122233300015" {
+		t.Errorf("supplier = %+v", s)
+	}
+}
+
+func TestParseUBL_Rejects(t *testing.T) {
+	cases := map[string]string{
+		"CII":      `<rsm:CrossIndustryInvoice xmlns:rsm="` + NamespaceRSM + `"/>`,
+		"no ns":    `<Invoice><ID>1</ID></Invoice>`,
+		"currency": `<Invoice xmlns="` + NamespaceUBLInvoice + `"><IssueDate>2025-01-01</IssueDate><DocumentCurrencyCode>USD</DocumentCurrencyCode></Invoice>`,
+		"garbage":  `not xml`,
+	}
+	for name, data := range cases {
+		if _, err := ParseUBL([]byte(data)); err == nil {
+			t.Errorf("%s: ParseUBL() = nil error", name)
+		}
+	}
+	if _, err := ParseUBL([]byte(cases["CII"])); !errors.Is(err, ErrNotUBL) {
+		t.Errorf("CII: error = %v, want ErrNotUBL", err)
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/diewo77/go-gate"
 	"github.com/diewo77/go-invoices/httpx"
 	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
 	"github.com/diewo77/go-invoices/view"
 	"gorm.io/gorm"
 )
@@ -100,7 +102,7 @@ func (h *AdminProfileHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.DB.Create(&profile).Error; err != nil {
+	if err := h.DB.WithContext(r.Context()).Create(&profile).Error; err != nil {
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
 			if strings.HasPrefix(contentType, "application/json") {
 				httpx.JSONError(w, http.StatusConflict, "name_already_exists", nil)
@@ -181,7 +183,7 @@ func (h *AdminProfileHandler) Update(w http.ResponseWriter, r *http.Request) {
 		profile.Description = strings.TrimSpace(r.FormValue("description"))
 	}
 
-	if err := h.DB.Save(&profile).Error; err != nil {
+	if err := h.DB.WithContext(r.Context()).Save(&profile).Error; err != nil {
 		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
 		return
 	}
@@ -235,7 +237,7 @@ func (h *AdminProfileHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete profile (soft delete via GORM)
-	if err := h.DB.Delete(&profile).Error; err != nil {
+	if err := h.DB.WithContext(r.Context()).Delete(&profile).Error; err != nil {
 		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
 		return
 	}
@@ -329,7 +331,25 @@ func (h *AdminProfileHandler) SavePermissions(w http.ResponseWriter, r *http.Req
 	}
 
 	// Replace the profile's permissions (GORM handles the many2many table)
-	if err := h.DB.Model(&profile).Association("Permissions").Replace(permissions); err != nil {
+	// and record the change in the audit log
+	err = h.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		var current []models.Permission
+		if err := tx.Model(&profile).Association("Permissions").Find(&current); err != nil {
+			return err
+		}
+		if err := tx.Model(&profile).Association("Permissions").Replace(permissions); err != nil {
+			return err
+		}
+		before, after := permissionCodes(current), permissionCodes(permissions)
+		if before == after {
+			return nil
+		}
+		return services.AppendAudit(tx, &models.AuditEntry{
+			ActorID: uid, Action: models.AuditUpdate, EntityType: "profile_permissions", EntityID: profile.ID,
+			Before: before, After: after,
+		})
+	})
+	if err != nil {
 		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
 		return
 	}
@@ -342,6 +362,17 @@ func (h *AdminProfileHandler) SavePermissions(w http.ResponseWriter, r *http.Req
 	http.Redirect(w, r, "/admin/profiles/permissions?id="+strconv.Itoa(id), http.StatusSeeOther)
 }
 
+// permissionCodes returns a permission set as an audit log JSON object.
+func permissionCodes(permissions []models.Permission) string {
+	codes := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		codes = append(codes, p.Code())
+	}
+	sort.Strings(codes)
+	data, _ := json.Marshal(map[string][]string{"permissions": codes})
+	return string(data)
+}
+
 // ListPermissions returns all available permissions (for API use).
 func (h *AdminProfileHandler) ListPermissions(w http.ResponseWriter, r *http.Request) {
 	var permissions []models.Permission
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/diewo77/go-gate"
+	"github.com/diewo77/go-invoices/httpx"
+	"gorm.io/gorm"
+)
+
+// The /api/v1 handlers answer JSON only. Errors are written with
+// httpx.JSONError and a snake_case code; validation errors carry the
+// violations as details.
+
+// Authorizer checks the current user's right to act on a loaded resource.
+// *policy.AuthGate implements it, with the ownership policies registered
+// per resource type.
+type Authorizer interface {
+	Authorize(ctx context.Context, action gate.Action, resourceType string, resource any) error
+}
+
+// API list pagination.
+const (
+	apiDefaultLimit = 20
+	apiMaxLimit     = 100
+)
+
+// apiPage is a page of a list endpoint. NextCursor is passed back as the
+// cursor query parameter to get the next page; it is empty on the last page.
+type apiPage struct {
+	Data       any    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// paginate loads one page of query into out, newest first. Cursors are
+// opaque to clients: they encode the ID of the last row of the page.
+func paginate[T any](r *http.Request, query *gorm.DB, out *[]T, id func(*T) uint) (string, error) {
+	limit := apiDefaultLimit
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, apiMaxLimit)
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return "", errInvalidCursor
+		}
+		after, err := strconv.ParseUint(string(raw), 10, 64)
+		if err != nil {
+			return "", errInvalidCursor
+		}
+		query = query.Where("id < ?", after)
+	}
+
+	// One extra row tells whether there is a next page
+	if err := query.Order("id DESC").Limit(limit + 1).Find(out).Error; err != nil {
+		return "", err
+	}
+	if len(*out) <= limit {
+		return "", nil
+	}
+	*out = (*out)[:limit]
+	last := id(&(*out)[limit-1])
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(last), 10))), nil
+}
+
+// writePage writes the result of paginate.
+func writePage[T any](w http.ResponseWriter, items []T, next string, err error) {
+	switch {
+	case errors.Is(err, errInvalidCursor):
+		httpx.JSONError(w, http.StatusBadRequest, "invalid_cursor", nil)
+	case err != nil:
+		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+	default:
+		if items == nil {
+			items = []T{}
+		}
+		httpx.JSON(w, http.StatusOK, apiPage{Data: items, NextCursor: next})
+	}
+}
+
+// loadOwned loads the resource with the path id into dst, and checks with
+// the gate that the user may act on it. Resources of other users are
+// reported as not found.
+func loadOwned(w http.ResponseWriter, r *http.Request, db *gorm.DB, authz Authorizer, resourceType string, action gate.Action, dst any) bool {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		httpx.JSONError(w, http.StatusNotFound, "not_found", nil)
+		return false
+	}
+	if err := db.First(dst, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			httpx.JSONError(w, http.StatusNotFound, "not_found", nil)
+		} else {
+			httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+		}
+		return false
+	}
+	if err := authz.Authorize(r.Context(), action, resourceType, dst); err != nil {
+		httpx.JSONError(w, http.StatusNotFound, "not_found", nil)
+		return false
+	}
+	return true
+}
+
+// decodeJSON decodes the request body into v. Unknown fields are rejected
+// so that typos do not go unnoticed.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, "invalid_json", map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
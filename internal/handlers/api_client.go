@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/diewo77/go-gate"
+	"github.com/diewo77/go-invoices/httpx"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/policy/principal"
+	"github.com/diewo77/go-invoices/validation"
+	"gorm.io/gorm"
+)
+
+// APIClientHandler serves the clients of the JSON API.
+type APIClientHandler struct {
+	db    *gorm.DB
+	authz Authorizer
+}
+
+func NewAPIClientHandler(db *gorm.DB, authz Authorizer) *APIClientHandler {
+	return &APIClientHandler{db: db, authz: authz}
+}
+
+// APIClientInput holds the writable fields of a client. Absent fields are
+// left unchanged on update.
+type APIClientInput struct {
+	Name       *string `json:"name"`
+	Email      *string `json:"email"`
+	Phone      *string `json:"phone"`
+	Company    *string `json:"company"`
+	Address    *string `json:"address"`
+	City       *string `json:"city"`
+	PostalCode *string `json:"postal_code"`
+	Country    *string `json:"country"`
+	// ISO 3166-1 alpha-2 code, for countries e-invoices do not recognize
+	CountryCode *string `json:"country_code"`
+	SIRET       *string `json:"siret"`
+	VATNumber   *string `json:"vat_number"`
+	// Currency of the client's invoices, the company's if empty
+	Currency *models.Currency `json:"currency"`
+}
+
+func (in *APIClientInput) apply(c *models.Client) {
+	set(&c.Name, in.Name)
+	set(&c.Email, in.Email)
+	set(&c.Phone, in.Phone)
+	set(&c.Company, in.Company)
+	set(&c.Address, in.Address)
+	set(&c.City, in.City)
+	set(&c.PostalCode, in.PostalCode)
+	set(&c.Country, in.Country)
+	set(&c.CountryCode, in.CountryCode)
+	set(&c.SIRET, in.SIRET)
+	set(&c.VATNumber, in.VATNumber)
+	set(&c.Currency, in.Currency)
+}
+
+// set copies an optional input field.
+func set[T any](dst *T, src *T) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+// List returns the user's clients. Query: q (name, company or email), cursor, limit.
+func (h *APIClientHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, _ := principal.UserIDFromContext(r.Context())
+
+	query := h.db.Where("user_id = ?", userID)
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		query = query.Where("name ILIKE ? OR company ILIKE ? OR email ILIKE ?", "%"+q+"%", "%"+q+"%", "%"+q+"%")
+	}
+
+	var clients []models.Client
+	next, err := paginate(r, query, &clients, func(c *models.Client) uint { return c.ID })
+	writePage(w, clients, next, err)
+}
+
+func (h *APIClientHandler) Get(w http.ResponseWriter, r *http.Request) {
+	var client models.Client
+	if !loadOwned(w, r, h.db, h.authz, "client", gate.ActionView, &client) {
+		return
+	}
+	httpx.JSON(w, http.StatusOK, client)
+}
+
+func (h *APIClientHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := principal.UserIDFromContext(r.Context())
+
+	var in APIClientInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	client := models.Client{UserID: userID}
+	in.apply(&client)
+
+	h.save(w, &client, http.StatusCreated)
+}
+
+func (h *APIClientHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var client models.Client
+	if !loadOwned(w, r, h.db, h.authz, "client", gate.ActionUpdate, &client) {
+		return
+	}
+
+	var in APIClientInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	in.apply(&client)
+
+	h.save(w, &client, http.StatusOK)
+}
+
+func (h *APIClientHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	var client models.Client
+	if !loadOwned(w, r, h.db, h.authz, "client", gate.ActionDelete, &client) {
+		return
+	}
+	if err := h.db.Delete(&client).Error; err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// save validates and stores a client, answering with it and status.
+func (h *APIClientHandler) save(w http.ResponseWriter, client *models.Client, status int) {
+	v := make(validation.Violations)
+	validation.Required("name", client.Name, v)
+	setCountryCode(client, client.CountryCode, v)
+	if client.Currency != "" && !client.Currency.IsValid() {
+		v["currency"] = "unsupported"
+	}
+	if !v.Empty() {
+		httpx.JSONError(w, http.StatusBadRequest, "validation_failed", v)
+		return
+	}
+
+	if err := h.db.Save(client).Error; err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+		return
+	}
+	httpx.JSON(w, status, client)
+}
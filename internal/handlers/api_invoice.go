@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/diewo77/go-gate"
+	"github.com/diewo77/go-invoices/httpx"
+	"github.com/diewo77/go-invoices/internal/einvoice"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/policy/principal"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/validation"
+	"gorm.io/gorm"
+)
+
+// APIInvoiceHandler serves invoices and their items in the JSON API.
+type APIInvoiceHandler struct {
+	db       *gorm.DB
+	authz    Authorizer
+	invoices *services.InvoiceService
+	archive  *services.ArchiveService
+	webhooks *services.WebhookService
+}
+
+func NewAPIInvoiceHandler(db *gorm.DB, authz Authorizer, invoices *services.InvoiceService, archive *services.ArchiveService, webhooks *services.WebhookService) *APIInvoiceHandler {
+	return &APIInvoiceHandler{db: db, authz: authz, invoices: invoices, archive: archive, webhooks: webhooks}
+}
+
+// APIInvoice is an invoice with its computed totals.
+type APIInvoice struct {
+	*models.Invoice
+	TotalHT  models.Money `json:"total_ht"`
+	TotalVAT models.Money `json:"total_vat"`
+	TotalTTC models.Money `json:"total_ttc"`
+}
+
+func newAPIInvoice(invoice *models.Invoice) APIInvoice {
+	return APIInvoice{
+		Invoice:  invoice,
+		TotalHT:  invoice.TotalHT(),
+		TotalVAT: invoice.TotalVAT(),
+		TotalTTC: invoice.TotalTTC(),
+	}
+}
+
+// APIInvoiceInput holds the writable fields of a draft invoice. Absent
+// fields are left unchanged on update.
+type APIInvoiceInput struct {
+	ClientID     *uint      `json:"client_id"`
+	IssueDate    *time.Time `json:"issue_date"`
+	DueDate      *time.Time `json:"due_date"`
+	Reference    *string    `json:"reference"`
+	Notes        *string    `json:"notes"`
+	PaymentTerms *string    `json:"payment_terms"`
+	// Currency defaults to the client's on creation
+	Currency *models.Currency `json:"currency"`
+}
+
+func (in *APIInvoiceInput) apply(i *models.Invoice) {
+	set(&i.ClientID, in.ClientID)
+	set(&i.IssueDate, in.IssueDate)
+	set(&i.DueDate, in.DueDate)
+	set(&i.Reference, in.Reference)
+	set(&i.Notes, in.Notes)
+	set(&i.PaymentTerms, in.PaymentTerms)
+	set(&i.Currency, in.Currency)
+}
+
+// APIItemInput holds the writable fields of an invoice item. On creation,
+// a product_id fills the fields that are not given from the product. kind
+// is line (the default), section or subtotal; discount_rate is a fraction.
+type APIItemInput struct {
+	ProductID      *uint            `json:"product_id"`
+	Kind           *models.ItemKind `json:"kind"`
+	Description    *string          `json:"description"`
+	Quantity       *float64         `json:"quantity"`
+	UnitPrice      *models.Money    `json:"unit_price"`
+	Unit           *string          `json:"unit"`
+	VATRate        *float64         `json:"vat_rate"`
+	DiscountRate   *float64         `json:"discount_rate"`
+	DiscountAmount *models.Money    `json:"discount_amount"`
+	Position       *int             `json:"position"`
+}
+
+func (in *APIItemInput) apply(item *models.InvoiceItem) {
+	set(&item.Kind, in.Kind)
+	set(&item.Description, in.Description)
+	set(&item.Quantity, in.Quantity)
+	set(&item.UnitPrice, in.UnitPrice)
+	set(&item.Unit, in.Unit)
+	set(&item.VATRate, in.VATRate)
+	set(&item.DiscountRate, in.DiscountRate)
+	set(&item.DiscountAmount, in.DiscountAmount)
+	set(&item.Position, in.Position)
+}
+
+// List returns the user's invoices and credit notes, without items.
+// Query: status, client_id, cursor, limit.
+func (h *APIInvoiceHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, _ := principal.UserIDFromContext(r.Context())
+
+	query := h.db.Where("user_id = ?", userID)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if clientID := r.URL.Query().Get("client_id"); clientID != "" {
+		query = query.Where("client_id = ?", clientID)
+	}
+
+	var invoices []models.Invoice
+	next, err := paginate(r, query, &invoices, func(i *models.Invoice) uint { return i.ID })
+	writePage(w, invoices, next, err)
+}
+
+func (h *APIInvoiceHandler) Get(w http.ResponseWriter, r *http.Request) {
+	var invoice models.Invoice
+	if !h.load(w, r, gate.ActionView, &invoice) {
+		return
+	}
+	httpx.JSON(w, http.StatusOK, newAPIInvoice(&invoice))
+}
+
+// Create creates a draft invoice. Numbers are assigned at finalization.
+func (h *APIInvoiceHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := principal.UserIDFromContext(r.Context())
+
+	var in APIInvoiceInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	now := time.Now()
+	invoice := models.Invoice{
+		UserID:    userID,
+		Number:    "DRAFT-" + now.Format("20060102-150405"),
+		IssueDate: now,
+		DueDate:   now.AddDate(0, 0, 30),
+		Status:    models.InvoiceStatusDraft,
+		Rounding:  h.invoices.RoundingPolicy(userID),
+	}
+	in.apply(&invoice)
+
+	if h.save(w, r, &invoice, http.StatusCreated) {
+		h.webhooks.Emit(userID, models.WebhookInvoiceCreated, invoice.ID)
+	}
+}
+
+// Update edits a draft invoice.
+func (h *APIInvoiceHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var invoice models.Invoice
+	if !h.load(w, r, gate.ActionUpdate, &invoice) || !h.editable(w, &invoice) {
+		return
+	}
+
+	var in APIInvoiceInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	in.apply(&invoice)
+	invoice.Client = nil
+
+	h.save(w, r, &invoice, http.StatusOK)
+}
+
+// Delete deletes a draft invoice.
+func (h *APIInvoiceHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	var invoice models.Invoice
+	if !h.load(w, r, gate.ActionDelete, &invoice) || !h.editable(w, &invoice) {
+		return
+	}
+	if err := h.db.Delete(&invoice).Error; err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Finalize numbers a draft invoice and locks it.
+func (h *APIInvoiceHandler) Finalize(w http.ResponseWriter, r *http.Request) {
+	userID, _ := principal.UserIDFromContext(r.Context())
+
+	var invoice models.Invoice
+	if !h.load(w, r, "finalize", &invoice) {
+		return
+	}
+
+	finalized, err := h.invoices.Finalize(userID, invoice.ID)
+	var invalid *einvoice.ValidationError
+	switch {
+	case errors.Is(err, services.ErrInvoiceNotDraft):
+		httpx.JSONError(w, http.StatusConflict, "invoice_not_draft", nil)
+		return
+	case errors.Is(err, services.ErrInvoiceEmpty):
+		httpx.JSONError(w, http.StatusBadRequest, "invoice_empty", nil)
+		return
+	case errors.Is(err, services.ErrDepositsPending), errors.Is(err, services.ErrDepositExceeds), errors.Is(err, services.ErrDepositParentFinal):
+		httpx.JSONError(w, http.StatusConflict, "deposits_conflict", nil)
+		return
+	case errors.Is(err, services.ErrNoExchangeRate):
+		httpx.JSONError(w, http.StatusConflict, "exchange_rate_missing", nil)
+		return
+	case errors.As(err, &invalid):
+		httpx.JSONError(w, http.StatusUnprocessableEntity, "invoice_not_compliant", invalid.Violations)
+		return
+	case err != nil:
+		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+		return
+	}
+
+	h.archive.ArchiveFinalized(r.Context(), userID, finalized.ID)
+	httpx.JSON(w, http.StatusOK, newAPIInvoice(finalized))
+	h.webhooks.Emit(userID, models.WebhookInvoiceFinalized, finalized.ID)
+}
+
+// PDF downloads the PDF of an invoice.
+func (h *APIInvoiceHandler) PDF(w http.ResponseWriter, r *http.Request) {
+	var invoice models.Invoice
+	if !h.load(w, r, gate.ActionView, &invoice) {
+		return
+	}
+
+	pdfBytes, err := h.archive.PDF(r.Context(), &invoice)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, "pdf_error", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"invoice-%s.pdf\"", invoice.Number))
+	w.Write(pdfBytes)
+}
+
+// ListItems returns the items of an invoice.
+func (h *APIInvoiceHandler) ListItems(w http.ResponseWriter, r *http.Request) {
+	var invoice models.Invoice
+	if !h.load(w, r, gate.ActionView, &invoice) {
+		return
+	}
+	httpx.JSON(w, http.StatusOK, map[string]any{"data": invoice.Items})
+}
+
+// CreateItem adds an item to a draft invoice.
+func (h *APIInvoiceHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
+	userID, _ := principal.UserIDFromContext(r.Context())
+
+	var invoice models.Invoice
+	if !h.load(w, r, gate.ActionUpdate, &invoice) || !h.editable(w, &invoice) {
+		return
+	}
+
+	var in APIItemInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	item := models.InvoiceItem{InvoiceID: invoice.ID, Quantity: 1, Unit: "unit", Position: len(invoice.Items)}
+	if in.ProductID != nil {
+		var product models.Product
+		if err := h.db.Where("id = ? AND user_id = ?", *in.ProductID, userID).First(&product).Error; err != nil {
+			httpx.JSONError(w, http.StatusBadRequest, "validation_failed", map[string]string{"product_id": "not_found"})
+			return
+		}
+		item.ProductID = &product.ID
+		item.Description = product.Name
+		item.UnitPrice = product.UnitPrice
+		item.Unit = product.Unit
+		item.VATRate = product.VATRate
+	}
+	in.apply(&item)
+
+	h.saveItem(w, r, &item, http.StatusCreated)
+}
+
+// UpdateItem edits an item of a draft invoice. Its product cannot change.
+func (h *APIInvoiceHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	var invoice models.Invoice
+	if !h.load(w, r, gate.ActionUpdate, &invoice) || !h.editable(w, &invoice) {
+		return
+	}
+	item, ok := h.item(w, r, &invoice)
+	if !ok {
+		return
+	}
+
+	var in APIItemInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	if in.ProductID != nil {
+		httpx.JSONError(w, http.StatusBadRequest, "validation_failed", map[string]string{"product_id": "read_only"})
+		return
+	}
+	in.apply(item)
+
+	h.saveItem(w, r, item, http.StatusOK)
+}
+
+// DeleteItem removes an item from a draft invoice.
+func (h *APIInvoiceHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	var invoice models.Invoice
+	if !h.load(w, r, gate.ActionUpdate, &invoice) || !h.editable(w, &invoice) {
+		return
+	}
+	item, ok := h.item(w, r, &invoice)
+	if !ok {
+		return
+	}
+	if err := h.db.Delete(item).Error; err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// load loads the invoice of the path with its client and items.
+func (h *APIInvoiceHandler) load(w http.ResponseWriter, r *http.Request, action gate.Action, invoice *models.Invoice) bool {
+	db := h.db.Preload("Client").Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position, id")
+	})
+	return loadOwned(w, r, db, h.authz, "invoice", action, invoice)
+}
+
+func (h *APIInvoiceHandler) editable(w http.ResponseWriter, invoice *models.Invoice) bool {
+	if !invoice.CanEdit() {
+		httpx.JSONError(w, http.StatusConflict, "invoice_not_draft", nil)
+		return false
+	}
+	return true
+}
+
+// item finds the path item among the items of an invoice.
+func (h *APIInvoiceHandler) item(w http.ResponseWriter, r *http.Request, invoice *models.Invoice) (*models.InvoiceItem, bool) {
+	itemID, _ := strconv.ParseUint(r.PathValue("item_id"), 10, 64)
+	for n := range invoice.Items {
+		if uint64(invoice.Items[n].ID) == itemID {
+			return &invoice.Items[n], true
+		}
+	}
+	httpx.JSONError(w, http.StatusNotFound, "not_found", nil)
+	return nil, false
+}
+
+// save validates and stores a draft invoice, answering with it and status.
+// It returns false if an error was answered instead.
+func (h *APIInvoiceHandler) save(w http.ResponseWriter, r *http.Request, invoice *models.Invoice, status int) bool {
+	userID, _ := principal.UserIDFromContext(r.Context())
+
+	v := make(validation.Violations)
+	var client models.Client
+	if invoice.ClientID == 0 {
+		v["client_id"] = "required"
+	} else if err := h.db.Where("id = ? AND user_id = ?", invoice.ClientID, userID).First(&client).Error; err != nil {
+		v["client_id"] = "not_found"
+	}
+	if invoice.DueDate.Before(invoice.IssueDate) {
+		v["due_date"] = "before_issue_date"
+	}
+	if invoice.Currency == "" && v.Empty() {
+		invoice.Currency = h.invoices.Currency(userID, invoice.ClientID)
+	}
+	if !invoice.Currency.OrDefault().IsValid() {
+		v["currency"] = "unsupported"
+	}
+	if !v.Empty() {
+		httpx.JSONError(w, http.StatusBadRequest, "validation_failed", v)
+		return false
+	}
+
+	if err := h.db.Omit("Client", "Items").Save(invoice).Error; err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+		return false
+	}
+	invoice.Client = &client
+	httpx.JSON(w, status, newAPIInvoice(invoice))
+	return true
+}
+
+// saveItem validates and stores an invoice item, answering with it and status.
+func (h *APIInvoiceHandler) saveItem(w http.ResponseWriter, r *http.Request, item *models.InvoiceItem, status int) {
+	userID, _ := principal.UserIDFromContext(r.Context())
+
+	v := make(validation.Violations)
+	services.ValidateItem(item, v)
+	if !v.Empty() {
+		httpx.JSONError(w, http.StatusBadRequest, "validation_failed", v)
+		return
+	}
+
+	// Businesses under the VAT franchise never charge VAT
+	var company models.CompanySettings
+	h.db.Where("user_id = ?", userID).Limit(1).Find(&company)
+	if company.VATExempt {
+		item.VATRate = 0
+	}
+
+	if err := h.db.Omit("Product", "Invoice").Save(item).Error; err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+		return
+	}
+	httpx.JSON(w, status, item)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/diewo77/go-gate"
+	"github.com/diewo77/go-invoices/httpx"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/policy/principal"
+	"github.com/diewo77/go-invoices/validation"
+	"gorm.io/gorm"
+)
+
+// APIProductHandler serves the products of the JSON API.
+type APIProductHandler struct {
+	db    *gorm.DB
+	authz Authorizer
+}
+
+func NewAPIProductHandler(db *gorm.DB, authz Authorizer) *APIProductHandler {
+	return &APIProductHandler{db: db, authz: authz}
+}
+
+// APIProductInput holds the writable fields of a product. Absent fields are
+// left unchanged on update. unit_price is in euros, vat_rate a fraction.
+type APIProductInput struct {
+	Code        *string       `json:"code"`
+	Name        *string       `json:"name"`
+	Description *string       `json:"description"`
+	UnitPrice   *models.Money `json:"unit_price"`
+	Unit        *string       `json:"unit"`
+	VATRate     *float64      `json:"vat_rate"`
+	Category    *string       `json:"category"`
+	IsActive    *bool         `json:"is_active"`
+}
+
+func (in *APIProductInput) apply(p *models.Product) {
+	set(&p.Code, in.Code)
+	p.Code = strings.ToUpper(p.Code)
+	set(&p.Name, in.Name)
+	set(&p.Description, in.Description)
+	set(&p.UnitPrice, in.UnitPrice)
+	set(&p.Unit, in.Unit)
+	set(&p.VATRate, in.VATRate)
+	set(&p.Category, in.Category)
+	set(&p.IsActive, in.IsActive)
+}
+
+// List returns the user's products. Query: q (code or name), cursor, limit.
+func (h *APIProductHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, _ := principal.UserIDFromContext(r.Context())
+
+	query := h.db.Where("user_id = ?", userID)
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		query = query.Where("code ILIKE ? OR name ILIKE ?", "%"+q+"%", "%"+q+"%")
+	}
+
+	var products []models.Product
+	next, err := paginate(r, query, &products, func(p *models.Product) uint { return p.ID })
+	writePage(w, products, next, err)
+}
+
+func (h *APIProductHandler) Get(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if !loadOwned(w, r, h.db, h.authz, "product", gate.ActionView, &product) {
+		return
+	}
+	httpx.JSON(w, http.StatusOK, product)
+}
+
+func (h *APIProductHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := principal.UserIDFromContext(r.Context())
+
+	var in APIProductInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	product := models.Product{UserID: userID, Unit: "unit", VATRate: 0.20, IsActive: true}
+	in.apply(&product)
+
+	h.save(w, &product, http.StatusCreated)
+}
+
+func (h *APIProductHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if !loadOwned(w, r, h.db, h.authz, "product", gate.ActionUpdate, &product) {
+		return
+	}
+
+	var in APIProductInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	in.apply(&product)
+
+	h.save(w, &product, http.StatusOK)
+}
+
+func (h *APIProductHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if !loadOwned(w, r, h.db, h.authz, "product", gate.ActionDelete, &product) {
+		return
+	}
+	if err := h.db.Delete(&product).Error; err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// save validates and stores a product, answering with it and status.
+func (h *APIProductHandler) save(w http.ResponseWriter, product *models.Product, status int) {
+	v := make(validation.Violations)
+	validation.Required("code", product.Code, v)
+	validation.Required("name", product.Name, v)
+	validation.PositiveFloat("unit_price", product.UnitPrice.Float64(), v)
+	if product.VATRate < 0 || product.VATRate >= 1 {
+		v["vat_rate"] = "must be a fraction between 0 and 1"
+	}
+	if !v.Empty() {
+		httpx.JSONError(w, http.StatusBadRequest, "validation_failed", v)
+		return
+	}
+
+	if err := h.db.Save(product).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "UNIQUE") {
+			httpx.JSONError(w, http.StatusConflict, "code_already_exists", nil)
+			return
+		}
+		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+		return
+	}
+	httpx.JSON(w, status, product)
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/diewo77/go-gate"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/policy/principal"
+	"github.com/diewo77/go-invoices/internal/services"
+	"gorm.io/gorm"
+)
+
+// ownerAuthorizer mimics the ownership policy of the gate.
+type ownerAuthorizer struct{}
+
+func (ownerAuthorizer) Authorize(ctx context.Context, _ gate.Action, _ string, resource any) error {
+	userID, _ := principal.UserIDFromContext(ctx)
+	if o, ok := resource.(interface{ GetUserID() uint }); ok && o.GetUserID() == userID {
+		return nil
+	}
+	return gate.ErrUnauthorized
+}
+
+func setupAPITestDB(t *testing.T) *gorm.DB {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Product{},
+		&models.Invoice{}, &models.InvoiceItem{}, &models.Payment{},
+		&models.WebhookEndpoint{}, &models.WebhookDelivery{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+// apiRequest serves a JSON request as userID, with path values set.
+func apiRequest(t *testing.T, handler http.HandlerFunc, userID uint, method, target, body string, pathValues map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range pathValues {
+		req.SetPathValue(k, v)
+	}
+	req = req.WithContext(principal.WithAPIToken(req.Context(), &models.APIToken{UserID: userID}))
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func decodeBody(t *testing.T, rr *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.NewDecoder(rr.Body).Decode(v); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+}
+
+func TestAPIClientHandler_CRUD(t *testing.T) {
+	db := setupAPITestDB(t)
+	h := NewAPIClientHandler(db, ownerAuthorizer{})
+
+	rr := apiRequest(t, h.Create, 1, http.MethodPost, "/api/v1/clients", `{"name":"Globex","vat_number":"FR98765432100"}`, nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rr.Code, rr.Body)
+	}
+	var client models.Client
+	decodeBody(t, rr, &client)
+	if client.ID == 0 || client.UserID != 1 || client.VATNumber != "FR98765432100" {
+		t.Fatalf("created client = %+v", client)
+	}
+	id := map[string]string{"id": "1"}
+
+	rr = apiRequest(t, h.Update, 1, http.MethodPatch, "/api/v1/clients/1", `{"city":"Lyon"}`, id)
+	decodeBody(t, rr, &client)
+	if rr.Code != http.StatusOK || client.City != "Lyon" || client.Name != "Globex" {
+		t.Errorf("update: %d %+v", rr.Code, client)
+	}
+
+	if rr := apiRequest(t, h.Get, 2, http.MethodGet, "/api/v1/clients/1", "", id); rr.Code != http.StatusNotFound {
+		t.Errorf("other user: expected 404, got %d", rr.Code)
+	}
+	if rr := apiRequest(t, h.Delete, 2, http.MethodDelete, "/api/v1/clients/1", "", id); rr.Code != http.StatusNotFound {
+		t.Errorf("other user delete: expected 404, got %d", rr.Code)
+	}
+	if rr := apiRequest(t, h.Delete, 1, http.MethodDelete, "/api/v1/clients/1", "", id); rr.Code != http.StatusNoContent {
+		t.Errorf("delete: expected 204, got %d", rr.Code)
+	}
+	if rr := apiRequest(t, h.Get, 1, http.MethodGet, "/api/v1/clients/1", "", id); rr.Code != http.StatusNotFound {
+		t.Errorf("deleted: expected 404, got %d", rr.Code)
+	}
+}
+
+func TestAPIClientHandler_Errors(t *testing.T) {
+	db := setupAPITestDB(t)
+	h := NewAPIClientHandler(db, ownerAuthorizer{})
+
+	tests := []struct {
+		name, body string
+		code       string
+	}{
+		{"missing name", `{"email":"a@b.test"}`, "validation_failed"},
+		{"unknown field", `{"name":"x","user_id":2}`, "invalid_json"},
+		{"malformed", `{"name":`, "invalid_json"},
+	}
+	for _, tt := range tests {
+		rr := apiRequest(t, h.Create, 1, http.MethodPost, "/api/v1/clients", tt.body, nil)
+		var body struct {
+			Error string `json:"error"`
+		}
+		decodeBody(t, rr, &body)
+		if rr.Code != http.StatusBadRequest || body.Error != tt.code {
+			t.Errorf("%s: got %d %q, want 400 %q", tt.name, rr.Code, body.Error, tt.code)
+		}
+	}
+}
+
+func TestAPIClientHandler_ListCursor(t *testing.T) {
+	db := setupAPITestDB(t)
+	for _, name := range []string{"A", "B", "C"} {
+		db.Create(&models.Client{UserID: 1, Name: name})
+	}
+	db.Create(&models.Client{UserID: 2, Name: "Other"})
+	h := NewAPIClientHandler(db, ownerAuthorizer{})
+
+	var page struct {
+		Data       []models.Client `json:"data"`
+		NextCursor string          `json:"next_cursor"`
+	}
+	rr := apiRequest(t, h.List, 1, http.MethodGet, "/api/v1/clients?limit=2", "", nil)
+	decodeBody(t, rr, &page)
+	if len(page.Data) != 2 || page.Data[0].Name != "C" || page.NextCursor == "" {
+		t.Fatalf("first page = %+v", page)
+	}
+
+	rr = apiRequest(t, h.List, 1, http.MethodGet, "/api/v1/clients?limit=2&cursor="+page.NextCursor, "", nil)
+	page.NextCursor = ""
+	decodeBody(t, rr, &page)
+	if len(page.Data) != 1 || page.Data[0].Name != "A" || page.NextCursor != "" {
+		t.Fatalf("last page = %+v", page)
+	}
+
+	if rr := apiRequest(t, h.List, 1, http.MethodGet, "/api/v1/clients?cursor=!!", "", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid cursor: expected 400, got %d", rr.Code)
+	}
+}
+
+func TestAPIInvoiceHandler_DraftLifecycle(t *testing.T) {
+	db := setupAPITestDB(t)
+	db.Create(&models.Client{UserID: 1, Name: "Globex"})
+	db.Create(&models.Client{UserID: 2, Name: "Not mine"})
+	db.Create(&models.Product{UserID: 1, Code: "CONS", Name: "Consulting", UnitPrice: 50000, Unit: "day", VATRate: 0.20})
+	invoices := services.NewInvoiceService(db, services.NewNumberingService(db), services.NewManualRateProvider(db))
+	h := NewAPIInvoiceHandler(db, ownerAuthorizer{}, invoices, nil, services.NewWebhookService(db))
+
+	if rr := apiRequest(t, h.Create, 1, http.MethodPost, "/api/v1/invoices", `{"client_id":2}`, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("foreign client: expected 400, got %d", rr.Code)
+	}
+	rr := apiRequest(t, h.Create, 1, http.MethodPost, "/api/v1/invoices", `{"client_id":1,"reference":"PO-1"}`, nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", rr.Code, rr.Body)
+	}
+	id := map[string]string{"id": "1"}
+
+	rr = apiRequest(t, h.CreateItem, 1, http.MethodPost, "/api/v1/invoices/1/items", `{"product_id":1}`, id)
+	var item models.InvoiceItem
+	decodeBody(t, rr, &item)
+	if rr.Code != http.StatusCreated || item.Description != "Consulting" || item.UnitPrice != 50000 || item.Unit != "day" {
+		t.Fatalf("create item: %d %+v", rr.Code, item)
+	}
+
+	itemID := map[string]string{"id": "1", "item_id": "1"}
+	if rr := apiRequest(t, h.UpdateItem, 1, http.MethodPatch, "/api/v1/invoices/1/items/1", `{"quantity":3}`, itemID); rr.Code != http.StatusOK {
+		t.Fatalf("update item: expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	rr = apiRequest(t, h.Get, 1, http.MethodGet, "/api/v1/invoices/1", "", id)
+	var invoice struct {
+		Reference string               `json:"reference"`
+		Items     []models.InvoiceItem `json:"items"`
+		TotalHT   json.RawMessage      `json:"total_ht"`
+		TotalTTC  json.RawMessage      `json:"total_ttc"`
+	}
+	decodeBody(t, rr, &invoice)
+	if invoice.Reference != "PO-1" || len(invoice.Items) != 1 || string(invoice.TotalHT) != "1500.00" || string(invoice.TotalTTC) != "1800.00" {
+		t.Errorf("invoice = %+v", invoice)
+	}
+
+	db.Model(&models.Invoice{}).Where("id = 1").Update("status", models.InvoiceStatusFinal)
+	if rr := apiRequest(t, h.UpdateItem, 1, http.MethodPatch, "/api/v1/invoices/1/items/1", `{"quantity":1}`, itemID); rr.Code != http.StatusConflict {
+		t.Errorf("final invoice: expected 409, got %d", rr.Code)
+	}
+	if rr := apiRequest(t, h.Delete, 1, http.MethodDelete, "/api/v1/invoices/1", "", id); rr.Code != http.StatusConflict {
+		t.Errorf("delete final invoice: expected 409, got %d", rr.Code)
+	}
+}
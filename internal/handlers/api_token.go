@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/view"
+	"gorm.io/gorm"
+)
+
+// apiTokenResources are the resource types exposed by the API, whose
+// permissions can be granted to tokens.
+var apiTokenResources = []string{"client", "product", "invoice"}
+
+// APITokenHandler manages the API tokens of the current user.
+type APITokenHandler struct {
+	db     *gorm.DB
+	tokens *services.APITokenService
+}
+
+func NewAPITokenHandler(db *gorm.DB, tokens *services.APITokenService) *APITokenHandler {
+	return &APITokenHandler{db: db, tokens: tokens}
+}
+
+// List shows the user's tokens and the form to create one.
+func (h *APITokenHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, "", "")
+}
+
+// Create issues a token and shows it once.
+func (h *APITokenHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	_, plaintext, err := h.tokens.Create(userID, r.FormValue("name"), r.Form["scopes"])
+	switch {
+	case errors.Is(err, services.ErrAPITokenName):
+		h.render(w, r, "", "api_token_name_required")
+		return
+	case errors.Is(err, services.ErrInvalidTokenScope):
+		h.render(w, r, "", "api_token_scope_required")
+		return
+	case err != nil:
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, r, plaintext, "")
+}
+
+// Revoke disables a token.
+func (h *APITokenHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	err = h.tokens.Revoke(userID, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/api-tokens", http.StatusSeeOther)
+}
+
+func (h *APITokenHandler) render(w http.ResponseWriter, r *http.Request, newToken, errKey string) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	tokens, err := h.tokens.List(userID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var permissions []models.Permission
+	h.db.Where("resource_type IN ?", apiTokenResources).
+		Order("resource_type, action").
+		Find(&permissions)
+
+	view.Render(w, r, "company/api_tokens.html", map[string]any{
+		"Tokens":      tokens,
+		"Permissions": permissions,
+		"NewToken":    newToken,
+		"Error":       errKey,
+	})
+}
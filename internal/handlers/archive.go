@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/view"
+)
+
+// ArchiveHandler reports on the archived invoices of the current user.
+type ArchiveHandler struct {
+	archive *services.ArchiveService
+}
+
+func NewArchiveHandler(archive *services.ArchiveService) *ArchiveHandler {
+	return &ArchiveHandler{archive: archive}
+}
+
+// Retention shows the retention report. With check=1 in the query string,
+// every archived document is read back and its checksum verified.
+func (h *ArchiveHandler) Retention(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, map[string]any{})
+}
+
+// ArchiveMissing archives the finalized invoices that are not yet, and
+// shows the retention report.
+func (h *ArchiveHandler) ArchiveMissing(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	n, err := h.archive.ArchiveMissing(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to archive invoices (%d archived): %v", n, err), http.StatusInternalServerError)
+		return
+	}
+	h.render(w, r, map[string]any{"ArchiveDone": true, "Archived": n})
+}
+
+func (h *ArchiveHandler) render(w http.ResponseWriter, r *http.Request, data map[string]any) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	now := time.Now()
+	report, err := h.archive.Retention(r.Context(), userID, now, r.URL.Query().Get("check") == "1")
+	if err != nil {
+		http.Error(w, "Failed to compute retention report", http.StatusInternalServerError)
+		return
+	}
+	data["Report"] = report
+	data["Now"] = now
+	view.Render(w, r, "reports/retention.html", data)
+}
+
+// RetentionCSV downloads the retention report by year of issue as CSV.
+func (h *ArchiveHandler) RetentionCSV(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	now := time.Now()
+	report, err := h.archive.Retention(r.Context(), userID, now, false)
+	if err != nil {
+		http.Error(w, "Failed to compute retention report", http.StatusInternalServerError)
+		return
+	}
+
+	records := [][]string{{"year", "documents", "size", "retain_until", "expired"}}
+	for _, y := range report.Years {
+		records = append(records, []string{strconv.Itoa(y.Year), strconv.Itoa(y.Documents),
+			strconv.FormatInt(y.Size, 10), y.RetainUntil.Format("2006-01-02"), strconv.FormatBool(y.Expired)})
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"retention-%s.csv\"", now.Format("20060102")))
+	cw := csv.NewWriter(w)
+	cw.WriteAll(records)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/view"
+	"gorm.io/gorm"
+)
+
+// AuditHandler shows the audit log to admins and verifies its chain.
+type AuditHandler struct {
+	db    *gorm.DB
+	audit *services.AuditService
+}
+
+func NewAuditHandler(db *gorm.DB, audit *services.AuditService) *AuditHandler {
+	return &AuditHandler{db: db, audit: audit}
+}
+
+// List shows a page of the audit log, filtered by entity and actor.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, nil)
+}
+
+// Verify checks the whole chain and shows the outcome above the log.
+func (h *AuditHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	n, err := h.audit.Verify()
+	var chainErr *services.AuditChainError
+	if err != nil && !errors.As(err, &chainErr) {
+		http.Error(w, "Failed to verify audit log", http.StatusInternalServerError)
+		return
+	}
+	h.render(w, r, map[string]any{"Entries": n, "Error": chainErr})
+}
+
+func (h *AuditHandler) render(w http.ResponseWriter, r *http.Request, verification map[string]any) {
+	q := r.URL.Query()
+	entityID, _ := strconv.ParseUint(q.Get("entity_id"), 10, 64)
+	actorID, _ := strconv.ParseUint(q.Get("actor_id"), 10, 64)
+	filter := services.AuditFilter{EntityType: q.Get("entity_type"), EntityID: uint(entityID), ActorID: uint(actorID)}
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit := 50
+
+	entries, total, err := h.audit.List(filter, limit, (page-1)*limit)
+	if err != nil {
+		http.Error(w, "Failed to load audit log", http.StatusInternalServerError)
+		return
+	}
+
+	actorIDs := make([]uint, 0, len(entries))
+	for _, e := range entries {
+		actorIDs = append(actorIDs, e.ActorID)
+	}
+	var users []models.User
+	h.db.Where("id IN ?", actorIDs).Find(&users)
+	actors := make(map[uint]string, len(users))
+	for _, u := range users {
+		actors[u.ID] = u.Email
+	}
+
+	view.Render(w, r, "admin/audit/index.html", map[string]any{
+		"AuditEntries": entries,
+		"Actors":       actors,
+		"Entities":     services.AuditEntities(),
+		"Filter":       filter,
+		"Page":         page,
+		"Total":        total,
+		"Limit":        limit,
+		"Verification": verification,
+	})
+}
@@ -6,17 +6,19 @@ import (
 
 	"github.com/diewo77/go-invoices/auth"
 	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
 	"github.com/diewo77/go-invoices/validation"
 	"github.com/diewo77/go-invoices/view"
 	"gorm.io/gorm"
 )
 
 type ClientHandler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	invoices *services.InvoiceService
 }
 
-func NewClientHandler(db *gorm.DB) *ClientHandler {
-	return &ClientHandler{db: db}
+func NewClientHandler(db *gorm.DB, invoices *services.InvoiceService) *ClientHandler {
+	return &ClientHandler{db: db, invoices: invoices}
 }
 
 func (h *ClientHandler) List(w http.ResponseWriter, r *http.Request) {
@@ -51,7 +53,10 @@ func (h *ClientHandler) List(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ClientHandler) New(w http.ResponseWriter, r *http.Request) {
-	view.Render(w, r, "clients/new.html", nil)
+	view.Render(w, r, "clients/new.html", map[string]any{
+		"Client":     models.Client{},
+		"Currencies": models.Currencies,
+	})
 }
 
 func (h *ClientHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -69,23 +74,27 @@ func (h *ClientHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Country:    r.FormValue("country"),
 		SIRET:      r.FormValue("siret"),
 		VATNumber:  r.FormValue("vat_number"),
+		Currency:   formCurrency(r),
 	}
 
 	v := make(validation.Violations)
 	validation.Required("name", client.Name, v)
+	setCountryCode(&client, r.FormValue("country_code"), v)
 
 	if !v.Empty() {
 		view.Render(w, r, "clients/new.html", map[string]any{
-			"Client": client,
-			"Errors": v,
+			"Client":     client,
+			"Errors":     v,
+			"Currencies": models.Currencies,
 		})
 		return
 	}
 
 	if err := h.db.Create(&client).Error; err != nil {
 		view.Render(w, r, "clients/new.html", map[string]any{
-			"Client": client,
-			"Error":  "Failed to create client",
+			"Client":     client,
+			"Error":      "Failed to create client",
+			"Currencies": models.Currencies,
 		})
 		return
 	}
@@ -103,8 +112,15 @@ func (h *ClientHandler) View(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	balance, err := h.invoices.ClientBalance(userID, client.ID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
 	view.Render(w, r, "clients/view.html", map[string]any{
-		"Client": client,
+		"Client":  client,
+		"Balance": balance,
 	})
 }
 
@@ -119,7 +135,8 @@ func (h *ClientHandler) Edit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	view.Render(w, r, "clients/edit.html", map[string]any{
-		"Client": client,
+		"Client":     client,
+		"Currencies": models.Currencies,
 	})
 }
 
@@ -143,22 +160,26 @@ func (h *ClientHandler) Update(w http.ResponseWriter, r *http.Request) {
 	client.Country = r.FormValue("country")
 	client.SIRET = r.FormValue("siret")
 	client.VATNumber = r.FormValue("vat_number")
+	client.Currency = formCurrency(r)
 
 	v := make(validation.Violations)
 	validation.Required("name", client.Name, v)
+	setCountryCode(&client, r.FormValue("country_code"), v)
 
 	if !v.Empty() {
 		view.Render(w, r, "clients/edit.html", map[string]any{
-			"Client": client,
-			"Errors": v,
+			"Client":     client,
+			"Errors":     v,
+			"Currencies": models.Currencies,
 		})
 		return
 	}
 
 	if err := h.db.Save(&client).Error; err != nil {
 		view.Render(w, r, "clients/edit.html", map[string]any{
-			"Client": client,
-			"Error":  "Failed to update client",
+			"Client":     client,
+			"Error":      "Failed to update client",
+			"Currencies": models.Currencies,
 		})
 		return
 	}
@@ -177,3 +198,23 @@ func (h *ClientHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, "/clients", http.StatusSeeOther)
 }
+
+// setCountryCode sets the ISO country code of a client, or records a
+// violation if it is not two letters.
+func setCountryCode(client *models.Client, value string, v validation.Violations) {
+	code, ok := models.ParseCountryCode(value)
+	if !ok {
+		v["country_code"] = "must be 2 letters"
+	}
+	client.CountryCode = code
+}
+
+// formCurrency reads the currency field of a form, empty if unset or not
+// supported.
+func formCurrency(r *http.Request) models.Currency {
+	currency, ok := models.ParseCurrency(r.FormValue("currency"))
+	if !ok {
+		return ""
+	}
+	return currency
+}
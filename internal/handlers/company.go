@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/diewo77/go-invoices/auth"
 	"github.com/diewo77/go-invoices/internal/models"
@@ -35,10 +37,17 @@ func (h *CompanyHandler) Edit(w http.ResponseWriter, r *http.Request) {
 	// If not found, we'll just show an empty form (or default values)
 	if err == gorm.ErrRecordNotFound {
 		settings.UserID = userID
+		settings.PaymentTermDays = 30
+		settings.ClientAccount = models.DefaultClientAccount
+		settings.RevenueAccount = models.DefaultRevenueAccount
+		settings.VATAccount = models.DefaultVATAccount
+		settings.BankAccount = models.DefaultBankAccount
 	}
 
 	view.Render(w, r, "company/edit.html", map[string]any{
-		"Settings": settings,
+		"Settings":         &settings,
+		"RoundingPolicies": models.RoundingPolicies,
+		"Currencies":       models.Currencies,
 	})
 }
 
@@ -75,10 +84,65 @@ func (h *CompanyHandler) Update(w http.ResponseWriter, r *http.Request) {
 	settings.City = r.FormValue("city")
 	settings.PostalCode = r.FormValue("postal_code")
 	settings.Country = r.FormValue("country")
+	countryCode, ok := models.ParseCountryCode(r.FormValue("country_code"))
+	if !ok {
+		http.Error(w, "Country code must be 2 letters", http.StatusBadRequest)
+		return
+	}
+	settings.CountryCode = countryCode
 	settings.SIRET = r.FormValue("siret")
 	settings.VATNumber = r.FormValue("vat_number")
 	settings.RCS = r.FormValue("rcs")
 	settings.Capital = r.FormValue("capital")
+	settings.VATExempt = r.FormValue("vat_exempt") == "on"
+	settings.Rounding = models.RoundingPolicy(r.FormValue("rounding")).OrDefault()
+	if currency, ok := models.ParseCurrency(r.FormValue("currency")); ok {
+		settings.Currency = currency
+	}
+
+	schedule, err := models.ParseReminderSchedule(r.FormValue("reminder_schedule"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	settings.ReminderSchedule = models.FormatReminderSchedule(schedule)
+
+	termDays, err := strconv.Atoi(r.FormValue("payment_term_days"))
+	if err != nil || termDays < 0 || termDays > 60 {
+		http.Error(w, "Payment term must be between 0 and 60 days", http.StatusBadRequest)
+		return
+	}
+	settings.PaymentTermDays = termDays
+	settings.PaymentTermEndOfMonth = r.FormValue("payment_term_end_of_month") == "on"
+
+	// The rate is entered in percent; empty means the legal default
+	settings.LatePenaltyRate = 0
+	if v := strings.TrimSpace(r.FormValue("late_penalty_rate")); v != "" {
+		rate, err := strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64)
+		if err != nil || rate < 0 {
+			http.Error(w, "Invalid late penalty rate", http.StatusBadRequest)
+			return
+		}
+		settings.LatePenaltyRate = rate / 100
+	}
+
+	// Accounts left empty fall back to the chart of accounts defaults
+	account := func(field, def string) string {
+		if v := strings.TrimSpace(r.FormValue(field)); v != "" {
+			return v
+		}
+		return def
+	}
+	settings.ClientAccount = account("client_account", models.DefaultClientAccount)
+	settings.RevenueAccount = account("revenue_account", models.DefaultRevenueAccount)
+	settings.VATAccount = account("vat_account", models.DefaultVATAccount)
+	settings.BankAccount = account("bank_account", models.DefaultBankAccount)
+	vatAccounts, err := models.ParseVATAccounts(r.FormValue("vat_accounts"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	settings.VATAccounts = models.FormatVATAccounts(vatAccounts)
 
 	if err := h.db.Save(&settings).Error; err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
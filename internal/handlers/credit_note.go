@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/view"
+	"gorm.io/gorm"
+)
+
+// creditNoteLine is one original invoice line on the credit note form.
+type creditNoteLine struct {
+	Item      models.InvoiceItem
+	Remaining float64
+}
+
+// NewCreditNote shows the form to credit all or part of a finalized invoice.
+func (h *InvoiceHandler) NewCreditNote(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id := r.PathValue("id")
+
+	var invoice models.Invoice
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).Preload("Client").Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).First(&invoice).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !invoice.CanCredit() {
+		http.Redirect(w, r, "/invoices/"+id, http.StatusSeeOther)
+		return
+	}
+
+	h.renderCreditNoteForm(w, r, &invoice, "")
+}
+
+// CreateCreditNote issues a credit note for the submitted lines.
+func (h *InvoiceHandler) CreateCreditNote(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id := r.PathValue("id")
+
+	invoiceID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	req := services.CreditNoteRequest{
+		Full:       r.FormValue("full") == "on",
+		Quantities: make(map[uint]float64),
+		Reason:     strings.TrimSpace(r.FormValue("reason")),
+	}
+	for key := range r.PostForm {
+		itemID, ok := strings.CutPrefix(key, "qty_")
+		if !ok {
+			continue
+		}
+		iid, err := strconv.ParseUint(itemID, 10, 32)
+		if err != nil {
+			continue
+		}
+		value := r.PostForm.Get(key)
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		qty, err := parseDecimal(value)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		req.Quantities[uint(iid)] = qty
+	}
+
+	var before models.Invoice
+	h.db.Select("status").Where("id = ? AND user_id = ?", invoiceID, userID).Limit(1).Find(&before)
+
+	creditNote, err := h.creditNotes.Issue(userID, uint(invoiceID), req)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrInvoiceNotCreditable):
+		http.Redirect(w, r, "/invoices/"+id, http.StatusSeeOther)
+		return
+	case errors.Is(err, services.ErrCreditNoteEmpty), errors.Is(err, services.ErrCreditExceedsInvoice),
+		errors.Is(err, services.ErrInvalidCreditQuantity):
+		var invoice models.Invoice
+		if err := h.db.Where("id = ? AND user_id = ?", id, userID).Preload("Client").Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).First(&invoice).Error; err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		h.renderCreditNoteForm(w, r, &invoice, err.Error())
+		return
+	case err != nil:
+		http.Error(w, "Failed to issue credit note", http.StatusInternalServerError)
+		return
+	}
+	h.archive.ArchiveFinalized(r.Context(), userID, creditNote.ID)
+	emitSettlement(h.db, h.webhooks, userID, uint(invoiceID), before.Status)
+
+	http.Redirect(w, r, "/invoices/"+strconv.Itoa(int(creditNote.ID)), http.StatusSeeOther)
+}
+
+func (h *InvoiceHandler) renderCreditNoteForm(w http.ResponseWriter, r *http.Request, invoice *models.Invoice, formError string) {
+	remaining, err := h.creditNotes.Remaining(invoice)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	lines := make([]creditNoteLine, 0, len(invoice.Items))
+	for _, item := range invoice.Items {
+		if item.IsLine() {
+			lines = append(lines, creditNoteLine{Item: item, Remaining: remaining[item.ID]})
+		}
+	}
+
+	view.Render(w, r, "invoices/credit_note.html", map[string]any{
+		"Invoice": invoice,
+		"Lines":   lines,
+		"Error":   formError,
+	})
+}
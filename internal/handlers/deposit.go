@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"gorm.io/gorm"
+)
+
+// CreateDeposit issues a deposit invoice on a draft final invoice.
+func (h *InvoiceHandler) CreateDeposit(w http.ResponseWriter, r *http.Request) {
+	parentID, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	createDeposit(w, r, h.invoices, h.webhooks, services.DepositRequest{ParentInvoiceID: uint(parentID)})
+}
+
+// CreateDeposit issues a deposit invoice on a sent quote.
+func (h *QuoteHandler) CreateDeposit(w http.ResponseWriter, r *http.Request) {
+	quoteID, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	createDeposit(w, r, h.invoices, h.webhooks, services.DepositRequest{QuoteID: uint(quoteID)})
+}
+
+// createDeposit creates the deposit invoice of req for the percentage
+// posted in the "percent" field, and opens it.
+func createDeposit(w http.ResponseWriter, r *http.Request, invoices *services.InvoiceService, webhooks *services.WebhookService, req services.DepositRequest) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	req.Percent, _ = strconv.ParseFloat(r.FormValue("percent"), 64)
+
+	deposit, err := invoices.CreateDeposit(userID, req)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrInvalidDepositPercent), errors.Is(err, services.ErrInvoiceEmpty):
+		http.Error(w, "Cannot create deposit: "+err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrDepositNotAllowed), errors.Is(err, services.ErrDepositExceeds):
+		http.Error(w, "Cannot create deposit: "+err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to create deposit", http.StatusInternalServerError)
+		return
+	}
+	webhooks.Emit(userID, models.WebhookInvoiceCreated, deposit.ID)
+
+	http.Redirect(w, r, "/invoices/"+strconv.Itoa(int(deposit.ID))+"/edit", http.StatusSeeOther)
+}
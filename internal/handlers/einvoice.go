@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/einvoice"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/view"
+	"gorm.io/gorm"
+)
+
+// maxImportSize bounds uploaded e-invoice documents.
+const maxImportSize = 5 << 20
+
+// EInvoiceHandler exports invoices as UBL documents and imports UBL invoices.
+type EInvoiceHandler struct {
+	db        *gorm.DB
+	einvoices *services.EInvoiceService
+	webhooks  *services.WebhookService
+}
+
+func NewEInvoiceHandler(db *gorm.DB, einvoices *services.EInvoiceService, webhooks *services.WebhookService) *EInvoiceHandler {
+	return &EInvoiceHandler{db: db, einvoices: einvoices, webhooks: webhooks}
+}
+
+// UBL downloads a finalized invoice or credit note as a Peppol BIS UBL document.
+func (h *EInvoiceHandler) UBL(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id := r.PathValue("id")
+
+	var invoice models.Invoice
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Items.Product").
+		Preload("OriginalInvoice").
+		First(&invoice).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	out, err := h.einvoices.UBL(&invoice)
+	var invalid *einvoice.ValidationError
+	switch {
+	case errors.Is(err, services.ErrInvoiceNotFinal):
+		http.Error(w, "Only finalized invoices can be exported", http.StatusConflict)
+		return
+	case errors.As(err, &invalid):
+		http.Error(w, invalid.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		http.Error(w, "Failed to generate UBL: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"ubl-%s.xml\"", invoice.Number))
+	w.Write(out)
+}
+
+// ImportForm shows the UBL upload form.
+func (h *EInvoiceHandler) ImportForm(w http.ResponseWriter, r *http.Request) {
+	view.Render(w, r, "invoices/import.html", map[string]any{})
+}
+
+// Import creates a draft invoice from an uploaded UBL invoice and opens it
+// for review.
+func (h *EInvoiceHandler) Import(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		h.importError(w, r, "file_required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		h.importError(w, r, "file_too_large")
+		return
+	}
+
+	invoice, err := h.einvoices.ImportUBL(userID, data)
+	switch {
+	case errors.Is(err, services.ErrImportCreditNote):
+		h.importError(w, r, "import_credit_note")
+		return
+	case errors.Is(err, services.ErrInvoiceEmpty):
+		h.importError(w, r, "import_empty")
+		return
+	case errors.Is(err, services.ErrInvalidEInvoice):
+		h.importError(w, r, "import_invalid")
+		return
+	case err != nil:
+		http.Error(w, "Failed to import invoice", http.StatusInternalServerError)
+		return
+	}
+	h.webhooks.Emit(userID, models.WebhookInvoiceCreated, invoice.ID)
+
+	http.Redirect(w, r, "/invoices/"+strconv.Itoa(int(invoice.ID))+"/edit", http.StatusSeeOther)
+}
+
+func (h *EInvoiceHandler) importError(w http.ResponseWriter, r *http.Request, message string) {
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	view.Render(w, r, "invoices/import.html", map[string]any{
+		"Error": message,
+	})
+}
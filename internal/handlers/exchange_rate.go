@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/view"
+	"gorm.io/gorm"
+)
+
+// ExchangeRateHandler manages the exchange rates entered by the current
+// user, used to convert foreign-currency invoices at finalization.
+type ExchangeRateHandler struct {
+	rates    *services.ManualRateProvider
+	invoices *services.InvoiceService
+}
+
+func NewExchangeRateHandler(rates *services.ManualRateProvider, invoices *services.InvoiceService) *ExchangeRateHandler {
+	return &ExchangeRateHandler{rates: rates, invoices: invoices}
+}
+
+// List shows the user's rates and the form to enter one.
+func (h *ExchangeRateHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, "")
+}
+
+// Create records the rate of a currency to the base currency at a date.
+func (h *ExchangeRateHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	currency, ok := models.ParseCurrency(r.FormValue("currency"))
+	date, err := time.Parse("2006-01-02", r.FormValue("date"))
+	rate, rateErr := strconv.ParseFloat(strings.Replace(strings.TrimSpace(r.FormValue("rate")), ",", ".", 1), 64)
+	if !ok || err != nil || rateErr != nil {
+		h.render(w, r, "exchange_rate_invalid")
+		return
+	}
+
+	_, err = h.rates.Set(userID, currency, h.invoices.BaseCurrency(userID), date, rate)
+	switch {
+	case errors.Is(err, services.ErrInvalidExchangeRate):
+		h.render(w, r, "exchange_rate_invalid")
+		return
+	case err != nil:
+		http.Error(w, "Failed to save exchange rate", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/exchange-rates", http.StatusSeeOther)
+}
+
+// Delete removes a rate.
+func (h *ExchangeRateHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	err = h.rates.Delete(userID, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete exchange rate", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/exchange-rates", http.StatusSeeOther)
+}
+
+func (h *ExchangeRateHandler) render(w http.ResponseWriter, r *http.Request, errKey string) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	rates, err := h.rates.List(userID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	base := h.invoices.BaseCurrency(userID)
+	var currencies []models.Currency
+	for _, c := range models.Currencies {
+		if c != base {
+			currencies = append(currencies, c)
+		}
+	}
+
+	view.Render(w, r, "company/exchange_rates.html", map[string]any{
+		"Rates":        rates,
+		"BaseCurrency": base,
+		"Currencies":   currencies,
+		"Today":        time.Now().Format("2006-01-02"),
+		"Error":        errKey,
+	})
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/view"
+)
+
+// ImportHandler runs the import wizard of clients or products: upload a
+// CSV or XLSX file, map its columns to fields, preview the rows and their
+// errors, then import them all at once.
+//
+// The table read from the file travels between the steps as JSON in a
+// hidden field, so the wizard keeps no state on the server.
+type ImportHandler struct {
+	imports *services.ImportService
+	kind    services.ImportKind
+}
+
+func NewImportHandler(imports *services.ImportService, kind services.ImportKind) *ImportHandler {
+	return &ImportHandler{imports: imports, kind: kind}
+}
+
+// importField is a field of the mapping step.
+type importField struct {
+	Name     string
+	Required bool
+	Column   int
+}
+
+// Form shows the upload step.
+func (h *ImportHandler) Form(w http.ResponseWriter, r *http.Request) {
+	h.renderUpload(w, r, "")
+}
+
+// Upload reads the uploaded file and shows the mapping step, with the
+// columns whose header names a field already mapped.
+func (h *ImportHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		h.renderUpload(w, r, "file_required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		h.renderUpload(w, r, "file_too_large")
+		return
+	}
+
+	table, err := services.ReadTable(header.Filename, data)
+	switch {
+	case errors.Is(err, services.ErrImportEmpty):
+		h.renderUpload(w, r, "import_file_empty")
+		return
+	case errors.Is(err, services.ErrImportTooLarge):
+		h.renderUpload(w, r, "import_too_many_rows")
+		return
+	case err != nil:
+		h.renderUpload(w, r, "import_file_invalid")
+		return
+	}
+
+	h.renderMapping(w, r, table, h.kind.GuessMapping(table.Headers), "")
+}
+
+// Preview validates the rows under the chosen mapping.
+func (h *ImportHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	table, mapping, ok := h.bind(r)
+	if !ok {
+		h.renderUpload(w, r, "import_file_invalid")
+		return
+	}
+
+	result, err := h.imports.Preview(userID, h.kind, table, mapping)
+	if errors.Is(err, services.ErrImportUnmapped) {
+		h.renderMapping(w, r, table, mapping, "import_required_unmapped")
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to preview import", http.StatusInternalServerError)
+		return
+	}
+	h.renderPreview(w, r, table, mapping, result)
+}
+
+// Import imports every row, or shows the preview again if a row is
+// invalid.
+func (h *ImportHandler) Import(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	table, mapping, ok := h.bind(r)
+	if !ok {
+		h.renderUpload(w, r, "import_file_invalid")
+		return
+	}
+
+	result, err := h.imports.Import(userID, h.kind, table, mapping)
+	switch {
+	case errors.Is(err, services.ErrImportUnmapped):
+		h.renderMapping(w, r, table, mapping, "import_required_unmapped")
+		return
+	case errors.Is(err, services.ErrImportRowErrors):
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		h.renderPreview(w, r, table, mapping, result)
+		return
+	case err != nil:
+		http.Error(w, "Failed to import", http.StatusInternalServerError)
+		return
+	}
+
+	view.Render(w, r, "import/done.html", map[string]any{
+		"Kind":   h.kind,
+		"Result": result,
+	})
+}
+
+// bind reads the table and the mapping posted by the mapping and preview
+// steps. Fields mapped to no column are left out.
+func (h *ImportHandler) bind(r *http.Request) (*services.ImportTable, services.ImportMapping, bool) {
+	var table services.ImportTable
+	if err := json.Unmarshal([]byte(r.FormValue("table")), &table); err != nil || len(table.Rows) == 0 {
+		return nil, nil, false
+	}
+	if len(table.Rows) > services.MaxImportRows {
+		return nil, nil, false
+	}
+
+	mapping := make(services.ImportMapping)
+	for _, field := range h.kind.Fields() {
+		col, err := strconv.Atoi(r.FormValue("map_" + field))
+		if err == nil && col >= 0 && col < len(table.Headers) {
+			mapping[field] = col
+		}
+	}
+	return &table, mapping, true
+}
+
+func (h *ImportHandler) renderUpload(w http.ResponseWriter, r *http.Request, errKey string) {
+	if errKey != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	view.Render(w, r, "import/upload.html", map[string]any{
+		"Kind":  h.kind,
+		"Error": errKey,
+	})
+}
+
+func (h *ImportHandler) renderMapping(w http.ResponseWriter, r *http.Request, table *services.ImportTable, mapping services.ImportMapping, errKey string) {
+	var fields []importField
+	for _, name := range h.kind.Fields() {
+		col, ok := mapping[name]
+		if !ok {
+			col = -1
+		}
+		fields = append(fields, importField{Name: name, Required: h.kind.IsRequired(name), Column: col})
+	}
+	sample := table.Rows
+	if len(sample) > 5 {
+		sample = sample[:5]
+	}
+
+	tableJSON, _ := json.Marshal(table)
+	view.Render(w, r, "import/mapping.html", map[string]any{
+		"Kind":   h.kind,
+		"Fields": fields,
+		"Table":  table,
+		"Sample": sample,
+		"JSON":   string(tableJSON),
+		"Error":  errKey,
+	})
+}
+
+func (h *ImportHandler) renderPreview(w http.ResponseWriter, r *http.Request, table *services.ImportTable, mapping services.ImportMapping, result *services.ImportResult) {
+	var fields []importField
+	for _, name := range h.kind.Fields() {
+		if col, ok := mapping[name]; ok {
+			fields = append(fields, importField{Name: name, Required: h.kind.IsRequired(name), Column: col})
+		}
+	}
+
+	tableJSON, _ := json.Marshal(table)
+	view.Render(w, r, "import/preview.html", map[string]any{
+		"Kind":   h.kind,
+		"Fields": fields,
+		"Result": result,
+		"JSON":   string(tableJSON),
+	})
+}
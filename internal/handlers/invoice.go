@@ -1,25 +1,33 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/einvoice"
 	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
 	"github.com/diewo77/go-invoices/validation"
 	"github.com/diewo77/go-invoices/view"
-	"github.com/diewo77/go-pdf"
 	"gorm.io/gorm"
 )
 
 type InvoiceHandler struct {
-	db *gorm.DB
+	db          *gorm.DB
+	invoices    *services.InvoiceService
+	creditNotes *services.CreditNoteService
+	pdf         *services.PDFService
+	archive     *services.ArchiveService
+	webhooks    *services.WebhookService
+	emails      *services.InvoiceEmailService
 }
 
-func NewInvoiceHandler(db *gorm.DB) *InvoiceHandler {
-	return &InvoiceHandler{db: db}
+func NewInvoiceHandler(db *gorm.DB, invoices *services.InvoiceService, creditNotes *services.CreditNoteService, pdf *services.PDFService, archive *services.ArchiveService, webhooks *services.WebhookService, emails *services.InvoiceEmailService) *InvoiceHandler {
+	return &InvoiceHandler{db: db, invoices: invoices, creditNotes: creditNotes, pdf: pdf, archive: archive, webhooks: webhooks, emails: emails}
 }
 
 func (h *InvoiceHandler) List(w http.ResponseWriter, r *http.Request) {
@@ -50,6 +58,7 @@ func (h *InvoiceHandler) List(w http.ResponseWriter, r *http.Request) {
 		"Page":     page,
 		"Total":    total,
 		"Limit":    limit,
+		"Now":      time.Now(),
 	})
 }
 
@@ -84,6 +93,24 @@ func (h *InvoiceHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Notes:        r.FormValue("notes"),
 		PaymentTerms: r.FormValue("payment_terms"),
 		Status:       models.InvoiceStatusDraft,
+		Rounding:     h.invoices.RoundingPolicy(userID),
+	}
+
+	// Default to the client's currency and the company's payment terms
+	if currency, ok := models.ParseCurrency(r.FormValue("currency")); ok {
+		invoice.Currency = currency
+	} else {
+		invoice.Currency = h.invoices.Currency(userID, invoice.ClientID)
+	}
+	if invoice.IssueDate.IsZero() {
+		invoice.IssueDate = time.Now()
+	}
+	defaultDueDate, defaultTerms := h.invoices.PaymentTerms(userID, invoice.IssueDate)
+	if invoice.DueDate.IsZero() {
+		invoice.DueDate = defaultDueDate
+	}
+	if invoice.PaymentTerms == "" {
+		invoice.PaymentTerms = defaultTerms
 	}
 
 	// Generate a temporary number if empty
@@ -105,6 +132,7 @@ func (h *InvoiceHandler) Create(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to create invoice", http.StatusInternalServerError)
 		return
 	}
+	h.webhooks.Emit(userID, models.WebhookInvoiceCreated, invoice.ID)
 
 	http.Redirect(w, r, "/invoices/"+strconv.Itoa(int(invoice.ID))+"/edit", http.StatusSeeOther)
 }
@@ -114,22 +142,67 @@ func (h *InvoiceHandler) View(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
 	var invoice models.Invoice
-	if err := h.db.Where("id = ? AND user_id = ?", id, userID).Preload("Client").Preload("Items.Product").First(&invoice).Error; err != nil {
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Items.Product").
+		Preload("OriginalInvoice").
+		Preload("PenalizedInvoice").
+		Preload("CreditNotes.Items").
+		Preload("ParentInvoice").
+		Preload("Deposits.Items").
+		Preload("Payments").
+		First(&invoice).Error; err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
+	var company models.CompanySettings
+	h.db.Where("user_id = ?", userID).First(&company)
+
+	// Finalized invoices show the details they were issued with
+	invoice.UseSnapshots()
+	seller := invoice.Seller(&company)
+
+	var reminders []models.Reminder
+	h.db.Where("invoice_id = ?", invoice.ID).Order("level").Find(&reminders)
+
+	emails, _ := h.emails.History(userID, invoice.ID)
+
+	var penalties []models.Invoice
+	h.db.Where("penalized_invoice_id = ? AND user_id = ?", invoice.ID, userID).Order("id").Find(&penalties)
+	penalty, err := h.invoices.LatePenalty(userID, invoice.ID, time.Now())
+
 	view.Render(w, r, "invoices/view.html", map[string]any{
-		"Invoice": invoice,
+		"Invoice":   &invoice,
+		"Company":   seller,
+		"Reminders": reminders,
+		"Emails":    emails,
+		"Penalty":   penalty,
+		"Penalties": penalties,
+		// Overdue, but penalties cannot be computed without a rate
+		"PenaltyRateMissing": errors.Is(err, services.ErrNoPenaltyRate),
+		"Now":                time.Now(),
 	})
 }
 
 func (h *InvoiceHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	h.renderEdit(w, r, nil)
+}
+
+// renderEdit shows the edit page of the invoice of the path, with the
+// violations of the item form posted, if any.
+func (h *InvoiceHandler) renderEdit(w http.ResponseWriter, r *http.Request, v validation.Violations) {
 	userID, _ := auth.UserIDFromContext(r.Context())
 	id := r.PathValue("id")
 
 	var invoice models.Invoice
-	if err := h.db.Where("id = ? AND user_id = ?", id, userID).Preload("Client").Preload("Items.Product").First(&invoice).Error; err != nil {
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Items.Product").
+		Preload("Deposits.Items").
+		First(&invoice).Error; err != nil {
 		http.NotFound(w, r)
 		return
 	}
@@ -145,10 +218,16 @@ func (h *InvoiceHandler) Edit(w http.ResponseWriter, r *http.Request) {
 	var products []models.Product
 	h.db.Where("user_id = ?", userID).Order("name").Find(&products)
 
+	var company models.CompanySettings
+	h.db.Where("user_id = ?", userID).Limit(1).Find(&company)
+
 	view.Render(w, r, "invoices/edit.html", map[string]any{
-		"Invoice":  invoice,
-		"Clients":  clients,
-		"Products": products,
+		"Invoice":    &invoice,
+		"Clients":    clients,
+		"Products":   products,
+		"Company":    &company,
+		"Currencies": models.Currencies,
+		"Errors":     v,
 	})
 }
 
@@ -177,6 +256,9 @@ func (h *InvoiceHandler) Update(w http.ResponseWriter, r *http.Request) {
 	invoice.Reference = r.FormValue("reference")
 	invoice.Notes = r.FormValue("notes")
 	invoice.PaymentTerms = r.FormValue("payment_terms")
+	if currency, ok := models.ParseCurrency(r.FormValue("currency")); ok {
+		invoice.Currency = currency
+	}
 
 	if err := h.db.Save(&invoice).Error; err != nil {
 		http.Error(w, "Failed to update invoice", http.StatusInternalServerError)
@@ -213,32 +295,37 @@ func (h *InvoiceHandler) Finalize(w http.ResponseWriter, r *http.Request) {
 	userID, _ := auth.UserIDFromContext(r.Context())
 	id := r.PathValue("id")
 
-	var invoice models.Invoice
-	if err := h.db.Where("id = ? AND user_id = ?", id, userID).Preload("Items").First(&invoice).Error; err != nil {
+	invoiceID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	if !invoice.IsDraft() {
+	invoice, err := h.invoices.Finalize(userID, uint(invoiceID))
+	var invalid *einvoice.ValidationError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrInvoiceNotDraft):
 		http.Redirect(w, r, "/invoices/"+id, http.StatusSeeOther)
 		return
-	}
-
-	if len(invoice.Items) == 0 {
+	case errors.Is(err, services.ErrInvoiceEmpty):
 		http.Error(w, "Cannot finalize invoice with no items", http.StatusBadRequest)
 		return
-	}
-
-	// Generate final number
-	var count int64
-	h.db.Model(&models.Invoice{}).Where("user_id = ? AND status != ?", userID, models.InvoiceStatusDraft).Count(&count)
-	invoice.Number = time.Now().Format("2006") + "-" + strconv.FormatInt(count+1, 10)
-	invoice.Status = models.InvoiceStatusFinal
-
-	if err := h.db.Save(&invoice).Error; err != nil {
+	case errors.Is(err, services.ErrDepositsPending), errors.Is(err, services.ErrDepositExceeds), errors.Is(err, services.ErrDepositParentFinal),
+		errors.Is(err, services.ErrNoExchangeRate):
+		http.Error(w, "Cannot finalize invoice: "+err.Error(), http.StatusConflict)
+		return
+	case errors.As(err, &invalid):
+		http.Error(w, "Cannot finalize invoice: "+invalid.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
 		http.Error(w, "Failed to finalize invoice", http.StatusInternalServerError)
 		return
 	}
+	h.archive.ArchiveFinalized(r.Context(), userID, invoice.ID)
+	h.webhooks.Emit(userID, models.WebhookInvoiceFinalized, invoice.ID)
 
 	http.Redirect(w, r, "/invoices/"+id, http.StatusSeeOther)
 }
@@ -250,119 +337,62 @@ func (h *InvoiceHandler) PDF(w http.ResponseWriter, r *http.Request) {
 	var invoice models.Invoice
 	if err := h.db.Where("id = ? AND user_id = ?", id, userID).
 		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
 		Preload("Items.Product").
+		Preload("OriginalInvoice").
+		Preload("PenalizedInvoice").
 		First(&invoice).Error; err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	var company models.CompanySettings
-	if err := h.db.Where("user_id = ?", userID).First(&company).Error; err != nil {
-		// Fallback or error if company settings not found
-		company.Name = "My Company" // Minimal fallback
-	}
-
-	// Map to PDF data
-	pdfData := pdf.InvoiceData{
-		InvoiceNumber: invoice.Number,
-		Date:          invoice.IssueDate.Format("02/01/2006"),
-		DueDate:       invoice.DueDate.Format("02/01/2006"),
-		Total:         invoice.TotalHT(),
-		VAT:           invoice.TotalVAT(),
-		GrandTotal:    invoice.TotalTTC(),
-		Client: pdf.ClientData{
-			Name:    invoice.Client.Name,
-			Address: invoice.Client.FullAddress(),
-			Email:   invoice.Client.Email,
-		},
-		Company: pdf.CompanyData{
-			Name:    company.Name,
-			Address: company.Address + "\n" + company.PostalCode + " " + company.City,
-			LogoURL: company.LogoURL,
-		},
-	}
-
-	for _, item := range invoice.Items {
-		pdfData.Items = append(pdfData.Items, pdf.InvoiceItem{
-			Description: item.Description,
-			Quantity:    int(item.Quantity),
-			UnitPrice:   item.UnitPrice,
-			Total:       item.TotalHT(),
-		})
-	}
-
-	pdfBytes, err := pdf.InvoicePDF(pdfData)
+	pdfBytes, err := h.archive.PDF(r.Context(), &invoice)
 	if err != nil {
 		http.Error(w, "Failed to generate PDF: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	filename := "invoice-" + invoice.Number
+	if invoice.IsCreditNote() {
+		filename = "credit-note-" + invoice.Number
+	}
 	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"invoice-%s.pdf\"", invoice.Number))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.pdf\"", filename))
 	w.Write(pdfBytes)
 }
 
-func (h *InvoiceHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+// FacturX downloads the invoice as a Factur-X PDF (PDF/A-3 with embedded CII XML).
+func (h *InvoiceHandler) FacturX(w http.ResponseWriter, r *http.Request) {
 	userID, _ := auth.UserIDFromContext(r.Context())
 	id := r.PathValue("id")
 
 	var invoice models.Invoice
-	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&invoice).Error; err != nil {
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Items.Product").
+		Preload("OriginalInvoice").
+		Preload("PenalizedInvoice").
+		First(&invoice).Error; err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	if !invoice.CanEdit() {
-		http.Error(w, "Cannot edit finalized invoice", http.StatusForbidden)
-		return
-	}
-
-	productID, _ := strconv.ParseUint(r.FormValue("product_id"), 10, 32)
-	quantity, _ := strconv.ParseFloat(r.FormValue("quantity"), 64)
-
-	var product models.Product
-	if err := h.db.Where("id = ? AND user_id = ?", productID, userID).First(&product).Error; err != nil {
-		http.Error(w, "Product not found", http.StatusBadRequest)
-		return
-	}
-
-	item := models.InvoiceItem{
-		InvoiceID:   invoice.ID,
-		ProductID:   &product.ID,
-		Description: product.Name,
-		Quantity:    quantity,
-		UnitPrice:   product.UnitPrice,
-		VATRate:     product.VATRate,
-	}
-
-	if err := h.db.Create(&item).Error; err != nil {
-		http.Error(w, "Failed to add item", http.StatusInternalServerError)
-		return
-	}
-
-	http.Redirect(w, r, "/invoices/"+id+"/edit", http.StatusSeeOther)
-}
-
-func (h *InvoiceHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
-	userID, _ := auth.UserIDFromContext(r.Context())
-	id := r.PathValue("id")
-	itemID := r.PathValue("item_id")
-
-	var invoice models.Invoice
-	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&invoice).Error; err != nil {
-		http.NotFound(w, r)
+	pdfBytes, err := h.pdf.RenderFacturX(&invoice)
+	var invalid *einvoice.ValidationError
+	switch {
+	case errors.Is(err, services.ErrInvoiceNotFinal):
+		http.Error(w, "Only finalized invoices can be exported", http.StatusConflict)
 		return
-	}
-
-	if !invoice.CanEdit() {
-		http.Error(w, "Cannot edit finalized invoice", http.StatusForbidden)
+	case errors.As(err, &invalid):
+		http.Error(w, invalid.Error(), http.StatusUnprocessableEntity)
 		return
-	}
-
-	if err := h.db.Where("id = ? AND invoice_id = ?", itemID, invoice.ID).Delete(&models.InvoiceItem{}).Error; err != nil {
-		http.Error(w, "Failed to remove item", http.StatusInternalServerError)
+	case err != nil:
+		http.Error(w, "Failed to generate Factur-X: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	http.Redirect(w, r, "/invoices/"+id+"/edit", http.StatusSeeOther)
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"facturx-%s.pdf\"", invoice.Number))
+	w.Write(pdfBytes)
 }
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/services"
+	"gorm.io/gorm"
+)
+
+// Send emails a finalized invoice to its client with the PDF attached.
+func (h *InvoiceHandler) Send(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	_, err = h.emails.Send(r.Context(), userID, userID, uint(id), services.SendInvoiceRequest{
+		To:       r.FormValue("to"),
+		Message:  r.FormValue("message"),
+		MarkSent: r.FormValue("mark_sent") == "on",
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrInvoiceNotFinal):
+		http.Error(w, "Cannot send invoice: "+err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, services.ErrNoClientEmail), errors.Is(err, services.ErrInvalidRecipient):
+		http.Error(w, "Cannot send invoice: "+err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Failed to send invoice: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, "/invoices/"+strconv.Itoa(int(id)), http.StatusSeeOther)
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/validation"
+	"gorm.io/gorm"
+)
+
+// AddItem adds a line, a section title or a subtotal at the end of a draft
+// invoice. A line may take its product's description, price, unit and VAT
+// rate, the fields posted overriding them, or be a custom line without
+// product.
+func (h *InvoiceHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	invoice, ok := h.editableInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	item := models.InvoiceItem{
+		InvoiceID: invoice.ID,
+		Kind:      models.ItemKind(r.FormValue("kind")),
+		Quantity:  1,
+		Unit:      "unit",
+	}
+	if item.Kind == "" {
+		item.Kind = models.ItemKindLine
+	}
+	if productID := r.FormValue("product_id"); productID != "" && item.IsLine() {
+		var product models.Product
+		if err := h.db.Where("id = ? AND user_id = ?", productID, userID).First(&product).Error; err != nil {
+			http.Error(w, "Product not found", http.StatusBadRequest)
+			return
+		}
+		item.ProductID = &product.ID
+		item.Description = product.Name
+		item.UnitPrice = product.UnitPrice
+		item.Unit = product.Unit
+		item.VATRate = product.VATRate
+	}
+
+	var last struct{ Position *int }
+	h.db.Model(&models.InvoiceItem{}).Select("MAX(position) AS position").Where("invoice_id = ?", invoice.ID).Scan(&last)
+	if last.Position != nil {
+		item.Position = *last.Position + 1
+	}
+
+	h.saveItem(w, r, invoice, &item)
+}
+
+// UpdateItem edits an item of a draft invoice from the posted fields. Its
+// product and kind cannot change, and deposit deductions are left as
+// computed.
+func (h *InvoiceHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	invoice, ok := h.editableInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	var item models.InvoiceItem
+	if err := h.db.Where("id = ? AND invoice_id = ?", r.PathValue("item_id"), invoice.ID).First(&item).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if item.DepositInvoiceID != nil {
+		http.Error(w, "Cannot edit a deposit deduction", http.StatusForbidden)
+		return
+	}
+
+	h.saveItem(w, r, invoice, &item)
+}
+
+func (h *InvoiceHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	invoice, ok := h.editableInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Where("id = ? AND invoice_id = ?", r.PathValue("item_id"), invoice.ID).Delete(&models.InvoiceItem{}).Error; err != nil {
+		http.Error(w, "Failed to remove item", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/invoices/"+r.PathValue("id")+"/edit", http.StatusSeeOther)
+}
+
+// ReorderItems stores the order of the items of a draft invoice, posted as
+// the item_id values in their new order. Items left out follow them.
+func (h *InvoiceHandler) ReorderItems(w http.ResponseWriter, r *http.Request) {
+	invoice, ok := h.editableInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	var items []models.InvoiceItem
+	if err := h.db.Where("invoice_id = ?", invoice.ID).Order("position, id").Find(&items).Error; err != nil {
+		http.Error(w, "Failed to reorder items", http.StatusInternalServerError)
+		return
+	}
+
+	positions := make(map[uint]int, len(items))
+	r.ParseForm()
+	for _, value := range r.Form["item_id"] {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid item", http.StatusBadRequest)
+			return
+		}
+		if _, seen := positions[uint(id)]; !seen {
+			positions[uint(id)] = len(positions)
+		}
+	}
+	for _, item := range items {
+		if _, listed := positions[item.ID]; !listed {
+			positions[item.ID] = len(positions)
+		}
+	}
+	if len(positions) != len(items) {
+		http.Error(w, "Item not found", http.StatusBadRequest)
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		for _, item := range items {
+			if item.Position == positions[item.ID] {
+				continue
+			}
+			if err := tx.Model(&item).Update("position", positions[item.ID]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Failed to reorder items", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/invoices/"+r.PathValue("id")+"/edit", http.StatusSeeOther)
+}
+
+// editableInvoice loads the draft invoice of the path, answering with an
+// error if there is none.
+func (h *InvoiceHandler) editableInvoice(w http.ResponseWriter, r *http.Request) (*models.Invoice, bool) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var invoice models.Invoice
+	if err := h.db.Where("id = ? AND user_id = ?", r.PathValue("id"), userID).First(&invoice).Error; err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	if !invoice.CanEdit() {
+		http.Error(w, "Cannot edit finalized invoice", http.StatusForbidden)
+		return nil, false
+	}
+	return &invoice, true
+}
+
+// saveItem applies the posted fields to an item of invoice, validates and
+// stores it, and goes back to the edit page, showing the violations if
+// the item is invalid.
+func (h *InvoiceHandler) saveItem(w http.ResponseWriter, r *http.Request, invoice *models.Invoice, item *models.InvoiceItem) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	v := make(validation.Violations)
+	applyItemForm(r, item, v)
+	if v.Empty() {
+		services.ValidateItem(item, v)
+	}
+	if !v.Empty() {
+		h.renderEdit(w, r, v)
+		return
+	}
+
+	// Businesses under the VAT franchise never charge VAT
+	var company models.CompanySettings
+	h.db.Where("user_id = ?", userID).Limit(1).Find(&company)
+	if company.VATExempt {
+		item.VATRate = 0
+	}
+
+	if err := h.db.Omit("Product", "Invoice").Save(item).Error; err != nil {
+		http.Error(w, "Failed to save item", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/invoices/"+strconv.Itoa(int(invoice.ID))+"/edit", http.StatusSeeOther)
+}
+
+// applyItemForm sets the fields of an invoice item posted by the edit
+// page. Fields left empty keep their value, so that a product line keeps
+// what it took from its product. VAT and discount rates are posted as
+// percentages; discount_type tells whether discount is a percentage or an
+// amount.
+func applyItemForm(r *http.Request, item *models.InvoiceItem, v validation.Violations) {
+	if description := strings.TrimSpace(r.FormValue("description")); description != "" {
+		item.Description = description
+	}
+	if unit := strings.TrimSpace(r.FormValue("unit")); unit != "" {
+		item.Unit = unit
+	}
+	if value := r.FormValue("quantity"); value != "" {
+		quantity, err := parseDecimal(value)
+		if err != nil {
+			v["quantity"] = "invalid"
+		}
+		item.Quantity = quantity
+	}
+	if value := r.FormValue("unit_price"); value != "" {
+		price, err := models.ParseMoney(value)
+		if err != nil {
+			v["unit_price"] = "invalid"
+		}
+		item.UnitPrice = price
+	}
+	if value := r.FormValue("vat_rate"); value != "" {
+		rate, err := parseDecimal(value)
+		if err != nil {
+			v["vat_rate"] = "invalid"
+		}
+		item.VATRate = rate / 100
+	}
+
+	if !r.Form.Has("discount") {
+		return
+	}
+	item.DiscountRate, item.DiscountAmount = 0, 0
+	value := strings.TrimSpace(r.FormValue("discount"))
+	if value == "" {
+		return
+	}
+	if r.FormValue("discount_type") == "amount" {
+		amount, err := models.ParseMoney(value)
+		if err != nil {
+			v["discount"] = "invalid"
+		}
+		item.DiscountAmount = amount
+		return
+	}
+	rate, err := parseDecimal(value)
+	if err != nil {
+		v["discount"] = "invalid"
+	}
+	item.DiscountRate = rate / 100
+}
+
+// parseDecimal parses a posted decimal number, with a dot or a comma.
+// strconv.ParseFloat also reads "NaN" and "Inf", which are no numbers.
+func parseDecimal(value string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(value), ",", "."), 64)
+	if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return 0, strconv.ErrSyntax
+	}
+	return f, err
+}
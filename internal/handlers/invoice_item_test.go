@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+)
+
+// formRequest serves a form post as user 1 on invoice 1, with the item
+// path value when itemID is set.
+func formRequest(t *testing.T, handler http.HandlerFunc, itemID string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/invoices/1/items", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", "1")
+	if itemID != "" {
+		req.SetPathValue("item_id", itemID)
+	}
+
+	rr := httptest.NewRecorder()
+	withSession(t, req, 1, handler).ServeHTTP(rr, req)
+	return rr
+}
+
+// withSession wraps handler in the session middleware, with req carrying
+// the session cookie of userID.
+func withSession(t *testing.T, req *http.Request, userID uint, handler http.Handler) http.Handler {
+	t.Helper()
+	login := httptest.NewRecorder()
+	auth.CreateSession(login, userID)
+	for _, cookie := range login.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return auth.Middleware(handler)
+}
+
+func TestInvoiceHandler_Items(t *testing.T) {
+	db := setupAPITestDB(t)
+	db.Create(&models.Client{UserID: 1, Name: "Globex"})
+	db.Create(&models.Product{UserID: 1, Code: "CONS", Name: "Consulting", UnitPrice: 50000, Unit: "day", VATRate: 0.20})
+	db.Create(&models.Invoice{UserID: 1, ClientID: 1, Number: "DRAFT-1", Status: models.InvoiceStatusDraft})
+	h := NewInvoiceHandler(db, nil, nil, nil, nil, nil, nil)
+
+	for _, form := range []url.Values{
+		{"kind": {"section"}, "description": {"Phase 1"}},
+		{"product_id": {"1"}, "quantity": {"2"}, "discount": {"10"}, "discount_type": {"percent"}},
+		{"description": {"Travel"}, "unit_price": {"120,50"}, "vat_rate": {"20"}, "discount": {"20.5"}, "discount_type": {"amount"}},
+		{"kind": {"subtotal"}},
+	} {
+		if rr := formRequest(t, h.AddItem, "", form); rr.Code != http.StatusSeeOther {
+			t.Fatalf("AddItem(%v) = %d: %s", form, rr.Code, rr.Body)
+		}
+	}
+
+	var items []models.InvoiceItem
+	db.Order("position").Find(&items)
+	if len(items) != 4 {
+		t.Fatalf("items = %+v", items)
+	}
+	product, custom := items[1], items[2]
+	if !items[0].IsSection() || !items[3].IsSubtotal() || items[3].Position != 3 {
+		t.Errorf("items = %+v", items)
+	}
+	if product.ProductID == nil || product.Description != "Consulting" || product.Unit != "day" || product.TotalHT() != 90000 {
+		t.Errorf("product line = %+v", product)
+	}
+	if custom.ProductID != nil || custom.UnitPrice != 12050 || custom.VATRate != 0.20 || custom.TotalHT() != 10000 {
+		t.Errorf("custom line = %+v", custom)
+	}
+
+	// Invalid lines are not saved
+	for _, form := range []url.Values{
+		{"unit_price": {"10"}},
+		{"description": {"Gift"}, "unit_price": {"10"}, "discount": {"11"}, "discount_type": {"amount"}},
+		{"kind": {"total"}, "description": {"Total"}},
+		{"description": {"Gift"}, "unit_price": {"10"}, "quantity": {"NaN"}},
+		{"description": {"Gift"}, "unit_price": {"10"}, "quantity": {"1e300"}},
+		{"description": {"Gift"}, "unit_price": {"10"}, "vat_rate": {"NaN"}},
+		{"description": {"Gift"}, "unit_price": {"10"}, "discount": {"Inf"}, "discount_type": {"percent"}},
+	} {
+		formRequest(t, h.AddItem, "", form)
+	}
+	var count int64
+	db.Model(&models.InvoiceItem{}).Count(&count)
+	if count != 4 {
+		t.Errorf("items after invalid posts = %d, want 4", count)
+	}
+
+	// Updating a line keeps its product; an empty discount removes it
+	form := url.Values{"description": {"Consulting, senior"}, "quantity": {"3"}, "discount": {""}, "discount_type": {"percent"}}
+	if rr := formRequest(t, h.UpdateItem, "2", form); rr.Code != http.StatusSeeOther {
+		t.Fatalf("UpdateItem() = %d: %s", rr.Code, rr.Body)
+	}
+	db.First(&product, product.ID)
+	if product.ProductID == nil || product.Description != "Consulting, senior" || product.DiscountRate != 0 || product.TotalHT() != 150000 {
+		t.Errorf("updated line = %+v", product)
+	}
+
+	// Reordering moves the listed items first, the others after
+	if rr := formRequest(t, h.ReorderItems, "", url.Values{"item_id": {"3", "1"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("ReorderItems() = %d: %s", rr.Code, rr.Body)
+	}
+	var order []uint
+	db.Model(&models.InvoiceItem{}).Order("position").Pluck("id", &order)
+	if len(order) != 4 || order[0] != 3 || order[1] != 1 || order[2] != 2 || order[3] != 4 {
+		t.Errorf("order = %v, want [3 1 2 4]", order)
+	}
+	if rr := formRequest(t, h.ReorderItems, "", url.Values{"item_id": {"99"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("ReorderItems() with a foreign item = %d, want 400", rr.Code)
+	}
+
+	db.Model(&models.Invoice{}).Where("id = 1").Update("status", models.InvoiceStatusFinal)
+	if rr := formRequest(t, h.UpdateItem, "2", form); rr.Code != http.StatusForbidden {
+		t.Errorf("UpdateItem() on a final invoice = %d, want 403", rr.Code)
+	}
+}
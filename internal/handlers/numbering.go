@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/validation"
+	"github.com/diewo77/go-invoices/view"
+)
+
+// NumberingHandler manages the document numbering settings page.
+type NumberingHandler struct {
+	numbering *services.NumberingService
+}
+
+func NewNumberingHandler(numbering *services.NumberingService) *NumberingHandler {
+	return &NumberingHandler{numbering: numbering}
+}
+
+// numberingRow is one document type on the settings page.
+type numberingRow struct {
+	Sequence models.NumberingSequence
+	Preview  string
+}
+
+// Edit shows the numbering configuration of every document type.
+func (h *NumberingHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	rows, err := h.rows(userID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	view.Render(w, r, "company/numbering.html", map[string]any{
+		"Rows": rows,
+	})
+}
+
+// Update validates and saves the numbering configuration.
+func (h *NumberingHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	v := make(validation.Violations)
+	var sequences []models.NumberingSequence
+	for _, docType := range models.NumberedDocumentTypes {
+		seq, err := h.numbering.Sequence(userID, docType)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		field := string(docType)
+		seq.Pattern = strings.TrimSpace(r.FormValue("pattern_" + field))
+		seq.Prefix = strings.TrimSpace(r.FormValue("prefix_" + field))
+		seq.Reset = models.SequenceReset(r.FormValue("reset_" + field))
+		if err := seq.Validate(); err != nil {
+			v["pattern_"+field] = err.Error()
+		} else if err := h.numbering.CheckSequence(&seq); errors.Is(err, services.ErrResetLocked) {
+			v["reset_"+field] = err.Error()
+		} else if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		sequences = append(sequences, seq)
+	}
+
+	if !v.Empty() {
+		rows := make([]numberingRow, len(sequences))
+		for i, seq := range sequences {
+			rows[i] = numberingRow{Sequence: seq}
+		}
+		view.Render(w, r, "company/numbering.html", map[string]any{
+			"Rows":   rows,
+			"Errors": v,
+		})
+		return
+	}
+
+	for i := range sequences {
+		if err := h.numbering.SaveSequence(&sequences[i]); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/settings/numbering", http.StatusSeeOther)
+}
+
+func (h *NumberingHandler) rows(userID uint) ([]numberingRow, error) {
+	now := time.Now()
+	rows := make([]numberingRow, 0, len(models.NumberedDocumentTypes))
+	for _, docType := range models.NumberedDocumentTypes {
+		seq, err := h.numbering.Sequence(userID, docType)
+		if err != nil {
+			return nil, err
+		}
+		preview, err := h.numbering.Peek(userID, docType, now)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, numberingRow{Sequence: seq, Preview: preview})
+	}
+	return rows, nil
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/httpx"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/validation"
+	"github.com/diewo77/go-invoices/view"
+	"gorm.io/gorm"
+)
+
+// PaymentHandler manages the payments recorded against an invoice.
+type PaymentHandler struct {
+	db       *gorm.DB
+	payments *services.PaymentService
+	webhooks *services.WebhookService
+}
+
+func NewPaymentHandler(db *gorm.DB, payments *services.PaymentService, webhooks *services.WebhookService) *PaymentHandler {
+	return &PaymentHandler{db: db, payments: payments, webhooks: webhooks}
+}
+
+// List shows the payment ledger of an invoice with the form to record a new payment.
+func (h *PaymentHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	invoice, ok := h.loadInvoice(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Check Accept header for JSON response
+	if strings.Contains(r.Header.Get("Accept"), "application/json") &&
+		!strings.Contains(r.Header.Get("Accept"), "text/html") {
+		httpx.JSON(w, http.StatusOK, map[string]any{
+			"payments": invoice.Payments,
+			"paid":     invoice.AmountPaid(),
+			"balance":  invoice.Balance(),
+		})
+		return
+	}
+
+	h.render(w, r, invoice, models.Payment{Date: time.Now(), Amount: invoice.Balance()}, nil)
+}
+
+// Create records a payment.
+func (h *PaymentHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	invoice, ok := h.loadInvoice(w, r, userID)
+	if !ok {
+		return
+	}
+
+	v := make(validation.Violations)
+	amount, err := models.ParseMoney(r.FormValue("amount"))
+	if err != nil {
+		v["amount"] = "invalid"
+	}
+	date, err := time.Parse("2006-01-02", r.FormValue("date"))
+	if err != nil {
+		v["date"] = "invalid"
+	}
+
+	payment := models.Payment{
+		Amount:    amount,
+		Date:      date,
+		Method:    models.PaymentMethod(r.FormValue("method")),
+		Reference: strings.TrimSpace(r.FormValue("reference")),
+	}
+	if !v.Empty() {
+		h.render(w, r, invoice, payment, v)
+		return
+	}
+
+	err = h.payments.Record(userID, invoice.ID, &payment)
+	switch {
+	case errors.Is(err, services.ErrInvalidPaymentAmount), errors.Is(err, services.ErrPaymentExceedsBalance):
+		v["amount"] = err.Error()
+	case errors.Is(err, services.ErrInvalidPaymentMethod):
+		v["method"] = err.Error()
+	case errors.Is(err, services.ErrInvoiceNotPayable):
+		http.Error(w, "Cannot record a payment on this invoice", http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Failed to record payment", http.StatusInternalServerError)
+		return
+	}
+
+	if !v.Empty() {
+		h.render(w, r, invoice, payment, v)
+		return
+	}
+	emitSettlement(h.db, h.webhooks, userID, invoice.ID, invoice.Status)
+
+	http.Redirect(w, r, "/invoices/"+r.PathValue("id")+"/payments", http.StatusSeeOther)
+}
+
+// Delete removes a payment.
+func (h *PaymentHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id := r.PathValue("id")
+
+	invoiceID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	paymentID, err := strconv.ParseUint(r.PathValue("payment_id"), 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var before models.Invoice
+	h.db.Select("status").Where("id = ? AND user_id = ?", invoiceID, userID).Limit(1).Find(&before)
+
+	err = h.payments.Delete(userID, uint(invoiceID), uint(paymentID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete payment", http.StatusInternalServerError)
+		return
+	}
+	emitSettlement(h.db, h.webhooks, userID, uint(invoiceID), before.Status)
+
+	http.Redirect(w, r, "/invoices/"+id+"/payments", http.StatusSeeOther)
+}
+
+func (h *PaymentHandler) loadInvoice(w http.ResponseWriter, r *http.Request, userID uint) (*models.Invoice, bool) {
+	var invoice models.Invoice
+	if err := h.db.Where("id = ? AND user_id = ?", r.PathValue("id"), userID).
+		Preload("Client").
+		Preload("Items").
+		Preload("Payments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("date, id")
+		}).
+		Preload("CreditNotes.Items").
+		First(&invoice).Error; err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return &invoice, true
+}
+
+func (h *PaymentHandler) render(w http.ResponseWriter, r *http.Request, invoice *models.Invoice, payment models.Payment, errs validation.Violations) {
+	view.Render(w, r, "invoices/payments.html", map[string]any{
+		"Invoice": invoice,
+		"Payment": payment,
+		"Methods": models.PaymentMethods,
+		"Errors":  errs,
+	})
+}
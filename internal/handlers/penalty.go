@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"gorm.io/gorm"
+)
+
+// CreatePenalty creates a draft invoice charging the late-payment
+// penalties accrued on an overdue invoice.
+func (h *InvoiceHandler) CreatePenalty(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	invoice, err := h.invoices.CreatePenaltyInvoice(userID, uint(id), time.Now())
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrInvoiceNotOverdue), errors.Is(err, services.ErrNoPenaltyDue),
+		errors.Is(err, services.ErrNoPenaltyRate):
+		http.Error(w, "Cannot charge penalties: "+err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to create penalty invoice", http.StatusInternalServerError)
+		return
+	}
+	h.webhooks.Emit(userID, models.WebhookInvoiceCreated, invoice.ID)
+
+	http.Redirect(w, r, "/invoices/"+strconv.Itoa(int(invoice.ID))+"/edit", http.StatusSeeOther)
+}
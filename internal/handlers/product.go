@@ -58,7 +58,7 @@ func (h *ProductHandler) New(w http.ResponseWriter, r *http.Request) {
 func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 	userID, _ := auth.UserIDFromContext(r.Context())
 
-	unitPrice, _ := strconv.ParseFloat(r.FormValue("unit_price"), 64)
+	unitPrice, _ := models.ParseMoney(r.FormValue("unit_price"))
 	vatRate, _ := strconv.ParseFloat(r.FormValue("vat_rate"), 64)
 
 	// Convert VAT rate to decimal if it's > 1 (e.g. 20 -> 0.20)
@@ -81,7 +81,7 @@ func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 	v := make(validation.Violations)
 	validation.Required("code", product.Code, v)
 	validation.Required("name", product.Name, v)
-	validation.PositiveFloat("unit_price", product.UnitPrice, v)
+	validation.PositiveFloat("unit_price", product.UnitPrice.Float64(), v)
 
 	if !v.Empty() {
 		view.Render(w, r, "products/new.html", map[string]any{
@@ -150,7 +150,7 @@ func (h *ProductHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	unitPrice, _ := strconv.ParseFloat(r.FormValue("unit_price"), 64)
+	unitPrice, _ := models.ParseMoney(r.FormValue("unit_price"))
 	vatRate, _ := strconv.ParseFloat(r.FormValue("vat_rate"), 64)
 
 	if vatRate > 1 {
@@ -167,7 +167,7 @@ func (h *ProductHandler) Update(w http.ResponseWriter, r *http.Request) {
 
 	v := make(validation.Violations)
 	validation.Required("name", product.Name, v)
-	validation.PositiveFloat("unit_price", product.UnitPrice, v)
+	validation.PositiveFloat("unit_price", product.UnitPrice.Float64(), v)
 
 	if !v.Empty() {
 		view.Render(w, r, "products/edit.html", map[string]any{
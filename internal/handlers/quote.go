@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/validation"
+	"github.com/diewo77/go-invoices/view"
+	"gorm.io/gorm"
+)
+
+// quoteValidityDays is the default validity of a new quote.
+const quoteValidityDays = 30
+
+type QuoteHandler struct {
+	db       *gorm.DB
+	quotes   *services.QuoteService
+	invoices *services.InvoiceService
+	pdf      *services.PDFService
+	webhooks *services.WebhookService
+}
+
+func NewQuoteHandler(db *gorm.DB, quotes *services.QuoteService, invoices *services.InvoiceService, pdf *services.PDFService, webhooks *services.WebhookService) *QuoteHandler {
+	return &QuoteHandler{db: db, quotes: quotes, invoices: invoices, pdf: pdf, webhooks: webhooks}
+}
+
+func (h *QuoteHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	query := r.URL.Query().Get("q")
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit := 20
+	offset := (page - 1) * limit
+
+	var quotes []models.Quote
+	var total int64
+
+	db := h.db.Where("user_id = ?", userID).Preload("Client").Preload("Items")
+	if query != "" {
+		db = db.Where("number ILIKE ? OR reference ILIKE ?", "%"+query+"%", "%"+query+"%")
+	}
+
+	db.Model(&models.Quote{}).Count(&total)
+	db.Order("created_at DESC").Limit(limit).Offset(offset).Find(&quotes)
+
+	view.Render(w, r, "quotes/index.html", map[string]any{
+		"Quotes": quotes,
+		"Query":  query,
+		"Page":   page,
+		"Total":  total,
+		"Limit":  limit,
+	})
+}
+
+func (h *QuoteHandler) New(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	h.renderNew(w, r, &models.Quote{IssueDate: now, ValidUntil: now.AddDate(0, 0, quoteValidityDays)}, nil)
+}
+
+func (h *QuoteHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	quote := models.Quote{
+		UserID:   userID,
+		Number:   "DRAFT-" + time.Now().Format("20060102-150405"),
+		Status:   models.QuoteStatusDraft,
+		Rounding: h.invoices.RoundingPolicy(userID),
+	}
+	if v := h.bind(r, &quote); !v.Empty() {
+		h.renderNew(w, r, &quote, v)
+		return
+	}
+
+	if err := h.db.Create(&quote).Error; err != nil {
+		http.Error(w, "Failed to create quote", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/quotes/"+strconv.Itoa(int(quote.ID))+"/edit", http.StatusSeeOther)
+}
+
+func (h *QuoteHandler) View(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var quote models.Quote
+	if err := h.db.Where("id = ? AND user_id = ?", r.PathValue("id"), userID).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Items.Product").
+		Preload("Invoice").
+		First(&quote).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var company models.CompanySettings
+	h.db.Where("user_id = ?", userID).Limit(1).Find(&company)
+
+	var deposits []models.Invoice
+	h.db.Where("quote_id = ? AND user_id = ? AND type = ?", quote.ID, userID, models.InvoiceTypeDeposit).
+		Preload("Items").
+		Order("created_at").
+		Find(&deposits)
+
+	view.Render(w, r, "quotes/view.html", map[string]any{
+		"Quote":    &quote,
+		"Company":  &company,
+		"Deposits": deposits,
+	})
+}
+
+func (h *QuoteHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	quote, ok := h.loadDraft(w, r)
+	if !ok {
+		return
+	}
+	h.renderEdit(w, r, quote, nil)
+}
+
+func (h *QuoteHandler) Update(w http.ResponseWriter, r *http.Request) {
+	quote, ok := h.loadDraft(w, r)
+	if !ok {
+		return
+	}
+
+	if v := h.bind(r, quote); !v.Empty() {
+		h.renderEdit(w, r, quote, v)
+		return
+	}
+
+	if err := h.db.Omit("Client", "Items").Save(quote).Error; err != nil {
+		http.Error(w, "Failed to update quote", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/quotes/"+r.PathValue("id")+"/edit", http.StatusSeeOther)
+}
+
+func (h *QuoteHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	quote, ok := h.loadDraft(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(quote).Error; err != nil {
+		http.Error(w, "Failed to delete quote", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/quotes", http.StatusSeeOther)
+}
+
+// Send numbers the quote and marks it as sent to the client.
+func (h *QuoteHandler) Send(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id := r.PathValue("id")
+
+	quoteID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	_, err = h.quotes.Send(userID, uint(quoteID))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrQuoteNotDraft):
+		http.Redirect(w, r, "/quotes/"+id, http.StatusSeeOther)
+		return
+	case errors.Is(err, services.ErrQuoteEmpty):
+		http.Error(w, "Cannot send quote with no items", http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Failed to send quote", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/quotes/"+id, http.StatusSeeOther)
+}
+
+// Accept records that the client accepted the quote.
+func (h *QuoteHandler) Accept(w http.ResponseWriter, r *http.Request) {
+	h.answer(w, r, true)
+}
+
+// Refuse records that the client refused the quote.
+func (h *QuoteHandler) Refuse(w http.ResponseWriter, r *http.Request) {
+	h.answer(w, r, false)
+}
+
+func (h *QuoteHandler) answer(w http.ResponseWriter, r *http.Request, accepted bool) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id := r.PathValue("id")
+
+	quoteID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = h.quotes.Answer(userID, uint(quoteID), accepted)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrQuoteNotSent):
+		http.Error(w, "Quote is not awaiting an answer", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to update quote", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/quotes/"+id, http.StatusSeeOther)
+}
+
+// Convert creates a draft invoice from the quote and opens it.
+func (h *QuoteHandler) Convert(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id := r.PathValue("id")
+
+	quoteID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	invoice, err := h.quotes.Convert(userID, uint(quoteID))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, services.ErrQuoteNotConvertible):
+		http.Error(w, "Quote cannot be converted into an invoice", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to convert quote", http.StatusInternalServerError)
+		return
+	}
+	h.webhooks.Emit(userID, models.WebhookInvoiceCreated, invoice.ID)
+
+	http.Redirect(w, r, "/invoices/"+strconv.Itoa(int(invoice.ID))+"/edit", http.StatusSeeOther)
+}
+
+func (h *QuoteHandler) PDF(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var quote models.Quote
+	if err := h.db.Where("id = ? AND user_id = ?", r.PathValue("id"), userID).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		First(&quote).Error; err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	pdfBytes, err := h.pdf.RenderQuote(&quote)
+	if err != nil {
+		http.Error(w, "Failed to generate PDF: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"quote-%s.pdf\"", quote.Number))
+	w.Write(pdfBytes)
+}
+
+func (h *QuoteHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	quote, ok := h.loadDraft(w, r)
+	if !ok {
+		return
+	}
+
+	productID, _ := strconv.ParseUint(r.FormValue("product_id"), 10, 32)
+	quantity, _ := strconv.ParseFloat(r.FormValue("quantity"), 64)
+
+	var product models.Product
+	if err := h.db.Where("id = ? AND user_id = ?", productID, userID).First(&product).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusBadRequest)
+		return
+	}
+
+	item := models.QuoteItem{
+		QuoteID:     quote.ID,
+		ProductID:   &product.ID,
+		Description: product.Name,
+		Quantity:    quantity,
+		UnitPrice:   product.UnitPrice,
+		Unit:        product.Unit,
+		VATRate:     product.VATRate,
+		Position:    len(quote.Items),
+	}
+
+	// Businesses under the VAT franchise never charge VAT
+	var company models.CompanySettings
+	h.db.Where("user_id = ?", userID).Limit(1).Find(&company)
+	if company.VATExempt {
+		item.VATRate = 0
+	}
+
+	if err := h.db.Create(&item).Error; err != nil {
+		http.Error(w, "Failed to add item", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/quotes/"+r.PathValue("id")+"/edit", http.StatusSeeOther)
+}
+
+func (h *QuoteHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	quote, ok := h.loadDraft(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Where("id = ? AND quote_id = ?", r.PathValue("item_id"), quote.ID).Delete(&models.QuoteItem{}).Error; err != nil {
+		http.Error(w, "Failed to remove item", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/quotes/"+r.PathValue("id")+"/edit", http.StatusSeeOther)
+}
+
+// loadDraft loads the user's quote with the path id for editing. It answers
+// 404 if there is none, and redirects to the quote once it was sent.
+func (h *QuoteHandler) loadDraft(w http.ResponseWriter, r *http.Request) (*models.Quote, bool) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	id := r.PathValue("id")
+
+	var quote models.Quote
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Items.Product").
+		First(&quote).Error; err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	if !quote.CanEdit() {
+		if r.Method == http.MethodGet {
+			http.Redirect(w, r, "/quotes/"+id, http.StatusSeeOther)
+		} else {
+			http.Error(w, "Cannot edit a quote once sent", http.StatusForbidden)
+		}
+		return nil, false
+	}
+	return &quote, true
+}
+
+// bind reads the quote form into quote and validates it.
+func (h *QuoteHandler) bind(r *http.Request, quote *models.Quote) validation.Violations {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	clientID, _ := strconv.ParseUint(r.FormValue("client_id"), 10, 32)
+	issueDate, issueErr := time.Parse("2006-01-02", r.FormValue("issue_date"))
+	validUntil, validErr := time.Parse("2006-01-02", r.FormValue("valid_until"))
+
+	quote.ClientID = uint(clientID)
+	quote.IssueDate = issueDate
+	quote.ValidUntil = validUntil
+	quote.Reference = r.FormValue("reference")
+	quote.Notes = r.FormValue("notes")
+	quote.PaymentTerms = r.FormValue("payment_terms")
+
+	v := make(validation.Violations)
+	var count int64
+	h.db.Model(&models.Client{}).Where("id = ? AND user_id = ?", quote.ClientID, userID).Count(&count)
+	if count == 0 {
+		v["client_id"] = "required"
+	}
+	if issueErr != nil {
+		v["issue_date"] = "required"
+	}
+	if validErr != nil || validUntil.Before(issueDate) {
+		v["valid_until"] = "before_issue_date"
+	}
+	return v
+}
+
+func (h *QuoteHandler) renderNew(w http.ResponseWriter, r *http.Request, quote *models.Quote, errs validation.Violations) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var clients []models.Client
+	h.db.Where("user_id = ?", userID).Order("name").Find(&clients)
+
+	view.Render(w, r, "quotes/new.html", map[string]any{
+		"Quote":   quote,
+		"Clients": clients,
+		"Errors":  errs,
+	})
+}
+
+func (h *QuoteHandler) renderEdit(w http.ResponseWriter, r *http.Request, quote *models.Quote, errs validation.Violations) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var clients []models.Client
+	h.db.Where("user_id = ?", userID).Order("name").Find(&clients)
+
+	var products []models.Product
+	h.db.Where("user_id = ?", userID).Order("name").Find(&products)
+
+	view.Render(w, r, "quotes/edit.html", map[string]any{
+		"Quote":    quote,
+		"Clients":  clients,
+		"Products": products,
+		"Errors":   errs,
+	})
+}
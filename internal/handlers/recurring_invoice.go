@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/validation"
+	"github.com/diewo77/go-invoices/view"
+	"gorm.io/gorm"
+)
+
+// recurringPreviewSize is the number of upcoming occurrences previewed.
+const recurringPreviewSize = 6
+
+// RecurringInvoiceHandler manages recurring invoices. Their invoices are
+// generated by the scheduler, see services.RecurringInvoiceService.
+type RecurringInvoiceHandler struct {
+	db        *gorm.DB
+	recurring *services.RecurringInvoiceService
+}
+
+func NewRecurringInvoiceHandler(db *gorm.DB, recurring *services.RecurringInvoiceService) *RecurringInvoiceHandler {
+	return &RecurringInvoiceHandler{db: db, recurring: recurring}
+}
+
+// List shows the user's recurring invoices.
+func (h *RecurringInvoiceHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var recurring []models.RecurringInvoice
+	h.db.Where("user_id = ?", userID).
+		Preload("Client").
+		Preload("Items").
+		Order("active DESC, next_date").
+		Find(&recurring)
+
+	view.Render(w, r, "invoices/recurring_index.html", map[string]any{
+		"Recurring": recurring,
+	})
+}
+
+// New shows the creation form.
+func (h *RecurringInvoiceHandler) New(w http.ResponseWriter, r *http.Request) {
+	h.renderNew(w, r, &models.RecurringInvoice{
+		Frequency: models.FrequencyMonthly,
+		StartDate: time.Now(),
+		DueDays:   30,
+	}, nil)
+}
+
+// Create saves a recurring invoice and opens it to add items.
+func (h *RecurringInvoiceHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	rec := models.RecurringInvoice{UserID: userID, Active: true}
+	if v := h.bind(r, &rec); !v.Empty() {
+		h.renderNew(w, r, &rec, v)
+		return
+	}
+	rec.NextDate = rec.Occurrence(0)
+
+	if err := h.db.Create(&rec).Error; err != nil {
+		http.Error(w, "Failed to create recurring invoice", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/invoices/recurring/"+strconv.Itoa(int(rec.ID))+"/edit", http.StatusSeeOther)
+}
+
+// Edit shows a recurring invoice with its items, and previews the invoices
+// of the next occurrences.
+func (h *RecurringInvoiceHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	h.renderEdit(w, r, rec, nil)
+}
+
+// Update saves the settings of a recurring invoice. Occurrences already
+// generated are kept; the next one follows the new schedule.
+func (h *RecurringInvoiceHandler) Update(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	if v := h.bind(r, rec); !v.Empty() {
+		h.renderEdit(w, r, rec, v)
+		return
+	}
+	rec.Active = r.FormValue("active") == "on"
+	rec.NextDate = rec.Occurrence(rec.Generated)
+
+	if err := h.db.Omit("Client", "Items").Save(rec).Error; err != nil {
+		http.Error(w, "Failed to update recurring invoice", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/invoices/recurring/"+r.PathValue("id")+"/edit", http.StatusSeeOther)
+}
+
+// Delete stops and removes a recurring invoice. Invoices already generated
+// are kept.
+func (h *RecurringInvoiceHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(rec).Error; err != nil {
+		http.Error(w, "Failed to delete recurring invoice", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/invoices/recurring", http.StatusSeeOther)
+}
+
+// AddItem adds a product line to a recurring invoice.
+func (h *RecurringInvoiceHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	rec, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	productID, _ := strconv.ParseUint(r.FormValue("product_id"), 10, 32)
+	quantity, _ := strconv.ParseFloat(r.FormValue("quantity"), 64)
+
+	var product models.Product
+	if err := h.db.Where("id = ? AND user_id = ?", productID, userID).First(&product).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusBadRequest)
+		return
+	}
+
+	item := models.RecurringInvoiceItem{
+		RecurringInvoiceID: rec.ID,
+		ProductID:          &product.ID,
+		Description:        product.Name,
+		Quantity:           quantity,
+		UnitPrice:          product.UnitPrice,
+		Unit:               product.Unit,
+		VATRate:            product.VATRate,
+		Position:           len(rec.Items),
+	}
+
+	// Businesses under the VAT franchise never charge VAT
+	var company models.CompanySettings
+	h.db.Where("user_id = ?", userID).Limit(1).Find(&company)
+	if company.VATExempt {
+		item.VATRate = 0
+	}
+
+	if err := h.db.Create(&item).Error; err != nil {
+		http.Error(w, "Failed to add item", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/invoices/recurring/"+r.PathValue("id")+"/edit", http.StatusSeeOther)
+}
+
+// RemoveItem removes a line from a recurring invoice.
+func (h *RecurringInvoiceHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Where("id = ? AND recurring_invoice_id = ?", r.PathValue("item_id"), rec.ID).Delete(&models.RecurringInvoiceItem{}).Error; err != nil {
+		http.Error(w, "Failed to remove item", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/invoices/recurring/"+r.PathValue("id")+"/edit", http.StatusSeeOther)
+}
+
+// load loads the user's recurring invoice with the path id, or answers 404.
+func (h *RecurringInvoiceHandler) load(w http.ResponseWriter, r *http.Request) (*models.RecurringInvoice, bool) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var rec models.RecurringInvoice
+	err := h.db.Where("id = ? AND user_id = ?", r.PathValue("id"), userID).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		First(&rec).Error
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return &rec, true
+}
+
+// bind reads the settings form into rec and validates it.
+func (h *RecurringInvoiceHandler) bind(r *http.Request, rec *models.RecurringInvoice) validation.Violations {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	clientID, _ := strconv.ParseUint(r.FormValue("client_id"), 10, 32)
+	startDate, startErr := time.Parse("2006-01-02", r.FormValue("start_date"))
+	dueDays, dueErr := strconv.Atoi(r.FormValue("due_days"))
+
+	rec.ClientID = uint(clientID)
+	rec.Name = strings.TrimSpace(r.FormValue("name"))
+	rec.Frequency = models.Frequency(r.FormValue("frequency"))
+	rec.StartDate = startDate
+	rec.EndDate = nil
+	rec.DueDays = dueDays
+	rec.AutoFinalize = r.FormValue("auto_finalize") == "on"
+	rec.Reference = strings.TrimSpace(r.FormValue("reference"))
+	rec.Notes = r.FormValue("notes")
+	rec.PaymentTerms = r.FormValue("payment_terms")
+
+	v := make(validation.Violations)
+	validation.Required("name", rec.Name, v)
+	var count int64
+	h.db.Model(&models.Client{}).Where("id = ? AND user_id = ?", rec.ClientID, userID).Count(&count)
+	if count == 0 {
+		v["client_id"] = "required"
+	}
+	if !rec.Frequency.IsValid() {
+		v["frequency"] = "invalid"
+	}
+	if startErr != nil {
+		v["start_date"] = "required"
+	}
+	if dueErr != nil || dueDays < 0 {
+		v["due_days"] = "must not be negative"
+	}
+	if end := r.FormValue("end_date"); end != "" {
+		endDate, err := time.Parse("2006-01-02", end)
+		if err != nil || endDate.Before(startDate) {
+			v["end_date"] = "before_start_date"
+		} else {
+			rec.EndDate = &endDate
+		}
+	}
+	return v
+}
+
+func (h *RecurringInvoiceHandler) renderNew(w http.ResponseWriter, r *http.Request, rec *models.RecurringInvoice, errs validation.Violations) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var clients []models.Client
+	h.db.Where("user_id = ?", userID).Order("name").Find(&clients)
+
+	view.Render(w, r, "invoices/recurring_new.html", map[string]any{
+		"Recurring":   rec,
+		"Clients":     clients,
+		"Frequencies": models.Frequencies,
+		"Errors":      errs,
+	})
+}
+
+func (h *RecurringInvoiceHandler) renderEdit(w http.ResponseWriter, r *http.Request, rec *models.RecurringInvoice, errs validation.Violations) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	var clients []models.Client
+	h.db.Where("user_id = ?", userID).Order("name").Find(&clients)
+
+	var products []models.Product
+	h.db.Where("user_id = ?", userID).Order("name").Find(&products)
+
+	var generated []models.Invoice
+	h.db.Where("recurring_invoice_id = ? AND user_id = ?", rec.ID, userID).
+		Preload("Items").
+		Order("recurrence_date DESC").
+		Limit(12).
+		Find(&generated)
+
+	view.Render(w, r, "invoices/recurring_edit.html", map[string]any{
+		"Recurring":   rec,
+		"Clients":     clients,
+		"Products":    products,
+		"Frequencies": models.Frequencies,
+		"Preview":     h.recurring.Preview(rec, recurringPreviewSize),
+		"Generated":   generated,
+		"Errors":      errs,
+	})
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/view"
+	"gorm.io/gorm"
+)
+
+// ReportHandler shows the revenue and VAT reports of the current user and
+// exports them as CSV.
+type ReportHandler struct {
+	db       *gorm.DB
+	reports  *services.ReportService
+	fec      *services.FECService
+	invoices *services.InvoiceService
+}
+
+func NewReportHandler(db *gorm.DB, reports *services.ReportService, fec *services.FECService, invoices *services.InvoiceService) *ReportHandler {
+	return &ReportHandler{db: db, reports: reports, fec: fec, invoices: invoices}
+}
+
+// Index shows every report for the filter in the query string.
+func (h *ReportHandler) Index(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	f := reportFilter(r)
+
+	revenue, err := h.reports.Compare(userID, f)
+	if err != nil {
+		http.Error(w, "Failed to compute reports", http.StatusInternalServerError)
+		return
+	}
+	vat, err := h.reports.VAT(userID, f)
+	if err != nil {
+		http.Error(w, "Failed to compute reports", http.StatusInternalServerError)
+		return
+	}
+	clients, err := h.reports.ByClient(userID, f)
+	if err != nil {
+		http.Error(w, "Failed to compute reports", http.StatusInternalServerError)
+		return
+	}
+	products, err := h.reports.ByProduct(userID, f)
+	if err != nil {
+		http.Error(w, "Failed to compute reports", http.StatusInternalServerError)
+		return
+	}
+
+	var total services.RevenueRow
+	for _, row := range revenue {
+		total.HT += row.HT
+		total.VAT += row.VAT
+	}
+
+	var clientList []models.Client
+	h.db.Where("user_id = ?", userID).Order("name").Find(&clientList)
+
+	view.Render(w, r, "reports/index.html", map[string]any{
+		"Revenue":      revenue,
+		"Total":        total,
+		"VAT":          vat,
+		"Clients":      clients,
+		"Products":     products,
+		"ClientList":   clientList,
+		"Filter":       f,
+		"From":         f.From.Format("2006-01-02"),
+		"To":           f.To.AddDate(0, 0, -1).Format("2006-01-02"),
+		"BaseCurrency": h.invoices.BaseCurrency(userID),
+	})
+}
+
+// Export downloads one report as CSV, for the filter in the query string.
+// Amounts are in the base currency, with a dot as decimal separator.
+func (h *ReportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	f := reportFilter(r)
+
+	var records [][]string
+	switch r.PathValue("report") {
+	case "revenue":
+		rows, err := h.reports.Compare(userID, f)
+		if err != nil {
+			http.Error(w, "Failed to compute report", http.StatusInternalServerError)
+			return
+		}
+		records = append(records, []string{"period", "ht", "vat", "ttc", "previous_year_ht"})
+		for _, row := range rows {
+			records = append(records, []string{row.Label(), row.HT.String(), row.VAT.String(), row.TTC().String(), row.Previous.String()})
+		}
+	case "vat":
+		lines, err := h.reports.VAT(userID, f)
+		if err != nil {
+			http.Error(w, "Failed to compute report", http.StatusInternalServerError)
+			return
+		}
+		records = append(records, []string{"rate", "base", "vat"})
+		for _, line := range lines {
+			records = append(records, []string{strconv.FormatFloat(line.RatePercent(), 'f', -1, 64), line.Base.String(), line.VAT.String()})
+		}
+	case "clients":
+		rows, err := h.reports.ByClient(userID, f)
+		if err != nil {
+			http.Error(w, "Failed to compute report", http.StatusInternalServerError)
+			return
+		}
+		records = append(records, []string{"client_id", "client", "invoices", "ht", "vat", "ttc"})
+		for _, row := range rows {
+			records = append(records, []string{strconv.FormatUint(uint64(row.ClientID), 10), row.ClientName,
+				strconv.Itoa(row.Invoices), row.HT.String(), row.VAT.String(), row.TTC().String()})
+		}
+	case "products":
+		rows, err := h.reports.ByProduct(userID, f)
+		if err != nil {
+			http.Error(w, "Failed to compute report", http.StatusInternalServerError)
+			return
+		}
+		records = append(records, []string{"product_id", "product", "quantity", "ht"})
+		for _, row := range rows {
+			id := ""
+			if row.ProductID != nil {
+				id = strconv.FormatUint(uint64(*row.ProductID), 10)
+			}
+			records = append(records, []string{id, row.ProductName, strconv.FormatFloat(row.Quantity, 'f', -1, 64), row.HT.String()})
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%s-%s.csv\"",
+		r.PathValue("report"), f.From.Format("20060102"), f.To.AddDate(0, 0, -1).Format("20060102")))
+	cw := csv.NewWriter(w)
+	cw.WriteAll(records)
+}
+
+// FEC downloads the accounting entries of the filter's dates as a FEC
+// file. The client filter does not apply: the FEC covers every entry.
+func (h *ReportHandler) FEC(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	f := reportFilter(r)
+
+	lines, err := h.fec.Lines(userID, f.From, f.To)
+	if err != nil {
+		http.Error(w, "Failed to export accounting entries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", h.fec.FileName(userID, f.To.AddDate(0, 0, -1))))
+	services.WriteFEC(w, lines)
+}
+
+// reportFilter reads the report filter from the query string. The dates
+// are inclusive and default to the current calendar year.
+func reportFilter(r *http.Request) services.ReportFilter {
+	q := r.URL.Query()
+	f := services.YearFilter(time.Now().Year(), services.ParseReportPeriod(q.Get("period")))
+	if from, err := time.Parse("2006-01-02", q.Get("from")); err == nil {
+		f.From = from
+	}
+	if to, err := time.Parse("2006-01-02", q.Get("to")); err == nil && !to.Before(f.From) {
+		f.To = to.AddDate(0, 0, 1)
+	}
+	if !f.To.After(f.From) {
+		f.To = f.From.AddDate(1, 0, 0)
+	}
+	if id, err := strconv.ParseUint(q.Get("client_id"), 10, 32); err == nil {
+		f.ClientID = uint(id)
+	}
+	return f
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/httpx"
+	"github.com/diewo77/go-invoices/internal/services"
+)
+
+// SealHandler checks the seals of the user's finalized invoices.
+type SealHandler struct {
+	seals *services.SealService
+}
+
+func NewSealHandler(seals *services.SealService) *SealHandler {
+	return &SealHandler{seals: seals}
+}
+
+// Integrity walks the seal chain of the user's invoices and reports the
+// broken seals as JSON.
+func (h *SealHandler) Integrity(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	report, err := h.seals.Verify(userID)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+		return
+	}
+	httpx.JSON(w, http.StatusOK, map[string]any{
+		"valid":  report.Valid(),
+		"sealed": report.Sealed,
+		"broken": report.Broken,
+	})
+}
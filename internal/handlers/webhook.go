@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/view"
+	"gorm.io/gorm"
+)
+
+// webhookLogSize is the number of deliveries shown in the delivery log.
+const webhookLogSize = 100
+
+// WebhookHandler manages the webhook endpoints of the current user and
+// shows their delivery log.
+type WebhookHandler struct {
+	webhooks *services.WebhookService
+}
+
+func NewWebhookHandler(webhooks *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks}
+}
+
+// List shows the user's endpoints and the form to add one.
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, "")
+}
+
+// Create adds an endpoint.
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	var events []models.WebhookEvent
+	for _, name := range r.Form["events"] {
+		events = append(events, models.WebhookEvent(name))
+	}
+
+	_, err := h.webhooks.CreateEndpoint(userID, r.FormValue("url"), events)
+	switch {
+	case errors.Is(err, services.ErrInvalidWebhookURL):
+		h.render(w, r, "webhook_url_invalid")
+		return
+	case errors.Is(err, services.ErrWebhookAddress):
+		h.render(w, r, "webhook_url_forbidden")
+		return
+	case errors.Is(err, services.ErrInvalidWebhookEvent):
+		h.render(w, r, "webhook_event_invalid")
+		return
+	case err != nil:
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/webhooks", http.StatusSeeOther)
+}
+
+// Delete removes an endpoint.
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	err = h.webhooks.DeleteEndpoint(userID, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/webhooks", http.StatusSeeOther)
+}
+
+// Deliveries shows the most recent deliveries.
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	deliveries, err := h.webhooks.ListDeliveries(userID, webhookLogSize)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	view.Render(w, r, "company/webhook_deliveries.html", map[string]any{
+		"Deliveries": deliveries,
+	})
+}
+
+// Redeliver queues a delivery again.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	err = h.webhooks.Redeliver(userID, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to queue delivery", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/webhooks/deliveries", http.StatusSeeOther)
+}
+
+// emitSettlement sends the event of an invoice whose settlement a payment
+// or a credit note just changed, if its status changed from before.
+func emitSettlement(db *gorm.DB, webhooks *services.WebhookService, userID, invoiceID uint, before models.InvoiceStatus) {
+	var invoice models.Invoice
+	if err := db.Select("id", "status").Where("id = ? AND user_id = ?", invoiceID, userID).First(&invoice).Error; err != nil {
+		return
+	}
+	if invoice.Status == before {
+		return
+	}
+	switch invoice.Status {
+	case models.InvoiceStatusPaid:
+		webhooks.Emit(userID, models.WebhookInvoicePaid, invoiceID)
+	case models.InvoiceStatusCancelled:
+		webhooks.Emit(userID, models.WebhookInvoiceCancelled, invoiceID)
+	case models.InvoiceStatusFinal:
+		webhooks.Emit(userID, models.WebhookInvoiceReopened, invoiceID)
+	}
+}
+
+func (h *WebhookHandler) render(w http.ResponseWriter, r *http.Request, errKey string) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+
+	endpoints, err := h.webhooks.ListEndpoints(userID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	view.Render(w, r, "company/webhooks.html", map[string]any{
+		"Endpoints": endpoints,
+		"Events":    models.WebhookEvents,
+		"Error":     errKey,
+	})
+}
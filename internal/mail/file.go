@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer writes each message as an .eml file in Dir instead of
+// sending it, for development.
+type FileMailer struct {
+	Dir string
+
+	mu sync.Mutex
+	n  int
+}
+
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{Dir: dir}
+}
+
+// Send implements Mailer.
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.n++
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().Format("20060102-150405"), m.n)
+	m.mu.Unlock()
+	return os.WriteFile(filepath.Join(m.Dir, name), body, 0o644)
+}
+
+// MemoryMailer keeps sent messages in memory, for tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send implements Mailer.
+func (m *MemoryMailer) Send(ctx context.Context, msg *Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipient
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
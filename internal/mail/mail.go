@@ -0,0 +1,150 @@
+// Package mail sends the application's emails through a pluggable Mailer:
+// SMTP in production, files or memory in development and tests.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message errors.
+var (
+	// ErrNoRecipient is returned when sending a message without recipient.
+	ErrNoRecipient = errors.New("mail: message has no recipient")
+	// ErrInvalidHeader is returned for a header value spanning several
+	// lines, which could inject headers of its own.
+	ErrInvalidHeader = errors.New("mail: header value contains a line break")
+)
+
+// Mailer delivers email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Message is a plain text email with optional attachments.
+type Message struct {
+	// ID is the Message-ID header, see NewMessageID. Optional.
+	ID          string
+	From        string
+	To          []string
+	ReplyTo     string
+	Subject     string
+	Text        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Bytes encodes the message in RFC 5322 format: a text/plain part
+// followed by one base64 part per attachment.
+func (m *Message) Bytes() ([]byte, error) {
+	if len(m.To) == 0 {
+		return nil, ErrNoRecipient
+	}
+
+	values := append([]string{m.ID, m.From, m.ReplyTo, m.Subject}, m.To...)
+	for _, a := range m.Attachments {
+		values = append(values, a.Filename, a.ContentType)
+	}
+	for _, value := range values {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", m.From)
+	header("To", strings.Join(m.To, ", "))
+	if m.ReplyTo != "" {
+		header("Reply-To", m.ReplyTo)
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	if m.ID != "" {
+		header("Message-ID", m.ID)
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	buf.WriteString("\r\n")
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBase64(part, []byte(m.Text)); err != nil {
+		return nil, err
+	}
+
+	for _, a := range m.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, a.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewMessageID returns a unique Message-ID in the domain of the from
+// address, so that a sent message can be traced in the recipient's and the
+// relay's logs.
+func NewMessageID(from string) string {
+	domain := "localhost"
+	if address := envelopeAddress(from); strings.Contains(address, "@") {
+		domain = address[strings.LastIndex(address, "@")+1:]
+	}
+	random := make([]byte, 12)
+	rand.Read(random)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(random), domain)
+}
+
+// writeBase64 writes data base64-encoded in lines of 76 characters.
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := w.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := w.Write([]byte(encoded + "\r\n"))
+	return err
+}
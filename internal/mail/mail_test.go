@@ -0,0 +1,140 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diewo77/go-invoices/internal/mail/mailtest"
+)
+
+func TestMessage_Bytes(t *testing.T) {
+	msg := &Message{
+		From:    "Acme <billing@acme.test>",
+		To:      []string{"jane@example.com"},
+		ReplyTo: "contact@acme.test",
+		Subject: "Relance facture FA-2025-00001",
+		Text:    "Bonjour, voici votre facture.",
+		Attachments: []Attachment{
+			{Filename: "FA-2025-00001.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.7")},
+		},
+	}
+	raw, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+
+	parsed, err := netmail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != msg.Subject || parsed.Header.Get("Reply-To") != msg.ReplyTo {
+		t.Errorf("headers = %v", parsed.Header)
+	}
+
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Content-Type: %v", err)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart() error = %v", err)
+		}
+		parts = append(parts, part.Header.Get("Content-Type")+" "+part.FileName())
+	}
+	want := []string{"text/plain; charset=utf-8 ", "application/pdf FA-2025-00001.pdf"}
+	if strings.Join(parts, "|") != strings.Join(want, "|") {
+		t.Errorf("parts = %q, want %q", parts, want)
+	}
+
+	if _, err := (&Message{Subject: "no one"}).Bytes(); !errors.Is(err, ErrNoRecipient) {
+		t.Errorf("Bytes() without recipient error = %v, want ErrNoRecipient", err)
+	}
+
+	// Header values cannot add headers of their own
+	for _, injected := range []*Message{
+		{To: []string{"jane@example.com\r\nBcc: all@example.com"}},
+		{To: []string{"jane@example.com"}, ReplyTo: "contact@acme.test\nBcc: all@example.com"},
+		{To: []string{"jane@example.com"}, Subject: "Facture\r\nBcc: all@example.com"},
+		{To: []string{"jane@example.com"}, Attachments: []Attachment{{Filename: "a.pdf\r\nX: y"}}},
+	} {
+		if _, err := injected.Bytes(); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("Bytes(%+v) error = %v, want ErrInvalidHeader", injected, err)
+		}
+	}
+}
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := NewFileMailer(dir)
+	for range 2 {
+		if err := m.Send(context.Background(), &Message{To: []string{"jane@example.com"}, Subject: "Hello"}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+	raw, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(raw), "To: jane@example.com") {
+		t.Errorf("file content = %s", raw)
+	}
+}
+
+func TestEnvelopeAddress(t *testing.T) {
+	if got := envelopeAddress("Acme <billing@acme.test>"); got != "billing@acme.test" {
+		t.Errorf("envelopeAddress() = %q", got)
+	}
+	if got := envelopeAddress("billing@acme.test"); got != "billing@acme.test" {
+		t.Errorf("envelopeAddress() = %q", got)
+	}
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	server := mailtest.NewServer(t)
+	m := NewSMTPMailer(server.Host, server.Port, "", "")
+
+	msg := &Message{
+		ID:      NewMessageID("Acme <billing@acme.test>"),
+		From:    "Acme <billing@acme.test>",
+		To:      []string{"Jane <jane@example.com>"},
+		Subject: "Facture FA-2025-00001",
+		Text:    "Bonjour",
+	}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	received := server.Messages()
+	if len(received) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(received))
+	}
+	env := received[0]
+	if env.From != "billing@acme.test" || len(env.To) != 1 || env.To[0] != "jane@example.com" {
+		t.Errorf("envelope = %q -> %q", env.From, env.To)
+	}
+	if !strings.Contains(env.Data, "Message-ID: "+msg.ID) || !strings.HasSuffix(msg.ID, "@acme.test>") {
+		t.Errorf("Message-ID %q not sent", msg.ID)
+	}
+
+	server.Reject("550 mailbox unavailable")
+	if err := m.Send(context.Background(), msg); err == nil || !strings.Contains(err.Error(), "mailbox unavailable") {
+		t.Errorf("Send() to a rejecting server error = %v", err)
+	}
+}
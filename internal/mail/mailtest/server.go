@@ -0,0 +1,159 @@
+// Package mailtest provides a fake SMTP server for tests, in the spirit
+// of net/http/httptest.
+package mailtest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Envelope is a message received by the server.
+type Envelope struct {
+	From string
+	To   []string
+	Data string
+}
+
+// Server is a local SMTP server accepting every message. It speaks just
+// enough SMTP for net/smtp.SendMail, without STARTTLS nor AUTH.
+type Server struct {
+	// Host and Port the server listens on.
+	Host string
+	Port int
+
+	listener net.Listener
+	mu       sync.Mutex
+	messages []Envelope
+	// reject makes the server refuse messages with this reply.
+	reject string
+	wg     sync.WaitGroup
+}
+
+// NewServer starts a server on a random local port, closed at the end of
+// the test.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("mailtest: %v", err)
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &Server{Host: addr.IP.String(), Port: addr.Port, listener: listener}
+
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// Reject makes the server refuse the following messages with reply, e.g.
+// "550 mailbox unavailable". An empty reply accepts them again.
+func (s *Server) Reject(reply string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject = reply
+}
+
+// Messages returns the messages received so far.
+func (s *Server) Messages() []Envelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Envelope(nil), s.messages...)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.session(conn)
+		}()
+	}
+}
+
+// session runs one SMTP session.
+func (s *Server) session(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	reply("220 mailtest ready")
+
+	var env Envelope
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250 mailtest")
+		case "MAIL":
+			env = Envelope{From: address(line)}
+			reply("250 OK")
+		case "RCPT":
+			env.To = append(env.To, address(line))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			env.Data = data.String()
+
+			s.mu.Lock()
+			rejected := s.reject
+			if rejected == "" {
+				s.messages = append(s.messages, env)
+			}
+			s.mu.Unlock()
+			if rejected != "" {
+				reply(rejected)
+			} else {
+				reply("250 OK queued")
+			}
+		case "RSET", "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// address extracts the address of a MAIL FROM:<a> or RCPT TO:<a> command.
+func address(line string) string {
+	start, end := strings.Index(line, "<"), strings.LastIndex(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
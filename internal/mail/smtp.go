@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"context"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+)
+
+// SMTPMailer sends messages through an SMTP server, authenticating with
+// PLAIN auth when a username is set. STARTTLS is used when the server
+// offers it.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+func NewSMTPMailer(host string, port int, username, password string) *SMTPMailer {
+	return &SMTPMailer{Host: host, Port: port, Username: username, Password: password}
+}
+
+// Send implements Mailer.
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	return smtp.SendMail(addr, auth, envelopeAddress(msg.From), envelopeAddresses(msg.To), body)
+}
+
+// envelopeAddress strips the display name of an address for the SMTP
+// envelope: "Acme <billing@acme.test>" becomes "billing@acme.test".
+func envelopeAddress(address string) string {
+	if parsed, err := netmail.ParseAddress(address); err == nil {
+		return parsed.Address
+	}
+	return address
+}
+
+// envelopeAddresses applies envelopeAddress to each address.
+func envelopeAddresses(addresses []string) []string {
+	envelope := make([]string, len(addresses))
+	for i, a := range addresses {
+		envelope[i] = envelopeAddress(a)
+	}
+	return envelope
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default accounts of the sales journal, from the French chart of accounts
+// (plan comptable général).
+const (
+	DefaultClientAccount  = "411"
+	DefaultRevenueAccount = "706"
+	DefaultVATAccount     = "44571"
+	DefaultBankAccount    = "512"
+)
+
+// ErrInvalidVATAccounts is returned for a malformed VAT account mapping.
+var ErrInvalidVATAccounts = errors.New("VAT accounts must map rates in percent to accounts, e.g. 20=445711,5.5=445713")
+
+// Accounts maps the sales journal to the chart of accounts: the client,
+// revenue, VAT collected and bank accounts. VAT collected at the rates of
+// VATByRate goes to their own account.
+type Accounts struct {
+	Client    string
+	Revenue   string
+	VAT       string
+	Bank      string
+	VATByRate map[float64]string
+}
+
+// VATFor returns the account of the VAT collected at rate.
+func (a Accounts) VATFor(rate float64) string {
+	if account, ok := a.VATByRate[vatRateKey(rate)]; ok {
+		return account
+	}
+	return a.VAT
+}
+
+// Accounts returns the accounts of the company, the default ones for
+// those not set.
+func (c *CompanySettings) Accounts() Accounts {
+	or := func(account, def string) string {
+		if account == "" {
+			return def
+		}
+		return account
+	}
+	byRate, _ := ParseVATAccounts(c.VATAccounts)
+	return Accounts{
+		Client:    or(c.ClientAccount, DefaultClientAccount),
+		Revenue:   or(c.RevenueAccount, DefaultRevenueAccount),
+		VAT:       or(c.VATAccount, DefaultVATAccount),
+		Bank:      or(c.BankAccount, DefaultBankAccount),
+		VATByRate: byRate,
+	}
+}
+
+// ParseVATAccounts parses a comma-separated list of rate=account pairs,
+// rates in percent, into accounts by rate (0.2 for 20%).
+func ParseVATAccounts(s string) (map[float64]string, error) {
+	accounts := make(map[float64]string)
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == ';' }) {
+		rate, account, ok := strings.Cut(field, "=")
+		percent, err := strconv.ParseFloat(rate, 64)
+		if !ok || err != nil || percent < 0 || account == "" {
+			return nil, ErrInvalidVATAccounts
+		}
+		accounts[vatRateKey(percent/100)] = account
+	}
+	return accounts, nil
+}
+
+// FormatVATAccounts is the inverse of ParseVATAccounts, highest rate
+// first.
+func FormatVATAccounts(accounts map[float64]string) string {
+	rates := make([]float64, 0, len(accounts))
+	for rate := range accounts {
+		rates = append(rates, rate)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(rates)))
+
+	fields := make([]string, len(rates))
+	for i, rate := range rates {
+		fields[i] = strconv.FormatFloat(VATLine{Rate: rate}.RatePercent(), 'f', -1, 64) + "=" + accounts[rate]
+	}
+	return strings.Join(fields, ",")
+}
+
+// vatRateKey rounds a rate to the precision it is stored with, so that
+// rates computed from percents and read from the database match.
+func vatRateKey(rate float64) float64 {
+	return math.Round(rate*10000) / 10000
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIToken authenticates API requests on behalf of a user. Only the SHA-256
+// hash of the token is stored: the token itself is shown once, at creation.
+// A token can never do more than its owner's profile allows; its scopes
+// restrict it further.
+type APIToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// UserID is the owner of this token
+	UserID uint `gorm:"index;not null" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+
+	Name string `gorm:"size:100;not null" json:"name"`
+	// Prefix is the beginning of the token, to recognise it in the UI
+	Prefix string `gorm:"size:16;not null" json:"prefix"`
+	Hash   string `gorm:"size:64;not null;uniqueIndex" json:"-"`
+
+	// Scopes are space-separated permission codes ("invoice:list client:*")
+	Scopes string `gorm:"size:1000;not null" json:"scopes"`
+
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+}
+
+// GetUserID implements the Ownable interface for authorization.
+func (t *APIToken) GetUserID() uint {
+	return t.UserID
+}
+
+// IsRevoked returns true once the token has been revoked.
+func (t *APIToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
+
+// ScopeList returns the permission codes the token is scoped to.
+func (t *APIToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// Allows returns true if one of the token scopes grants action on
+// resourceType. Scopes follow permission codes, "*" matching anything.
+func (t *APIToken) Allows(resourceType, action string) bool {
+	for _, scope := range t.ScopeList() {
+		resource, act, ok := strings.Cut(scope, ":")
+		if !ok {
+			continue
+		}
+		if (resource == "*" || resource == resourceType) && (act == "*" || act == action) {
+			return true
+		}
+	}
+	return false
+}
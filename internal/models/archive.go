@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// RetentionYears is how long invoices must be kept: ten years from the
+// end of the fiscal year (art. L123-22 du Code de commerce).
+const RetentionYears = 10
+
+// ArchivedDocument records the PDF of a finalized invoice as stored when
+// it was issued. The stored copy is served afterwards, so that the
+// document can be reproduced exactly as the client received it.
+type ArchivedDocument struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID    uint     `gorm:"index;not null" json:"user_id"`
+	InvoiceID uint     `gorm:"uniqueIndex;not null" json:"invoice_id"`
+	Invoice   *Invoice `gorm:"foreignKey:InvoiceID" json:"-"`
+
+	// Key locates the document in the storage.
+	Key         string `gorm:"size:500;not null" json:"key"`
+	ContentType string `gorm:"size:100;not null" json:"content_type"`
+	Size        int64  `gorm:"not null" json:"size"`
+	// SHA256 is the checksum of the stored document, as hex.
+	SHA256 string `gorm:"size:64;not null" json:"sha256"`
+	// RetainUntil is the end of the legal retention period.
+	RetainUntil time.Time `gorm:"index;not null" json:"retain_until"`
+}
+
+// GetUserID returns the owner's user ID (implements Ownable).
+func (d *ArchivedDocument) GetUserID() uint {
+	return d.UserID
+}
+
+// RetentionEnd returns the last day documents issued on issueDate must be
+// kept: December 31st of the tenth following year.
+func RetentionEnd(issueDate time.Time) time.Time {
+	return time.Date(issueDate.Year()+RetentionYears, time.December, 31, 0, 0, 0, 0, time.UTC)
+}
+
+// Expired returns true if the retention period ended before now.
+func (d *ArchivedDocument) Expired(now time.Time) bool {
+	return now.After(d.RetainUntil.AddDate(0, 0, 1))
+}
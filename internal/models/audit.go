@@ -0,0 +1,103 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// AuditAction is the kind of change recorded by an audit entry.
+type AuditAction string
+
+const (
+	AuditCreate   AuditAction = "create"
+	AuditUpdate   AuditAction = "update"
+	AuditDelete   AuditAction = "delete"
+	AuditFinalize AuditAction = "finalize"
+)
+
+// AuditEntry records one change to an audited record. Entries are never
+// updated nor deleted, and each one holds the hash of the previous entry,
+// so that altering or removing an entry breaks the chain.
+type AuditEntry struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+	// Sequence numbers the entries of the chain from 1, without gaps.
+	Sequence  uint64    `gorm:"uniqueIndex;not null" json:"sequence"`
+	CreatedAt time.Time `json:"created_at"`
+	// ActorID is the user who made the change, 0 for the system.
+	ActorID    uint        `gorm:"index" json:"actor_id"`
+	Action     AuditAction `gorm:"size:20;not null" json:"action"`
+	EntityType string      `gorm:"size:50;not null;index:idx_audit_entity" json:"entity_type"`
+	EntityID   uint        `gorm:"index:idx_audit_entity" json:"entity_id"`
+	// Before and After are JSON objects of the columns of the record:
+	// all of them on create and delete, the changed ones on update.
+	Before   string `gorm:"type:text" json:"before,omitempty"`
+	After    string `gorm:"type:text" json:"after,omitempty"`
+	PrevHash string `gorm:"size:64" json:"prev_hash"`
+	Hash     string `gorm:"size:64;not null" json:"hash"`
+}
+
+// ComputeHash returns the SHA-256 of the entry content chained to
+// PrevHash, as hex.
+func (e *AuditEntry) ComputeHash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|%d|%s|%s|%d|%s|%s|%s",
+		e.Sequence, e.CreatedAt.UTC().Format(time.RFC3339Nano), e.ActorID, e.Action,
+		e.EntityType, e.EntityID, e.Before, e.After, e.PrevHash)))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditChange is a column changed by an audit entry.
+type AuditChange struct {
+	Field  string
+	Before any
+	After  any
+}
+
+// BeforeText returns the value before the change as text.
+func (c AuditChange) BeforeText() string { return auditText(c.Before) }
+
+// AfterText returns the value after the change as text.
+func (c AuditChange) AfterText() string { return auditText(c.After) }
+
+func auditText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// Changes returns the columns of Before and After, sorted by name.
+func (e *AuditEntry) Changes() []AuditChange {
+	var before, after map[string]any
+	_ = json.Unmarshal([]byte(e.Before), &before)
+	_ = json.Unmarshal([]byte(e.After), &after)
+
+	fields := make(map[string]bool)
+	for f := range before {
+		fields[f] = true
+	}
+	for f := range after {
+		fields[f] = true
+	}
+	changes := make([]AuditChange, 0, len(fields))
+	for f := range fields {
+		changes = append(changes, AuditChange{Field: f, Before: before[f], After: after[f]})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// AuditHead is the single row holding the end of the audit chain. It is
+// locked while an entry is appended, which serializes the writers.
+type AuditHead struct {
+	ID       uint   `gorm:"primaryKey"`
+	Sequence uint64 `gorm:"not null"`
+	Hash     string `gorm:"size:64"`
+}
@@ -29,11 +29,17 @@ type Client struct {
 	City       string `gorm:"size:100" json:"city,omitempty"`
 	PostalCode string `gorm:"size:20" json:"postal_code,omitempty"`
 	Country    string `gorm:"size:100" json:"country,omitempty"`
+	// ISO 3166-1 alpha-2 code of Country, for e-invoices when the name
+	// is not one einvoice.CountryCode knows
+	CountryCode string `gorm:"size:2" json:"country_code,omitempty"`
 
 	// Tax information
 	SIRET    string `gorm:"size:14" json:"siret,omitempty"`
 	VATNumber string `gorm:"size:20" json:"vat_number,omitempty"`
 
+	// Currency of the client's invoices, the company's if empty
+	Currency Currency `gorm:"size:3" json:"currency,omitempty"`
+
 	// Relations
 	Invoices []Invoice `gorm:"foreignKey:ClientID" json:"invoices,omitempty"`
 }
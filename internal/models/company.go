@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 
 	"gorm.io/gorm"
@@ -28,6 +30,9 @@ type CompanySettings struct {
 	City       string `gorm:"size:100" json:"city,omitempty"`
 	PostalCode string `gorm:"size:20" json:"postal_code,omitempty"`
 	Country    string `gorm:"size:100" json:"country,omitempty"`
+	// ISO 3166-1 alpha-2 code of Country, for e-invoices when the name
+	// is not one einvoice.CountryCode knows
+	CountryCode string `gorm:"size:2" json:"country_code,omitempty"`
 
 	// Tax & Legal information
 	SIRET     string `gorm:"size:14" json:"siret,omitempty"`
@@ -35,6 +40,39 @@ type CompanySettings struct {
 	RCS       string `gorm:"size:100" json:"rcs,omitempty"`
 	Capital   string `gorm:"size:100" json:"capital,omitempty"`
 
+	// VATExempt marks a business under the VAT franchise (franchise en base,
+	// e.g. micro-entrepreneurs): invoices carry no VAT and must say so.
+	VATExempt bool `gorm:"default:false" json:"vat_exempt"`
+
+	// Invoicing preferences
+	Rounding RoundingPolicy `gorm:"size:10;not null;default:'rate'" json:"rounding"`
+	// Currency is the base currency, in which revenue is reported
+	Currency Currency `gorm:"size:3;not null;default:'EUR'" json:"currency"`
+
+	// Payment terms: invoices are due PaymentTermDays after issue, at the
+	// end of that month if PaymentTermEndOfMonth ("30 jours fin de mois")
+	PaymentTermDays       int  `gorm:"not null;default:30" json:"payment_term_days"`
+	PaymentTermEndOfMonth bool `gorm:"default:false" json:"payment_term_end_of_month"`
+
+	// LatePenaltyRate is the annual late-payment penalty rate agreed with
+	// clients (0.10 for 10%). Zero means the legal default, the ECB rate
+	// plus 10 points, which is printed only: penalties cannot be computed
+	// until a rate is set.
+	LatePenaltyRate float64 `gorm:"default:0" json:"late_penalty_rate"`
+
+	// ReminderSchedule lists the days after the due date at which payment
+	// reminders are emailed, e.g. "7,15,30". Empty disables reminders.
+	ReminderSchedule string `gorm:"size:100" json:"reminder_schedule,omitempty"`
+
+	// Accounting accounts of the journal entries exported in the FEC, see
+	// Accounts. VATAccounts lists the rates with their own VAT account,
+	// e.g. "20=445711,5.5=445713".
+	ClientAccount  string `gorm:"size:20;not null;default:'411'" json:"client_account"`
+	RevenueAccount string `gorm:"size:20;not null;default:'706'" json:"revenue_account"`
+	VATAccount     string `gorm:"size:20;not null;default:'44571'" json:"vat_account"`
+	VATAccounts    string `gorm:"size:255" json:"vat_accounts,omitempty"`
+	BankAccount    string `gorm:"size:20;not null;default:'512'" json:"bank_account"`
+
 	// Branding
 	LogoURL string `gorm:"size:500" json:"logo_url,omitempty"`
 }
@@ -43,3 +81,62 @@ type CompanySettings struct {
 func (c *CompanySettings) GetUserID() uint {
 	return c.UserID
 }
+
+// DueDate returns the due date of an invoice issued on issueDate under the
+// company's payment terms.
+func (c *CompanySettings) DueDate(issueDate time.Time) time.Time {
+	due := issueDate.AddDate(0, 0, c.PaymentTermDays)
+	if c.PaymentTermEndOfMonth {
+		due = time.Date(due.Year(), due.Month()+1, 0, 0, 0, 0, 0, due.Location())
+	}
+	return due
+}
+
+// PaymentTermsText describes the company's payment terms, as printed on
+// invoices that have no specific terms.
+func (c *CompanySettings) PaymentTermsText() string {
+	switch {
+	case c.PaymentTermDays <= 0 && !c.PaymentTermEndOfMonth:
+		return "Paiement à réception de facture"
+	case c.PaymentTermEndOfMonth:
+		return fmt.Sprintf("Paiement à %d jours fin de mois", c.PaymentTermDays)
+	default:
+		return fmt.Sprintf("Paiement à %d jours", c.PaymentTermDays)
+	}
+}
+
+// LatePenaltyPercent formats the penalty rate in percent, empty for the
+// legal default.
+func (c *CompanySettings) LatePenaltyPercent() string {
+	if c.LatePenaltyRate <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(c.LatePenaltyRate*100, 'f', -1, 64)
+}
+
+// LatePaymentMentions returns the late-payment mentions required on B2B
+// invoices (art. L441-9 du Code de commerce): the penalty rate, the fixed
+// recovery indemnity and the absence of early payment discount.
+func (c *CompanySettings) LatePaymentMentions() []string {
+	rate := "taux directeur de la BCE majoré de 10 points"
+	if c.LatePenaltyRate > 0 {
+		rate = "taux annuel de " + c.LatePenaltyPercent() + " %"
+	}
+	return []string{
+		"En cas de retard de paiement, pénalités au " + rate + ", exigibles dès le lendemain de l'échéance",
+		"Indemnité forfaitaire pour frais de recouvrement : " + RecoveryIndemnity.String() + " € (art. D441-5 du Code de commerce)",
+		"Pas d'escompte pour paiement anticipé",
+	}
+}
+
+// VATExemptionMention is the legal mention required on invoices of
+// businesses under the VAT franchise.
+const VATExemptionMention = "TVA non applicable, art. 293 B du CGI"
+
+// VATMentions returns the VAT-related legal mentions to print on invoices.
+func (c *CompanySettings) VATMentions() []string {
+	if c.VATExempt {
+		return []string{VATExemptionMention}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package models
+
+import "strings"
+
+// ParseCountryCode normalizes an ISO 3166-1 alpha-2 country code. An empty
+// code is valid: the country name is used instead. It returns false if the
+// code is not two letters.
+func ParseCountryCode(s string) (string, bool) {
+	code := strings.ToUpper(strings.TrimSpace(s))
+	if code == "" {
+		return "", true
+	}
+	if len(code) != 2 {
+		return code, false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return code, false
+		}
+	}
+	return code, true
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Currency is an ISO 4217 currency code.
+type Currency string
+
+const (
+	CurrencyEUR Currency = "EUR"
+	CurrencyGBP Currency = "GBP"
+	CurrencyUSD Currency = "USD"
+	CurrencyCHF Currency = "CHF"
+)
+
+// DefaultCurrency is the currency of documents and companies that do not
+// set one.
+const DefaultCurrency = CurrencyEUR
+
+// Currencies lists the supported currencies, in display order.
+var Currencies = []Currency{
+	CurrencyEUR,
+	CurrencyGBP,
+	CurrencyUSD,
+	CurrencyCHF,
+}
+
+// currencySymbols maps currencies to their symbol, and whether the symbol
+// goes before the amount.
+var currencySymbols = map[Currency]struct {
+	symbol string
+	prefix bool
+}{
+	CurrencyEUR: {"€", false},
+	CurrencyGBP: {"£", true},
+	CurrencyUSD: {"$", true},
+	CurrencyCHF: {"CHF", false},
+}
+
+// ParseCurrency normalizes a currency code. It returns false if the
+// currency is not supported.
+func ParseCurrency(s string) (Currency, bool) {
+	c := Currency(strings.ToUpper(strings.TrimSpace(s)))
+	return c, c.IsValid()
+}
+
+// IsValid returns true if c is one of the supported currencies.
+func (c Currency) IsValid() bool {
+	_, ok := currencySymbols[c]
+	return ok
+}
+
+// OrDefault returns c, or the default currency if c is not set.
+func (c Currency) OrDefault() Currency {
+	if c == "" {
+		return DefaultCurrency
+	}
+	return c
+}
+
+// Symbol returns the symbol of the currency, or its code if it has none.
+func (c Currency) Symbol() string {
+	c = c.OrDefault()
+	if s, ok := currencySymbols[c]; ok {
+		return s.symbol
+	}
+	return string(c)
+}
+
+// Format formats an amount in the currency, e.g. "1234.50 €" or "£1234.50".
+func (c Currency) Format(m Money) string {
+	c = c.OrDefault()
+	if s, ok := currencySymbols[c]; ok && s.prefix {
+		if m < 0 {
+			return "-" + s.symbol + (-m).String()
+		}
+		return s.symbol + m.String()
+	}
+	return m.String() + " " + c.Symbol()
+}
+
+// ExchangeRate is a rate entered by a user to convert amounts in Currency
+// to their base currency, valid from Date until the next rate.
+type ExchangeRate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// UserID is the owner of this rate (for multi-tenant isolation)
+	UserID uint `gorm:"index;not null;uniqueIndex:idx_exchange_rate" json:"user_id"`
+
+	Currency     Currency  `gorm:"size:3;not null;uniqueIndex:idx_exchange_rate" json:"currency"`
+	BaseCurrency Currency  `gorm:"size:3;not null;uniqueIndex:idx_exchange_rate" json:"base_currency"`
+	Date         time.Time `gorm:"type:date;not null;uniqueIndex:idx_exchange_rate" json:"date"`
+	// Rate is the value of one unit of Currency in BaseCurrency
+	Rate float64 `gorm:"not null" json:"rate"`
+}
+
+// GetUserID implements the Ownable interface for authorization.
+func (r *ExchangeRate) GetUserID() uint {
+	return r.UserID
+}
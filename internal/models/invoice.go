@@ -1,7 +1,8 @@
 package models
 
 import (
-	"fmt"
+	"math"
+	"sort"
 	"time"
 
 	"gorm.io/gorm"
@@ -17,6 +18,18 @@ const (
 	InvoiceStatusCancelled InvoiceStatus = "cancelled"
 )
 
+// InvoiceType distinguishes invoices from the documents that correct them
+// and from deposit invoices.
+type InvoiceType string
+
+const (
+	InvoiceTypeInvoice    InvoiceType = "invoice"
+	InvoiceTypeCreditNote InvoiceType = "credit_note"
+	// InvoiceTypeDeposit is a deposit invoice (facture d'acompte), deducted
+	// from the final invoice of the quote or parent invoice it belongs to.
+	InvoiceTypeDeposit InvoiceType = "deposit"
+)
+
 // Invoice represents a billing invoice.
 // Implements the Ownable interface for ownership-based authorization.
 type Invoice struct {
@@ -26,12 +39,34 @@ type Invoice struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 
 	// UserID is the owner of this invoice (for multi-tenant isolation)
-	UserID uint `gorm:"index;not null" json:"user_id"`
+	UserID uint `gorm:"index;not null;uniqueIndex:idx_invoice_user_number" json:"user_id"`
 	User   User `gorm:"foreignKey:UserID" json:"-"`
 
-	// Invoice identification
-	Number    string `gorm:"size:50;uniqueIndex" json:"number"`
-	Reference string `gorm:"size:100" json:"reference,omitempty"`
+	// Invoice identification (numbers are unique per issuer, see NumberingSequence)
+	Number    string      `gorm:"size:50;uniqueIndex:idx_invoice_user_number" json:"number"`
+	Reference string      `gorm:"size:100" json:"reference,omitempty"`
+	Type      InvoiceType `gorm:"size:20;not null;default:'invoice'" json:"type"`
+
+	// Credit notes point to the invoice they correct
+	OriginalInvoiceID *uint     `gorm:"index" json:"original_invoice_id,omitempty"`
+	OriginalInvoice   *Invoice  `gorm:"foreignKey:OriginalInvoiceID" json:"-"`
+	CreditNotes       []Invoice `gorm:"foreignKey:OriginalInvoiceID" json:"credit_notes,omitempty"`
+
+	// Deposits and final invoices point to the quote they invoice, and
+	// deposits to the final invoice they are deducted from
+	QuoteID         *uint     `gorm:"index" json:"quote_id,omitempty"`
+	ParentInvoiceID *uint     `gorm:"index" json:"parent_invoice_id,omitempty"`
+	ParentInvoice   *Invoice  `gorm:"foreignKey:ParentInvoiceID" json:"-"`
+	Deposits        []Invoice `gorm:"foreignKey:ParentInvoiceID" json:"deposits,omitempty"`
+
+	// Penalty invoices point to the invoice paid late that they charge
+	PenalizedInvoiceID *uint    `gorm:"index" json:"penalized_invoice_id,omitempty"`
+	PenalizedInvoice   *Invoice `gorm:"foreignKey:PenalizedInvoiceID" json:"-"`
+
+	// Invoices generated from a recurring invoice record the occurrence, so
+	// that each one is generated once
+	RecurringInvoiceID *uint      `gorm:"uniqueIndex:idx_invoice_recurrence" json:"recurring_invoice_id,omitempty"`
+	RecurrenceDate     *time.Time `gorm:"uniqueIndex:idx_invoice_recurrence" json:"recurrence_date,omitempty"`
 
 	// Client relationship
 	ClientID uint    `gorm:"index;not null" json:"client_id"`
@@ -41,17 +76,44 @@ type Invoice struct {
 	IssueDate time.Time  `gorm:"not null" json:"issue_date"`
 	DueDate   time.Time  `gorm:"not null" json:"due_date"`
 	PaidDate  *time.Time `json:"paid_date,omitempty"`
+	// SentAt is when the invoice was first sent to the client, if marked so
+	SentAt *time.Time `json:"sent_at,omitempty"`
 
 	// Status
 	Status InvoiceStatus `gorm:"size:20;default:'draft'" json:"status"`
 
+	// VAT rounding policy, copied from the company settings when the
+	// invoice is created and frozen at finalization
+	Rounding RoundingPolicy `gorm:"size:10;not null;default:'rate'" json:"rounding"`
+
+	// Currency of the amounts, defaulted from the client. ExchangeRate
+	// converts them to BaseCurrency, the company's currency; both are
+	// captured at finalization.
+	Currency     Currency `gorm:"size:3;not null;default:'EUR'" json:"currency"`
+	BaseCurrency Currency `gorm:"size:3" json:"base_currency,omitempty"`
+	ExchangeRate float64  `gorm:"not null;default:1" json:"exchange_rate"`
+
 	// Notes and terms
 	Notes          string `gorm:"type:text" json:"notes,omitempty"`
 	PaymentTerms   string `gorm:"size:500" json:"payment_terms,omitempty"`
 	FooterText     string `gorm:"type:text" json:"footer_text,omitempty"`
 
+	// Client and issuer as they were at finalization
+	ClientSnapshot  *ClientSnapshot  `gorm:"serializer:json;type:text" json:"client_snapshot,omitempty"`
+	CompanySnapshot *CompanySnapshot `gorm:"serializer:json;type:text" json:"company_snapshot,omitempty"`
+
+	// Seal of the finalized invoice: the hash of its content chained to
+	// the previous sealed invoice of the user (see SealPayload)
+	SealSequence uint       `gorm:"index" json:"seal_sequence,omitempty"`
+	SealHash     string     `gorm:"size:64" json:"seal_hash,omitempty"`
+	SealPrevHash string     `gorm:"size:64" json:"-"`
+	SealedAt     *time.Time `json:"sealed_at,omitempty"`
+
 	// Invoice items
 	Items []InvoiceItem `gorm:"foreignKey:InvoiceID" json:"items,omitempty"`
+
+	// Payments received against this invoice
+	Payments []Payment `gorm:"foreignKey:InvoiceID" json:"payments,omitempty"`
 }
 
 // GetUserID implements the Ownable interface for authorization.
@@ -64,39 +126,192 @@ func (i *Invoice) IsDraft() bool {
 	return i.Status == InvoiceStatusDraft
 }
 
+// IsCreditNote returns true if the document is a credit note (avoir).
+func (i *Invoice) IsCreditNote() bool {
+	return i.Type == InvoiceTypeCreditNote
+}
+
+// IsDeposit returns true if the document is a deposit invoice (acompte).
+func (i *Invoice) IsDeposit() bool {
+	return i.Type == InvoiceTypeDeposit
+}
+
+// IsPenalty returns true if the document charges the late-payment
+// penalties of another invoice.
+func (i *Invoice) IsPenalty() bool {
+	return i.PenalizedInvoiceID != nil
+}
+
+// CanTakeDeposits returns true if deposit invoices can still be issued
+// against this invoice: it is a draft final invoice.
+func (i *Invoice) CanTakeDeposits() bool {
+	return i.IsDraft() && (i.Type == InvoiceTypeInvoice || i.Type == "")
+}
+
+// CanCredit returns true if a credit note can be issued against this document.
+// Only finalized invoices can be corrected; drafts are simply edited.
+func (i *Invoice) CanCredit() bool {
+	return !i.IsCreditNote() && i.IsFinal()
+}
+
 // IsFinal returns true if the invoice has been finalized.
 func (i *Invoice) IsFinal() bool {
 	return i.Status == InvoiceStatusFinal || i.Status == InvoiceStatusPaid
 }
 
+// IsOverdue returns true if the invoice is finalized, not paid and its due
+// date is before the day of now. Credit notes are never overdue.
+func (i *Invoice) IsOverdue(now time.Time) bool {
+	return i.DaysOverdue(now) > 0
+}
+
+// DaysOverdue returns the number of days since the due date of an unpaid
+// finalized invoice, 0 if it is not overdue.
+func (i *Invoice) DaysOverdue(now time.Time) int {
+	if i.Status != InvoiceStatusFinal || i.IsCreditNote() || i.DueDate.IsZero() {
+		return 0
+	}
+	due := time.Date(i.DueDate.Year(), i.DueDate.Month(), i.DueDate.Day(), 0, 0, 0, 0, time.UTC)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return max(int(today.Sub(due).Hours()/24), 0)
+}
+
 // CanEdit returns true if the invoice can still be edited.
 func (i *Invoice) CanEdit() bool {
 	return i.Status == InvoiceStatusDraft
 }
 
 // TotalHT calculates the total excluding VAT.
-func (i *Invoice) TotalHT() float64 {
-	var total float64
+func (i *Invoice) TotalHT() Money {
+	var total Money
 	for _, item := range i.Items {
 		total += item.TotalHT()
 	}
 	return total
 }
 
-// TotalVAT calculates the total VAT amount.
-func (i *Invoice) TotalVAT() float64 {
-	var total float64
+// HasLines returns true if the invoice has at least one priced line.
+func (i *Invoice) HasLines() bool {
 	for _, item := range i.Items {
-		total += item.TotalVAT()
+		if item.IsLine() {
+			return true
+		}
+	}
+	return false
+}
+
+// Subtotal returns the total excluding VAT of the lines between item n and
+// the previous section title or subtotal, as shown by a subtotal at n.
+// Items must be in position order.
+func (i *Invoice) Subtotal(n int) Money {
+	var total Money
+	for k := min(n, len(i.Items)) - 1; k >= 0; k-- {
+		item := i.Items[k]
+		if !item.IsLine() {
+			break
+		}
+		total += item.TotalHT()
+	}
+	return total
+}
+
+// TotalVAT calculates the total VAT amount, i.e. the sum of the VAT
+// breakdown.
+func (i *Invoice) TotalVAT() Money {
+	var total Money
+	for _, line := range i.VATBreakdown() {
+		total += line.VAT
 	}
 	return total
 }
 
 // TotalTTC calculates the total including VAT.
-func (i *Invoice) TotalTTC() float64 {
+func (i *Invoice) TotalTTC() Money {
 	return i.TotalHT() + i.TotalVAT()
 }
 
+// VATLine is one row of the VAT summary: the taxable base and the VAT
+// amount of all lines sharing a rate.
+type VATLine struct {
+	Rate float64 `json:"rate"`
+	Base Money   `json:"base"`
+	VAT  Money   `json:"vat"`
+}
+
+// RatePercent returns the rate as a percentage (e.g., 5.5 for 5.5%).
+func (l VATLine) RatePercent() float64 {
+	return math.Round(l.Rate*10000) / 100
+}
+
+// VATBreakdown groups the lines by VAT rate, highest rate first. The VAT of
+// each rate is rounded once on its base, or summed from the rounded lines
+// under RoundingPerLine.
+func (i *Invoice) VATBreakdown() []VATLine {
+	var lines []VATLine
+	index := make(map[float64]int)
+	for _, item := range i.Items {
+		if !item.IsLine() {
+			continue
+		}
+		n, ok := index[item.VATRate]
+		if !ok {
+			n = len(lines)
+			index[item.VATRate] = n
+			lines = append(lines, VATLine{Rate: item.VATRate})
+		}
+		lines[n].Base += item.TotalHT()
+		lines[n].VAT += item.TotalVAT()
+	}
+
+	if i.Rounding.OrDefault() == RoundingPerRate {
+		for n := range lines {
+			lines[n].VAT = lines[n].Base.Mul(lines[n].Rate)
+		}
+	}
+	sort.Slice(lines, func(a, b int) bool { return lines[a].Rate > lines[b].Rate })
+	return lines
+}
+
+// AmountPaid sums the payments received. Payments must be preloaded.
+func (i *Invoice) AmountPaid() Money {
+	var total Money
+	for _, p := range i.Payments {
+		total += p.Amount
+	}
+	return total
+}
+
+// Balance returns the amount still due: the total TTC, reduced by credit
+// notes issued against the invoice and by payments received.
+// Payments and CreditNotes.Items must be preloaded.
+func (i *Invoice) Balance() Money {
+	balance := i.TotalTTC() - i.AmountPaid()
+	for _, cn := range i.CreditNotes {
+		balance += cn.TotalTTC()
+	}
+	return balance
+}
+
+// Format formats an amount in the invoice currency.
+func (i *Invoice) Format(m Money) string {
+	return i.Currency.OrDefault().Format(m)
+}
+
+// IsForeignCurrency returns true if the invoice was finalized in another
+// currency than the company's.
+func (i *Invoice) IsForeignCurrency() bool {
+	return i.BaseCurrency != "" && i.Currency.OrDefault() != i.BaseCurrency
+}
+
+// ToBase converts an amount of the invoice to the base currency at the
+// exchange rate captured at finalization.
+func (i *Invoice) ToBase(m Money) Money {
+	if !i.IsForeignCurrency() || i.ExchangeRate <= 0 {
+		return m
+	}
+	return m.Mul(i.ExchangeRate)
+}
+
 // InvoiceItem represents a line item on an invoice.
 type InvoiceItem struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
@@ -112,41 +327,117 @@ type InvoiceItem struct {
 	ProductID *uint    `gorm:"index" json:"product_id,omitempty"`
 	Product   *Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
 
+	// Product as it was at finalization
+	ProductSnapshot *ProductSnapshot `gorm:"serializer:json;type:text" json:"product_snapshot,omitempty"`
+
+	// On credit notes, the original invoice line this line reverses
+	CreditedItemID *uint `gorm:"index" json:"credited_item_id,omitempty"`
+
+	// On final invoices, the deposit invoice this line deducts
+	DepositInvoiceID *uint `gorm:"index" json:"deposit_invoice_id,omitempty"`
+
 	// Item details (copied from product or custom)
 	Description string  `gorm:"size:500;not null" json:"description"`
 	Quantity    float64 `gorm:"type:decimal(10,3);not null;default:1" json:"quantity"`
-	UnitPrice   float64 `gorm:"type:decimal(10,2);not null" json:"unit_price"`
+	UnitPrice   Money   `gorm:"type:decimal(10,2);not null" json:"unit_price"`
 	Unit        string  `gorm:"size:50;default:'unit'" json:"unit"`
 	VATRate     float64 `gorm:"type:decimal(5,4);not null" json:"vat_rate"`
 
+	// Section titles and subtotals structure the document between the
+	// lines; they carry no amount
+	Kind ItemKind `gorm:"size:20;not null;default:'line'" json:"kind"`
+
+	// Discount on the line: a rate (e.g., 0.1 for 10%) or an amount, not both
+	DiscountRate   float64 `gorm:"type:decimal(5,4);not null;default:0" json:"discount_rate,omitempty"`
+	DiscountAmount Money   `gorm:"type:decimal(10,2);not null;default:0" json:"discount_amount,omitempty"`
+
 	// Position for ordering
 	Position int `gorm:"default:0" json:"position"`
 }
 
-// TotalHT calculates the line total excluding VAT.
-func (item *InvoiceItem) TotalHT() float64 {
-	return item.Quantity * item.UnitPrice
+// ItemKind distinguishes the priced lines of an invoice from the lines
+// that only structure it.
+type ItemKind string
+
+const (
+	ItemKindLine ItemKind = "line"
+	// ItemKindSection is a section title, its Description the title.
+	ItemKindSection ItemKind = "section"
+	// ItemKindSubtotal shows the total excluding VAT of the lines since the
+	// previous section or subtotal.
+	ItemKindSubtotal ItemKind = "subtotal"
+)
+
+// IsValid returns true if k is a known kind.
+func (k ItemKind) IsValid() bool {
+	return k == ItemKindLine || k == ItemKindSection || k == ItemKindSubtotal
 }
 
-// TotalVAT calculates the VAT amount for this line.
-func (item *InvoiceItem) TotalVAT() float64 {
-	return item.TotalHT() * item.VATRate
+// IsLine returns true if the item is a priced line. Items without kind,
+// such as the lines of quotes, are.
+func (item *InvoiceItem) IsLine() bool {
+	return item.Kind == "" || item.Kind == ItemKindLine
 }
 
-// TotalTTC calculates the line total including VAT.
-func (item *InvoiceItem) TotalTTC() float64 {
-	return item.TotalHT() + item.TotalVAT()
+// IsSection returns true if the item is a section title.
+func (item *InvoiceItem) IsSection() bool {
+	return item.Kind == ItemKindSection
+}
+
+// IsSubtotal returns true if the item is a subtotal.
+func (item *InvoiceItem) IsSubtotal() bool {
+	return item.Kind == ItemKindSubtotal
 }
 
-// GenerateInvoiceNumber generates a unique invoice number.
-// Format: INV-YYYY-NNNN (e.g., INV-2025-0001)
-func GenerateInvoiceNumber(db *gorm.DB, userID uint, year int) (string, error) {
-	var count int64
-	err := db.Model(&Invoice{}).
-		Where("user_id = ? AND EXTRACT(YEAR FROM issue_date) = ?", userID, year).
-		Count(&count).Error
-	if err != nil {
-		return "", err
+// GrossHT calculates the line total excluding VAT before discount,
+// rounded to the cent.
+func (item *InvoiceItem) GrossHT() Money {
+	if !item.IsLine() {
+		return 0
 	}
-	return fmt.Sprintf("INV-%d-%04d", year, count+1), nil
+	return item.UnitPrice.Mul(item.Quantity)
+}
+
+// Discount returns the discount on the line, rounded to the cent.
+func (item *InvoiceItem) Discount() Money {
+	if !item.IsLine() {
+		return 0
+	}
+	if item.DiscountRate != 0 {
+		return item.GrossHT().Mul(item.DiscountRate)
+	}
+	return item.DiscountAmount
+}
+
+// HasDiscount returns true if the line is discounted.
+func (item *InvoiceItem) HasDiscount() bool {
+	return item.Discount() != 0
+}
+
+// VATPercent returns the VAT rate as a percentage (e.g., 5.5 for 5.5%).
+func (item *InvoiceItem) VATPercent() float64 {
+	return math.Round(item.VATRate*10000) / 100
+}
+
+// DiscountPercent returns the discount rate as a percentage (e.g., 10 for
+// 10%).
+func (item *InvoiceItem) DiscountPercent() float64 {
+	return math.Round(item.DiscountRate*10000) / 100
+}
+
+// TotalHT calculates the line total excluding VAT after discount, rounded
+// to the cent. Section titles and subtotals count for nothing.
+func (item *InvoiceItem) TotalHT() Money {
+	return item.GrossHT() - item.Discount()
+}
+
+// TotalVAT calculates the VAT amount for this line, rounded to the cent.
+// Invoice.TotalVAT only sums these under RoundingPerLine.
+func (item *InvoiceItem) TotalVAT() Money {
+	return item.TotalHT().Mul(item.VATRate)
+}
+
+// TotalTTC calculates the line total including VAT.
+func (item *InvoiceItem) TotalTTC() Money {
+	return item.TotalHT() + item.TotalVAT()
 }
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// InvoiceEmail records an invoice emailed to a client from the app,
+// successfully or not.
+type InvoiceEmail struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID    uint `gorm:"index;not null" json:"user_id"`
+	InvoiceID uint `gorm:"index;not null" json:"invoice_id"`
+	// SentByID is the user who sent the email.
+	SentByID uint  `gorm:"not null" json:"sent_by_id"`
+	SentBy   *User `gorm:"foreignKey:SentByID" json:"-"`
+
+	Recipient string `gorm:"size:255;not null" json:"recipient"`
+	Subject   string `gorm:"size:255" json:"subject"`
+	// MessageID is the Message-ID header of the email, to trace it in mail
+	// server logs.
+	MessageID string `gorm:"size:255" json:"message_id"`
+	// Error is why the email could not be sent; empty if it was.
+	Error string `gorm:"size:500" json:"error,omitempty"`
+}
+
+// GetUserID returns the owner's user ID (implements Ownable).
+func (e *InvoiceEmail) GetUserID() uint {
+	return e.UserID
+}
+
+// Sent returns true if the email was accepted by the mail server.
+func (e *InvoiceEmail) Sent() bool {
+	return e.Error == ""
+}
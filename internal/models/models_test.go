@@ -1,7 +1,12 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestProduct_GetUserID(t *testing.T) {
@@ -14,32 +19,31 @@ func TestProduct_GetUserID(t *testing.T) {
 func TestProduct_PriceWithVAT(t *testing.T) {
 	tests := []struct {
 		name      string
-		unitPrice float64
+		unitPrice Money
 		vatRate   float64
-		want      float64
+		want      Money
 	}{
-		{"20% VAT on €100", 100, 0.20, 120},
-		{"10% VAT on €50", 50, 0.10, 55},
-		{"0% VAT", 100, 0, 100},
-		{"5.5% VAT", 100, 0.055, 105.5},
+		{"20% VAT on €100", 10000, 0.20, 12000},
+		{"10% VAT on €50", 5000, 0.10, 5500},
+		{"0% VAT", 10000, 0, 10000},
+		{"5.5% VAT", 10000, 0.055, 10550},
+		{"VAT rounded to the cent", 999, 0.055, 1054},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &Product{UnitPrice: tt.unitPrice, VATRate: tt.vatRate}
-			got := p.PriceWithVAT()
-			// Use a small epsilon for floating point comparison
-			if diff := got - tt.want; diff > 0.001 || diff < -0.001 {
-				t.Errorf("PriceWithVAT() = %f, want %f", got, tt.want)
+			if got := p.PriceWithVAT(); got != tt.want {
+				t.Errorf("PriceWithVAT() = %s, want %s", got, tt.want)
 			}
 		})
 	}
 }
 
 func TestProduct_VATAmount(t *testing.T) {
-	p := &Product{UnitPrice: 100, VATRate: 0.20}
-	if got := p.VATAmount(); got != 20 {
-		t.Errorf("VATAmount() = %f, want 20", got)
+	p := &Product{UnitPrice: 10000, VATRate: 0.20}
+	if got := p.VATAmount(); got != 2000 {
+		t.Errorf("VATAmount() = %s, want 20.00", got)
 	}
 }
 
@@ -144,49 +148,778 @@ func TestInvoice_Status(t *testing.T) {
 func TestInvoice_Totals(t *testing.T) {
 	invoice := &Invoice{
 		Items: []InvoiceItem{
-			{Quantity: 2, UnitPrice: 100, VATRate: 0.20},   // HT: 200, VAT: 40
-			{Quantity: 1, UnitPrice: 50, VATRate: 0.10},    // HT: 50, VAT: 5
-			{Quantity: 3, UnitPrice: 10, VATRate: 0.055},   // HT: 30, VAT: 1.65
+			{Quantity: 2, UnitPrice: 10000, VATRate: 0.20}, // HT: 200, VAT: 40
+			{Quantity: 1, UnitPrice: 5000, VATRate: 0.10},  // HT: 50, VAT: 5
+			{Quantity: 3, UnitPrice: 1000, VATRate: 0.055}, // HT: 30, VAT: 1.65
 		},
 	}
 
 	// Total HT should be 200 + 50 + 30 = 280
-	if got := invoice.TotalHT(); got != 280 {
-		t.Errorf("TotalHT() = %f, want 280", got)
+	if got := invoice.TotalHT(); got != 28000 {
+		t.Errorf("TotalHT() = %s, want 280.00", got)
 	}
 
 	// Total VAT should be 40 + 5 + 1.65 = 46.65
-	expectedVAT := 46.65
-	if got := invoice.TotalVAT(); got != expectedVAT {
-		t.Errorf("TotalVAT() = %f, want %f", got, expectedVAT)
+	if got := invoice.TotalVAT(); got != 4665 {
+		t.Errorf("TotalVAT() = %s, want 46.65", got)
 	}
 
 	// Total TTC should be HT + VAT = 280 + 46.65 = 326.65
-	expectedTTC := 326.65
-	if got := invoice.TotalTTC(); got != expectedTTC {
-		t.Errorf("TotalTTC() = %f, want %f", got, expectedTTC)
+	if got := invoice.TotalTTC(); got != 32665 {
+		t.Errorf("TotalTTC() = %s, want 326.65", got)
+	}
+}
+
+func TestInvoice_RoundingPolicy(t *testing.T) {
+	// Three lines at 0.10 HT and 5.5% VAT: each line carries 0.0055 of VAT.
+	items := []InvoiceItem{
+		{Quantity: 1, UnitPrice: 10, VATRate: 0.055},
+		{Quantity: 1, UnitPrice: 10, VATRate: 0.055},
+		{Quantity: 1, UnitPrice: 10, VATRate: 0.055},
+	}
+
+	tests := []struct {
+		rounding RoundingPolicy
+		vat      Money
+	}{
+		{RoundingPerLine, 3}, // 0.01 + 0.01 + 0.01
+		{RoundingPerRate, 2}, // 0.30 * 5.5% = 0.0165
+		{"", 2},              // defaults to per rate
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.rounding), func(t *testing.T) {
+			invoice := &Invoice{Rounding: tt.rounding, Items: items}
+			if got := invoice.TotalVAT(); got != tt.vat {
+				t.Errorf("TotalVAT() = %s, want %s", got, tt.vat)
+			}
+			if got := invoice.TotalTTC(); got != invoice.TotalHT()+tt.vat {
+				t.Errorf("TotalTTC() = %s, want HT + VAT", got)
+			}
+		})
+	}
+}
+
+func TestInvoice_TotalsReconcile(t *testing.T) {
+	// Amounts that drift with float64: 0.1 + 0.2 != 0.3
+	invoice := &Invoice{
+		Items: []InvoiceItem{
+			{Quantity: 1, UnitPrice: 10, VATRate: 0.20},
+			{Quantity: 1, UnitPrice: 20, VATRate: 0.20},
+			{Quantity: 3, UnitPrice: 3333, VATRate: 0.20},
+			{Quantity: 0.333, UnitPrice: 1999, VATRate: 0.10},
+		},
+	}
+
+	var lines Money
+	for _, item := range invoice.Items {
+		lines += item.TotalHT()
+	}
+	if got := invoice.TotalHT(); got != lines || got != 10695 {
+		t.Errorf("TotalHT() = %s, want 106.95 (sum of lines %s)", got, lines)
+	}
+
+	// 20%: 100.29 * 0.2 = 20.058 -> 20.06; 10%: 6.66 * 0.1 = 0.666 -> 0.67
+	if got := invoice.TotalVAT(); got != 2073 {
+		t.Errorf("TotalVAT() = %s, want 20.73", got)
+	}
+	if got := invoice.TotalTTC(); got != 12768 {
+		t.Errorf("TotalTTC() = %s, want 127.68", got)
+	}
+}
+
+func TestInvoice_VATBreakdown(t *testing.T) {
+	items := []InvoiceItem{
+		{Quantity: 1, UnitPrice: 1010, VATRate: 0.055},
+		{Quantity: 2, UnitPrice: 10000, VATRate: 0.20},
+		{Quantity: 1, UnitPrice: 1010, VATRate: 0.055},
+		{Quantity: 1, UnitPrice: 5000, VATRate: 0},
+		{Quantity: 3, UnitPrice: 333, VATRate: 0.10},
+	}
+
+	tests := []struct {
+		rounding RoundingPolicy
+		want     []VATLine
+	}{
+		{RoundingPerRate, []VATLine{
+			{Rate: 0.20, Base: 20000, VAT: 4000},
+			{Rate: 0.10, Base: 999, VAT: 100},
+			{Rate: 0.055, Base: 2020, VAT: 111}, // 20.20 * 5.5% = 1.111
+			{Rate: 0, Base: 5000, VAT: 0},
+		}},
+		{RoundingPerLine, []VATLine{
+			{Rate: 0.20, Base: 20000, VAT: 4000},
+			{Rate: 0.10, Base: 999, VAT: 100},
+			{Rate: 0.055, Base: 2020, VAT: 112}, // 2 * round(0.5555)
+			{Rate: 0, Base: 5000, VAT: 0},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.rounding), func(t *testing.T) {
+			invoice := &Invoice{Rounding: tt.rounding, Items: items}
+			got := invoice.VATBreakdown()
+			if len(got) != len(tt.want) {
+				t.Fatalf("VATBreakdown() = %v, want %v", got, tt.want)
+			}
+			var base, vat Money
+			for n := range got {
+				if got[n] != tt.want[n] {
+					t.Errorf("VATBreakdown()[%d] = %+v, want %+v", n, got[n], tt.want[n])
+				}
+				base += got[n].Base
+				vat += got[n].VAT
+			}
+			if base != invoice.TotalHT() || vat != invoice.TotalVAT() {
+				t.Errorf("breakdown sums to %s / %s, want TotalHT %s / TotalVAT %s",
+					base, vat, invoice.TotalHT(), invoice.TotalVAT())
+			}
+		})
+	}
+}
+
+func TestVATLine_RatePercent(t *testing.T) {
+	if got := (VATLine{Rate: 0.055}).RatePercent(); got != 5.5 {
+		t.Errorf("RatePercent() = %v, want 5.5", got)
+	}
+}
+
+func TestCompanySettings_VATMentions(t *testing.T) {
+	exempt := &CompanySettings{VATExempt: true}
+	if got := exempt.VATMentions(); len(got) != 1 || got[0] != "TVA non applicable, art. 293 B du CGI" {
+		t.Errorf("VATMentions() = %v", got)
+	}
+	if got := (&CompanySettings{}).VATMentions(); len(got) != 0 {
+		t.Errorf("VATMentions() = %v, want none", got)
 	}
 }
 
 func TestInvoiceItem_Totals(t *testing.T) {
 	item := &InvoiceItem{
 		Quantity:  5,
-		UnitPrice: 20,
+		UnitPrice: 2000,
 		VATRate:   0.20,
 	}
 
 	// HT = 5 * 20 = 100
-	if got := item.TotalHT(); got != 100 {
-		t.Errorf("TotalHT() = %f, want 100", got)
+	if got := item.TotalHT(); got != 10000 {
+		t.Errorf("TotalHT() = %s, want 100.00", got)
 	}
 
 	// VAT = 100 * 0.20 = 20
-	if got := item.TotalVAT(); got != 20 {
-		t.Errorf("TotalVAT() = %f, want 20", got)
+	if got := item.TotalVAT(); got != 2000 {
+		t.Errorf("TotalVAT() = %s, want 20.00", got)
 	}
 
 	// TTC = 100 + 20 = 120
-	if got := item.TotalTTC(); got != 120 {
-		t.Errorf("TotalTTC() = %f, want 120", got)
+	if got := item.TotalTTC(); got != 12000 {
+		t.Errorf("TotalTTC() = %s, want 120.00", got)
+	}
+}
+
+func TestInvoiceItem_Discount(t *testing.T) {
+	tests := []struct {
+		name string
+		item InvoiceItem
+		want Money
+	}{
+		{"none", InvoiceItem{Quantity: 3, UnitPrice: 3333}, 9999},
+		{"rate", InvoiceItem{Quantity: 3, UnitPrice: 3333, DiscountRate: 0.15}, 8499}, // 99.99 - 15.00
+		{"amount", InvoiceItem{Quantity: 3, UnitPrice: 3333, DiscountAmount: 999}, 9000},
+		{"credited amount", InvoiceItem{Quantity: -3, UnitPrice: 3333, DiscountAmount: -999}, -9000},
+		{"section", InvoiceItem{Kind: ItemKindSection, Quantity: 1, UnitPrice: 3333, DiscountRate: 0.15}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.item.TotalHT(); got != tt.want {
+				t.Errorf("TotalHT() = %s, want %s", got, tt.want)
+			}
+			if got := tt.item.GrossHT() - tt.item.Discount(); got != tt.want {
+				t.Errorf("GrossHT() - Discount() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvoice_SectionsAndSubtotals(t *testing.T) {
+	invoice := &Invoice{Items: []InvoiceItem{
+		{Kind: ItemKindSection, Description: "Design"},
+		{Quantity: 2, UnitPrice: 50000, VATRate: 0.20},
+		{Quantity: 1, UnitPrice: 20000, VATRate: 0.20, DiscountRate: 0.5},
+		{Kind: ItemKindSubtotal},
+		{Kind: ItemKindSection, Description: "Books"},
+		{Quantity: 4, UnitPrice: 2500, VATRate: 0.055},
+		{Kind: ItemKindSubtotal},
+	}}
+
+	if got := invoice.Subtotal(3); got != 110000 {
+		t.Errorf("Subtotal(3) = %s, want 1100.00", got)
+	}
+	if got := invoice.Subtotal(6); got != 10000 {
+		t.Errorf("Subtotal(6) = %s, want 100.00", got)
+	}
+	if got := invoice.TotalHT(); got != 120000 {
+		t.Errorf("TotalHT() = %s, want 1200.00", got)
+	}
+	// Section titles and subtotals add no VAT rate
+	breakdown := invoice.VATBreakdown()
+	if len(breakdown) != 2 || breakdown[0].Base != 110000 || breakdown[1].Base != 10000 {
+		t.Errorf("VATBreakdown() = %+v", breakdown)
+	}
+	if !invoice.HasLines() || (&Invoice{Items: invoice.Items[:1]}).HasLines() {
+		t.Error("HasLines() should only count priced lines")
+	}
+}
+
+func TestMoney_ParseAndFormat(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		str  string
+	}{
+		{"12", 1200, "12.00"},
+		{"12.5", 1250, "12.50"},
+		{"0,99", 99, "0.99"},
+		{"-3.07", -307, "-3.07"},
+		{"1.005", 101, "1.01"},
+		{"-1.005", -101, "-1.01"},
+		{" 1234.56 ", 123456, "1234.56"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+			if got.String() != tt.str {
+				t.Errorf("String() = %q, want %q", got.String(), tt.str)
+			}
+		})
+	}
+
+	for _, in := range []string{"", "abc", "1/3", "1e3", "99999999999999999999"} {
+		if _, err := ParseMoney(in); err == nil {
+			t.Errorf("ParseMoney(%q) expected error", in)
+		}
+	}
+}
+
+func TestMoney_Mul(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount Money
+		factor float64
+		want   Money
+	}{
+		{"quantity", 1999, 3, 5997},
+		{"fractional quantity", 1999, 0.333, 666},
+		{"half rounds up", 1010, 0.055, 56},
+		{"negative half rounds away from zero", -1010, 0.055, -56},
+		{"zero", 1999, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.amount.Mul(tt.factor); got != tt.want {
+				t.Errorf("Mul(%v) = %d, want %d", tt.factor, got, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		factor float64
+		want   error
+	}{
+		{math.NaN(), ErrInvalidFactor},
+		{math.Inf(1), ErrInvalidFactor},
+		{math.Inf(-1), ErrInvalidFactor},
+		{1e300, ErrMoneyOverflow},
+		{-1e17, ErrMoneyOverflow},
+	} {
+		if _, err := Money(1999).MulChecked(tt.factor); !errors.Is(err, tt.want) {
+			t.Errorf("MulChecked(%v) error = %v, want %v", tt.factor, err, tt.want)
+		}
+		if got := Money(1999).Mul(tt.factor); got != 0 {
+			t.Errorf("Mul(%v) = %d, want 0", tt.factor, got)
+		}
+	}
+	if got := NewMoney(math.NaN()); got != 0 {
+		t.Errorf("NewMoney(NaN) = %d, want 0", got)
+	}
+}
+
+func TestMoney_ScanAndJSON(t *testing.T) {
+	for _, value := range []any{"12.30", []byte("12.30"), 12.3, int64(12)} {
+		var m Money
+		if err := m.Scan(value); err != nil {
+			t.Fatalf("Scan(%v) error: %v", value, err)
+		}
+		want := Money(1230)
+		if _, ok := value.(int64); ok {
+			want = 1200
+		}
+		if m != want {
+			t.Errorf("Scan(%v) = %d, want %d", value, m, want)
+		}
+	}
+
+	var m Money
+	if err := m.Scan(math.NaN()); !errors.Is(err, ErrInvalidFactor) {
+		t.Errorf("Scan(NaN) error = %v, want ErrInvalidFactor", err)
+	}
+
+	data, err := json.Marshal(struct{ Amount Money }{Amount: -1050})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"Amount":-10.50}` {
+		t.Errorf("json.Marshal = %s", data)
+	}
+
+	var decoded struct{ Amount Money }
+	if err := json.Unmarshal([]byte(`{"Amount":"7.5"}`), &decoded); err != nil || decoded.Amount != 750 {
+		t.Errorf("json.Unmarshal = %d, %v", decoded.Amount, err)
+	}
+}
+
+func TestNumberingSequence_FormatNumber(t *testing.T) {
+	date := time.Date(2025, time.March, 14, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		pattern string
+		prefix  string
+		seq     int64
+		want    string
+	}{
+		{"default pattern", "{PREFIX}-{YYYY}-{SEQ:5}", "FA", 1, "FA-2025-00001"},
+		{"short year and month", "{YY}{MM}-{SEQ:3}", "", 42, "2503-042"},
+		{"unpadded sequence", "F{SEQ}", "", 1234, "F1234"},
+		{"width overflow", "{SEQ:2}", "", 1234, "1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &NumberingSequence{Pattern: tt.pattern, Prefix: tt.prefix}
+			if got := s.FormatNumber(date, tt.seq); got != tt.want {
+				t.Errorf("FormatNumber() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumberingSequence_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		reset   SequenceReset
+		want    error
+	}{
+		{"valid yearly", "{PREFIX}-{YYYY}-{SEQ:5}", SequenceResetYearly, nil},
+		{"valid never without year", "{PREFIX}{SEQ:6}", SequenceResetNever, nil},
+		{"missing sequence", "{PREFIX}-{YYYY}", SequenceResetYearly, ErrPatternMissingSeq},
+		{"yearly without year", "{PREFIX}-{SEQ}", SequenceResetYearly, ErrPatternMissingYear},
+		{"unknown placeholder", "{FOO}-{YYYY}-{SEQ}", SequenceResetYearly, ErrPatternUnknownTag},
+		{"bad width", "{YYYY}-{SEQ:x}", SequenceResetYearly, ErrPatternUnknownTag},
+		{"unclosed placeholder", "{YYYY}-{SEQ", SequenceResetYearly, ErrPatternUnclosedTag},
+		{"invalid reset", "{YYYY}-{SEQ}", "monthly", ErrInvalidReset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &NumberingSequence{Pattern: tt.pattern, Reset: tt.reset}
+			if got := s.Validate(); got != tt.want {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumberingSequence_Period(t *testing.T) {
+	date := time.Date(2025, time.December, 31, 0, 0, 0, 0, time.UTC)
+	yearly := &NumberingSequence{Reset: SequenceResetYearly}
+	if got := yearly.Period(date); got != 2025 {
+		t.Errorf("yearly Period() = %d, want 2025", got)
+	}
+	never := &NumberingSequence{Reset: SequenceResetNever}
+	if got := never.Period(date); got != 0 {
+		t.Errorf("never Period() = %d, want 0", got)
+	}
+}
+
+func TestInvoice_CanCredit(t *testing.T) {
+	tests := []struct {
+		name      string
+		invoice   Invoice
+		canCredit bool
+	}{
+		{"draft invoice", Invoice{Type: InvoiceTypeInvoice, Status: InvoiceStatusDraft}, false},
+		{"final invoice", Invoice{Type: InvoiceTypeInvoice, Status: InvoiceStatusFinal}, true},
+		{"paid invoice", Invoice{Type: InvoiceTypeInvoice, Status: InvoiceStatusPaid}, true},
+		{"cancelled invoice", Invoice{Type: InvoiceTypeInvoice, Status: InvoiceStatusCancelled}, false},
+		{"credit note", Invoice{Type: InvoiceTypeCreditNote, Status: InvoiceStatusFinal}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.invoice.CanCredit(); got != tt.canCredit {
+				t.Errorf("CanCredit() = %v, want %v", got, tt.canCredit)
+			}
+		})
+	}
+}
+
+func TestInvoice_CreditNoteTotalsAreNegative(t *testing.T) {
+	creditNote := &Invoice{
+		Type: InvoiceTypeCreditNote,
+		Items: []InvoiceItem{
+			{Quantity: -2, UnitPrice: 10000, VATRate: 0.20},
+		},
+	}
+	if got := creditNote.TotalHT(); got != -20000 {
+		t.Errorf("TotalHT() = %s, want -200.00", got)
+	}
+	if got := creditNote.TotalTTC(); got != -24000 {
+		t.Errorf("TotalTTC() = %s, want -240.00", got)
+	}
+}
+
+func TestInvoice_Balance(t *testing.T) {
+	items := []InvoiceItem{{Quantity: 1, UnitPrice: 10000, VATRate: 0.20}}
+	creditNote := Invoice{
+		Type:  InvoiceTypeCreditNote,
+		Items: []InvoiceItem{{Quantity: -1, UnitPrice: 5000, VATRate: 0.20}},
+	}
+
+	tests := []struct {
+		name    string
+		invoice Invoice
+		paid    Money
+		balance Money
+	}{
+		{"unpaid", Invoice{Items: items}, 0, 12000},
+		{"partially paid", Invoice{Items: items, Payments: []Payment{{Amount: 2000}, {Amount: 3050}}}, 5050, 6950},
+		{"fully paid", Invoice{Items: items, Payments: []Payment{{Amount: 12000}}}, 12000, 0},
+		{"partially credited", Invoice{Items: items, CreditNotes: []Invoice{creditNote}}, 0, 6000},
+		{"credited and paid", Invoice{Items: items, CreditNotes: []Invoice{creditNote}, Payments: []Payment{{Amount: 6000}}}, 6000, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.invoice.AmountPaid(); got != tt.paid {
+				t.Errorf("AmountPaid() = %v, want %v", got, tt.paid)
+			}
+			if got := tt.invoice.Balance(); got != tt.balance {
+				t.Errorf("Balance() = %v, want %v", got, tt.balance)
+			}
+		})
+	}
+}
+
+func TestPaymentMethod_IsValid(t *testing.T) {
+	for _, m := range PaymentMethods {
+		if !m.IsValid() {
+			t.Errorf("%q.IsValid() = false, want true", m)
+		}
+	}
+	if PaymentMethod("bitcoin").IsValid() {
+		t.Error(`"bitcoin".IsValid() = true, want false`)
+	}
+}
+
+func TestRecurringInvoice_Occurrence(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		frequency Frequency
+		n         int
+		want      time.Time
+	}{
+		{FrequencyMonthly, 0, start},
+		{FrequencyMonthly, 1, time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{FrequencyMonthly, 2, time.Date(2024, time.March, 31, 0, 0, 0, 0, time.UTC)},
+		{FrequencyMonthly, 13, time.Date(2025, time.February, 28, 0, 0, 0, 0, time.UTC)},
+		{FrequencyQuarterly, 1, time.Date(2024, time.April, 30, 0, 0, 0, 0, time.UTC)},
+		{FrequencyQuarterly, 4, time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC)},
+		{FrequencyYearly, 1, time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		rec := RecurringInvoice{Frequency: tt.frequency, StartDate: start}
+		if got := rec.Occurrence(tt.n); !got.Equal(tt.want) {
+			t.Errorf("%s Occurrence(%d) = %v, want %v", tt.frequency, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestRecurringInvoice_Upcoming(t *testing.T) {
+	end := time.Date(2024, time.April, 15, 0, 0, 0, 0, time.UTC)
+	rec := RecurringInvoice{
+		Frequency: FrequencyMonthly,
+		StartDate: time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC),
+		EndDate:   &end,
+		Generated: 1,
+	}
+
+	dates := rec.Upcoming(6)
+	if len(dates) != 3 {
+		t.Fatalf("Upcoming(6) = %v, want 3 dates until the end date", dates)
+	}
+	if dates[0].Month() != time.February || dates[2].Month() != time.April {
+		t.Errorf("Upcoming(6) = %v, want February to April", dates)
+	}
+}
+
+func TestRecurringInvoice_Invoice(t *testing.T) {
+	rec := RecurringInvoice{
+		ID: 7, UserID: 1, ClientID: 2, DueDays: 30, Reference: "PO-42",
+		Items: []RecurringInvoiceItem{{Description: "Hosting", Quantity: 1, UnitPrice: 10000, VATRate: 0.20}},
+	}
+	date := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	invoice := rec.Invoice(date, RoundingPerLine)
+	if !invoice.IsDraft() || invoice.Number != "DRAFT-R20240301-7" || invoice.Reference != "PO-42" {
+		t.Errorf("Invoice() = %+v", invoice)
+	}
+	if !invoice.DueDate.Equal(date.AddDate(0, 0, 30)) {
+		t.Errorf("DueDate = %v, want 30 days after the occurrence", invoice.DueDate)
+	}
+	if *invoice.RecurringInvoiceID != 7 || !invoice.RecurrenceDate.Equal(date) {
+		t.Errorf("recurrence = %v %v", *invoice.RecurringInvoiceID, *invoice.RecurrenceDate)
+	}
+	if invoice.TotalTTC() != 12000 {
+		t.Errorf("TotalTTC() = %v, want 120.00", invoice.TotalTTC())
+	}
+}
+
+func TestQuote_TotalsMatchInvoice(t *testing.T) {
+	quote := Quote{Rounding: RoundingPerRate, Items: []QuoteItem{
+		{Description: "Design", Quantity: 3, UnitPrice: 3333, VATRate: 0.20},
+		{Description: "Book", Quantity: 1, UnitPrice: 1999, VATRate: 0.055},
+	}}
+
+	invoice := quote.Lines()
+	if len(invoice.Items) != 2 || invoice.Rounding != RoundingPerRate {
+		t.Fatalf("Lines() = %+v", invoice)
+	}
+	if quote.TotalHT() != invoice.TotalHT() || quote.TotalVAT() != invoice.TotalVAT() || quote.TotalTTC() != invoice.TotalTTC() {
+		t.Errorf("quote totals %v/%v/%v differ from the invoice ones", quote.TotalHT(), quote.TotalVAT(), quote.TotalTTC())
+	}
+	if quote.TotalHT() != 11998 {
+		t.Errorf("TotalHT() = %v, want 119.98", quote.TotalHT())
+	}
+}
+
+func TestQuote_CanConvert(t *testing.T) {
+	invoiceID := uint(1)
+	tests := []struct {
+		quote Quote
+		want  bool
+	}{
+		{Quote{Status: QuoteStatusDraft}, false},
+		{Quote{Status: QuoteStatusSent}, true},
+		{Quote{Status: QuoteStatusAccepted}, true},
+		{Quote{Status: QuoteStatusAccepted, InvoiceID: &invoiceID}, false},
+		{Quote{Status: QuoteStatusRefused}, false},
+		{Quote{Status: QuoteStatusExpired}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.quote.CanConvert(); got != tt.want {
+			t.Errorf("%s (converted: %v) CanConvert() = %v, want %v", tt.quote.Status, tt.quote.IsConverted(), got, tt.want)
+		}
+	}
+}
+
+func TestInvoice_CanTakeDeposits(t *testing.T) {
+	tests := []struct {
+		invoice Invoice
+		want    bool
+	}{
+		{Invoice{Status: InvoiceStatusDraft}, true},
+		{Invoice{Status: InvoiceStatusDraft, Type: InvoiceTypeInvoice}, true},
+		{Invoice{Status: InvoiceStatusFinal, Type: InvoiceTypeInvoice}, false},
+		{Invoice{Status: InvoiceStatusDraft, Type: InvoiceTypeDeposit}, false},
+		{Invoice{Status: InvoiceStatusDraft, Type: InvoiceTypeCreditNote}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.invoice.CanTakeDeposits(); got != tt.want {
+			t.Errorf("%s %q CanTakeDeposits() = %v, want %v", tt.invoice.Status, tt.invoice.Type, got, tt.want)
+		}
+	}
+}
+
+func TestInvoice_DaysOverdue(t *testing.T) {
+	due := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, 3, 11, 22, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		invoice Invoice
+		want    int
+	}{
+		{"final", Invoice{Status: InvoiceStatusFinal, DueDate: due}, 10},
+		{"not yet due", Invoice{Status: InvoiceStatusFinal, DueDate: now}, 0},
+		{"draft", Invoice{Status: InvoiceStatusDraft, DueDate: due}, 0},
+		{"paid", Invoice{Status: InvoiceStatusPaid, DueDate: due}, 0},
+		{"credit note", Invoice{Status: InvoiceStatusFinal, Type: InvoiceTypeCreditNote, DueDate: due}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.invoice.DaysOverdue(now); got != tt.want {
+			t.Errorf("%s: DaysOverdue() = %d, want %d", tt.name, got, tt.want)
+		}
+		if got := tt.invoice.IsOverdue(now); got != (tt.want > 0) {
+			t.Errorf("%s: IsOverdue() = %v", tt.name, got)
+		}
+	}
+}
+
+func TestParseReminderSchedule(t *testing.T) {
+	days, err := ParseReminderSchedule(" 30, 7;15 7")
+	if err != nil || FormatReminderSchedule(days) != "7,15,30" {
+		t.Errorf("ParseReminderSchedule() = %v, %v", days, err)
+	}
+	if days, err := ParseReminderSchedule(""); err != nil || days != nil {
+		t.Errorf("ParseReminderSchedule(\"\") = %v, %v; want reminders off", days, err)
+	}
+	for _, bad := range []string{"7,x", "0", "-5"} {
+		if _, err := ParseReminderSchedule(bad); err != ErrInvalidReminderSchedule {
+			t.Errorf("ParseReminderSchedule(%q) error = %v", bad, err)
+		}
+	}
+
+	schedule := []int{7, 15, 30}
+	for daysLate, want := range map[int]int{0: 0, 6: 0, 7: 1, 20: 2, 45: 3} {
+		if got := ReminderLevel(schedule, daysLate); got != want {
+			t.Errorf("ReminderLevel(%d) = %d, want %d", daysLate, got, want)
+		}
+	}
+}
+
+func TestComputeLatePenalty(t *testing.T) {
+	p := ComputeLatePenalty(120000, 0.10, 73)
+	// 1200.00 at 10% over 73 days: 1200 * 0.10 * 73 / 365 = 24.00
+	if p.Interest != 2400 || p.Indemnity != RecoveryIndemnity || p.Total() != 6400 {
+		t.Errorf("ComputeLatePenalty() = %+v", p)
+	}
+	p.Invoiced = 5000
+	if p.Due() != 1400 {
+		t.Errorf("Due() = %v, want 14.00", p.Due())
+	}
+	p.Invoiced = 9000
+	if p.Due() != 0 {
+		t.Errorf("Due() over-invoiced = %v, want 0", p.Due())
+	}
+
+	if p := ComputeLatePenalty(120000, 0.10, 0); p.Total() != 0 {
+		t.Errorf("ComputeLatePenalty() not late = %+v", p)
+	}
+	// The legal default rate is not computed, the indemnity still applies
+	if p := ComputeLatePenalty(120000, 0, 10); p.Interest != 0 || p.Indemnity != RecoveryIndemnity {
+		t.Errorf("ComputeLatePenalty() without rate = %+v", p)
+	}
+}
+
+func TestCompanySettings_PaymentTerms(t *testing.T) {
+	issued := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		company  CompanySettings
+		wantDue  time.Time
+		wantText string
+	}{
+		{"on receipt", CompanySettings{}, issued, "Paiement à réception de facture"},
+		{"30 days", CompanySettings{PaymentTermDays: 30}, time.Date(2025, 2, 14, 0, 0, 0, 0, time.UTC), "Paiement à 30 jours"},
+		{"30 days end of month", CompanySettings{PaymentTermDays: 30, PaymentTermEndOfMonth: true},
+			time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC), "Paiement à 30 jours fin de mois"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.company.DueDate(issued); !got.Equal(tt.wantDue) {
+			t.Errorf("%s: DueDate() = %v, want %v", tt.name, got, tt.wantDue)
+		}
+		if got := tt.company.PaymentTermsText(); got != tt.wantText {
+			t.Errorf("%s: PaymentTermsText() = %q, want %q", tt.name, got, tt.wantText)
+		}
+	}
+}
+
+func TestCompanySettings_LatePaymentMentions(t *testing.T) {
+	mentions := (&CompanySettings{LatePenaltyRate: 0.12}).LatePaymentMentions()
+	if len(mentions) != 3 || !strings.Contains(mentions[0], "12 %") || !strings.Contains(mentions[1], "40.00 €") {
+		t.Errorf("LatePaymentMentions() = %q", mentions)
+	}
+	if mentions := (&CompanySettings{}).LatePaymentMentions(); !strings.Contains(mentions[0], "BCE") {
+		t.Errorf("LatePaymentMentions() default rate = %q", mentions[0])
+	}
+}
+
+func TestCurrency_Format(t *testing.T) {
+	tests := []struct {
+		currency Currency
+		amount   Money
+		want     string
+	}{
+		{"", 123450, "1234.50 €"},
+		{CurrencyEUR, -500, "-5.00 €"},
+		{CurrencyGBP, 123450, "£1234.50"},
+		{CurrencyUSD, -500, "-$5.00"},
+		{CurrencyCHF, 100, "1.00 CHF"},
+	}
+	for _, tt := range tests {
+		if got := tt.currency.Format(tt.amount); got != tt.want {
+			t.Errorf("%q.Format(%v) = %q, want %q", tt.currency, tt.amount, got, tt.want)
+		}
+	}
+
+	if c, ok := ParseCurrency(" usd "); !ok || c != CurrencyUSD {
+		t.Errorf("ParseCurrency() = %q, %v", c, ok)
+	}
+	if _, ok := ParseCurrency("XYZ"); ok {
+		t.Error("ParseCurrency() accepted an unsupported currency")
+	}
+}
+
+func TestInvoice_ToBase(t *testing.T) {
+	invoice := Invoice{Currency: CurrencyUSD, BaseCurrency: CurrencyEUR, ExchangeRate: 0.92}
+	if !invoice.IsForeignCurrency() || invoice.ToBase(100000) != 92000 {
+		t.Errorf("ToBase() = %v", invoice.ToBase(100000))
+	}
+
+	// Drafts and invoices in the base currency are not converted
+	for _, invoice := range []Invoice{
+		{Currency: CurrencyUSD, ExchangeRate: 1},
+		{Currency: CurrencyEUR, BaseCurrency: CurrencyEUR, ExchangeRate: 1},
+	} {
+		if invoice.IsForeignCurrency() || invoice.ToBase(100000) != 100000 {
+			t.Errorf("ToBase() of %+v = %v", invoice, invoice.ToBase(100000))
+		}
+	}
+}
+
+func TestCompanySettings_Accounts(t *testing.T) {
+	var settings CompanySettings
+	accounts := settings.Accounts()
+	if accounts.Client != "411" || accounts.Revenue != "706" || accounts.VATFor(0.2) != "44571" || accounts.Bank != "512" {
+		t.Errorf("default Accounts() = %+v", accounts)
+	}
+
+	settings.VATAccounts = "20=445711, 5.5=445713"
+	accounts = settings.Accounts()
+	if accounts.VATFor(0.2) != "445711" || accounts.VATFor(0.055) != "445713" || accounts.VATFor(0.1) != "44571" {
+		t.Errorf("Accounts() by rate = %+v", accounts.VATByRate)
+	}
+	if got := FormatVATAccounts(accounts.VATByRate); got != "20=445711,5.5=445713" {
+		t.Errorf("FormatVATAccounts() = %q", got)
+	}
+
+	for _, s := range []string{"20", "x=445711", "20="} {
+		if _, err := ParseVATAccounts(s); err != ErrInvalidVATAccounts {
+			t.Errorf("ParseVATAccounts(%q) error = %v, want ErrInvalidVATAccounts", s, err)
+		}
 	}
 }
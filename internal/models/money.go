@@ -0,0 +1,198 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in cents. Using an integer avoids the drift of float64
+// arithmetic: totals are sums of amounts that were each rounded once, so
+// they always reconcile to the cent.
+//
+// Money is stored in decimal(…,2) columns and serialized as a JSON number.
+type Money int64
+
+var (
+	// ErrInvalidMoney is returned when a string cannot be parsed as an amount.
+	ErrInvalidMoney = errors.New("invalid amount")
+	// ErrInvalidFactor is returned when an amount is multiplied by NaN or
+	// an infinity.
+	ErrInvalidFactor = errors.New("invalid factor")
+	// ErrMoneyOverflow is returned when an amount does not fit in a Money.
+	ErrMoneyOverflow = errors.New("amount out of range")
+)
+
+// NewMoney converts a float amount (in currency units) to Money, rounding
+// half away from zero. It returns 0 for an amount MulChecked rejects.
+func NewMoney(amount float64) Money {
+	return Money(100).Mul(amount)
+}
+
+// ParseMoney parses a decimal amount such as "12.5" or "-0,99". Extra
+// decimals are rounded half away from zero.
+func ParseMoney(s string) (Money, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", ".")
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.ContainsAny(s, "/eE") {
+		return 0, ErrInvalidMoney
+	}
+	return roundRat(r.Mul(r, big.NewRat(100, 1)))
+}
+
+// Cents returns the amount in cents.
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// Float64 returns the amount in currency units. Only use it at the edges
+// (PDF rendering, display); never to compute.
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// Mul multiplies the amount by a decimal factor (a quantity or a rate) and
+// rounds the result to the cent, half away from zero. The factor is taken
+// at its shortest decimal representation, so 0.055 is exactly 0.055.
+//
+// Mul returns 0 when MulChecked fails: factors read from user input are
+// checked with MulChecked before they are stored.
+func (m Money) Mul(factor float64) Money {
+	product, err := m.MulChecked(factor)
+	if err != nil {
+		return 0
+	}
+	return product
+}
+
+// MulChecked is Mul returning ErrInvalidFactor for a NaN or infinite factor
+// and ErrMoneyOverflow when the product does not fit in a Money.
+func (m Money) MulChecked(factor float64) (Money, error) {
+	if math.IsNaN(factor) || math.IsInf(factor, 0) {
+		return 0, ErrInvalidFactor
+	}
+	r := new(big.Rat).SetInt64(int64(m))
+	return roundRat(r.Mul(r, decimalRat(factor)))
+}
+
+// String formats the amount with two decimals, e.g. "1234.50".
+func (m Money) String() string {
+	sign := ""
+	c := int64(m)
+	if c < 0 {
+		sign = "-"
+		c = -c
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, c/100, c%100)
+}
+
+// Value implements driver.Valuer.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan implements sql.Scanner. Drivers return decimals as text (postgres)
+// or as numbers (sqlite).
+func (m *Money) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v * 100)
+	case float64:
+		parsed, err := Money(100).MulChecked(v)
+		if err != nil {
+			return fmt.Errorf("scan money %v: %w", v, err)
+		}
+		*m = parsed
+	case []byte:
+		return m.Scan(string(v))
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return fmt.Errorf("scan money %q: %w", v, err)
+		}
+		*m = parsed
+	default:
+		return fmt.Errorf("scan money: unsupported type %T", value)
+	}
+	return nil
+}
+
+// MarshalJSON encodes the amount as a number with two decimals.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// decimalRat converts a finite float to the exact rational of its shortest
+// decimal form.
+func decimalRat(f float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	return r
+}
+
+// roundRat rounds a rational to the nearest integer, half away from zero.
+// It returns ErrMoneyOverflow if the result does not fit in a Money.
+func roundRat(r *big.Rat) (Money, error) {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+	if !q.IsInt64() {
+		return 0, ErrMoneyOverflow
+	}
+	return Money(q.Int64()), nil
+}
+
+// RoundingPolicy decides where VAT is rounded.
+type RoundingPolicy string
+
+const (
+	// RoundingPerLine rounds the VAT of every line, then sums the lines.
+	RoundingPerLine RoundingPolicy = "line"
+	// RoundingPerRate sums the line amounts of each VAT rate and rounds the
+	// VAT once per rate. This is the EN 16931 rule and the default.
+	RoundingPerRate RoundingPolicy = "rate"
+)
+
+// RoundingPolicies lists the available policies, in display order.
+var RoundingPolicies = []RoundingPolicy{RoundingPerRate, RoundingPerLine}
+
+// IsValid returns true if p is a known policy.
+func (p RoundingPolicy) IsValid() bool {
+	return p == RoundingPerLine || p == RoundingPerRate
+}
+
+// OrDefault returns p, or RoundingPerRate when p is not set.
+func (p RoundingPolicy) OrDefault() RoundingPolicy {
+	if !p.IsValid() {
+		return RoundingPerRate
+	}
+	return p
+}
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DocumentType identifies a family of documents numbered by its own sequence.
+type DocumentType string
+
+const (
+	DocumentTypeInvoice    DocumentType = "invoice"
+	DocumentTypeCreditNote DocumentType = "credit_note"
+	DocumentTypeQuote      DocumentType = "quote"
+)
+
+// NumberedDocumentTypes lists the document types that can be configured
+// from the numbering settings page, in display order.
+var NumberedDocumentTypes = []DocumentType{
+	DocumentTypeInvoice,
+	DocumentTypeCreditNote,
+	DocumentTypeQuote,
+}
+
+// SequenceReset controls when a numbering sequence restarts at 1.
+type SequenceReset string
+
+const (
+	SequenceResetYearly SequenceReset = "yearly"
+	SequenceResetNever  SequenceReset = "never"
+)
+
+// Pattern validation errors.
+var (
+	ErrPatternMissingSeq  = errors.New("pattern must contain {SEQ} or {SEQ:n}")
+	ErrPatternMissingYear = errors.New("pattern must contain {YYYY} or {YY} when the sequence resets yearly")
+	ErrPatternUnknownTag  = errors.New("pattern contains an unknown placeholder")
+	ErrPatternUnclosedTag = errors.New("pattern contains an unclosed placeholder")
+	ErrInvalidReset       = errors.New("reset must be yearly or never")
+)
+
+// NumberingSequence holds a user's numbering configuration for one document type.
+// Supported placeholders: {PREFIX}, {YYYY}, {YY}, {MM}, {SEQ} and {SEQ:n}
+// where n is the zero-padded width (e.g. {PREFIX}-{YYYY}-{SEQ:5} → FA-2025-00001).
+type NumberingSequence struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// UserID is the owner of this sequence
+	UserID uint `gorm:"not null;uniqueIndex:idx_numbering_user_type" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+
+	DocumentType DocumentType  `gorm:"size:20;not null;uniqueIndex:idx_numbering_user_type" json:"document_type"`
+	Pattern      string        `gorm:"size:100;not null" json:"pattern"`
+	Prefix       string        `gorm:"size:20" json:"prefix"`
+	Reset        SequenceReset `gorm:"size:10;not null;default:'yearly'" json:"reset"`
+}
+
+// NumberingCounter stores the last value issued for a sequence period.
+// Rows are never deleted: a counter is the proof that numbering is continuous.
+type NumberingCounter struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID       uint         `gorm:"not null;uniqueIndex:idx_counter_user_type_period" json:"user_id"`
+	DocumentType DocumentType `gorm:"size:20;not null;uniqueIndex:idx_counter_user_type_period" json:"document_type"`
+	// Period is the year for yearly sequences, 0 for sequences that never reset.
+	Period    int   `gorm:"not null;uniqueIndex:idx_counter_user_type_period" json:"period"`
+	LastValue int64 `gorm:"not null;default:0" json:"last_value"`
+}
+
+// DefaultNumberingSequence returns the configuration used until the user saves their own.
+func DefaultNumberingSequence(userID uint, docType DocumentType) NumberingSequence {
+	seq := NumberingSequence{
+		UserID:       userID,
+		DocumentType: docType,
+		Pattern:      "{PREFIX}-{YYYY}-{SEQ:5}",
+		Reset:        SequenceResetYearly,
+	}
+	switch docType {
+	case DocumentTypeInvoice:
+		seq.Prefix = "FA"
+	case DocumentTypeCreditNote:
+		seq.Prefix = "AV"
+	case DocumentTypeQuote:
+		seq.Prefix = "DE"
+	}
+	return seq
+}
+
+// GetUserID implements the Ownable interface.
+func (s *NumberingSequence) GetUserID() uint {
+	return s.UserID
+}
+
+// Period returns the counter period a document dated at date belongs to.
+func (s *NumberingSequence) Period(date time.Time) int {
+	if s.Reset == SequenceResetNever {
+		return 0
+	}
+	return date.Year()
+}
+
+// Validate checks the pattern placeholders and the reset policy.
+func (s *NumberingSequence) Validate() error {
+	if s.Reset != SequenceResetYearly && s.Reset != SequenceResetNever {
+		return ErrInvalidReset
+	}
+	var hasSeq, hasYear bool
+	err := walkPattern(s.Pattern, func(literal string) {}, func(tag string) error {
+		name, _, _ := strings.Cut(tag, ":")
+		switch name {
+		case "SEQ":
+			if _, err := seqWidth(tag); err != nil {
+				return err
+			}
+			hasSeq = true
+		case "YYYY", "YY":
+			hasYear = true
+		case "PREFIX", "MM":
+		default:
+			return ErrPatternUnknownTag
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !hasSeq {
+		return ErrPatternMissingSeq
+	}
+	if s.Reset == SequenceResetYearly && !hasYear {
+		return ErrPatternMissingYear
+	}
+	return nil
+}
+
+// FormatNumber renders the pattern for a document dated at date with sequence value seq.
+// The pattern is assumed to be valid; unknown placeholders are copied verbatim.
+func (s *NumberingSequence) FormatNumber(date time.Time, seq int64) string {
+	var b strings.Builder
+	_ = walkPattern(s.Pattern, func(literal string) {
+		b.WriteString(literal)
+	}, func(tag string) error {
+		name, _, _ := strings.Cut(tag, ":")
+		switch name {
+		case "PREFIX":
+			b.WriteString(s.Prefix)
+		case "YYYY":
+			b.WriteString(strconv.Itoa(date.Year()))
+		case "YY":
+			fmt.Fprintf(&b, "%02d", date.Year()%100)
+		case "MM":
+			fmt.Fprintf(&b, "%02d", int(date.Month()))
+		case "SEQ":
+			width, _ := seqWidth(tag)
+			fmt.Fprintf(&b, "%0*d", width, seq)
+		default:
+			b.WriteString("{" + tag + "}")
+		}
+		return nil
+	})
+	return b.String()
+}
+
+// walkPattern splits a pattern into literal text and {placeholder} tags.
+func walkPattern(pattern string, literal func(string), tag func(string) error) error {
+	for pattern != "" {
+		open := strings.IndexByte(pattern, '{')
+		if open < 0 {
+			literal(pattern)
+			return nil
+		}
+		if open > 0 {
+			literal(pattern[:open])
+		}
+		end := strings.IndexByte(pattern[open:], '}')
+		if end < 0 {
+			return ErrPatternUnclosedTag
+		}
+		if err := tag(pattern[open+1 : open+end]); err != nil {
+			return err
+		}
+		pattern = pattern[open+end+1:]
+	}
+	return nil
+}
+
+// seqWidth parses the padding width of a SEQ or SEQ:n tag.
+func seqWidth(tag string) (int, error) {
+	_, width, ok := strings.Cut(tag, ":")
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(width)
+	if err != nil || n < 1 || n > 10 {
+		return 0, ErrPatternUnknownTag
+	}
+	return n, nil
+}
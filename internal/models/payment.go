@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentMethod describes how a payment was received.
+type PaymentMethod string
+
+const (
+	PaymentMethodBankTransfer PaymentMethod = "bank_transfer"
+	PaymentMethodCard         PaymentMethod = "card"
+	PaymentMethodCheque       PaymentMethod = "cheque"
+	PaymentMethodCash         PaymentMethod = "cash"
+	PaymentMethodOther        PaymentMethod = "other"
+)
+
+// PaymentMethods lists the accepted payment methods, in display order.
+var PaymentMethods = []PaymentMethod{
+	PaymentMethodBankTransfer,
+	PaymentMethodCard,
+	PaymentMethodCheque,
+	PaymentMethodCash,
+	PaymentMethodOther,
+}
+
+// IsValid returns true if m is one of the known payment methods.
+func (m PaymentMethod) IsValid() bool {
+	for _, known := range PaymentMethods {
+		if m == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Payment records money received against an invoice.
+// Implements the Ownable interface for ownership-based authorization.
+type Payment struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	// UserID is the owner of this payment (for multi-tenant isolation)
+	UserID uint `gorm:"index;not null" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+
+	// Invoice the payment is applied to
+	InvoiceID uint     `gorm:"index;not null" json:"invoice_id"`
+	Invoice   *Invoice `gorm:"foreignKey:InvoiceID" json:"-"`
+
+	// Payment details
+	Amount    Money         `gorm:"type:decimal(10,2);not null" json:"amount"`
+	Date      time.Time     `gorm:"not null" json:"date"`
+	Method    PaymentMethod `gorm:"size:20;not null" json:"method"`
+	Reference string        `gorm:"size:100" json:"reference,omitempty"`
+}
+
+// GetUserID implements the Ownable interface for authorization.
+func (p *Payment) GetUserID() uint {
+	return p.UserID
+}
@@ -0,0 +1,43 @@
+package models
+
+// RecoveryIndemnity is the fixed indemnity for recovery costs owed by a
+// business client for each invoice paid late (art. L441-10 du Code de
+// commerce).
+const RecoveryIndemnity Money = 4000
+
+// LatePenalty is what a client owes for paying an invoice late: interest
+// at the annual penalty rate on the amount due, for each day past the due
+// date, plus the recovery indemnity.
+type LatePenalty struct {
+	DaysLate int
+	// Base is the amount due, including VAT.
+	Base Money
+	// Rate is the annual penalty rate.
+	Rate      float64
+	Interest  Money
+	Indemnity Money
+	// Invoiced is the part already charged by earlier penalty invoices.
+	Invoiced Money
+}
+
+// ComputeLatePenalty computes the penalties accrued on base after
+// daysLate days at the annual rate, on a 365-day year.
+func ComputeLatePenalty(base Money, rate float64, daysLate int) LatePenalty {
+	p := LatePenalty{DaysLate: daysLate, Base: base, Rate: rate}
+	if daysLate <= 0 || base <= 0 {
+		return p
+	}
+	p.Interest = base.Mul(rate * float64(daysLate) / 365)
+	p.Indemnity = RecoveryIndemnity
+	return p
+}
+
+// Total returns the accrued interest plus the indemnity.
+func (p LatePenalty) Total() Money {
+	return p.Interest + p.Indemnity
+}
+
+// Due returns what remains to be charged.
+func (p LatePenalty) Due() Money {
+	return max(p.Total()-p.Invoiced, 0)
+}
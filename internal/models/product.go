@@ -19,11 +19,11 @@ type Product struct {
 	User   User `gorm:"foreignKey:UserID" json:"-"`
 
 	// Product information
-	Code        string  `gorm:"size:50;not null;uniqueIndex:idx_product_user_code" json:"code"`
-	Name        string  `gorm:"size:255;not null" json:"name"`
-	Description string  `gorm:"type:text" json:"description,omitempty"`
-	UnitPrice   float64 `gorm:"type:decimal(10,2);not null" json:"unit_price"`
-	Unit        string  `gorm:"size:50;default:'unit'" json:"unit"` // unit, hour, day, kg, etc.
+	Code        string `gorm:"size:50;not null;uniqueIndex:idx_product_user_code" json:"code"`
+	Name        string `gorm:"size:255;not null" json:"name"`
+	Description string `gorm:"type:text" json:"description,omitempty"`
+	UnitPrice   Money  `gorm:"type:decimal(10,2);not null" json:"unit_price"`
+	Unit        string `gorm:"size:50;default:'unit'" json:"unit"` // unit, hour, day, kg, etc.
 
 	// VAT rate stored as decimal (0.20 = 20%)
 	VATRate float64 `gorm:"type:decimal(5,4);default:0.20" json:"vat_rate"`
@@ -39,13 +39,13 @@ func (p *Product) GetUserID() uint {
 }
 
 // PriceWithVAT returns the unit price including VAT.
-func (p *Product) PriceWithVAT() float64 {
-	return p.UnitPrice * (1 + p.VATRate)
+func (p *Product) PriceWithVAT() Money {
+	return p.UnitPrice + p.VATAmount()
 }
 
-// VATAmount returns the VAT amount for one unit.
-func (p *Product) VATAmount() float64 {
-	return p.UnitPrice * p.VATRate
+// VATAmount returns the VAT amount for one unit, rounded to the cent.
+func (p *Product) VATAmount() Money {
+	return p.UnitPrice.Mul(p.VATRate)
 }
 
 // VATRatePercent returns the VAT rate as a percentage (e.g., 20 for 20%).
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// QuoteStatus represents the status of a quote.
+type QuoteStatus string
+
+const (
+	QuoteStatusDraft    QuoteStatus = "draft"
+	QuoteStatusSent     QuoteStatus = "sent"
+	QuoteStatusAccepted QuoteStatus = "accepted"
+	QuoteStatusRefused  QuoteStatus = "refused"
+	QuoteStatusExpired  QuoteStatus = "expired"
+)
+
+// Quote is an offer (devis) sent to a client before invoicing. Its lines
+// share the pricing and VAT rules of invoice lines, and an accepted quote
+// is converted into a draft invoice.
+// Implements the Ownable interface for ownership-based authorization.
+type Quote struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	UserID uint `gorm:"index;not null;uniqueIndex:idx_quote_user_number" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+
+	// Quotes are numbered by their own sequence when they are sent
+	Number    string `gorm:"size:50;uniqueIndex:idx_quote_user_number" json:"number"`
+	Reference string `gorm:"size:100" json:"reference,omitempty"`
+
+	ClientID uint    `gorm:"index;not null" json:"client_id"`
+	Client   *Client `gorm:"foreignKey:ClientID" json:"client,omitempty"`
+
+	IssueDate  time.Time `gorm:"not null" json:"issue_date"`
+	ValidUntil time.Time `gorm:"not null" json:"valid_until"`
+
+	Status   QuoteStatus    `gorm:"size:20;not null;default:'draft'" json:"status"`
+	Rounding RoundingPolicy `gorm:"size:10;not null;default:'rate'" json:"rounding"`
+
+	Notes        string `gorm:"type:text" json:"notes,omitempty"`
+	PaymentTerms string `gorm:"size:500" json:"payment_terms,omitempty"`
+
+	// The invoice the quote was converted into
+	InvoiceID *uint    `gorm:"index" json:"invoice_id,omitempty"`
+	Invoice   *Invoice `gorm:"foreignKey:InvoiceID" json:"-"`
+
+	Items []QuoteItem `gorm:"foreignKey:QuoteID" json:"items,omitempty"`
+}
+
+// GetUserID implements the Ownable interface for authorization.
+func (q *Quote) GetUserID() uint {
+	return q.UserID
+}
+
+// IsDraft returns true if the quote has not been sent yet.
+func (q *Quote) IsDraft() bool {
+	return q.Status == QuoteStatusDraft
+}
+
+// CanEdit returns true if the quote can still be edited.
+func (q *Quote) CanEdit() bool {
+	return q.Status == QuoteStatusDraft
+}
+
+// CanAnswer returns true if the client's answer can be recorded.
+func (q *Quote) CanAnswer() bool {
+	return q.Status == QuoteStatusSent
+}
+
+// CanConvert returns true if the quote can be converted into an invoice:
+// it was sent or accepted, and not converted yet.
+func (q *Quote) CanConvert() bool {
+	return q.InvoiceID == nil && (q.Status == QuoteStatusSent || q.Status == QuoteStatusAccepted)
+}
+
+// IsConverted returns true if the quote was converted into an invoice.
+func (q *Quote) IsConverted() bool {
+	return q.InvoiceID != nil
+}
+
+// Lines returns the quote as an invoice document holding its lines, so
+// that quotes are priced by the same rules as invoices.
+func (q *Quote) Lines() *Invoice {
+	invoice := &Invoice{Rounding: q.Rounding}
+	for _, item := range q.Items {
+		invoice.Items = append(invoice.Items, item.InvoiceItem())
+	}
+	return invoice
+}
+
+// TotalHT calculates the total excluding VAT.
+func (q *Quote) TotalHT() Money {
+	return q.Lines().TotalHT()
+}
+
+// TotalVAT calculates the total VAT amount.
+func (q *Quote) TotalVAT() Money {
+	return q.Lines().TotalVAT()
+}
+
+// TotalTTC calculates the total including VAT.
+func (q *Quote) TotalTTC() Money {
+	return q.Lines().TotalTTC()
+}
+
+// VATBreakdown returns the VAT summary, one line per rate.
+func (q *Quote) VATBreakdown() []VATLine {
+	return q.Lines().VATBreakdown()
+}
+
+// QuoteItem represents a line item on a quote. Lines are copied to the
+// invoice when the quote is converted.
+type QuoteItem struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	QuoteID uint   `gorm:"index;not null" json:"quote_id"`
+	Quote   *Quote `gorm:"foreignKey:QuoteID" json:"-"`
+
+	ProductID *uint    `gorm:"index" json:"product_id,omitempty"`
+	Product   *Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+
+	Description string  `gorm:"size:500;not null" json:"description"`
+	Quantity    float64 `gorm:"type:decimal(10,3);not null;default:1" json:"quantity"`
+	UnitPrice   Money   `gorm:"type:decimal(10,2);not null" json:"unit_price"`
+	Unit        string  `gorm:"size:50;default:'unit'" json:"unit"`
+	VATRate     float64 `gorm:"type:decimal(5,4);not null" json:"vat_rate"`
+
+	Position int `gorm:"default:0" json:"position"`
+}
+
+// InvoiceItem returns the invoice line matching this quote line.
+func (item *QuoteItem) InvoiceItem() InvoiceItem {
+	return InvoiceItem{
+		ProductID:   item.ProductID,
+		Product:     item.Product,
+		Description: item.Description,
+		Quantity:    item.Quantity,
+		UnitPrice:   item.UnitPrice,
+		Unit:        item.Unit,
+		VATRate:     item.VATRate,
+		Position:    item.Position,
+	}
+}
+
+// TotalHT calculates the line total excluding VAT, rounded to the cent.
+func (item *QuoteItem) TotalHT() Money {
+	line := item.InvoiceItem()
+	return line.TotalHT()
+}
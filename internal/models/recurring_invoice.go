@@ -0,0 +1,182 @@
+package models
+
+import (
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Frequency is the billing period of a recurring invoice.
+type Frequency string
+
+const (
+	FrequencyMonthly   Frequency = "monthly"
+	FrequencyQuarterly Frequency = "quarterly"
+	FrequencyYearly    Frequency = "yearly"
+)
+
+// Frequencies lists the available frequencies, in display order.
+var Frequencies = []Frequency{FrequencyMonthly, FrequencyQuarterly, FrequencyYearly}
+
+// IsValid returns true if f is one of the known frequencies.
+func (f Frequency) IsValid() bool {
+	return f.Months() > 0
+}
+
+// Months returns the length of the period in months, 0 if f is unknown.
+func (f Frequency) Months() int {
+	switch f {
+	case FrequencyMonthly:
+		return 1
+	case FrequencyQuarterly:
+		return 3
+	case FrequencyYearly:
+		return 12
+	}
+	return 0
+}
+
+// RecurringInvoice is a template from which an invoice is generated at
+// every period, from StartDate until EndDate.
+// Implements the Ownable interface for ownership-based authorization.
+type RecurringInvoice struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	UserID uint `gorm:"index;not null" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+
+	ClientID uint    `gorm:"index;not null" json:"client_id"`
+	Client   *Client `gorm:"foreignKey:ClientID" json:"client,omitempty"`
+
+	Name      string     `gorm:"size:255;not null" json:"name"`
+	Frequency Frequency  `gorm:"size:20;not null" json:"frequency"`
+	StartDate time.Time  `gorm:"not null" json:"start_date"`
+	EndDate   *time.Time `json:"end_date,omitempty"`
+	// DueDays is the payment delay of the generated invoices.
+	DueDays int `gorm:"not null;default:30" json:"due_days"`
+	// AutoFinalize finalizes the generated invoices instead of leaving drafts.
+	AutoFinalize bool `gorm:"not null;default:false" json:"auto_finalize"`
+	Active       bool `gorm:"not null;default:true" json:"active"`
+
+	// Copied to the generated invoices
+	Reference    string `gorm:"size:100" json:"reference,omitempty"`
+	Notes        string `gorm:"type:text" json:"notes,omitempty"`
+	PaymentTerms string `gorm:"size:500" json:"payment_terms,omitempty"`
+
+	// Generated is the number of occurrences generated so far, and
+	// NextDate the date of the next one.
+	Generated int       `gorm:"not null;default:0" json:"generated"`
+	NextDate  time.Time `gorm:"index" json:"next_date"`
+	// LastError reports why the last generated invoice could not be
+	// finalized.
+	LastError string `gorm:"size:500" json:"last_error,omitempty"`
+
+	Items []RecurringInvoiceItem `gorm:"foreignKey:RecurringInvoiceID" json:"items,omitempty"`
+}
+
+// GetUserID implements the Ownable interface for authorization.
+func (r *RecurringInvoice) GetUserID() uint {
+	return r.UserID
+}
+
+// Occurrence returns the date of the n-th occurrence, counting from 0. The
+// day of the start date is kept, or the last day of shorter months.
+func (r *RecurringInvoice) Occurrence(n int) time.Time {
+	start := r.StartDate
+	months := int(start.Month()) - 1 + n*r.Frequency.Months()
+	year := start.Year() + months/12
+	month := time.Month(months%12 + 1)
+
+	day := start.Day()
+	if last := time.Date(year, month+1, 0, 0, 0, 0, 0, start.Location()).Day(); day > last {
+		day = last
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, start.Location())
+}
+
+// Ended returns true if the occurrence date is past the end date.
+func (r *RecurringInvoice) Ended(date time.Time) bool {
+	return r.EndDate != nil && date.After(*r.EndDate)
+}
+
+// Upcoming returns up to n future occurrence dates, from the next one.
+func (r *RecurringInvoice) Upcoming(n int) []time.Time {
+	var dates []time.Time
+	for i := r.Generated; len(dates) < n; i++ {
+		date := r.Occurrence(i)
+		if r.Ended(date) {
+			break
+		}
+		dates = append(dates, date)
+	}
+	return dates
+}
+
+// TotalHT returns the amount excluding VAT of each occurrence.
+func (r *RecurringInvoice) TotalHT() Money {
+	var total Money
+	for _, item := range r.Items {
+		total += item.TotalHT()
+	}
+	return total
+}
+
+// Invoice builds the draft invoice of the occurrence at date. Dates are
+// those of the occurrence; the number is a draft number.
+func (r *RecurringInvoice) Invoice(date time.Time, rounding RoundingPolicy) *Invoice {
+	id := r.ID
+	invoice := &Invoice{
+		UserID:             r.UserID,
+		ClientID:           r.ClientID,
+		Number:             "DRAFT-R" + date.Format("20060102") + "-" + strconv.FormatUint(uint64(r.ID), 10),
+		Reference:          r.Reference,
+		IssueDate:          date,
+		DueDate:            date.AddDate(0, 0, r.DueDays),
+		Status:             InvoiceStatusDraft,
+		Rounding:           rounding,
+		Notes:              r.Notes,
+		PaymentTerms:       r.PaymentTerms,
+		RecurringInvoiceID: &id,
+		RecurrenceDate:     &date,
+	}
+	for _, item := range r.Items {
+		invoice.Items = append(invoice.Items, InvoiceItem{
+			ProductID:   item.ProductID,
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Unit:        item.Unit,
+			VATRate:     item.VATRate,
+			Position:    item.Position,
+		})
+	}
+	return invoice
+}
+
+// RecurringInvoiceItem is a line copied to every generated invoice.
+type RecurringInvoiceItem struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	RecurringInvoiceID uint `gorm:"index;not null" json:"recurring_invoice_id"`
+
+	ProductID *uint    `gorm:"index" json:"product_id,omitempty"`
+	Product   *Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+
+	Description string  `gorm:"size:500;not null" json:"description"`
+	Quantity    float64 `gorm:"type:decimal(10,3);not null;default:1" json:"quantity"`
+	UnitPrice   Money   `gorm:"type:decimal(10,2);not null" json:"unit_price"`
+	Unit        string  `gorm:"size:50;default:'unit'" json:"unit"`
+	VATRate     float64 `gorm:"type:decimal(5,4);not null" json:"vat_rate"`
+	Position    int     `gorm:"default:0" json:"position"`
+}
+
+// TotalHT calculates the line total excluding VAT, rounded to the cent.
+func (item *RecurringInvoiceItem) TotalHT() Money {
+	return item.UnitPrice.Mul(item.Quantity)
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidReminderSchedule is returned for a malformed reminder schedule.
+var ErrInvalidReminderSchedule = errors.New("reminder schedule must list positive numbers of days, e.g. 7,15,30")
+
+// ParseReminderSchedule parses a comma-separated list of days after the
+// due date, returned sorted and without duplicates.
+func ParseReminderSchedule(s string) ([]int, error) {
+	var days []int
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == ';' }) {
+		n, err := strconv.Atoi(field)
+		if err != nil || n <= 0 {
+			return nil, ErrInvalidReminderSchedule
+		}
+		days = append(days, n)
+	}
+	slices.Sort(days)
+	return slices.Compact(days), nil
+}
+
+// FormatReminderSchedule is the inverse of ParseReminderSchedule.
+func FormatReminderSchedule(days []int) string {
+	fields := make([]string, len(days))
+	for i, n := range days {
+		fields[i] = strconv.Itoa(n)
+	}
+	return strings.Join(fields, ",")
+}
+
+// ReminderDays returns the reminder schedule, nil if reminders are off.
+func (c *CompanySettings) ReminderDays() []int {
+	days, _ := ParseReminderSchedule(c.ReminderSchedule)
+	return days
+}
+
+// ReminderLevel returns the escalation level reached by an invoice
+// daysLate days past due: the number of schedule steps passed, 0 before
+// the first one.
+func ReminderLevel(schedule []int, daysLate int) int {
+	level := 0
+	for _, days := range schedule {
+		if daysLate >= days {
+			level++
+		}
+	}
+	return level
+}
+
+// ReminderStatus is the delivery state of a reminder.
+type ReminderStatus string
+
+const (
+	ReminderPending ReminderStatus = "pending"
+	ReminderSent    ReminderStatus = "sent"
+	ReminderFailed  ReminderStatus = "failed"
+)
+
+// Reminder records a payment reminder emailed for an overdue invoice.
+// There is one reminder per invoice and escalation level, so that each
+// level is sent once; failed ones are retried, and so are pending ones
+// whose sender stopped before recording the outcome.
+type Reminder struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID    uint `gorm:"index;not null" json:"user_id"`
+	InvoiceID uint `gorm:"not null;uniqueIndex:idx_reminder_invoice_level" json:"invoice_id"`
+	Level     int  `gorm:"not null;uniqueIndex:idx_reminder_invoice_level" json:"level"`
+
+	DaysLate  int            `json:"days_late"`
+	Recipient string         `gorm:"size:255" json:"recipient"`
+	Status    ReminderStatus `gorm:"size:20;not null;default:'pending'" json:"status"`
+	// ClaimedAt is when a worker last started sending the reminder.
+	ClaimedAt *time.Time `json:"claimed_at,omitempty"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+	LastError string     `gorm:"size:500" json:"last_error,omitempty"`
+}
+
+// GetUserID returns the owner's user ID (implements Ownable).
+func (r *Reminder) GetUserID() uint {
+	return r.UserID
+}
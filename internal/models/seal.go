@@ -0,0 +1,138 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// InvoiceSealHead holds the end of the seal chain of a user's invoices.
+// It is locked while an invoice is sealed, which serializes the sealing.
+type InvoiceSealHead struct {
+	UserID   uint   `gorm:"primaryKey;autoIncrement:false"`
+	Sequence uint   `gorm:"not null"`
+	Hash     string `gorm:"size:64"`
+}
+
+// IsSealed returns true if the invoice was sealed when finalized.
+func (i *Invoice) IsSealed() bool {
+	return i.SealSequence > 0
+}
+
+// sealPayload is the canonical content of a sealed invoice. Its fields
+// are serialized in this order; the status, payments and sending dates,
+// which change after finalization, are left out.
+type sealPayload struct {
+	Sequence          uint            `json:"sequence"`
+	PrevHash          string          `json:"prev_hash"`
+	SealedAt          string          `json:"sealed_at"`
+	UserID            uint            `json:"user_id"`
+	Type              InvoiceType     `json:"type"`
+	Number            string          `json:"number"`
+	Reference         string          `json:"reference"`
+	OriginalInvoiceID *uint           `json:"original_invoice_id"`
+	IssueDate         string          `json:"issue_date"`
+	DueDate           string          `json:"due_date"`
+	Currency          Currency        `json:"currency"`
+	BaseCurrency      Currency        `json:"base_currency"`
+	ExchangeRate      float64         `json:"exchange_rate"`
+	Rounding          RoundingPolicy  `json:"rounding"`
+	Notes             string          `json:"notes"`
+	PaymentTerms      string          `json:"payment_terms"`
+	FooterText        string          `json:"footer_text"`
+	Client            *ClientSnapshot `json:"client"`
+	// Company is left out of the invoices sealed before it was snapshot
+	Company  *CompanySnapshot `json:"company,omitempty"`
+	Items    []sealItem       `json:"items"`
+	TotalHT  Money            `json:"total_ht"`
+	TotalVAT Money            `json:"total_vat"`
+	TotalTTC Money            `json:"total_ttc"`
+}
+
+type sealItem struct {
+	ProductID        *uint            `json:"product_id"`
+	CreditedItemID   *uint            `json:"credited_item_id"`
+	DepositInvoiceID *uint            `json:"deposit_invoice_id"`
+	Description      string           `json:"description"`
+	Quantity         float64          `json:"quantity"`
+	Unit             string           `json:"unit"`
+	UnitPrice        Money            `json:"unit_price"`
+	VATRate          float64          `json:"vat_rate"`
+	Product          *ProductSnapshot `json:"product,omitempty"`
+	Kind             ItemKind         `json:"kind,omitempty"`
+	DiscountRate     float64          `json:"discount_rate,omitempty"`
+	DiscountAmount   Money            `json:"discount_amount,omitempty"`
+}
+
+// SealPayload returns the canonical serialization of the invoice sealed
+// by SealHash. Items must be loaded.
+func (i *Invoice) SealPayload() []byte {
+	items := make([]InvoiceItem, len(i.Items))
+	copy(items, i.Items)
+	sort.SliceStable(items, func(a, b int) bool {
+		if items[a].Position != items[b].Position {
+			return items[a].Position < items[b].Position
+		}
+		return items[a].ID < items[b].ID
+	})
+
+	p := sealPayload{
+		Sequence:          i.SealSequence,
+		PrevHash:          i.SealPrevHash,
+		UserID:            i.UserID,
+		Type:              i.Type,
+		Number:            i.Number,
+		Reference:         i.Reference,
+		OriginalInvoiceID: i.OriginalInvoiceID,
+		IssueDate:         i.IssueDate.UTC().Format(time.RFC3339),
+		DueDate:           i.DueDate.UTC().Format(time.RFC3339),
+		Currency:          i.Currency,
+		BaseCurrency:      i.BaseCurrency,
+		ExchangeRate:      i.ExchangeRate,
+		Rounding:          i.Rounding,
+		Notes:             i.Notes,
+		PaymentTerms:      i.PaymentTerms,
+		FooterText:        i.FooterText,
+		Client:            i.ClientSnapshot,
+		Company:           i.CompanySnapshot,
+		Items:             make([]sealItem, 0, len(items)),
+		TotalHT:           i.TotalHT(),
+		TotalVAT:          i.TotalVAT(),
+		TotalTTC:          i.TotalTTC(),
+	}
+	if i.SealedAt != nil {
+		p.SealedAt = i.SealedAt.UTC().Format(time.RFC3339)
+	}
+	for _, item := range items {
+		// Lines leave the kind out, as they did before sections existed
+		var kind ItemKind
+		if !item.IsLine() {
+			kind = item.Kind
+		}
+		p.Items = append(p.Items, sealItem{
+			ProductID:        item.ProductID,
+			CreditedItemID:   item.CreditedItemID,
+			DepositInvoiceID: item.DepositInvoiceID,
+			Description:      item.Description,
+			Quantity:         item.Quantity,
+			Unit:             item.Unit,
+			UnitPrice:        item.UnitPrice,
+			VATRate:          item.VATRate,
+			Product:          item.ProductSnapshot,
+			Kind:             kind,
+			DiscountRate:     item.DiscountRate,
+			DiscountAmount:   item.DiscountAmount,
+		})
+	}
+	data, _ := json.Marshal(p)
+	return data
+}
+
+// ComputeSeal returns the SHA-256 of the canonical content of the
+// invoice, which includes the previous seal of the chain, as hex.
+func (i *Invoice) ComputeSeal() string {
+	sum := sha256.Sum256(i.SealPayload())
+	return hex.EncodeToString(sum[:])
+}
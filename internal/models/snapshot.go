@@ -0,0 +1,191 @@
+package models
+
+// ClientSnapshot is the client of an invoice as it was when the invoice
+// was finalized. Later edits of the client do not change issued invoices.
+type ClientSnapshot struct {
+	Name        string `json:"name"`
+	Company     string `json:"company,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Address     string `json:"address,omitempty"`
+	PostalCode  string `json:"postal_code,omitempty"`
+	City        string `json:"city,omitempty"`
+	Country     string `json:"country,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+	SIRET       string `json:"siret,omitempty"`
+	VATNumber   string `json:"vat_number,omitempty"`
+}
+
+// Snapshot returns the current details of the client.
+func (c *Client) Snapshot() *ClientSnapshot {
+	return &ClientSnapshot{
+		Name:        c.Name,
+		Company:     c.Company,
+		Email:       c.Email,
+		Address:     c.Address,
+		PostalCode:  c.PostalCode,
+		City:        c.City,
+		Country:     c.Country,
+		CountryCode: c.CountryCode,
+		SIRET:       c.SIRET,
+		VATNumber:   c.VATNumber,
+	}
+}
+
+// Client returns a client holding the snapshot details, to render the
+// invoice as issued.
+func (s *ClientSnapshot) Client() *Client {
+	return &Client{
+		Name:        s.Name,
+		Company:     s.Company,
+		Email:       s.Email,
+		Address:     s.Address,
+		PostalCode:  s.PostalCode,
+		City:        s.City,
+		Country:     s.Country,
+		CountryCode: s.CountryCode,
+		SIRET:       s.SIRET,
+		VATNumber:   s.VATNumber,
+	}
+}
+
+// CompanySnapshot is the issuer of an invoice as it was when the invoice
+// was finalized, with the terms its legal mentions derive from.
+type CompanySnapshot struct {
+	Name                  string  `json:"name"`
+	Email                 string  `json:"email,omitempty"`
+	Phone                 string  `json:"phone,omitempty"`
+	Website               string  `json:"website,omitempty"`
+	Address               string  `json:"address,omitempty"`
+	PostalCode            string  `json:"postal_code,omitempty"`
+	City                  string  `json:"city,omitempty"`
+	Country               string  `json:"country,omitempty"`
+	CountryCode           string  `json:"country_code,omitempty"`
+	SIRET                 string  `json:"siret,omitempty"`
+	VATNumber             string  `json:"vat_number,omitempty"`
+	RCS                   string  `json:"rcs,omitempty"`
+	Capital               string  `json:"capital,omitempty"`
+	VATExempt             bool    `json:"vat_exempt,omitempty"`
+	PaymentTermDays       int     `json:"payment_term_days"`
+	PaymentTermEndOfMonth bool    `json:"payment_term_end_of_month,omitempty"`
+	LatePenaltyRate       float64 `json:"late_penalty_rate,omitempty"`
+	LogoURL               string  `json:"logo_url,omitempty"`
+}
+
+// Snapshot returns the current details of the company.
+func (c *CompanySettings) Snapshot() *CompanySnapshot {
+	return &CompanySnapshot{
+		Name:                  c.Name,
+		Email:                 c.Email,
+		Phone:                 c.Phone,
+		Website:               c.Website,
+		Address:               c.Address,
+		PostalCode:            c.PostalCode,
+		City:                  c.City,
+		Country:               c.Country,
+		CountryCode:           c.CountryCode,
+		SIRET:                 c.SIRET,
+		VATNumber:             c.VATNumber,
+		RCS:                   c.RCS,
+		Capital:               c.Capital,
+		VATExempt:             c.VATExempt,
+		PaymentTermDays:       c.PaymentTermDays,
+		PaymentTermEndOfMonth: c.PaymentTermEndOfMonth,
+		LatePenaltyRate:       c.LatePenaltyRate,
+		LogoURL:               c.LogoURL,
+	}
+}
+
+// Company returns company settings holding the snapshot details, to
+// render the invoice as issued.
+func (s *CompanySnapshot) Company(userID uint) *CompanySettings {
+	return &CompanySettings{
+		UserID:                userID,
+		Name:                  s.Name,
+		Email:                 s.Email,
+		Phone:                 s.Phone,
+		Website:               s.Website,
+		Address:               s.Address,
+		PostalCode:            s.PostalCode,
+		City:                  s.City,
+		Country:               s.Country,
+		CountryCode:           s.CountryCode,
+		SIRET:                 s.SIRET,
+		VATNumber:             s.VATNumber,
+		RCS:                   s.RCS,
+		Capital:               s.Capital,
+		VATExempt:             s.VATExempt,
+		PaymentTermDays:       s.PaymentTermDays,
+		PaymentTermEndOfMonth: s.PaymentTermEndOfMonth,
+		LatePenaltyRate:       s.LatePenaltyRate,
+		LogoURL:               s.LogoURL,
+	}
+}
+
+// ProductSnapshot is the product of an invoice line as it was when the
+// invoice was finalized.
+type ProductSnapshot struct {
+	Code        string  `json:"code"`
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Unit        string  `json:"unit,omitempty"`
+	UnitPrice   Money   `json:"unit_price"`
+	VATRate     float64 `json:"vat_rate"`
+	Category    string  `json:"category,omitempty"`
+}
+
+// Snapshot returns the current details of the product.
+func (p *Product) Snapshot() *ProductSnapshot {
+	return &ProductSnapshot{
+		Code:        p.Code,
+		Name:        p.Name,
+		Description: p.Description,
+		Unit:        p.Unit,
+		UnitPrice:   p.UnitPrice,
+		VATRate:     p.VATRate,
+		Category:    p.Category,
+	}
+}
+
+// Product returns a product holding the snapshot details.
+func (s *ProductSnapshot) Product(id uint) *Product {
+	return &Product{
+		ID:          id,
+		Code:        s.Code,
+		Name:        s.Name,
+		Description: s.Description,
+		Unit:        s.Unit,
+		UnitPrice:   s.UnitPrice,
+		VATRate:     s.VATRate,
+		Category:    s.Category,
+	}
+}
+
+// UseSnapshots replaces the client and the products of a finalized
+// invoice by their snapshots, so that it renders as issued whatever was
+// edited since. Drafts, and invoices finalized before snapshots were
+// taken, keep the live records.
+func (i *Invoice) UseSnapshots() {
+	if i.IsDraft() {
+		return
+	}
+	if i.ClientSnapshot != nil {
+		client := i.ClientSnapshot.Client()
+		client.ID, client.UserID = i.ClientID, i.UserID
+		i.Client = client
+	}
+	for n := range i.Items {
+		item := &i.Items[n]
+		if item.ProductSnapshot != nil && item.ProductID != nil {
+			item.Product = item.ProductSnapshot.Product(*item.ProductID)
+		}
+	}
+}
+
+// Seller returns the issuer of the invoice: the company snapshot once
+// finalized, the given live settings otherwise.
+func (i *Invoice) Seller(company *CompanySettings) *CompanySettings {
+	if i.IsDraft() || i.CompanySnapshot == nil {
+		return company
+	}
+	return i.CompanySnapshot.Company(i.UserID)
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookEvent names an invoice lifecycle event sent to webhook endpoints.
+type WebhookEvent string
+
+const (
+	WebhookInvoiceCreated   WebhookEvent = "invoice.created"
+	WebhookInvoiceFinalized WebhookEvent = "invoice.finalized"
+	WebhookInvoicePaid      WebhookEvent = "invoice.paid"
+	WebhookInvoiceCancelled WebhookEvent = "invoice.cancelled"
+	// WebhookInvoiceReopened is sent when a paid invoice has an outstanding
+	// balance again, after a payment was deleted.
+	WebhookInvoiceReopened WebhookEvent = "invoice.reopened"
+)
+
+// WebhookEvents lists the events an endpoint can subscribe to.
+var WebhookEvents = []WebhookEvent{
+	WebhookInvoiceCreated,
+	WebhookInvoiceFinalized,
+	WebhookInvoicePaid,
+	WebhookInvoiceCancelled,
+	WebhookInvoiceReopened,
+}
+
+// IsValid returns true if e is one of the known events.
+func (e WebhookEvent) IsValid() bool {
+	for _, known := range WebhookEvents {
+		if e == known {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEndpoint is a URL notified of the lifecycle events of a user's
+// invoices. Deliveries are signed with Secret.
+// Implements the Ownable interface for ownership-based authorization.
+type WebhookEndpoint struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	UserID uint `gorm:"index;not null" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+
+	URL    string `gorm:"size:500;not null" json:"url"`
+	Secret string `gorm:"size:100;not null" json:"-"`
+	// Events is a space-separated list of WebhookEvent; empty means all events.
+	Events string `gorm:"size:255" json:"events"`
+	Active bool   `gorm:"default:true" json:"active"`
+}
+
+// GetUserID returns the owner's user ID (implements Ownable).
+func (e *WebhookEndpoint) GetUserID() uint {
+	return e.UserID
+}
+
+// EventList returns the subscribed events.
+func (e *WebhookEndpoint) EventList() []WebhookEvent {
+	var events []WebhookEvent
+	for _, name := range strings.Fields(e.Events) {
+		events = append(events, WebhookEvent(name))
+	}
+	return events
+}
+
+// Accepts returns true if the endpoint subscribes to event.
+func (e *WebhookEndpoint) Accepts(event WebhookEvent) bool {
+	events := e.EventList()
+	if len(events) == 0 {
+		return true
+	}
+	for _, ev := range events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDeliveryStatus is the state of a delivery in the queue.
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event to send to one endpoint. Pending deliveries
+// form the queue: they are attempted once NextAttemptAt is reached, and
+// rescheduled with a growing delay until delivered or out of attempts.
+type WebhookDelivery struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID     uint             `gorm:"index;not null" json:"user_id"`
+	EndpointID uint             `gorm:"index;not null" json:"endpoint_id"`
+	Endpoint   *WebhookEndpoint `gorm:"foreignKey:EndpointID" json:"-"`
+
+	Event     WebhookEvent `gorm:"size:50;not null" json:"event"`
+	InvoiceID uint         `gorm:"index" json:"invoice_id"`
+	Payload   string       `gorm:"type:text;not null" json:"-"`
+
+	Status        WebhookDeliveryStatus `gorm:"size:20;not null;default:'pending';index:idx_webhook_queue" json:"status"`
+	NextAttemptAt time.Time             `gorm:"index:idx_webhook_queue" json:"next_attempt_at"`
+	Attempts      int                   `gorm:"not null;default:0" json:"attempts"`
+	LastAttemptAt *time.Time            `json:"last_attempt_at,omitempty"`
+	// ResponseStatus is the HTTP status of the last attempt, 0 if the
+	// request did not get a response.
+	ResponseStatus int    `json:"response_status"`
+	LastError      string `gorm:"size:500" json:"last_error,omitempty"`
+}
+
+// GetUserID returns the owner's user ID (implements Ownable).
+func (d *WebhookDelivery) GetUserID() uint {
+	return d.UserID
+}
@@ -0,0 +1,222 @@
+// Package openapi builds OpenAPI 3.1 documents. Schemas are derived from
+// Go types and their json tags, so the spec follows the models.
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.1.0"
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+	Tags       []Tag                 `json:"tags,omitempty"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag groups operations.
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// PathItem maps the lowercase HTTP methods of a path to their operation.
+type PathItem map[string]*Operation
+
+// Operation describes one method on one path.
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Description string              `json:"description,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	// Security overrides the document security; an empty list makes the
+	// operation public.
+	Security *[]map[string][]string `json:"security,omitempty"`
+	// Permission is the gate permission required, as "resource:action".
+	Permission string `json:"x-permission,omitempty"`
+}
+
+// Parameter is a path or query parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the body of a request.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a response, or references one with Ref.
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body for a content type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the reusable parts of a document.
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	Responses       map[string]Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how requests authenticate.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Schema is a JSON Schema (2020-12, as used by OpenAPI 3.1).
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        any                `json:"type,omitempty"` // a name, or a list of names
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+	MultipleOf  float64            `json:"multipleOf,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+}
+
+// RefTo returns a reference to the component schema name.
+func RefTo(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// Registry derives schemas from Go types. Named struct types become
+// component schemas, referenced by their type name.
+type Registry struct {
+	schemas map[string]*Schema
+	defined map[reflect.Type]*Schema
+}
+
+// NewRegistry returns a registry that knows time.Time.
+func NewRegistry() *Registry {
+	r := &Registry{
+		schemas: map[string]*Schema{},
+		defined: map[reflect.Type]*Schema{},
+	}
+	r.Define(time.Time{}, &Schema{Type: "string", Format: "date-time"})
+	return r
+}
+
+// Define sets the schema of the type of v, for types whose JSON encoding
+// is not derived from their fields (custom MarshalJSON).
+func (r *Registry) Define(v any, s *Schema) {
+	r.defined[reflect.TypeOf(v)] = s
+}
+
+// Schema returns the schema of the type of v, registering the component
+// schemas it needs.
+func (r *Registry) Schema(v any) *Schema {
+	return r.schemaOf(reflect.TypeOf(v))
+}
+
+// Schemas returns the component schemas registered so far.
+func (r *Registry) Schemas() map[string]*Schema {
+	return r.schemas
+}
+
+func (r *Registry) schemaOf(t reflect.Type) *Schema {
+	if s, ok := r.defined[t]; ok {
+		return s
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return r.schemaOf(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: r.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.object(t)
+		}
+		if _, ok := r.schemas[t.Name()]; !ok {
+			// Register first: models reference each other
+			r.schemas[t.Name()] = &Schema{}
+			*r.schemas[t.Name()] = *r.object(t)
+		}
+		return RefTo(t.Name())
+	}
+	return &Schema{}
+}
+
+// object builds the schema of a struct from its json tags, as
+// encoding/json would encode it. Fields without omitempty are required.
+func (r *Registry) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	r.fields(t, s)
+	return s
+}
+
+func (r *Registry) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				r.fields(ft, s)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = r.schemaOf(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package pdfa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// sRGB is the name of the output condition of the profile.
+const sRGB = "sRGB IEC61966-2.1"
+
+// srgbProfile builds an ICC v2 display profile of sRGB: its primaries
+// adapted to D50 and its tone curve sampled in 1024 points.
+func srgbProfile() []byte {
+	xyz := func(x, y, z float64) []byte {
+		b := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range []float64{x, y, z} {
+			b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(v*65536))))
+		}
+		return b
+	}
+
+	curve := []byte("curv\x00\x00\x00\x00")
+	const points = 1024
+	curve = binary.BigEndian.AppendUint32(curve, points)
+	for i := 0; i < points; i++ {
+		v := float64(i) / (points - 1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		curve = binary.BigEndian.AppendUint16(curve, uint16(math.Round(v*65535)))
+	}
+
+	desc := []byte("desc\x00\x00\x00\x00")
+	desc = binary.BigEndian.AppendUint32(desc, uint32(len(sRGB)+1))
+	desc = append(desc, sRGB+"\x00"...)
+	// No Unicode nor ScriptCode description
+	desc = append(desc, make([]byte, 4+4+2+1+67)...)
+
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", desc},
+		{"cprt", []byte("text\x00\x00\x00\x00No copyright\x00")},
+		{"wtpt", xyz(0.9642, 1, 0.8249)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	offset := 128 + 4 + 12*len(tags)
+	for _, tag := range tags {
+		table.WriteString(tag.sig)
+		binary.Write(&table, binary.BigEndian, uint32(offset+data.Len()))
+		binary.Write(&table, binary.BigEndian, uint32(len(tag.data)))
+		data.Write(tag.data)
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(128+table.Len()+data.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	binary.BigEndian.PutUint16(header[24:], 2024)
+	binary.BigEndian.PutUint16(header[26:], 1)
+	binary.BigEndian.PutUint16(header[28:], 1)
+	copy(header[36:], "acsp")
+	copy(header[68:], xyz(0.9642, 1, 0.8249)[8:])
+
+	return append(append(header, table.Bytes()...), data.Bytes()...)
+}
@@ -0,0 +1,247 @@
+package pdfa
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Block is a titled group of lines of an appended page.
+type Block struct {
+	Title string
+	Lines []string
+}
+
+// Layout of appended pages, in points.
+const (
+	pageMargin  = 50
+	headingSize = 14
+	titleSize   = 10
+	textSize    = 9
+	leading     = 1.4
+)
+
+// AppendPages appends pages holding a heading and blocks of text after
+// the pages of doc. Text is set in Helvetica, lines are wrapped to the
+// width of the first page and run on to a new page when one is full.
+func AppendPages(doc []byte, heading string, blocks ...Block) ([]byte, error) {
+	t, err := readTrailer(doc)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := readDict(doc, t.root)
+	if err != nil {
+		return nil, err
+	}
+	raw, _ := catalog.get("Pages")
+	root, ok := parseRef(raw)
+	if !ok {
+		return nil, fmt.Errorf("%w: no page tree", ErrUnsupported)
+	}
+	pages, err := readDict(doc, root)
+	if err != nil {
+		return nil, err
+	}
+	kids, _ := pages.get("Kids")
+	kids = strings.TrimSpace(kids)
+	count, _ := pages.get("Count")
+	n, err := strconv.Atoi(count)
+	if err != nil || !strings.HasPrefix(kids, "[") || !strings.HasSuffix(kids, "]") {
+		return nil, fmt.Errorf("%w: invalid page tree", ErrUnsupported)
+	}
+	width, height := pageSize(doc, pages, kids)
+
+	u := newUpdate(doc, t)
+	font := func(name string) string {
+		return u.object(dict{
+			{"Type", "/Font"},
+			{"Subtype", "/Type1"},
+			{"BaseFont", "/" + name},
+			{"Encoding", "/WinAnsiEncoding"},
+		}.String()).String()
+	}
+	resources := dict{{"Font", dict{{"F1", font("Helvetica")}, {"F2", font("Helvetica-Bold")}}.String()}}.String()
+	mediaBox := "[0 0 " + formatNumber(width) + " " + formatNumber(height) + "]"
+
+	var added []string
+	for _, content := range layout(width, height, heading, blocks) {
+		contents := u.stream(nil, content, true)
+		page := u.object(dict{
+			{"Type", "/Page"},
+			{"Parent", root.String()},
+			{"MediaBox", mediaBox},
+			{"Resources", resources},
+			{"Contents", contents.String()},
+		}.String())
+		added = append(added, page.String())
+	}
+	kids = strings.TrimSpace(strings.TrimSuffix(kids, "]")) + " " + strings.Join(added, " ") + "]"
+	pages = pages.set("Kids", kids)
+	pages = pages.set("Count", strconv.Itoa(n+len(added)))
+	u.write(root, pages.String())
+	return u.finish(doc, t, t.info), nil
+}
+
+// pageSize returns the size of the first page of a page tree, A4 if it
+// cannot be read.
+func pageSize(doc []byte, pages dict, kids string) (float64, float64) {
+	box, ok := "", false
+	if refs := strings.Fields(strings.Trim(kids, "[] ")); len(refs) >= 3 {
+		if first, isRef := parseRef(strings.Join(refs[:3], " ")); isRef {
+			if page, err := readDict(doc, first); err == nil {
+				box, ok = page.get("MediaBox")
+			}
+		}
+	}
+	if !ok {
+		box, ok = pages.get("MediaBox")
+	}
+	if fields := strings.Fields(strings.Trim(box, "[] ")); ok && len(fields) == 4 {
+		var v [4]float64
+		for i, field := range fields {
+			f, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return 595.28, 841.89
+			}
+			v[i] = f
+		}
+		if v[2] > v[0] && v[3] > v[1] {
+			return v[2] - v[0], v[3] - v[1]
+		}
+	}
+	return 595.28, 841.89
+}
+
+// textLine is a line of an appended page, with the space before it.
+type textLine struct {
+	font  string
+	size  float64
+	text  string
+	space float64
+}
+
+// layout returns the content streams of the pages holding heading and
+// blocks.
+func layout(width, height float64, heading string, blocks []Block) [][]byte {
+	lines := []textLine{{font: "F2", size: headingSize, text: heading}}
+	for _, block := range blocks {
+		if len(block.Lines) == 0 {
+			continue
+		}
+		space := float64(titleSize)
+		if block.Title != "" {
+			lines = append(lines, textLine{font: "F2", size: titleSize, text: block.Title, space: space})
+			space = 0
+		}
+		for _, line := range block.Lines {
+			for _, wrapped := range wrap(line, textSize, width-2*pageMargin) {
+				lines = append(lines, textLine{font: "F1", size: textSize, text: wrapped, space: space})
+				space = 0
+			}
+		}
+	}
+
+	var pages [][]byte
+	var content *bytes.Buffer
+	top := 0.0
+	for _, line := range lines {
+		if content == nil || top-line.space-line.size*leading < pageMargin {
+			if content != nil {
+				pages = append(pages, content.Bytes())
+			}
+			content = new(bytes.Buffer)
+			top = height - pageMargin
+		} else {
+			top -= line.space
+		}
+		fmt.Fprintf(content, "BT /%s %s Tf %s %s Td %s Tj ET\n",
+			line.font, formatNumber(line.size), formatNumber(pageMargin), formatNumber(top-line.size), winAnsiString(line.text))
+		top -= line.size * leading
+	}
+	return append(pages, content.Bytes())
+}
+
+// wrap splits text into lines no wider than width at size. A word wider
+// than width gets a line of its own.
+func wrap(text string, size, width float64) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && textWidth(candidate, size) > width {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	return append(lines, line)
+}
+
+// helveticaWidths are the widths of the printable ASCII characters in
+// Helvetica, in thousandths of the font size.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+}
+
+// textWidth returns the width of text set in Helvetica at size. Other
+// characters than ASCII are counted as wide as a digit.
+func textWidth(text string, size float64) float64 {
+	w := 0
+	for _, r := range text {
+		if r >= ' ' && r <= '~' {
+			w += helveticaWidths[r-' ']
+		} else {
+			w += 556
+		}
+	}
+	return float64(w) * size / 1000
+}
+
+// winAnsi maps the characters of WinAnsiEncoding outside Latin-1.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, 'Œ': 0x8c, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'–': 0x96, '—': 0x97, 'œ': 0x9c, ' ': 0xa0,
+}
+
+// winAnsiString encodes text as a literal string in WinAnsiEncoding,
+// with characters it cannot hold replaced by "?".
+func winAnsiString(text string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range text {
+		c, ok := winAnsi[r]
+		switch {
+		case ok:
+		case r >= ' ' && r <= '~' || r >= 0xa0 && r <= 0xff:
+			c = byte(r)
+		default:
+			c = '?'
+		}
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c >= 0x80:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// formatNumber formats a coordinate with at most 2 decimals.
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,306 @@
+package pdfa
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ref is an indirect object reference.
+type ref struct {
+	num, gen int
+}
+
+func (r ref) String() string {
+	return fmt.Sprintf("%d %d R", r.num, r.gen)
+}
+
+func parseRef(raw string) (ref, bool) {
+	fields := strings.Fields(raw)
+	if len(fields) != 3 || fields[2] != "R" {
+		return ref{}, false
+	}
+	num, err1 := strconv.Atoi(fields[0])
+	gen, err2 := strconv.Atoi(fields[1])
+	return ref{num, gen}, err1 == nil && err2 == nil
+}
+
+// entry is a dictionary entry, its value kept as written.
+type entry struct {
+	key, value string
+}
+
+// dict is a PDF dictionary whose entries keep their order.
+type dict []entry
+
+func (d dict) get(key string) (string, bool) {
+	for _, e := range d {
+		if e.key == key {
+			return e.value, true
+		}
+	}
+	return "", false
+}
+
+func (d dict) set(key, value string) dict {
+	for i, e := range d {
+		if e.key == key {
+			d[i].value = value
+			return d
+		}
+	}
+	return append(d, entry{key, value})
+}
+
+func (d dict) String() string {
+	var b strings.Builder
+	b.WriteString("<<")
+	for _, e := range d {
+		b.WriteString(" /" + e.key + " " + e.value)
+	}
+	b.WriteString(" >>")
+	return b.String()
+}
+
+// trailer is what an incremental update needs from the last
+// cross-reference section of a PDF.
+type trailer struct {
+	offset int  // of the cross-reference section
+	stream bool // a cross-reference stream rather than a table
+	size   int
+	root   ref
+	info   string // raw reference, empty if none
+	id     string // first file identifier, as a hex string
+}
+
+func readTrailer(doc []byte) (*trailer, error) {
+	i := bytes.LastIndex(doc, []byte("startxref"))
+	if i < 0 {
+		return nil, fmt.Errorf("%w: no startxref", ErrUnsupported)
+	}
+	s := &scanner{b: doc, pos: i + len("startxref")}
+	s.skipSpace()
+	offset, err := strconv.Atoi(s.token())
+	if err != nil || offset <= 0 || offset >= len(doc) {
+		return nil, fmt.Errorf("%w: invalid startxref", ErrUnsupported)
+	}
+
+	t := &trailer{offset: offset}
+	var d dict
+	if bytes.HasPrefix(doc[offset:], []byte("xref")) {
+		j := bytes.Index(doc[offset:], []byte("trailer"))
+		if j < 0 {
+			return nil, fmt.Errorf("%w: no trailer", ErrUnsupported)
+		}
+		s = &scanner{b: doc, pos: offset + j + len("trailer")}
+		d, err = s.dict()
+	} else {
+		t.stream = true
+		s = &scanner{b: doc, pos: offset}
+		d, err = s.indirectDict()
+		if typ, _ := d.get("Type"); err == nil && typ != "/XRef" {
+			err = fmt.Errorf("%w: no cross-reference at startxref", ErrUnsupported)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	size, _ := d.get("Size")
+	if t.size, err = strconv.Atoi(size); err != nil {
+		return nil, fmt.Errorf("%w: invalid trailer size", ErrUnsupported)
+	}
+	root, _ := d.get("Root")
+	var ok bool
+	if t.root, ok = parseRef(root); !ok {
+		return nil, fmt.Errorf("%w: no document catalog", ErrUnsupported)
+	}
+	t.info, _ = d.get("Info")
+	if id, ok := d.get("ID"); ok {
+		if open, end := strings.IndexByte(id, '<'), strings.IndexByte(id, '>'); open >= 0 && end > open {
+			t.id = id[open+1 : end]
+		}
+	}
+	return t, nil
+}
+
+// readDict returns the dictionary of an object, from its last definition.
+// Objects stored in object streams are not supported.
+func readDict(doc []byte, r ref) (dict, error) {
+	pattern := regexp.MustCompile(fmt.Sprintf(`(?:^|\s)%d\s+%d\s+obj\b`, r.num, r.gen))
+	matches := pattern.FindAllIndex(doc, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: object %d not found", ErrUnsupported, r.num)
+	}
+	s := &scanner{b: doc, pos: matches[len(matches)-1][0]}
+	return s.indirectDict()
+}
+
+// scanner reads PDF objects, keeping their text as written.
+type scanner struct {
+	b   []byte
+	pos int
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return isSpace(c) || strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (s *scanner) skipSpace() {
+	for s.pos < len(s.b) {
+		switch c := s.b[s.pos]; {
+		case isSpace(c):
+			s.pos++
+		case c == '%':
+			for s.pos < len(s.b) && s.b[s.pos] != '\n' && s.b[s.pos] != '\r' {
+				s.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token reads a run of regular characters.
+func (s *scanner) token() string {
+	start := s.pos
+	for s.pos < len(s.b) && !isDelimiter(s.b[s.pos]) {
+		s.pos++
+	}
+	return string(s.b[start:s.pos])
+}
+
+func (s *scanner) expect(keyword string) error {
+	s.skipSpace()
+	if !bytes.HasPrefix(s.b[s.pos:], []byte(keyword)) {
+		return fmt.Errorf("%w: expected %q at offset %d", ErrUnsupported, keyword, s.pos)
+	}
+	s.pos += len(keyword)
+	return nil
+}
+
+// indirectDict reads "num gen obj" followed by a dictionary.
+func (s *scanner) indirectDict() (dict, error) {
+	s.skipSpace()
+	s.token()
+	s.skipSpace()
+	s.token()
+	if err := s.expect("obj"); err != nil {
+		return nil, err
+	}
+	return s.dict()
+}
+
+func (s *scanner) dict() (dict, error) {
+	if err := s.expect("<<"); err != nil {
+		return nil, err
+	}
+	var d dict
+	for {
+		s.skipSpace()
+		if s.pos >= len(s.b) {
+			return nil, fmt.Errorf("%w: unterminated dictionary", ErrUnsupported)
+		}
+		if bytes.HasPrefix(s.b[s.pos:], []byte(">>")) {
+			s.pos += 2
+			return d, nil
+		}
+		if s.b[s.pos] != '/' {
+			return nil, fmt.Errorf("%w: expected a name at offset %d", ErrUnsupported, s.pos)
+		}
+		s.pos++
+		key := s.token()
+		value, err := s.object()
+		if err != nil {
+			return nil, err
+		}
+		d = append(d, entry{key, value})
+	}
+}
+
+// object reads any object, a reference included, and returns its text.
+func (s *scanner) object() (string, error) {
+	s.skipSpace()
+	if s.pos >= len(s.b) {
+		return "", fmt.Errorf("%w: unexpected end of file", ErrUnsupported)
+	}
+	start := s.pos
+	switch c := s.b[s.pos]; {
+	case bytes.HasPrefix(s.b[s.pos:], []byte("<<")):
+		if _, err := s.dict(); err != nil {
+			return "", err
+		}
+	case c == '<':
+		end := bytes.IndexByte(s.b[s.pos:], '>')
+		if end < 0 {
+			return "", fmt.Errorf("%w: unterminated string", ErrUnsupported)
+		}
+		s.pos += end + 1
+	case c == '(':
+		if err := s.literal(); err != nil {
+			return "", err
+		}
+	case c == '[':
+		s.pos++
+		for {
+			s.skipSpace()
+			if s.pos < len(s.b) && s.b[s.pos] == ']' {
+				s.pos++
+				break
+			}
+			if _, err := s.object(); err != nil {
+				return "", err
+			}
+		}
+	case c == '/':
+		s.pos++
+		s.token()
+	default:
+		if s.token() == "" {
+			return "", fmt.Errorf("%w: unexpected %q at offset %d", ErrUnsupported, c, s.pos)
+		}
+		// A number may start a reference: "num gen R"
+		end := s.pos
+		s.skipSpace()
+		if gen := s.token(); gen != "" && isInteger(gen) {
+			s.skipSpace()
+			if s.token() == "R" {
+				return string(s.b[start:s.pos]), nil
+			}
+		}
+		s.pos = end
+	}
+	return string(s.b[start:s.pos]), nil
+}
+
+// literal reads a literal string, with its balanced parentheses and
+// escapes.
+func (s *scanner) literal() error {
+	depth := 0
+	for ; s.pos < len(s.b); s.pos++ {
+		switch s.b[s.pos] {
+		case '\\':
+			s.pos++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				s.pos++
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: unterminated string", ErrUnsupported)
+}
+
+func isInteger(token string) bool {
+	_, err := strconv.Atoi(token)
+	return err == nil
+}
@@ -0,0 +1,310 @@
+// Package pdfa turns PDFs into PDF/A-3 documents carrying embedded files,
+// as Factur-X requires. It appends an incremental update, leaving the
+// rendered pages untouched: the catalog gets the XMP metadata, an sRGB
+// output intent and the files, declared as associated files. Pages of
+// text can be appended the same way, for what the renderer does not lay
+// out.
+package pdfa
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// ErrUnsupported is returned for PDFs whose structure cannot be updated:
+// no classic or stream cross-reference, a catalog in an object stream or
+// one that already has a name tree.
+var ErrUnsupported = errors.New("pdfa: unsupported PDF structure")
+
+// File is a file to embed.
+type File struct {
+	Name        string
+	Description string
+	MimeType    string
+	// Relationship is the AFRelationship of the file to the document:
+	// Source, Data, Alternative, Supplement or Unspecified.
+	Relationship string
+	Data         []byte
+}
+
+// Metadata describes the document in its XMP metadata and information
+// dictionary.
+type Metadata struct {
+	Title    string
+	Producer string
+	Date     time.Time
+	// Extension holds rdf:Description elements added to the XMP packet,
+	// with the extension schemas their namespaces require.
+	Extension string
+}
+
+// Convert declares doc as PDF/A-3B and embeds files into it. The PDF must
+// already meet PDF/A requirements on its content, such as embedded fonts.
+func Convert(doc []byte, meta Metadata, files ...File) ([]byte, error) {
+	t, err := readTrailer(doc)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := readDict(doc, t.root)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := catalog.get("Names"); ok {
+		return nil, fmt.Errorf("%w: catalog already has a name tree", ErrUnsupported)
+	}
+
+	u := newUpdate(doc, t)
+	date := pdfDate(meta.Date)
+	var specs, names []string
+	for _, file := range files {
+		stream := u.stream(dict{
+			{"Type", "/EmbeddedFile"},
+			{"Subtype", pdfName(file.MimeType)},
+			{"Params", dict{{"Size", strconv.Itoa(len(file.Data))}, {"ModDate", date}}.String()},
+		}, file.Data, true)
+		spec := u.object(dict{
+			{"Type", "/Filespec"},
+			{"F", pdfString(file.Name)},
+			{"UF", pdfString(file.Name)},
+			{"Desc", pdfString(file.Description)},
+			{"AFRelationship", pdfName(file.Relationship)},
+			{"EF", dict{{"F", stream.String()}, {"UF", stream.String()}}.String()},
+		}.String())
+		specs = append(specs, spec.String())
+		names = append(names, pdfString(file.Name)+" "+spec.String())
+	}
+
+	metadata := u.stream(dict{{"Type", "/Metadata"}, {"Subtype", "/XML"}}, []byte(xmp(meta)), false)
+	profile := u.stream(dict{{"N", "3"}}, srgbProfile(), true)
+	intent := u.object(dict{
+		{"Type", "/OutputIntent"},
+		{"S", "/GTS_PDFA1"},
+		{"OutputConditionIdentifier", pdfString(sRGB)},
+		{"Info", pdfString(sRGB)},
+		{"DestOutputProfile", profile.String()},
+	}.String())
+	info := u.object(dict{
+		{"Title", pdfString(meta.Title)},
+		{"Producer", pdfString(meta.Producer)},
+		{"CreationDate", date},
+		{"ModDate", date},
+	}.String())
+
+	catalog = catalog.set("Metadata", metadata.String())
+	catalog = catalog.set("OutputIntents", "["+intent.String()+"]")
+	if len(files) > 0 {
+		embedded := u.object(dict{{"Names", "[" + strings.Join(names, " ") + "]"}}.String())
+		catalog = catalog.set("Names", dict{{"EmbeddedFiles", embedded.String()}}.String())
+		catalog = catalog.set("AF", "["+strings.Join(specs, " ")+"]")
+	}
+	u.write(t.root, catalog.String())
+	return u.finish(doc, t, info.String()), nil
+}
+
+// update appends objects to a PDF and their cross-reference section.
+type update struct {
+	buf     bytes.Buffer
+	next    int
+	offsets map[int]int
+	gens    map[int]int
+}
+
+// newUpdate starts an update of doc, whose last cross-reference section
+// is t.
+func newUpdate(doc []byte, t *trailer) *update {
+	u := &update{next: t.size, offsets: map[int]int{}, gens: map[int]int{}}
+	u.buf.Write(doc)
+	if c := doc[len(doc)-1]; c != '\n' && c != '\r' {
+		u.buf.WriteByte('\n')
+	}
+	return u
+}
+
+// finish writes the cross-reference section of the update, in the form of
+// the original one, and returns the updated document. info is the
+// information dictionary reference, if any.
+func (u *update) finish(doc []byte, t *trailer, info string) []byte {
+	// The first identifier is the original file's, the second one changes
+	// with every update
+	id := t.id
+	if id == "" {
+		sum := md5.Sum(doc)
+		id = hex.EncodeToString(sum[:])
+	}
+	sum := md5.Sum(u.buf.Bytes())
+	trailer := dict{{"Size", ""}, {"Root", t.root.String()}}
+	if info != "" {
+		trailer = trailer.set("Info", info)
+	}
+	trailer = trailer.set("Prev", strconv.Itoa(t.offset))
+	trailer = trailer.set("ID", "[<"+id+"> <"+hex.EncodeToString(sum[:])+">]")
+	if t.stream {
+		u.xrefStream(trailer)
+	} else {
+		u.xrefTable(trailer)
+	}
+	return u.buf.Bytes()
+}
+
+// write writes an object, replacing any previous definition.
+func (u *update) write(r ref, body string) {
+	u.offsets[r.num] = u.buf.Len()
+	u.gens[r.num] = r.gen
+	fmt.Fprintf(&u.buf, "%d %d obj\n%s\nendobj\n", r.num, r.gen, body)
+}
+
+// object writes a new object and returns its reference.
+func (u *update) object(body string) ref {
+	r := ref{num: u.next}
+	u.next++
+	u.write(r, body)
+	return r
+}
+
+// stream writes a new stream object, compressed or not.
+func (u *update) stream(d dict, data []byte, compress bool) ref {
+	if compress {
+		var b bytes.Buffer
+		w := zlib.NewWriter(&b)
+		w.Write(data)
+		w.Close()
+		data = b.Bytes()
+		d = d.set("Filter", "/FlateDecode")
+	}
+	d = d.set("Length", strconv.Itoa(len(data)))
+	return u.object(d.String() + "\nstream\n" + string(data) + "\nendstream")
+}
+
+// numbers returns the numbers of the objects written, in order, and the
+// /Index of their subsections.
+func (u *update) numbers() ([]int, []string) {
+	nums := make([]int, 0, len(u.offsets))
+	for num := range u.offsets {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	var index []string
+	for i := 0; i < len(nums); {
+		j := i + 1
+		for j < len(nums) && nums[j] == nums[j-1]+1 {
+			j++
+		}
+		index = append(index, strconv.Itoa(nums[i]), strconv.Itoa(j-i))
+		i = j
+	}
+	return nums, index
+}
+
+func (u *update) xrefTable(trailer dict) {
+	start := u.buf.Len()
+	nums, index := u.numbers()
+	u.buf.WriteString("xref\n")
+	n := 0
+	for i := 0; i < len(index); i += 2 {
+		count, _ := strconv.Atoi(index[i+1])
+		fmt.Fprintf(&u.buf, "%s %d\n", index[i], count)
+		for _, num := range nums[n : n+count] {
+			fmt.Fprintf(&u.buf, "%010d %05d n \n", u.offsets[num], u.gens[num])
+		}
+		n += count
+	}
+	trailer = trailer.set("Size", strconv.Itoa(u.next))
+	fmt.Fprintf(&u.buf, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer, start)
+}
+
+func (u *update) xrefStream(trailer dict) {
+	self := ref{num: u.next}
+	u.next++
+	u.offsets[self.num] = u.buf.Len()
+	nums, index := u.numbers()
+
+	var data []byte
+	for _, num := range nums {
+		data = append(data, 1)
+		data = binary.BigEndian.AppendUint32(data, uint32(u.offsets[num]))
+		data = binary.BigEndian.AppendUint16(data, uint16(u.gens[num]))
+	}
+	trailer = trailer.set("Size", strconv.Itoa(u.next))
+	trailer = append(dict{{"Type", "/XRef"}, {"Index", "[" + strings.Join(index, " ") + "]"}, {"W", "[1 4 2]"}}, trailer...)
+	trailer = trailer.set("Length", strconv.Itoa(len(data)))
+
+	start := u.buf.Len()
+	u.write(self, trailer.String()+"\nstream\n"+string(data)+"\nendstream")
+	fmt.Fprintf(&u.buf, "startxref\n%d\n%%%%EOF\n", start)
+}
+
+// xmp returns the XMP packet of a document.
+func xmp(meta Metadata) string {
+	date := meta.Date.UTC().Format(time.RFC3339)
+	return `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+  <pdfaid:part>3</pdfaid:part>
+  <pdfaid:conformance>B</pdfaid:conformance>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + html.EscapeString(meta.Title) + `</rdf:li></rdf:Alt></dc:title>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+  <xmp:CreateDate>` + date + `</xmp:CreateDate>
+  <xmp:ModifyDate>` + date + `</xmp:ModifyDate>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+  <pdf:Producer>` + html.EscapeString(meta.Producer) + `</pdf:Producer>
+</rdf:Description>
+` + meta.Extension + `
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+}
+
+// pdfString encodes a text string, in UTF-16 when it is not ASCII.
+func pdfString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s) + ")"
+	}
+	b := []byte{0xfe, 0xff}
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.BigEndian.AppendUint16(b, c)
+	}
+	return "<" + hex.EncodeToString(b) + ">"
+}
+
+// pdfName encodes a name, escaping the characters names cannot hold.
+func pdfName(s string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '!' || c > '~' || c == '#' || isDelimiter(c) {
+			fmt.Fprintf(&b, "#%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// pdfDate formats a date as a PDF date string.
+func pdfDate(t time.Time) string {
+	return "(D:" + t.UTC().Format("20060102150405") + "Z)"
+}
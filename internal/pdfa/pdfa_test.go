@@ -0,0 +1,257 @@
+package pdfa
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// samplePDF returns a one-page PDF with a classic cross-reference table,
+// or a cross-reference stream.
+func samplePDF(xrefStream bool) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R /PageLayout /OneColumn >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Contents (a \\) string) >>",
+	}
+	var offsets []int
+	for i, object := range objects {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	start := b.Len()
+	if xrefStream {
+		var data []byte
+		for _, offset := range append(offsets, start) {
+			data = append(data, 1, byte(offset>>24), byte(offset>>16), byte(offset>>8), byte(offset), 0, 0)
+		}
+		fmt.Fprintf(&b, "4 0 obj\n<< /Type /XRef /Size 5 /Index [1 4] /W [1 4 2] /Root 1 0 R /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(data), data)
+	} else {
+		b.WriteString("xref\n0 4\n0000000000 65535 f \n")
+		for _, offset := range offsets {
+			fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+		}
+		b.WriteString("trailer\n<< /Size 4 /Root 1 0 R /ID [<0123abcd> <0123abcd>] >>\n")
+	}
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", start)
+	return b.Bytes()
+}
+
+func TestConvert(t *testing.T) {
+	for _, xrefStream := range []bool{false, true} {
+		doc := samplePDF(xrefStream)
+		xml := []byte("<rsm:CrossIndustryInvoice/>")
+		out, err := Convert(doc, Metadata{
+			Title:     "Facture FA-2025-00001",
+			Producer:  "go-invoices",
+			Date:      time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			Extension: `<rdf:Description rdf:about="" xmlns:fx="urn:fx#"><fx:Version>1.0</fx:Version></rdf:Description>`,
+		}, File{Name: "factur-x.xml", Description: "Factur-X invoice", MimeType: "text/xml", Relationship: "Data", Data: xml})
+		if err != nil {
+			t.Fatalf("Convert(xref stream %v) error = %v", xrefStream, err)
+		}
+		if !bytes.HasPrefix(out, doc) {
+			t.Fatalf("Convert() changed the original bytes")
+		}
+
+		// The update is a valid cross-reference section over the original
+		tr, err := readTrailer(out)
+		if err != nil {
+			t.Fatalf("readTrailer() error = %v", err)
+		}
+		if tr.stream != xrefStream || tr.offset <= len(doc) || tr.root != (ref{1, 0}) {
+			t.Errorf("trailer = %+v", tr)
+		}
+		if !xrefStream && tr.id != "0123abcd" {
+			t.Errorf("first file identifier = %q, want the original one", tr.id)
+		}
+		catalog, err := readDict(out, tr.root)
+		if err != nil {
+			t.Fatalf("readDict(catalog) error = %v", err)
+		}
+		for _, key := range []string{"Pages", "PageLayout", "Metadata", "OutputIntents", "Names", "AF"} {
+			if _, ok := catalog.get(key); !ok {
+				t.Errorf("catalog %s has no /%s", catalog, key)
+			}
+		}
+		if !xrefStream {
+			checkXrefTable(t, out, tr.offset)
+		}
+
+		metadata, _ := catalog.get("Metadata")
+		if packet := streamData(t, out, metadata); !strings.Contains(packet, "<pdfaid:part>3</pdfaid:part>") ||
+			!strings.Contains(packet, "<fx:Version>1.0</fx:Version>") || !strings.Contains(packet, "2025-03-01T00:00:00Z") {
+			t.Errorf("XMP packet = %s", packet)
+		}
+
+		af, _ := catalog.get("AF")
+		spec, err := readDict(out, mustRef(t, strings.Trim(af, "[]")))
+		if err != nil {
+			t.Fatalf("readDict(file spec) error = %v", err)
+		}
+		if relationship, _ := spec.get("AFRelationship"); relationship != "/Data" {
+			t.Errorf("file spec = %s", spec)
+		}
+		ef, _ := spec.get("EF")
+		stream := (&scanner{b: []byte(ef)})
+		files, _ := stream.dict()
+		f, _ := files.get("F")
+		file, _ := readDict(out, mustRef(t, f))
+		if subtype, _ := file.get("Subtype"); subtype != "/text#2Fxml" {
+			t.Errorf("embedded file = %s", file)
+		}
+		if data := streamData(t, out, f); data != string(xml) {
+			t.Errorf("embedded file data = %q", data)
+		}
+	}
+}
+
+func TestConvert_Unsupported(t *testing.T) {
+	withNames := bytes.Replace(samplePDF(false), []byte("/PageLayout"), []byte("/Names"), 1)
+	for name, doc := range map[string][]byte{
+		"no startxref": []byte("%PDF-1.7\n1 0 obj\n<< >>\nendobj\n"),
+		"name tree":    withNames,
+	} {
+		if _, err := Convert(doc, Metadata{}); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Convert(%s) error = %v, want ErrUnsupported", name, err)
+		}
+	}
+}
+
+func TestSRGBProfile(t *testing.T) {
+	profile := srgbProfile()
+	size := int(profile[0])<<24 | int(profile[1])<<16 | int(profile[2])<<8 | int(profile[3])
+	if size != len(profile) || string(profile[36:40]) != "acsp" || string(profile[16:20]) != "RGB " {
+		t.Errorf("profile header = % x", profile[:40])
+	}
+}
+
+// checkXrefTable checks that every entry of the table at offset points
+// to its object.
+func checkXrefTable(t *testing.T, doc []byte, offset int) {
+	t.Helper()
+	lines := strings.Split(string(doc[offset:]), "\n")
+	for i := 1; i < len(lines) && lines[i] != "trailer"; {
+		fields := strings.Fields(lines[i])
+		first, _ := strconv.Atoi(fields[0])
+		count, _ := strconv.Atoi(fields[1])
+		for n := 0; n < count; n++ {
+			entry := lines[i+1+n]
+			at, _ := strconv.Atoi(entry[:10])
+			if want := fmt.Sprintf("%d 0 obj", first+n); !bytes.HasPrefix(doc[at:], []byte(want)) {
+				t.Errorf("xref entry %q does not point to %q", entry, want)
+			}
+		}
+		i += 1 + count
+	}
+}
+
+func mustRef(t *testing.T, raw string) ref {
+	t.Helper()
+	r, ok := parseRef(raw)
+	if !ok {
+		t.Fatalf("%q is not a reference", raw)
+	}
+	return r
+}
+
+// streamData returns the decoded data of a stream object.
+func streamData(t *testing.T, doc []byte, raw string) string {
+	t.Helper()
+	d, err := readDict(doc, mustRef(t, raw))
+	if err != nil {
+		t.Fatalf("readDict(%s) error = %v", raw, err)
+	}
+	length, _ := d.get("Length")
+	n, _ := strconv.Atoi(length)
+	i := bytes.Index(doc, []byte(d.String()+"\nstream\n"))
+	data := doc[i+len(d.String())+len("\nstream\n"):][:n]
+	if _, ok := d.get("Filter"); !ok {
+		return string(data)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("zlib: %v", err)
+	}
+	out, _ := io.ReadAll(r)
+	return string(out)
+}
+
+func TestAppendPages(t *testing.T) {
+	long := strings.Repeat("Pénalités de retard exigibles ", 20)
+	for _, xrefStream := range []bool{false, true} {
+		doc := samplePDF(xrefStream)
+		out, err := AppendPages(doc, "AVOIR n° AV-2025-00001", Block{Title: "TVA", Lines: []string{"TVA 20 % (1/2)", long}}, Block{Title: "Vide"})
+		if err != nil {
+			t.Fatalf("AppendPages(xref stream %v) error = %v", xrefStream, err)
+		}
+		if !bytes.HasPrefix(out, doc) {
+			t.Fatalf("AppendPages() changed the original bytes")
+		}
+		tr, err := readTrailer(out)
+		if err != nil {
+			t.Fatalf("readTrailer() error = %v", err)
+		}
+		if !xrefStream {
+			checkXrefTable(t, out, tr.offset)
+		}
+
+		pages, err := readDict(out, ref{2, 0})
+		if err != nil {
+			t.Fatalf("readDict(pages) error = %v", err)
+		}
+		kids, _ := pages.get("Kids")
+		refs := strings.Fields(strings.Trim(kids, "[]"))
+		if count, _ := pages.get("Count"); count != "2" || len(refs) != 6 || refs[0] != "3" {
+			t.Fatalf("pages = %s", pages)
+		}
+		page, err := readDict(out, mustRef(t, strings.Join(refs[3:], " ")))
+		if err != nil {
+			t.Fatalf("readDict(page) error = %v", err)
+		}
+		if box, _ := page.get("MediaBox"); box != "[0 0 595 842]" {
+			t.Errorf("MediaBox = %s, want the first page's", box)
+		}
+		contents, _ := page.get("Contents")
+		content := streamData(t, out, contents)
+		for _, want := range []string{`(AVOIR n\260 AV-2025-00001)`, "(TVA)", `(TVA 20 % \(1/2\))`} {
+			if !strings.Contains(content, want) {
+				t.Errorf("content has no %s:\n%s", want, content)
+			}
+		}
+		if strings.Contains(content, "(Vide)") {
+			t.Errorf("content has the title of an empty block:\n%s", content)
+		}
+		// The long line is wrapped to the page width
+		if n := strings.Count(content, "Tj"); n < 5 {
+			t.Errorf("content has %d lines, want the long one wrapped:\n%s", n, content)
+		}
+
+		if _, err := Convert(out, Metadata{Title: "Avoir"}); err != nil {
+			t.Errorf("Convert() after AppendPages() error = %v", err)
+		}
+	}
+}
+
+func TestAppendPages_RunsOn(t *testing.T) {
+	lines := make([]string, 200)
+	for i := range lines {
+		lines[i] = "Ligne " + strconv.Itoa(i)
+	}
+	out, err := AppendPages(samplePDF(false), "Mentions", Block{Lines: lines})
+	if err != nil {
+		t.Fatalf("AppendPages() error = %v", err)
+	}
+	pages, _ := readDict(out, ref{2, 0})
+	if count, _ := pages.get("Count"); count != "5" {
+		t.Errorf("Count = %s, want 5: 4 appended pages of text", count)
+	}
+}
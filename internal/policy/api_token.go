@@ -0,0 +1,53 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/diewo77/go-invoices/httpx"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/policy/principal"
+)
+
+// TokenAuthenticator authenticates API tokens. It returns
+// principal.ErrInvalidAPIToken for tokens that do not authenticate.
+type TokenAuthenticator interface {
+	Authenticate(plaintext string) (*models.APIToken, error)
+}
+
+// tokenAllows returns false when the request is authenticated by a token
+// that is not scoped to the permission. Session requests are not restricted.
+func tokenAllows(ctx context.Context, resourceType, action string) bool {
+	token, ok := principal.APITokenFromContext(ctx)
+	return !ok || token.Allows(resourceType, action)
+}
+
+// RequireAPIToken returns middleware authenticating requests by their
+// "Authorization: Bearer <token>" header. Failures get a JSON 401.
+func (ag *AuthGate) RequireAPIToken(tokens TokenAuthenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, plaintext, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				httpx.JSONError(w, http.StatusUnauthorized, "unauthorized", nil)
+				return
+			}
+
+			token, err := tokens.Authenticate(strings.TrimSpace(plaintext))
+			if errors.Is(err, principal.ErrInvalidAPIToken) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+				httpx.JSONError(w, http.StatusUnauthorized, "invalid_token", nil)
+				return
+			}
+			if err != nil {
+				httpx.JSONError(w, http.StatusInternalServerError, "db_error", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(principal.WithAPIToken(r.Context(), token)))
+		})
+	}
+}
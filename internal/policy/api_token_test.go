@@ -0,0 +1,133 @@
+package policy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-gate"
+	"github.com/diewo77/go-invoices/internal/db"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/policy"
+	"github.com/diewo77/go-invoices/internal/policy/principal"
+	"github.com/diewo77/go-invoices/internal/services"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupTokenTest returns a gate and a token service over a database with
+// an accountant user (invoice:*, client:*).
+func setupTokenTest(t *testing.T) (*gorm.DB, *policy.AuthGate, *services.APITokenService) {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := conn.AutoMigrate(&models.Profile{}, &models.Permission{}, &models.User{}, &models.APIToken{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	if err := db.SeedProfiles(conn); err != nil {
+		t.Fatalf("failed to seed profiles: %v", err)
+	}
+	var accountant models.Profile
+	conn.Where("name = ?", "accountant").First(&accountant)
+	conn.Create(&models.User{Email: "a@b.test", Password: "x", ProfileID: &accountant.ID})
+
+	return conn, policy.NewAuthGate(conn, time.Minute), services.NewAPITokenService(conn)
+}
+
+func TestRequireAPIToken(t *testing.T) {
+	conn, ag, tokens := setupTokenTest(t)
+	token, plaintext, err := tokens.Create(1, "CI", []string{"invoice:list"})
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+
+	var gotUser uint
+	handler := ag.RequireAPIToken(tokens)(
+		ag.RequirePermission("invoice", gate.ActionList)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotUser, _ = principal.UserIDFromContext(r.Context())
+		})))
+
+	serve := func(authorization string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/invoices", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := serve(""); code != http.StatusUnauthorized {
+		t.Errorf("no token: expected 401, got %d", code)
+	}
+	if code := serve("Bearer gi_nope"); code != http.StatusUnauthorized {
+		t.Errorf("unknown token: expected 401, got %d", code)
+	}
+	if code := serve("Bearer " + plaintext); code != http.StatusOK || gotUser != 1 {
+		t.Errorf("valid token: got %d, user %d", code, gotUser)
+	}
+
+	var stored models.APIToken
+	conn.First(&stored, token.ID)
+	if stored.LastUsedAt == nil || stored.Hash == plaintext {
+		t.Errorf("stored token = %+v", stored)
+	}
+
+	// The token of a deleted user no longer authenticates
+	conn.Delete(&models.User{}, 1)
+	if code := serve("Bearer " + plaintext); code != http.StatusUnauthorized {
+		t.Errorf("token of a deleted user: expected 401, got %d", code)
+	}
+	conn.Unscoped().Model(&models.User{}).Where("id = 1").Update("deleted_at", nil)
+
+	if err := tokens.Revoke(1, token.ID); err != nil {
+		t.Fatalf("Revoke() error: %v", err)
+	}
+	if code := serve("Bearer " + plaintext); code != http.StatusUnauthorized {
+		t.Errorf("revoked token: expected 401, got %d", code)
+	}
+}
+
+func TestRequirePermission_TokenScopes(t *testing.T) {
+	_, ag, tokens := setupTokenTest(t)
+	_, plaintext, err := tokens.Create(1, "read-only", []string{"invoice:list", "client:*", "product:*"})
+	if err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+
+	tests := []struct {
+		resource string
+		action   gate.Action
+		want     int
+	}{
+		{"invoice", gate.ActionList, http.StatusOK},
+		{"invoice", gate.ActionCreate, http.StatusForbidden},
+		{"client", gate.ActionDelete, http.StatusOK},
+		// in the token scopes, but not granted by the accountant profile
+		{"product", gate.ActionCreate, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		handler := ag.RequireAPIToken(tokens)(
+			ag.RequirePermission(tt.resource, tt.action)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/x", nil)
+		req.Header.Set("Authorization", "Bearer "+plaintext)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s:%s: expected %d, got %d", tt.resource, tt.action, tt.want, rr.Code)
+		}
+	}
+}
+
+func TestAPITokenService_CreateRejectsUnknownScope(t *testing.T) {
+	_, _, tokens := setupTokenTest(t)
+	if _, _, err := tokens.Create(1, "bad", []string{"invoice:steal"}); err != services.ErrInvalidTokenScope {
+		t.Errorf("Create() error = %v, want ErrInvalidTokenScope", err)
+	}
+	if _, _, err := tokens.Create(1, " ", []string{"invoice:list"}); err != services.ErrAPITokenName {
+		t.Errorf("Create() error = %v, want ErrAPITokenName", err)
+	}
+}
@@ -5,8 +5,9 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/diewo77/go-invoices/auth"
 	"github.com/diewo77/go-gate"
+	"github.com/diewo77/go-invoices/httpx"
+	"github.com/diewo77/go-invoices/internal/policy/principal"
 	"gorm.io/gorm"
 )
 
@@ -45,8 +46,8 @@ func (ag *AuthGate) RegisterPolicy(resourceType string, p gate.Policy[uint]) {
 // Authorize checks if the current user can perform an action on a resource.
 // Returns nil if authorized, gate.ErrUnauthorized otherwise.
 func (ag *AuthGate) Authorize(ctx context.Context, action gate.Action, resourceType string, resource any) error {
-	userID, ok := auth.UserIDFromContext(ctx)
-	if !ok {
+	userID, ok := principal.UserIDFromContext(ctx)
+	if !ok || !tokenAllows(ctx, resourceType, string(action)) {
 		return gate.ErrUnauthorized
 	}
 	return ag.Gate.Authorize(ctx, userID, action, resourceType, resource)
@@ -57,11 +58,12 @@ func (ag *AuthGate) Can(ctx context.Context, action gate.Action, resourceType st
 	return ag.Authorize(ctx, action, resourceType, resource) == nil
 }
 
-// CanProfile checks only profile permissions (no ownership check).
+// CanProfile checks only profile permissions (no ownership check), and the
+// scopes of the API token when the request carries one.
 // Useful for UI to show/hide buttons before a specific resource is loaded.
 func (ag *AuthGate) CanProfile(ctx context.Context, action gate.Action, resourceType string) bool {
-	userID, ok := auth.UserIDFromContext(ctx)
-	if !ok {
+	userID, ok := principal.UserIDFromContext(ctx)
+	if !ok || !tokenAllows(ctx, resourceType, string(action)) {
 		return false
 	}
 	return ag.Gate.CanProfile(ctx, userID, action, resourceType)
@@ -80,11 +82,18 @@ func (ag *AuthGate) InvalidateAll() {
 }
 
 // RequirePermission returns middleware that checks profile permission.
-// Blocks access if user doesn't have the required permission.
+// Blocks access if user doesn't have the required permission, with a JSON
+// error for API token requests.
 func (ag *AuthGate) RequirePermission(resourceType string, action gate.Action) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if !ag.CanProfile(r.Context(), action, resourceType) {
+				if _, ok := principal.APITokenFromContext(r.Context()); ok {
+					httpx.JSONError(w, http.StatusForbidden, "forbidden", map[string]string{
+						"permission": resourceType + ":" + string(action),
+					})
+					return
+				}
 				http.Error(w, "Forbidden", http.StatusForbidden)
 				return
 			}
@@ -98,7 +107,7 @@ func (ag *AuthGate) RequirePermission(resourceType string, action gate.Action) f
 func (ag *AuthGate) RequireAdmin() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID, ok := auth.UserIDFromContext(r.Context())
+			userID, ok := principal.UserIDFromContext(r.Context())
 			if !ok {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
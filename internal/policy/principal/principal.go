@@ -0,0 +1,38 @@
+// Package principal tells who a request acts for: the user of its session,
+// or the owner of the API token it carries. It depends on nothing but the
+// models, so handlers, services and the authorization gate can all use it.
+package principal
+
+import (
+	"context"
+	"errors"
+
+	"github.com/diewo77/go-invoices/auth"
+	"github.com/diewo77/go-invoices/internal/models"
+)
+
+// ErrInvalidAPIToken is returned for unknown and revoked tokens, and for
+// tokens whose owner was deleted.
+var ErrInvalidAPIToken = errors.New("invalid or revoked API token")
+
+type apiTokenKey struct{}
+
+// WithAPIToken marks a request context as authenticated by an API token.
+func WithAPIToken(ctx context.Context, token *models.APIToken) context.Context {
+	return context.WithValue(ctx, apiTokenKey{}, token)
+}
+
+// APITokenFromContext returns the API token authenticating a request, if any.
+func APITokenFromContext(ctx context.Context) (*models.APIToken, bool) {
+	token, ok := ctx.Value(apiTokenKey{}).(*models.APIToken)
+	return token, ok
+}
+
+// UserIDFromContext returns the user a request acts for: the owner of its
+// API token, or else the user of its session.
+func UserIDFromContext(ctx context.Context) (uint, bool) {
+	if token, ok := APITokenFromContext(ctx); ok {
+		return token.UserID, true
+	}
+	return auth.UserIDFromContext(ctx)
+}
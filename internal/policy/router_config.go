@@ -4,7 +4,9 @@ import (
 	"time"
 
 	"github.com/diewo77/go-invoices/internal/handlers"
+	"github.com/diewo77/go-invoices/internal/mail"
 	"github.com/diewo77/go-invoices/internal/services"
+	"github.com/diewo77/go-invoices/internal/storage"
 	"gorm.io/gorm"
 )
 
@@ -22,21 +24,59 @@ type RouterConfig struct {
 	AuthHandler *handlers.AuthHandler
 
 	// Business handlers
-	ClientHandler  *handlers.ClientHandler
-	ProductHandler *handlers.ProductHandler
-	InvoiceHandler *handlers.InvoiceHandler
-	CompanyHandler *handlers.CompanyHandler
+	ClientHandler           *handlers.ClientHandler
+	ProductHandler          *handlers.ProductHandler
+	InvoiceHandler          *handlers.InvoiceHandler
+	CompanyHandler          *handlers.CompanyHandler
+	NumberingHandler        *handlers.NumberingHandler
+	PaymentHandler          *handlers.PaymentHandler
+	EInvoiceHandler         *handlers.EInvoiceHandler
+	APITokenHandler         *handlers.APITokenHandler
+	WebhookHandler          *handlers.WebhookHandler
+	RecurringInvoiceHandler *handlers.RecurringInvoiceHandler
+	QuoteHandler            *handlers.QuoteHandler
+	ExchangeRateHandler     *handlers.ExchangeRateHandler
+	ReportHandler           *handlers.ReportHandler
+	ClientImportHandler     *handlers.ImportHandler
+	ProductImportHandler    *handlers.ImportHandler
+	AuditHandler            *handlers.AuditHandler
+	SealHandler             *handlers.SealHandler
+	ArchiveHandler          *handlers.ArchiveHandler
+
+	// JSON API handlers
+	APIClientHandler  *handlers.APIClientHandler
+	APIProductHandler *handlers.APIProductHandler
+	APIInvoiceHandler *handlers.APIInvoiceHandler
 
 	// Services
-	InvoiceService *services.InvoiceService
+	InvoiceService          *services.InvoiceService
+	NumberingService        *services.NumberingService
+	CreditNoteService       *services.CreditNoteService
+	PDFService              *services.PDFService
+	PaymentService          *services.PaymentService
+	EInvoiceService         *services.EInvoiceService
+	APITokenService         *services.APITokenService
+	WebhookService          *services.WebhookService
+	RecurringInvoiceService *services.RecurringInvoiceService
+	QuoteService            *services.QuoteService
+	ReminderService         *services.ReminderService
+	InvoiceEmailService     *services.InvoiceEmailService
+	ReportService           *services.ReportService
+	FECService              *services.FECService
+	ImportService           *services.ImportService
+	AuditService            *services.AuditService
+	SealService             *services.SealService
+	ArchiveService          *services.ArchiveService
 }
 
 // NewRouterConfig creates a fully configured router setup.
 // This wires together the authorization gate, policies, and admin handlers.
+// Emails are sent through mailer, from the mailFrom address, and the PDF
+// of finalized invoices are archived in store.
 //
 // Example usage in your main.go or router setup:
 //
-//	cfg := policy.NewRouterConfig(db)
+//	cfg := policy.NewRouterConfig(db, mail.NewFileMailer("tmp/mail"), "no-reply@example.com", storage.NewFileStore("data/archive"))
 //
 //	// Protected routes with ownership check
 //	mux.Handle("GET /products", cfg.AuthGate.RequirePermission("product", gate.ActionList)(productHandler.List))
@@ -45,7 +85,7 @@ type RouterConfig struct {
 //	// Admin-only routes
 //	mux.Handle("GET /admin/profiles", cfg.AuthGate.RequireAdmin()(http.HandlerFunc(cfg.AdminProfileHandler.List)))
 //	mux.Handle("POST /admin/profiles/create", cfg.AuthGate.RequireAdmin()(http.HandlerFunc(cfg.AdminProfileHandler.Create)))
-func NewRouterConfig(db *gorm.DB) *RouterConfig {
+func NewRouterConfig(db *gorm.DB, mailer mail.Mailer, mailFrom string, store storage.Store) *RouterConfig {
 	// Create authorization gate with 5-minute cache
 	authGate := NewAuthGate(db, 5*time.Minute)
 
@@ -54,6 +94,7 @@ func NewRouterConfig(db *gorm.DB) *RouterConfig {
 	ownershipPolicy := NewOwnershipPolicy()
 	authGate.RegisterPolicy("product", ownershipPolicy)
 	authGate.RegisterPolicy("invoice", ownershipPolicy)
+	authGate.RegisterPolicy("quote", ownershipPolicy)
 	authGate.RegisterPolicy("client", ownershipPolicy)
 	authGate.RegisterPolicy("company_settings", ownershipPolicy)
 
@@ -64,14 +105,51 @@ func NewRouterConfig(db *gorm.DB) *RouterConfig {
 	// Create auth handler
 	authHandler := handlers.NewAuthHandler(db)
 
+	// Create services
+	numberingService := services.NewNumberingService(db)
+	rateProvider := services.NewManualRateProvider(db)
+	invoiceService := services.NewInvoiceService(db, numberingService, rateProvider)
+	creditNoteService := services.NewCreditNoteService(db, numberingService)
+	pdfService := services.NewPDFService(db)
+	archiveService := services.NewArchiveService(db, pdfService, store)
+	paymentService := services.NewPaymentService(db)
+	einvoiceService := services.NewEInvoiceService(db)
+	apiTokenService := services.NewAPITokenService(db)
+	webhookService := services.NewWebhookService(db)
+	recurringInvoiceService := services.NewRecurringInvoiceService(db, invoiceService, webhookService, archiveService)
+	quoteService := services.NewQuoteService(db, numberingService)
+	reminderService := services.NewReminderService(db, archiveService, mailer, mailFrom)
+	invoiceEmailService := services.NewInvoiceEmailService(db, archiveService, mailer, mailFrom)
+	reportService := services.NewReportService(db)
+	fecService := services.NewFECService(db)
+	importService := services.NewImportService(db)
+	auditService := services.NewAuditService(db)
+	sealService := services.NewSealService(db)
+
 	// Create business handlers
-	clientHandler := handlers.NewClientHandler(db)
+	clientHandler := handlers.NewClientHandler(db, invoiceService)
 	productHandler := handlers.NewProductHandler(db)
-	invoiceHandler := handlers.NewInvoiceHandler(db)
+	invoiceHandler := handlers.NewInvoiceHandler(db, invoiceService, creditNoteService, pdfService, archiveService, webhookService, invoiceEmailService)
 	companyHandler := handlers.NewCompanyHandler(db)
+	numberingHandler := handlers.NewNumberingHandler(numberingService)
+	paymentHandler := handlers.NewPaymentHandler(db, paymentService, webhookService)
+	einvoiceHandler := handlers.NewEInvoiceHandler(db, einvoiceService, webhookService)
+	apiTokenHandler := handlers.NewAPITokenHandler(db, apiTokenService)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	recurringInvoiceHandler := handlers.NewRecurringInvoiceHandler(db, recurringInvoiceService)
+	quoteHandler := handlers.NewQuoteHandler(db, quoteService, invoiceService, pdfService, webhookService)
+	exchangeRateHandler := handlers.NewExchangeRateHandler(rateProvider, invoiceService)
+	reportHandler := handlers.NewReportHandler(db, reportService, fecService, invoiceService)
+	clientImportHandler := handlers.NewImportHandler(importService, services.ImportClients)
+	productImportHandler := handlers.NewImportHandler(importService, services.ImportProducts)
+	auditHandler := handlers.NewAuditHandler(db, auditService)
+	sealHandler := handlers.NewSealHandler(sealService)
+	archiveHandler := handlers.NewArchiveHandler(archiveService)
 
-	// Create services
-	invoiceService := services.NewInvoiceService(db)
+	// Create JSON API handlers, checking ownership through the gate
+	apiClientHandler := handlers.NewAPIClientHandler(db, authGate)
+	apiProductHandler := handlers.NewAPIProductHandler(db, authGate)
+	apiInvoiceHandler := handlers.NewAPIInvoiceHandler(db, authGate, invoiceService, archiveService, webhookService)
 
 	return &RouterConfig{
 		AuthGate:                authGate,
@@ -82,7 +160,41 @@ func NewRouterConfig(db *gorm.DB) *RouterConfig {
 		ProductHandler:          productHandler,
 		InvoiceHandler:          invoiceHandler,
 		CompanyHandler:          companyHandler,
+		NumberingHandler:        numberingHandler,
+		PaymentHandler:          paymentHandler,
+		EInvoiceHandler:         einvoiceHandler,
+		APITokenHandler:         apiTokenHandler,
+		WebhookHandler:          webhookHandler,
+		RecurringInvoiceHandler: recurringInvoiceHandler,
+		QuoteHandler:            quoteHandler,
+		ExchangeRateHandler:     exchangeRateHandler,
+		ReportHandler:           reportHandler,
+		ClientImportHandler:     clientImportHandler,
+		ProductImportHandler:    productImportHandler,
+		AuditHandler:            auditHandler,
+		SealHandler:             sealHandler,
+		ArchiveHandler:          archiveHandler,
+		APIClientHandler:        apiClientHandler,
+		APIProductHandler:       apiProductHandler,
+		APIInvoiceHandler:       apiInvoiceHandler,
 		InvoiceService:          invoiceService,
+		NumberingService:        numberingService,
+		CreditNoteService:       creditNoteService,
+		PDFService:              pdfService,
+		PaymentService:          paymentService,
+		EInvoiceService:         einvoiceService,
+		APITokenService:         apiTokenService,
+		WebhookService:          webhookService,
+		RecurringInvoiceService: recurringInvoiceService,
+		QuoteService:            quoteService,
+		ReminderService:         reminderService,
+		InvoiceEmailService:     invoiceEmailService,
+		ReportService:           reportService,
+		FECService:              fecService,
+		ImportService:           importService,
+		AuditService:            auditService,
+		SealService:             sealService,
+		ArchiveService:          archiveService,
 	}
 }
 
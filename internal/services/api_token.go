@@ -0,0 +1,125 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/policy/principal"
+	"gorm.io/gorm"
+)
+
+// APITokenPrefix starts every API token, so leaked tokens are easy to spot.
+const APITokenPrefix = "gi_"
+
+// API token errors.
+var (
+	ErrInvalidAPIToken   = principal.ErrInvalidAPIToken
+	ErrAPITokenName      = errors.New("API token name is required")
+	ErrInvalidTokenScope = errors.New("unknown API token scope")
+)
+
+// APITokenService issues, authenticates and revokes API tokens.
+type APITokenService struct {
+	db *gorm.DB
+}
+
+func NewAPITokenService(db *gorm.DB) *APITokenService {
+	return &APITokenService{db: db}
+}
+
+// Create issues a token for a user. Scopes must be seeded permission codes.
+// The returned plaintext token is not stored and cannot be retrieved later.
+func (s *APITokenService) Create(userID uint, name string, scopes []string) (*models.APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrAPITokenName
+	}
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidTokenScope
+	}
+	for _, scope := range scopes {
+		resource, action, ok := strings.Cut(scope, ":")
+		if !ok {
+			return nil, "", ErrInvalidTokenScope
+		}
+		var count int64
+		s.db.Model(&models.Permission{}).Where("resource_type = ? AND action = ?", resource, action).Count(&count)
+		if count == 0 {
+			return nil, "", ErrInvalidTokenScope
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	plaintext := APITokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	token := models.APIToken{
+		UserID: userID,
+		Name:   name,
+		Prefix: plaintext[:len(APITokenPrefix)+6],
+		Hash:   hashAPIToken(plaintext),
+		Scopes: strings.Join(scopes, " "),
+	}
+	if err := s.db.Create(&token).Error; err != nil {
+		return nil, "", err
+	}
+	return &token, plaintext, nil
+}
+
+// Authenticate returns the active token matching a plaintext token and
+// records its use. Tokens of deleted users no longer authenticate, as
+// their sessions do not.
+func (s *APITokenService) Authenticate(plaintext string) (*models.APIToken, error) {
+	if !strings.HasPrefix(plaintext, APITokenPrefix) {
+		return nil, ErrInvalidAPIToken
+	}
+	var token models.APIToken
+	err := s.db.Joins("JOIN users ON users.id = api_tokens.user_id AND users.deleted_at IS NULL").
+		Where("api_tokens.hash = ? AND api_tokens.revoked_at IS NULL", hashAPIToken(plaintext)).
+		First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s.db.Model(&token).UpdateColumn("last_used_at", now)
+	token.LastUsedAt = &now
+	return &token, nil
+}
+
+// List returns the tokens of a user, newest first, revoked ones included.
+func (s *APITokenService) List(userID uint) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// Revoke disables a token of a user for good.
+func (s *APITokenService) Revoke(userID, tokenID uint) error {
+	result := s.db.Model(&models.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func hashAPIToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
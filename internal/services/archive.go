@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/storage"
+	"gorm.io/gorm"
+)
+
+// ErrArchiveCorrupted is returned when an archived document no longer
+// matches its checksum.
+var ErrArchiveCorrupted = errors.New("archived document does not match its checksum")
+
+// ArchiveService stores the PDF of invoices when they are finalized and
+// serves the stored copy afterwards, so that what the client received can
+// be reproduced for the whole retention period.
+type ArchiveService struct {
+	db    *gorm.DB
+	pdf   *PDFService
+	store storage.Store
+}
+
+func NewArchiveService(db *gorm.DB, pdf *PDFService, store storage.Store) *ArchiveService {
+	return &ArchiveService{db: db, pdf: pdf, store: store}
+}
+
+// Archive renders and stores the PDF of a finalized invoice of userID. An
+// invoice is archived once: archiving it again returns its document.
+func (s *ArchiveService) Archive(ctx context.Context, userID, invoiceID uint) (*models.ArchivedDocument, error) {
+	var invoice models.Invoice
+	if err := s.db.Where("id = ? AND user_id = ?", invoiceID, userID).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("OriginalInvoice").
+		Preload("PenalizedInvoice").
+		First(&invoice).Error; err != nil {
+		return nil, err
+	}
+	_, doc, err := s.document(ctx, &invoice)
+	return doc, err
+}
+
+// ArchiveFinalized archives a just finalized invoice. A failure is logged
+// rather than returned: the finalization stands, and the invoice is
+// archived when its PDF is first requested.
+func (s *ArchiveService) ArchiveFinalized(ctx context.Context, userID, invoiceID uint) {
+	if _, err := s.Archive(ctx, userID, invoiceID); err != nil {
+		log.Printf("archive: invoice %d: %v", invoiceID, err)
+	}
+}
+
+// PDF returns the PDF of an invoice. Finalized invoices get their archived
+// copy, archived now if it was not at finalization; drafts are rendered.
+// The invoice must be loaded as for PDFService.Render.
+func (s *ArchiveService) PDF(ctx context.Context, invoice *models.Invoice) ([]byte, error) {
+	if invoice.IsDraft() {
+		return s.pdf.Render(invoice)
+	}
+	data, _, err := s.document(ctx, invoice)
+	return data, err
+}
+
+// document returns the archived PDF of a finalized invoice and its record,
+// archiving it first if needed.
+func (s *ArchiveService) document(ctx context.Context, invoice *models.Invoice) ([]byte, *models.ArchivedDocument, error) {
+	if invoice.IsDraft() {
+		return nil, nil, ErrInvoiceNotFinal
+	}
+	var doc models.ArchivedDocument
+	err := s.db.Where("invoice_id = ?", invoice.ID).First(&doc).Error
+	if err == nil {
+		data, err := s.open(ctx, &doc)
+		return data, &doc, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	data, err := s.pdf.Render(invoice)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := archiveKey(invoice)
+	err = s.store.Put(ctx, key, data)
+	if errors.Is(err, storage.ErrExists) {
+		// Stored by a concurrent request, or by an attempt whose record
+		// was not saved: the stored copy stands
+		data, err = s.store.Get(ctx, key)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	doc = models.ArchivedDocument{
+		UserID:      invoice.UserID,
+		InvoiceID:   invoice.ID,
+		Key:         key,
+		ContentType: "application/pdf",
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		RetainUntil: models.RetentionEnd(invoice.IssueDate),
+	}
+	if err := s.db.Where("invoice_id = ?", invoice.ID).Attrs(doc).FirstOrCreate(&doc).Error; err != nil {
+		return nil, nil, err
+	}
+	return data, &doc, nil
+}
+
+// open reads an archived document and checks its checksum.
+func (s *ArchiveService) open(ctx context.Context, doc *models.ArchivedDocument) ([]byte, error) {
+	data, err := s.store.Get(ctx, doc.Key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != doc.SHA256 {
+		return nil, ErrArchiveCorrupted
+	}
+	return data, nil
+}
+
+// archiveKey returns the storage key of the PDF of an invoice:
+// invoices/{user}/{year}/{id}-{number}.pdf.
+func archiveKey(invoice *models.Invoice) string {
+	number := strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' || 'a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, invoice.Number)
+	return fmt.Sprintf("invoices/%d/%d/%d-%s.pdf", invoice.UserID, invoice.IssueDate.Year(), invoice.ID, number)
+}
+
+// RetentionYear sums up the archived documents issued in a year.
+type RetentionYear struct {
+	Year        int
+	Documents   int
+	Size        int64
+	RetainUntil time.Time
+	// Expired is true once the retention period of the year is over.
+	Expired bool
+}
+
+// SizeText returns the size of the year's documents, e.g. "1.2 MB".
+func (y RetentionYear) SizeText() string {
+	return sizeText(y.Size)
+}
+
+// RetentionIssue is an invoice whose archive is missing or damaged.
+type RetentionIssue struct {
+	InvoiceID uint
+	Number    string
+	Reason    string
+}
+
+// RetentionReport is the state of the archive of a user's invoices.
+type RetentionReport struct {
+	UserID    uint
+	Documents int
+	Size      int64
+	Years     []RetentionYear
+	// Missing lists the finalized invoices without archived document.
+	Missing []RetentionIssue
+	// Corrupted lists the documents that could not be read back or no
+	// longer match their checksum, when Checked.
+	Corrupted []RetentionIssue
+	Checked   bool
+}
+
+// SizeText returns the size of all documents, e.g. "1.2 MB".
+func (r *RetentionReport) SizeText() string {
+	return sizeText(r.Size)
+}
+
+// Valid returns true if every finalized invoice is archived, and no
+// document is corrupted.
+func (r *RetentionReport) Valid() bool {
+	return len(r.Missing) == 0 && len(r.Corrupted) == 0
+}
+
+// Retention reports on the archived documents of a user by year of issue,
+// with the finalized invoices left unarchived. When check is set, every
+// document is read back from the storage and its checksum verified.
+func (s *ArchiveService) Retention(ctx context.Context, userID uint, now time.Time, check bool) (*RetentionReport, error) {
+	report := &RetentionReport{UserID: userID, Checked: check}
+
+	var docs []models.ArchivedDocument
+	if err := s.db.Where("user_id = ?", userID).Order("retain_until, invoice_id").
+		Preload("Invoice", func(db *gorm.DB) *gorm.DB { return db.Unscoped().Select("id", "number") }).
+		Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		report.Documents++
+		report.Size += doc.Size
+		year := doc.RetainUntil.Year() - models.RetentionYears
+		if n := len(report.Years); n == 0 || report.Years[n-1].Year != year {
+			report.Years = append(report.Years, RetentionYear{Year: year, RetainUntil: doc.RetainUntil, Expired: doc.Expired(now)})
+		}
+		y := &report.Years[len(report.Years)-1]
+		y.Documents++
+		y.Size += doc.Size
+
+		if !check {
+			continue
+		}
+		if _, err := s.open(ctx, &doc); err != nil {
+			issue := RetentionIssue{InvoiceID: doc.InvoiceID, Reason: err.Error()}
+			if doc.Invoice != nil {
+				issue.Number = doc.Invoice.Number
+			}
+			report.Corrupted = append(report.Corrupted, issue)
+		}
+	}
+
+	var missing []models.Invoice
+	if err := s.db.Select("id", "number").
+		Where("user_id = ? AND status <> ?", userID, models.InvoiceStatusDraft).
+		Where("id NOT IN (?)", s.db.Model(&models.ArchivedDocument{}).Select("invoice_id")).
+		Order("issue_date, id").Find(&missing).Error; err != nil {
+		return nil, err
+	}
+	for _, inv := range missing {
+		report.Missing = append(report.Missing, RetentionIssue{InvoiceID: inv.ID, Number: inv.Number, Reason: "not archived"})
+	}
+	return report, nil
+}
+
+// sizeText formats a size in bytes with a decimal unit.
+func sizeText(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, prefix := float64(size)/unit, 0
+	for value >= unit && prefix < 3 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "kMGT"[prefix])
+}
+
+// ArchiveMissing archives the finalized invoices of a user that have no
+// archived document, such as those finalized before archiving, and
+// returns how many were archived.
+func (s *ArchiveService) ArchiveMissing(ctx context.Context, userID uint) (int, error) {
+	var ids []uint
+	if err := s.db.Model(&models.Invoice{}).
+		Where("user_id = ? AND status <> ?", userID, models.InvoiceStatusDraft).
+		Where("id NOT IN (?)", s.db.Model(&models.ArchivedDocument{}).Select("invoice_id")).
+		Order("id").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for n, id := range ids {
+		if _, err := s.Archive(ctx, userID, id); err != nil {
+			return n, err
+		}
+	}
+	return len(ids), nil
+}
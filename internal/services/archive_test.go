@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/storage"
+	"github.com/diewo77/go-invoices/internal/storage/storagetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupArchiveTest returns an archive service storing in a fake S3
+// server, over a database holding two final invoices of user 1 issued in
+// 2025 and a draft.
+func setupArchiveTest(t *testing.T) (*gorm.DB, *ArchiveService, *storagetest.Server, []*models.Invoice) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.ArchivedDocument{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	db.Create(&models.CompanySettings{UserID: 1, Name: "Acme SARL"})
+	client := models.Client{UserID: 1, Name: "Globex"}
+	db.Create(&client)
+	var invoices []*models.Invoice
+	for _, inv := range []models.Invoice{
+		{Number: "FA-2025-00001", Status: models.InvoiceStatusFinal},
+		{Number: "FA-2025-00002", Status: models.InvoiceStatusPaid},
+		{Number: "DRAFT-1", Status: models.InvoiceStatusDraft},
+	} {
+		inv.UserID, inv.ClientID = 1, client.ID
+		inv.IssueDate = time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+		inv.DueDate = time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+		inv.Items = []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20}}
+		db.Create(&inv)
+		invoices = append(invoices, &inv)
+	}
+
+	server := storagetest.NewServer(t)
+	store := storage.NewS3Store(server.URL, "fr-par", "archive", storagetest.AccessKey, storagetest.SecretKey)
+	return db, NewArchiveService(db, NewPDFService(db), store), server, invoices
+}
+
+func TestArchiveService_Archive(t *testing.T) {
+	db, s, server, invoices := setupArchiveTest(t)
+	ctx := context.Background()
+	load := func(inv *models.Invoice) *models.Invoice {
+		var loaded models.Invoice
+		db.Preload("Client").Preload("Items").First(&loaded, inv.ID)
+		return &loaded
+	}
+
+	doc, err := s.Archive(ctx, 1, invoices[0].ID)
+	if err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+	stored, ok := server.Object("/archive/" + doc.Key)
+	if !ok || doc.Key != "invoices/1/2025/1-FA-2025-00001.pdf" || doc.Size != int64(len(stored)) || len(doc.SHA256) != 64 {
+		t.Fatalf("Archive() = %+v, stored %v", doc, ok)
+	}
+	if want := time.Date(2035, 12, 31, 0, 0, 0, 0, time.UTC); !doc.RetainUntil.Equal(want) {
+		t.Errorf("RetainUntil = %v, want %v", doc.RetainUntil, want)
+	}
+	if again, err := s.Archive(ctx, 1, invoices[0].ID); err != nil || again.ID != doc.ID || again.SHA256 != doc.SHA256 {
+		t.Errorf("Archive() again = %+v, %v; want the same document", again, err)
+	}
+	if _, err := s.Archive(ctx, 1, invoices[2].ID); !errors.Is(err, ErrInvoiceNotFinal) {
+		t.Errorf("Archive() of a draft error = %v, want ErrInvoiceNotFinal", err)
+	}
+	if _, err := s.Archive(ctx, 2, invoices[0].ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Archive() of another user's invoice error = %v", err)
+	}
+
+	// The archived copy is served, whatever changed since
+	db.Model(&models.CompanySettings{}).Where("user_id = ?", 1).Update("name", "Acme SAS")
+	pdf, err := s.PDF(ctx, load(invoices[0]))
+	if err != nil || !bytes.Equal(pdf, stored) {
+		t.Errorf("PDF() = %d bytes, %v; want the archived copy", len(pdf), err)
+	}
+
+	// Invoices finalized without archive are archived on first use
+	if _, err := s.PDF(ctx, load(invoices[1])); err != nil {
+		t.Fatalf("PDF() error = %v", err)
+	}
+	var count int64
+	db.Model(&models.ArchivedDocument{}).Count(&count)
+	if count != 2 {
+		t.Errorf("archived documents = %d, want 2", count)
+	}
+	// Drafts are not
+	if _, err := s.PDF(ctx, load(invoices[2])); err != nil {
+		t.Errorf("PDF() of a draft error = %v", err)
+	}
+	db.Model(&models.ArchivedDocument{}).Count(&count)
+	if count != 2 {
+		t.Errorf("archived documents after a draft = %d, want 2", count)
+	}
+
+	// An altered copy is refused
+	server.SetObject("/archive/"+doc.Key, append(stored, '\n'))
+	if _, err := s.PDF(ctx, load(invoices[0])); !errors.Is(err, ErrArchiveCorrupted) {
+		t.Errorf("PDF() of an altered copy error = %v, want ErrArchiveCorrupted", err)
+	}
+}
+
+func TestArchiveService_Retention(t *testing.T) {
+	_, s, server, invoices := setupArchiveTest(t)
+	ctx := context.Background()
+	now := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	doc, _ := s.Archive(ctx, 1, invoices[0].ID)
+	report, err := s.Retention(ctx, 1, now, false)
+	if err != nil {
+		t.Fatalf("Retention() error = %v", err)
+	}
+	if report.Documents != 1 || len(report.Years) != 1 || report.Years[0].Year != 2025 || report.Years[0].Expired ||
+		len(report.Missing) != 1 || report.Missing[0].Number != "FA-2025-00002" || report.Valid() {
+		t.Fatalf("Retention() = %+v", report)
+	}
+
+	if n, err := s.ArchiveMissing(ctx, 1); err != nil || n != 1 {
+		t.Fatalf("ArchiveMissing() = %d, %v; want 1", n, err)
+	}
+	server.SetObject("/archive/"+doc.Key, []byte("%PDF-1.7 forged"))
+	report, _ = s.Retention(ctx, 1, now, true)
+	if report.Documents != 2 || report.Years[0].Documents != 2 || len(report.Missing) != 0 ||
+		len(report.Corrupted) != 1 || report.Corrupted[0].Number != "FA-2025-00001" {
+		t.Errorf("Retention() after archiving = %+v", report)
+	}
+
+	// The retention period ends on December 31st of the tenth year
+	report, _ = s.Retention(ctx, 1, time.Date(2036, 1, 2, 0, 0, 0, 0, time.UTC), false)
+	if !report.Years[0].Expired {
+		t.Errorf("Retention() in 2036 = %+v, want expired", report.Years)
+	}
+	if report, _ := s.Retention(ctx, 2, now, true); report.Documents != 0 || !report.Valid() {
+		t.Errorf("Retention() of another user = %+v", report)
+	}
+}
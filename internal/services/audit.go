@@ -0,0 +1,459 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/policy/principal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrAuditImmutable is returned when an audit entry is updated or deleted.
+var ErrAuditImmutable = errors.New("audit entries cannot be changed")
+
+// AuditChainError tells where the audit chain is broken.
+type AuditChainError struct {
+	Sequence uint64
+	Reason   string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("audit chain broken at entry %d: %s", e.Sequence, e.Reason)
+}
+
+// auditedTables maps the tables whose changes are recorded to the entity
+// type of their entries.
+var auditedTables = map[string]string{
+	"invoices":         "invoice",
+	"invoice_items":    "invoice_item",
+	"clients":          "client",
+	"products":         "product",
+	"company_settings": "company_settings",
+	"profiles":         "profile",
+}
+
+// AuditEntities returns the entity types found in the audit log, sorted.
+func AuditEntities() []string {
+	entities := []string{"profile_permissions"}
+	for _, entity := range auditedTables {
+		entities = append(entities, entity)
+	}
+	sort.Strings(entities)
+	return entities
+}
+
+const (
+	auditEntriesTable = "audit_entries"
+	auditBeforeKey    = "audit:before"
+	auditNewKey       = "audit:new"
+	auditBatchSize    = 500
+)
+
+// RegisterAudit installs the GORM callbacks recording every create,
+// update and delete of the audited tables in the audit log, in the
+// transaction of the change. They also refuse any update or delete of
+// audit entries.
+//
+// The actor of a change is the user of the statement context when set
+// (see gorm.DB.WithContext), else the owner of the record.
+func RegisterAudit(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:before_create").Register("audit:before_create", auditBeforeCreate),
+		cb.Create().Before("gorm:commit_or_rollback_transaction").Register("audit:create", auditCreate),
+		cb.Update().Before("gorm:before_update").Register("audit:before_update", auditBefore),
+		cb.Update().Before("gorm:commit_or_rollback_transaction").Register("audit:update", auditUpdate),
+		cb.Delete().Before("gorm:before_delete").Register("audit:before_delete", auditBefore),
+		cb.Delete().Before("gorm:commit_or_rollback_transaction").Register("audit:delete", auditDelete),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppendAudit appends entry to the audit chain: it numbers it, links it
+// to the previous entry and hashes it. tx should be the transaction of
+// the recorded change.
+func AppendAudit(tx *gorm.DB, entry *models.AuditEntry) error {
+	tx = tx.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+
+	head := models.AuditHead{ID: 1}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).FirstOrCreate(&head).Error; err != nil {
+		return err
+	}
+
+	entry.Sequence = head.Sequence + 1
+	entry.PrevHash = head.Hash
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	// Stored timestamps keep microseconds at most
+	entry.CreatedAt = entry.CreatedAt.UTC().Truncate(time.Microsecond)
+	entry.Hash = entry.ComputeHash()
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+	return tx.Model(&head).Updates(map[string]any{"sequence": entry.Sequence, "hash": entry.Hash}).Error
+}
+
+// auditBeforeCreate remembers which records have no primary key yet.
+// The others are upserted by GORM when saving associations, and are not
+// new.
+func auditBeforeCreate(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil || auditedTables[stmt.Schema.Table] == "" {
+		return
+	}
+	var isNew []bool
+	auditEach(stmt.ReflectValue, func(rv reflect.Value) {
+		_, zero := stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, rv)
+		_, upsert := stmt.Clauses["ON CONFLICT"]
+		isNew = append(isNew, zero || !upsert)
+	})
+	stmt.Settings.Store(auditNewKey, isNew)
+}
+
+func auditCreate(db *gorm.DB) {
+	stmt := db.Statement
+	entity := auditEntity(db)
+	if entity == "" {
+		return
+	}
+	v, _ := stmt.Settings.LoadAndDelete(auditNewKey)
+	isNew, _ := v.([]bool)
+
+	var rows []map[string]any
+	i := 0
+	auditEach(stmt.ReflectValue, func(rv reflect.Value) {
+		if i < len(isNew) && isNew[i] {
+			rows = append(rows, auditColumns(stmt, rv))
+		}
+		i++
+	})
+	for _, row := range rows {
+		entry := &models.AuditEntry{Action: models.AuditCreate, After: auditJSON(row)}
+		if !auditAppend(db, entity, entry, row) {
+			return
+		}
+	}
+}
+
+// auditBefore loads the records about to be updated or deleted.
+func auditBefore(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return
+	}
+	if stmt.Schema.Table == auditEntriesTable {
+		db.AddError(ErrAuditImmutable)
+		return
+	}
+	if auditedTables[stmt.Schema.Table] == "" {
+		return
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true}).Model(reflect.New(stmt.Schema.ModelType).Interface())
+	if stmt.Unscoped {
+		tx = tx.Unscoped()
+	}
+	scoped := false
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			tx = tx.Clauses(where)
+			scoped = true
+		}
+	}
+	var ids []any
+	auditEach(stmt.ReflectValue, func(rv reflect.Value) {
+		if id, zero := stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, rv); !zero {
+			ids = append(ids, id)
+		}
+	})
+	if len(ids) > 0 {
+		tx = tx.Where(auditPrimaryKeyIn(stmt.Schema, ids))
+		scoped = true
+	}
+	if !scoped {
+		// GORM refuses global updates and deletes
+		return
+	}
+
+	rows, err := auditLoad(tx, stmt)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	stmt.Settings.Store(auditBeforeKey, rows)
+}
+
+func auditUpdate(db *gorm.DB) {
+	stmt := db.Statement
+	entity := auditEntity(db)
+	if entity == "" {
+		return
+	}
+	v, _ := stmt.Settings.LoadAndDelete(auditBeforeKey)
+	befores, _ := v.([]map[string]any)
+	if len(befores) == 0 {
+		return
+	}
+
+	pk := stmt.Schema.PrioritizedPrimaryField.DBName
+	ids := make([]any, len(befores))
+	for i, row := range befores {
+		ids[i] = row[pk]
+	}
+	tx := db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(reflect.New(stmt.Schema.ModelType).Interface())
+	afters, err := auditLoad(tx.Where(auditPrimaryKeyIn(stmt.Schema, ids)), stmt)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	byID := make(map[string]map[string]any, len(afters))
+	for _, row := range afters {
+		byID[fmt.Sprint(row[pk])] = row
+	}
+
+	for _, before := range befores {
+		after := byID[fmt.Sprint(before[pk])]
+		changedBefore, changedAfter := auditDiff(before, after)
+		if len(changedAfter) == 0 {
+			continue
+		}
+		action := models.AuditUpdate
+		if entity == "invoice" && fmt.Sprint(before["status"]) == string(models.InvoiceStatusDraft) &&
+			fmt.Sprint(after["status"]) != string(models.InvoiceStatusDraft) {
+			action = models.AuditFinalize
+		}
+		entry := &models.AuditEntry{Action: action, Before: auditJSON(changedBefore), After: auditJSON(changedAfter)}
+		if !auditAppend(db, entity, entry, after) {
+			return
+		}
+	}
+}
+
+func auditDelete(db *gorm.DB) {
+	stmt := db.Statement
+	entity := auditEntity(db)
+	if entity == "" {
+		return
+	}
+	v, _ := stmt.Settings.LoadAndDelete(auditBeforeKey)
+	befores, _ := v.([]map[string]any)
+	for _, before := range befores {
+		entry := &models.AuditEntry{Action: models.AuditDelete, Before: auditJSON(before)}
+		if !auditAppend(db, entity, entry, before) {
+			return
+		}
+	}
+}
+
+// auditEntity returns the entity type of the statement table, or "" if
+// it is not audited or the statement failed.
+func auditEntity(db *gorm.DB) string {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return ""
+	}
+	return auditedTables[db.Statement.Schema.Table]
+}
+
+// auditAppend completes entry for row and appends it, and reports whether
+// it succeeded.
+func auditAppend(db *gorm.DB, entity string, entry *models.AuditEntry, row map[string]any) bool {
+	entry.EntityType = entity
+	if id, ok := row["id"].(uint); ok {
+		entry.EntityID = id
+	}
+	entry.ActorID = auditActor(db, row)
+	if err := AppendAudit(db, entry); err != nil {
+		db.AddError(err)
+		return false
+	}
+	return true
+}
+
+// auditActor returns the user of the statement context, or the owner of
+// the record: its user, or the user of its invoice.
+func auditActor(db *gorm.DB, row map[string]any) uint {
+	if userID, ok := principal.UserIDFromContext(db.Statement.Context); ok {
+		return userID
+	}
+	if userID, ok := row["user_id"].(uint); ok {
+		return userID
+	}
+	if invoiceID, ok := row["invoice_id"].(uint); ok && invoiceID != 0 {
+		var userID uint
+		db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&models.Invoice{}).
+			Where("id = ?", invoiceID).Limit(1).Pluck("user_id", &userID)
+		return userID
+	}
+	return 0
+}
+
+// auditLoad runs tx and returns the columns of the records found.
+func auditLoad(tx *gorm.DB, stmt *gorm.Statement) ([]map[string]any, error) {
+	dest := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	if err := tx.Find(dest.Interface()).Error; err != nil {
+		return nil, err
+	}
+	var rows []map[string]any
+	for i := 0; i < dest.Elem().Len(); i++ {
+		rows = append(rows, auditColumns(stmt, dest.Elem().Index(i)))
+	}
+	return rows, nil
+}
+
+// auditColumns returns the column values of a record.
+func auditColumns(stmt *gorm.Statement, rv reflect.Value) map[string]any {
+	row := make(map[string]any)
+	for _, f := range stmt.Schema.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		if f.Serializer != nil {
+			// ValueOf wraps serialized fields for the driver
+			row[f.DBName] = f.ReflectValueOf(stmt.Context, rv).Interface()
+			continue
+		}
+		v, _ := f.ValueOf(stmt.Context, rv)
+		row[f.DBName] = v
+	}
+	return row
+}
+
+// auditDiff returns the columns that differ between before and after,
+// ignoring the update time.
+func auditDiff(before, after map[string]any) (map[string]any, map[string]any) {
+	changedBefore, changedAfter := make(map[string]any), make(map[string]any)
+	for col, value := range after {
+		if col == "updated_at" {
+			continue
+		}
+		b, _ := json.Marshal(before[col])
+		a, _ := json.Marshal(value)
+		if string(a) != string(b) {
+			changedBefore[col] = before[col]
+			changedAfter[col] = value
+		}
+	}
+	return changedBefore, changedAfter
+}
+
+// auditEach calls fn with each record of a statement value.
+func auditEach(rv reflect.Value, fn func(reflect.Value)) {
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		fn(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			elem := rv.Index(i)
+			for elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Struct {
+				fn(elem)
+			}
+		}
+	}
+}
+
+func auditPrimaryKeyIn(s *schema.Schema, ids []any) clause.IN {
+	return clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: s.PrioritizedPrimaryField.DBName}, Values: ids}
+}
+
+func auditJSON(row map[string]any) string {
+	data, _ := json.Marshal(row)
+	return string(data)
+}
+
+// AuditService reads and verifies the audit log.
+type AuditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// AuditFilter selects audit entries. Zero fields select everything.
+type AuditFilter struct {
+	EntityType string
+	EntityID   uint
+	ActorID    uint
+}
+
+// List returns a page of the entries matching f, latest first, and their
+// total count.
+func (s *AuditService) List(f AuditFilter, limit, offset int) ([]models.AuditEntry, int64, error) {
+	q := s.db.Model(&models.AuditEntry{})
+	if f.EntityType != "" {
+		q = q.Where("entity_type = ?", f.EntityType)
+	}
+	if f.EntityID != 0 {
+		q = q.Where("entity_id = ?", f.EntityID)
+	}
+	if f.ActorID != 0 {
+		q = q.Where("actor_id = ?", f.ActorID)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var entries []models.AuditEntry
+	err := q.Order("sequence DESC").Limit(limit).Offset(offset).Find(&entries).Error
+	return entries, total, err
+}
+
+// Verify checks the whole audit chain: entries numbered without gaps,
+// each one linked to the previous one and matching its hash, and the
+// last one matching the head. It returns the number of entries checked,
+// and an AuditChainError if the chain is broken.
+func (s *AuditService) Verify() (int, error) {
+	var (
+		prevHash string
+		next     uint64 = 1
+	)
+	for {
+		var entries []models.AuditEntry
+		if err := s.db.Where("sequence >= ?", next).Order("sequence").Limit(auditBatchSize).Find(&entries).Error; err != nil {
+			return int(next - 1), err
+		}
+		for _, e := range entries {
+			switch {
+			case e.Sequence != next:
+				return int(next - 1), &AuditChainError{Sequence: next, Reason: "entry missing"}
+			case e.PrevHash != prevHash:
+				return int(next - 1), &AuditChainError{Sequence: next, Reason: "not linked to the previous entry"}
+			case e.ComputeHash() != e.Hash:
+				return int(next - 1), &AuditChainError{Sequence: next, Reason: "content altered"}
+			}
+			prevHash = e.Hash
+			next++
+		}
+		if len(entries) < auditBatchSize {
+			break
+		}
+	}
+
+	var head models.AuditHead
+	if err := s.db.Where("id = ?", 1).Limit(1).Find(&head).Error; err != nil {
+		return int(next - 1), err
+	}
+	if head.Sequence != next-1 || head.Hash != prevHash {
+		return int(next - 1), &AuditChainError{Sequence: next, Reason: "last entries missing"}
+	}
+	return int(next - 1), nil
+}
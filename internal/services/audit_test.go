@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/policy/principal"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAuditTest(t *testing.T) (*AuditService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Client{}, &models.Invoice{}, &models.InvoiceItem{}, &models.AuditEntry{}, &models.AuditHead{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	if err := RegisterAudit(db); err != nil {
+		t.Fatalf("RegisterAudit() error = %v", err)
+	}
+	return NewAuditService(db), db
+}
+
+func TestAudit_RecordsChanges(t *testing.T) {
+	s, db := setupAuditTest(t)
+
+	client := models.Client{UserID: 1, Name: "Globex"}
+	db.Create(&client)
+	invoice := models.Invoice{
+		UserID: 1, ClientID: client.ID, Number: "DRAFT-1", Status: models.InvoiceStatusDraft,
+		Items: []models.InvoiceItem{
+			{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20},
+			{Description: "Travel", Quantity: 1, UnitPrice: 5000, VATRate: 0.20},
+		},
+	}
+	db.Create(&invoice)
+	// Saving the invoice upserts its items, which must not count as creations
+	invoice.Reference = "PO-42"
+	db.Save(&invoice)
+	db.Where("invoice_id = ? AND description = ?", invoice.ID, "Travel").Delete(&models.InvoiceItem{})
+	// API requests are recorded under the user of their token
+	ctx := principal.WithAPIToken(t.Context(), &models.APIToken{UserID: 7})
+	db.WithContext(ctx).Model(&invoice).Updates(map[string]any{"status": models.InvoiceStatusFinal, "number": "FA-2025-00001"})
+	// An unchanged record is not recorded
+	db.Save(&client)
+
+	entries, total, err := s.List(AuditFilter{}, 50, 0)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var got []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		got = append(got, entries[i].EntityType+":"+string(entries[i].Action))
+	}
+	want := "client:create invoice_item:create invoice_item:create invoice:create invoice:update invoice_item:delete invoice:finalize"
+	if total != 7 || strings.Join(got, " ") != want {
+		t.Fatalf("entries = %q (%d), want %q", strings.Join(got, " "), total, want)
+	}
+
+	finalize := entries[0]
+	if finalize.ActorID != 7 || finalize.EntityID != invoice.ID {
+		t.Errorf("finalize entry actor/entity = %d/%d, want 7/%d", finalize.ActorID, finalize.EntityID, invoice.ID)
+	}
+	changes := map[string][2]any{}
+	for _, c := range finalize.Changes() {
+		changes[c.Field] = [2]any{c.Before, c.After}
+	}
+	if len(changes) != 2 || changes["status"] != [2]any{"draft", "final"} || changes["number"] != [2]any{"DRAFT-1", "FA-2025-00001"} {
+		t.Errorf("finalize changes = %v", changes)
+	}
+	if deleted := entries[1]; deleted.ActorID != 1 || !strings.Contains(deleted.Before, `"description":"Travel"`) || deleted.After != "" {
+		t.Errorf("item delete entry = %+v", deleted)
+	}
+
+	if n, err := s.Verify(); err != nil || n != 7 {
+		t.Errorf("Verify() = %d, %v, want 7, nil", n, err)
+	}
+
+	// Filters
+	if _, n, _ := s.List(AuditFilter{EntityType: "invoice", EntityID: invoice.ID}, 50, 0); n != 3 {
+		t.Errorf("List() of the invoice = %d entries, want 3", n)
+	}
+}
+
+func TestAudit_RolledBackChangesAreNotRecorded(t *testing.T) {
+	s, db := setupAuditTest(t)
+
+	failed := errors.New("failed")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		tx.Create(&models.Client{UserID: 1, Name: "Globex"})
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+	db.Create(&models.Client{UserID: 1, Name: "Initech"})
+
+	if n, err := s.Verify(); err != nil || n != 1 {
+		t.Errorf("Verify() = %d, %v, want 1, nil", n, err)
+	}
+}
+
+func TestAuditService_Verify_DetectsTampering(t *testing.T) {
+	s, db := setupAuditTest(t)
+
+	for _, name := range []string{"Globex", "Initech", "Hooli"} {
+		db.Create(&models.Client{UserID: 1, Name: name})
+	}
+
+	// Entries cannot be changed through GORM
+	if err := db.Model(&models.AuditEntry{}).Where("sequence = ?", 2).Update("actor_id", 9).Error; !errors.Is(err, ErrAuditImmutable) {
+		t.Fatalf("Update() of an entry error = %v, want ErrAuditImmutable", err)
+	}
+	if err := db.Where("sequence = ?", 3).Delete(&models.AuditEntry{}).Error; !errors.Is(err, ErrAuditImmutable) {
+		t.Fatalf("Delete() of an entry error = %v, want ErrAuditImmutable", err)
+	}
+
+	// ... but they can be in SQL
+	db.Exec("UPDATE audit_entries SET after = REPLACE(after, 'Initech', 'Umbrella') WHERE sequence = 2")
+	var chainErr *AuditChainError
+	if n, err := s.Verify(); !errors.As(err, &chainErr) || chainErr.Sequence != 2 || n != 1 {
+		t.Errorf("Verify() of an altered entry = %d, %v", n, err)
+	}
+
+	db.Exec("DELETE FROM audit_entries WHERE sequence = 2")
+	if _, err := s.Verify(); !errors.As(err, &chainErr) || chainErr.Sequence != 2 || chainErr.Reason != "entry missing" {
+		t.Errorf("Verify() of a missing entry error = %v", err)
+	}
+
+	db.Exec("DELETE FROM audit_entries WHERE sequence >= 2")
+	if _, err := s.Verify(); !errors.As(err, &chainErr) || chainErr.Reason != "last entries missing" {
+		t.Errorf("Verify() of a truncated chain error = %v", err)
+	}
+}
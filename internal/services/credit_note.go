@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Credit note errors.
+var (
+	ErrInvoiceNotCreditable  = errors.New("only finalized invoices can be credited")
+	ErrCreditNoteEmpty       = errors.New("credit note has no lines")
+	ErrCreditExceedsInvoice  = errors.New("credited quantity exceeds the remaining invoiced quantity")
+	ErrInvalidCreditQuantity = errors.New("credited quantity must be a positive number")
+)
+
+// CreditNoteRequest describes which part of an invoice to credit.
+type CreditNoteRequest struct {
+	// Full credits every remaining quantity and ignores Quantities.
+	Full bool
+	// Quantities maps original invoice item IDs to the quantity to credit.
+	Quantities map[uint]float64
+	// Reason is printed on the credit note.
+	Reason string
+}
+
+// CreditNoteService issues credit notes (avoirs) against finalized invoices.
+type CreditNoteService struct {
+	db        *gorm.DB
+	numbering *NumberingService
+}
+
+func NewCreditNoteService(db *gorm.DB, numbering *NumberingService) *CreditNoteService {
+	return &CreditNoteService{db: db, numbering: numbering}
+}
+
+// Remaining returns, per original item ID, the quantity that has not been credited yet.
+func (s *CreditNoteService) Remaining(invoice *models.Invoice) (map[uint]float64, error) {
+	return s.remaining(s.db, invoice)
+}
+
+// Issue creates a finalized credit note reversing the requested lines of an invoice.
+// The credit note gets its own number from the credit note sequence. When the
+// invoice ends up fully credited it is marked cancelled: this is the only way
+// an invoice can reach InvoiceStatusCancelled.
+func (s *CreditNoteService) Issue(userID, invoiceID uint, req CreditNoteRequest) (*models.Invoice, error) {
+	var creditNote models.Invoice
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// The lock serializes credit notes on the same invoice, which would
+		// otherwise both see the full remaining quantities
+		var invoice models.Invoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", invoiceID, userID).Preload("Items").First(&invoice).Error; err != nil {
+			return err
+		}
+		if !invoice.CanCredit() {
+			return ErrInvoiceNotCreditable
+		}
+
+		remaining, err := s.remaining(tx, &invoice)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		creditNote = models.Invoice{
+			UserID:            userID,
+			ClientID:          invoice.ClientID,
+			Type:              models.InvoiceTypeCreditNote,
+			OriginalInvoiceID: &invoice.ID,
+			Reference:         invoice.Number,
+			IssueDate:         now,
+			DueDate:           now,
+			Status:            models.InvoiceStatusFinal,
+			Rounding:          invoice.Rounding,
+			Currency:          invoice.Currency,
+			BaseCurrency:      invoice.BaseCurrency,
+			ExchangeRate:      invoice.ExchangeRate,
+			Notes:             req.Reason,
+		}
+
+		fullyCredited := true
+		for _, item := range invoice.Items {
+			if !item.IsLine() {
+				continue
+			}
+			left := remaining[item.ID]
+			qty := left
+			if !req.Full {
+				qty = req.Quantities[item.ID]
+			}
+			if math.IsNaN(qty) || qty < 0 {
+				return ErrInvalidCreditQuantity
+			}
+			if qty > left {
+				return ErrCreditExceedsInvoice
+			}
+			if qty < left {
+				fullyCredited = false
+			}
+			if qty == 0 {
+				continue
+			}
+			creditNote.Items = append(creditNote.Items, models.InvoiceItem{
+				ProductID:       item.ProductID,
+				ProductSnapshot: item.ProductSnapshot,
+				CreditedItemID:  &item.ID,
+				Description:     item.Description,
+				Quantity:        -qty,
+				UnitPrice:       item.UnitPrice,
+				Unit:            item.Unit,
+				VATRate:         item.VATRate,
+				DiscountRate:    item.DiscountRate,
+				DiscountAmount:  -creditedDiscount(item, left, qty),
+				Position:        item.Position,
+			})
+		}
+		if len(creditNote.Items) == 0 {
+			return ErrCreditNoteEmpty
+		}
+
+		number, err := s.numbering.Next(tx, userID, models.DocumentTypeCreditNote, now)
+		if err != nil {
+			return err
+		}
+		creditNote.Number = number
+
+		if err := tx.Create(&creditNote).Error; err != nil {
+			return err
+		}
+		sealed, err := sealInvoice(tx, creditNote.ID)
+		if err != nil {
+			return err
+		}
+		creditNote.ClientSnapshot, creditNote.CompanySnapshot = sealed.ClientSnapshot, sealed.CompanySnapshot
+		creditNote.Items = sealed.Items
+		creditNote.SealSequence, creditNote.SealHash, creditNote.SealPrevHash, creditNote.SealedAt =
+			sealed.SealSequence, sealed.SealHash, sealed.SealPrevHash, sealed.SealedAt
+
+		if fullyCredited {
+			return tx.Model(&invoice).Update("status", models.InvoiceStatusCancelled).Error
+		}
+		// A partial credit may settle what is left after earlier payments
+		return refreshPaymentStatus(tx, userID, invoice.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &creditNote, nil
+}
+
+// creditedDiscount returns the share of the discount amount of an invoice
+// line that goes with crediting qty of the left quantity. Shares are taken
+// off the discount credited so far, so that crediting a line in several
+// times adds up to its discount.
+func creditedDiscount(item models.InvoiceItem, left, qty float64) models.Money {
+	if item.DiscountAmount == 0 || item.Quantity == 0 {
+		return 0
+	}
+	credited := item.Quantity - left
+	return item.DiscountAmount.Mul((credited+qty)/item.Quantity) - item.DiscountAmount.Mul(credited/item.Quantity)
+}
+
+func (s *CreditNoteService) remaining(db *gorm.DB, invoice *models.Invoice) (map[uint]float64, error) {
+	var credited []struct {
+		CreditedItemID uint
+		Quantity       float64
+	}
+	err := db.Model(&models.InvoiceItem{}).
+		Select("invoice_items.credited_item_id, SUM(invoice_items.quantity) AS quantity").
+		Joins("JOIN invoices ON invoices.id = invoice_items.invoice_id AND invoices.deleted_at IS NULL").
+		Where("invoices.original_invoice_id = ? AND invoices.type = ?", invoice.ID, models.InvoiceTypeCreditNote).
+		Group("invoice_items.credited_item_id").
+		Scan(&credited).Error
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := make(map[uint]float64, len(invoice.Items))
+	for _, item := range invoice.Items {
+		if item.IsLine() {
+			remaining[item.ID] = item.Quantity
+		}
+	}
+	for _, c := range credited {
+		// Credit note quantities are negative
+		remaining[c.CreditedItemID] += c.Quantity
+	}
+	for id, qty := range remaining {
+		// Quantities are stored with 3 decimals; drop float noise from the sums
+		remaining[id] = math.Round(qty*1000) / 1000
+	}
+	return remaining, nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCreditNoteService_Issue(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.Payment{}, &models.NumberingSequence{}, &models.NumberingCounter{}, &models.InvoiceSealHead{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	db.Create(&models.CompanySettings{
+		UserID: 1, Name: "Acme SARL", Country: "France", SIRET: "12345678900012", VATNumber: "FR12345678900",
+	})
+	client := models.Client{UserID: 1, Name: "Globex", Country: "France", SIRET: "98765432100019"}
+	db.Create(&client)
+
+	numbering := NewNumberingService(db)
+	s := NewCreditNoteService(db, numbering)
+	draft := models.Invoice{
+		UserID: 1, ClientID: client.ID, Number: "DRAFT-1", Status: models.InvoiceStatusDraft,
+		IssueDate: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), DueDate: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+		Items: []models.InvoiceItem{
+			{Description: "Consulting", Quantity: 3, UnitPrice: 10000, VATRate: 0.20},
+			{Description: "Training", Quantity: 1, UnitPrice: 20000, VATRate: 0.20},
+		},
+	}
+	db.Create(&draft)
+	if _, err := s.Issue(1, draft.ID, CreditNoteRequest{Full: true}); !errors.Is(err, ErrInvoiceNotCreditable) {
+		t.Fatalf("Issue(draft) error = %v, want ErrInvoiceNotCreditable", err)
+	}
+	final, err := NewInvoiceService(db, numbering, NewManualRateProvider(db)).Finalize(1, draft.ID)
+	if err != nil {
+		t.Fatalf("Finalize() error = %v", err)
+	}
+	consulting, training := final.Items[0].ID, final.Items[1].ID
+
+	// A partial credit note gets its own number and reverses the lines
+	creditNote, err := s.Issue(1, final.ID, CreditNoteRequest{Quantities: map[uint]float64{consulting: 2}, Reason: "Cancelled session"})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if want := fmt.Sprintf("AV-%d-00001", time.Now().Year()); creditNote.Number != want {
+		t.Errorf("Number = %q, want %q", creditNote.Number, want)
+	}
+	if !creditNote.IsCreditNote() || creditNote.Reference != final.Number || creditNote.TotalTTC() != -24000 {
+		t.Errorf("credit note = %+v, total %s", creditNote, creditNote.TotalTTC())
+	}
+
+	// No more than what is left can be credited
+	for _, req := range []CreditNoteRequest{
+		{Quantities: map[uint]float64{consulting: 2}},
+		{Quantities: map[uint]float64{training: 1.5}},
+	} {
+		if _, err := s.Issue(1, final.ID, req); !errors.Is(err, ErrCreditExceedsInvoice) {
+			t.Errorf("Issue(%v) error = %v, want ErrCreditExceedsInvoice", req.Quantities, err)
+		}
+	}
+	for _, qty := range []float64{-1, math.NaN()} {
+		if _, err := s.Issue(1, final.ID, CreditNoteRequest{Quantities: map[uint]float64{consulting: qty}}); !errors.Is(err, ErrInvalidCreditQuantity) {
+			t.Errorf("Issue(%v) error = %v, want ErrInvalidCreditQuantity", qty, err)
+		}
+	}
+	if _, err := s.Issue(1, final.ID, CreditNoteRequest{Quantities: map[uint]float64{training: math.Inf(1)}}); !errors.Is(err, ErrCreditExceedsInvoice) {
+		t.Errorf("Issue(+Inf) error = %v, want ErrCreditExceedsInvoice", err)
+	}
+	if _, err := s.Issue(1, final.ID, CreditNoteRequest{Quantities: map[uint]float64{}}); !errors.Is(err, ErrCreditNoteEmpty) {
+		t.Errorf("Issue(nothing) error = %v, want ErrCreditNoteEmpty", err)
+	}
+
+	// Crediting the rest cancels the invoice
+	if _, err := s.Issue(1, final.ID, CreditNoteRequest{Full: true}); err != nil {
+		t.Fatalf("Issue(full) error = %v", err)
+	}
+	var invoice models.Invoice
+	db.First(&invoice, final.ID)
+	if invoice.Status != models.InvoiceStatusCancelled {
+		t.Errorf("Status = %q, want cancelled", invoice.Status)
+	}
+	if _, err := s.Issue(1, final.ID, CreditNoteRequest{Full: true}); !errors.Is(err, ErrInvoiceNotCreditable) {
+		t.Errorf("Issue(cancelled) error = %v, want ErrInvoiceNotCreditable", err)
+	}
+}
+
+func TestCreditNoteService_DiscountsAndSections(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.Payment{}, &models.NumberingSequence{}, &models.NumberingCounter{}, &models.InvoiceSealHead{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	db.Create(&models.CompanySettings{
+		UserID: 1, Name: "Acme SARL", Country: "France", SIRET: "12345678900012", VATNumber: "FR12345678900",
+	})
+	client := models.Client{UserID: 1, Name: "Globex", Country: "France", SIRET: "98765432100019"}
+	db.Create(&client)
+
+	numbering := NewNumberingService(db)
+	draft := models.Invoice{
+		UserID: 1, ClientID: client.ID, Number: "DRAFT-1", Status: models.InvoiceStatusDraft,
+		IssueDate: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), DueDate: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+		Items: []models.InvoiceItem{
+			{Kind: models.ItemKindSection, Description: "Phase 1", Position: 0},
+			{Description: "Consulting", Quantity: 3, UnitPrice: 10000, VATRate: 0.20, DiscountAmount: 1000, Position: 1},
+			{Description: "Training", Quantity: 1, UnitPrice: 20000, VATRate: 0.20, DiscountRate: 0.25, Position: 2},
+			{Kind: models.ItemKindSubtotal, Position: 3},
+		},
+	}
+	db.Create(&draft)
+	final, err := NewInvoiceService(db, numbering, NewManualRateProvider(db)).Finalize(1, draft.ID)
+	if err != nil {
+		t.Fatalf("Finalize() error = %v", err)
+	}
+	if final.TotalHT() != 44000 {
+		t.Fatalf("TotalHT() = %s, want 440.00", final.TotalHT())
+	}
+	consulting := draft.Items[1].ID
+
+	// Crediting a line in several times adds up to its discount
+	s := NewCreditNoteService(db, numbering)
+	var credited models.Money
+	for _, qty := range []float64{1, 2} {
+		creditNote, err := s.Issue(1, final.ID, CreditNoteRequest{Quantities: map[uint]float64{consulting: qty}})
+		if err != nil {
+			t.Fatalf("Issue() error = %v", err)
+		}
+		if len(creditNote.Items) != 1 {
+			t.Fatalf("credit note items = %+v", creditNote.Items)
+		}
+		credited += creditNote.TotalHT()
+	}
+	if credited != -29000 {
+		t.Errorf("credited = %s, want -290.00", credited)
+	}
+
+	// Section titles and subtotals are not credited
+	creditNote, err := s.Issue(1, final.ID, CreditNoteRequest{Full: true})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if len(creditNote.Items) != 1 || creditNote.TotalHT() != -15000 {
+		t.Errorf("credit note = %+v, total %s", creditNote.Items, creditNote.TotalHT())
+	}
+
+	report, err := NewSealService(db).Verify(1)
+	if err != nil || !report.Valid() {
+		t.Errorf("Verify() = %+v, %v", report, err)
+	}
+}
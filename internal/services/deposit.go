@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+)
+
+// Deposit errors.
+var (
+	ErrInvalidDepositPercent = errors.New("deposit percentage must be between 0 and 100")
+	ErrDepositNotAllowed     = errors.New("deposits are taken on sent quotes and draft invoices only")
+	ErrDepositExceeds        = errors.New("deposits exceed the amount to invoice")
+	ErrDepositsPending       = errors.New("deposit invoices must be finalized or deleted first")
+	ErrDepositParentFinal    = errors.New("the final invoice of this deposit is already finalized")
+)
+
+// DepositRequest describes a deposit invoice (facture d'acompte) to issue,
+// as a percentage of a quote or of a draft final invoice.
+type DepositRequest struct {
+	// QuoteID or ParentInvoiceID names what the deposit is taken on.
+	QuoteID         uint
+	ParentInvoiceID uint
+	// Percent of the amount excluding VAT, in (0, 100].
+	Percent float64
+}
+
+// CreateDeposit creates a draft deposit invoice for a share of a quote or
+// of a draft final invoice. The deposit has one line per VAT rate of what
+// it is taken on, so that the VAT it collects is deducted rate by rate
+// from the final invoice.
+func (s *InvoiceService) CreateDeposit(userID uint, req DepositRequest) (*models.Invoice, error) {
+	if !(req.Percent > 0 && req.Percent <= 100) {
+		return nil, ErrInvalidDepositPercent
+	}
+
+	var deposit *models.Invoice
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		basis, label, err := s.depositBasis(tx, userID, req)
+		if err != nil {
+			return err
+		}
+		if !basis.HasLines() {
+			return ErrInvoiceEmpty
+		}
+
+		// Deposits already taken on the same quote or invoice
+		previous := tx.Where("user_id = ? AND type = ?", userID, models.InvoiceTypeDeposit).
+			Preload("Items").Preload("CreditNotes.Items")
+		if req.QuoteID != 0 {
+			previous = previous.Where("quote_id = ?", req.QuoteID)
+		} else {
+			previous = previous.Where("parent_invoice_id = ?", req.ParentInvoiceID)
+		}
+		var deposits []models.Invoice
+		if err := previous.Find(&deposits).Error; err != nil {
+			return err
+		}
+		var taken models.Money
+		for _, d := range deposits {
+			taken += netOfCreditNotes(d).TotalHT()
+		}
+
+		now := time.Now()
+		deposit = &models.Invoice{
+			UserID:       userID,
+			ClientID:     basis.ClientID,
+			Number:       "DRAFT-" + now.Format("20060102-150405.000000"),
+			Reference:    basis.Reference,
+			Type:         models.InvoiceTypeDeposit,
+			IssueDate:    now,
+			DueDate:      now,
+			Status:       models.InvoiceStatusDraft,
+			Rounding:     basis.Rounding,
+			Currency:     basis.Currency,
+			PaymentTerms: basis.PaymentTerms,
+		}
+		if req.QuoteID != 0 {
+			deposit.QuoteID = &req.QuoteID
+		} else {
+			deposit.ParentInvoiceID = &req.ParentInvoiceID
+		}
+
+		percent := strconv.FormatFloat(req.Percent, 'f', -1, 64)
+		description := "Acompte de " + percent + " %" + label
+		breakdown := basis.VATBreakdown()
+		for n, line := range breakdown {
+			amount := line.Base.Mul(req.Percent / 100)
+			if amount == 0 {
+				continue
+			}
+			item := models.InvoiceItem{
+				Description: description,
+				Quantity:    1,
+				UnitPrice:   amount,
+				VATRate:     line.Rate,
+				Position:    n,
+			}
+			if len(breakdown) > 1 {
+				item.Description += fmt.Sprintf(" (TVA %g %%)", line.RatePercent())
+			}
+			deposit.Items = append(deposit.Items, item)
+		}
+		if len(deposit.Items) == 0 {
+			return ErrInvoiceEmpty
+		}
+		if taken+deposit.TotalHT() > basis.TotalHT() {
+			return ErrDepositExceeds
+		}
+
+		return tx.Create(deposit).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deposit, nil
+}
+
+// depositBasis loads what a deposit is taken on, as an invoice document,
+// and the label describing it on the deposit lines.
+func (s *InvoiceService) depositBasis(tx *gorm.DB, userID uint, req DepositRequest) (*models.Invoice, string, error) {
+	if req.QuoteID != 0 {
+		var quote models.Quote
+		if err := tx.Where("id = ? AND user_id = ?", req.QuoteID, userID).Preload("Items").First(&quote).Error; err != nil {
+			return nil, "", err
+		}
+		if !quote.CanConvert() {
+			return nil, "", ErrDepositNotAllowed
+		}
+		basis := quote.Lines()
+		basis.ClientID = quote.ClientID
+		basis.Reference = quote.Reference
+		basis.PaymentTerms = quote.PaymentTerms
+		basis.Currency = invoiceCurrency(tx, userID, quote.ClientID)
+		return basis, " sur devis n° " + quote.Number, nil
+	}
+
+	var parent models.Invoice
+	if err := tx.Where("id = ? AND user_id = ?", req.ParentInvoiceID, userID).Preload("Items").First(&parent).Error; err != nil {
+		return nil, "", err
+	}
+	if !parent.CanTakeDeposits() {
+		return nil, "", ErrDepositNotAllowed
+	}
+	label := ""
+	if parent.Reference != "" {
+		label = " (réf. " + parent.Reference + ")"
+	}
+	return &parent, label, nil
+}
+
+// deductDeposits adds to a final invoice, before it is finalized, one
+// negative line per VAT rate of each deposit taken on it, so that both the
+// amounts and the VAT already invoiced are subtracted. Deposits still in
+// draft block the finalization. Credited deposits are deducted net of
+// their credit notes, and not at all once fully credited.
+func (s *InvoiceService) deductDeposits(tx *gorm.DB, invoice *models.Invoice) error {
+	var deposits []models.Invoice
+	if err := tx.Where("parent_invoice_id = ? AND type = ?", invoice.ID, models.InvoiceTypeDeposit).
+		Preload("Items").Preload("CreditNotes.Items").
+		Order("issue_date, id").
+		Find(&deposits).Error; err != nil {
+		return err
+	}
+
+	deducted := make(map[uint]bool)
+	position := 0
+	for _, item := range invoice.Items {
+		if item.DepositInvoiceID != nil {
+			deducted[*item.DepositInvoiceID] = true
+		}
+		position = max(position, item.Position+1)
+	}
+
+	for _, deposit := range deposits {
+		if deducted[deposit.ID] {
+			continue
+		}
+		if deposit.IsDraft() {
+			return ErrDepositsPending
+		}
+		if deposit.Status == models.InvoiceStatusCancelled {
+			continue
+		}
+		for _, line := range netOfCreditNotes(deposit).VATBreakdown() {
+			if line.Base == 0 {
+				continue
+			}
+			item := models.InvoiceItem{
+				InvoiceID:        invoice.ID,
+				DepositInvoiceID: &deposit.ID,
+				Description: strings.Join([]string{"Acompte n°", deposit.Number, "du",
+					deposit.IssueDate.Format("02/01/2006")}, " "),
+				Quantity:  1,
+				UnitPrice: -line.Base,
+				VATRate:   line.Rate,
+				Position:  position,
+			}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+			invoice.Items = append(invoice.Items, item)
+			position++
+		}
+	}
+
+	if invoice.TotalHT() < 0 {
+		return ErrDepositExceeds
+	}
+	return nil
+}
+
+// netOfCreditNotes returns a deposit with the lines of its credit notes,
+// which must be preloaded, so that its totals are what was not credited.
+func netOfCreditNotes(deposit models.Invoice) *models.Invoice {
+	for _, creditNote := range deposit.CreditNotes {
+		deposit.Items = append(slices.Clip(deposit.Items), creditNote.Items...)
+	}
+	return &deposit
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupDepositTest returns an invoice service over a database holding a
+// compliant company and client of user 1, and a sent quote for 1000.00 at
+// 20% and 100.00 at 5.5%.
+func setupDepositTest(t *testing.T) (*gorm.DB, *InvoiceService, *QuoteService, *models.Quote) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.Payment{}, &models.NumberingSequence{}, &models.NumberingCounter{}, &models.Quote{}, &models.QuoteItem{}, &models.InvoiceSealHead{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	db.Create(&models.CompanySettings{
+		UserID: 1, Name: "Acme SARL", Country: "France", SIRET: "12345678900012", VATNumber: "FR12345678900",
+	})
+	client := models.Client{UserID: 1, Name: "Globex", Country: "FR"}
+	db.Create(&client)
+	quote := models.Quote{
+		UserID: 1, ClientID: client.ID, Number: "DRAFT-1", Status: models.QuoteStatusDraft, Rounding: models.RoundingPerRate,
+		IssueDate: time.Now(), ValidUntil: time.Now().AddDate(0, 1, 0),
+		Items: []models.QuoteItem{
+			{Description: "Development", Quantity: 10, UnitPrice: 10000, VATRate: 0.20},
+			{Description: "Books", Quantity: 1, UnitPrice: 10000, VATRate: 0.055},
+		},
+	}
+	db.Create(&quote)
+
+	numbering := NewNumberingService(db)
+	quotes := NewQuoteService(db, numbering)
+	if _, err := quotes.Send(1, quote.ID); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	return db, NewInvoiceService(db, numbering, NewManualRateProvider(db)), quotes, &quote
+}
+
+func TestInvoiceService_DepositOnQuote(t *testing.T) {
+	db, s, quotes, quote := setupDepositTest(t)
+
+	deposit, err := s.CreateDeposit(1, DepositRequest{QuoteID: quote.ID, Percent: 30})
+	if err != nil {
+		t.Fatalf("CreateDeposit() error = %v", err)
+	}
+	if !deposit.IsDeposit() || !deposit.IsDraft() || *deposit.QuoteID != quote.ID {
+		t.Errorf("deposit = %+v", deposit)
+	}
+	// One line per rate of the quote
+	if len(deposit.Items) != 2 || deposit.TotalHT() != 33000 || deposit.TotalVAT() != 6165 {
+		t.Fatalf("deposit lines = %+v, HT %v, VAT %v; want 330.00 and 61.65", deposit.Items, deposit.TotalHT(), deposit.TotalVAT())
+	}
+	if _, err := s.Finalize(1, deposit.ID); err != nil {
+		t.Fatalf("Finalize(deposit) error = %v", err)
+	}
+
+	invoice, err := quotes.Convert(1, quote.ID)
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	final, err := s.Finalize(1, invoice.ID)
+	if err != nil {
+		t.Fatalf("Finalize(final) error = %v", err)
+	}
+
+	// The final invoice lists the quote lines and deducts the deposit per rate
+	if len(final.Items) != 4 {
+		t.Fatalf("final invoice has %d lines, want 2 + 2 deductions", len(final.Items))
+	}
+	if final.TotalHT() != 77000 || final.TotalVAT() != 14385 {
+		t.Errorf("final invoice HT %v, VAT %v; want 770.00 and 143.85", final.TotalHT(), final.TotalVAT())
+	}
+	for _, line := range final.VATBreakdown() {
+		if line.Rate == 0.20 && line.Base != 70000 || line.Rate == 0.055 && line.Base != 7000 {
+			t.Errorf("VAT line %+v, want 70%% of the quote base", line)
+		}
+	}
+
+	var saved models.Invoice
+	db.Preload("Items").First(&saved, final.ID)
+	if saved.TotalTTC() != final.TotalTTC() {
+		t.Errorf("deduction lines not saved: TTC %v, want %v", saved.TotalTTC(), final.TotalTTC())
+	}
+}
+
+func TestInvoiceService_DepositOnInvoice(t *testing.T) {
+	db, s, quotes, quote := setupDepositTest(t)
+	invoice, _ := quotes.Convert(1, quote.ID)
+
+	deposit, err := s.CreateDeposit(1, DepositRequest{ParentInvoiceID: invoice.ID, Percent: 50})
+	if err != nil {
+		t.Fatalf("CreateDeposit() error = %v", err)
+	}
+	if _, err := s.Finalize(1, invoice.ID); !errors.Is(err, ErrDepositsPending) {
+		t.Fatalf("Finalize() with a draft deposit error = %v, want ErrDepositsPending", err)
+	}
+	var count int64
+	db.Model(&models.InvoiceItem{}).Where("invoice_id = ?", invoice.ID).Count(&count)
+	if count != 2 {
+		t.Errorf("failed finalization left %d lines, want 2", count)
+	}
+
+	if _, err := s.Finalize(1, deposit.ID); err != nil {
+		t.Fatalf("Finalize(deposit) error = %v", err)
+	}
+	final, err := s.Finalize(1, invoice.ID)
+	if err != nil {
+		t.Fatalf("Finalize(final) error = %v", err)
+	}
+	if final.TotalTTC() != deposit.TotalTTC() {
+		t.Errorf("final TTC %v, want the other half %v", final.TotalTTC(), deposit.TotalTTC())
+	}
+}
+
+func TestInvoiceService_DepositCredited(t *testing.T) {
+	_, s, quotes, quote := setupDepositTest(t)
+	invoice, _ := quotes.Convert(1, quote.ID)
+	creditNotes := NewCreditNoteService(s.db, s.numbering)
+
+	var deposits []*models.Invoice
+	for _, percent := range []float64{50, 20} {
+		deposit, err := s.CreateDeposit(1, DepositRequest{ParentInvoiceID: invoice.ID, Percent: percent})
+		if err != nil {
+			t.Fatalf("CreateDeposit(%v%%) error = %v", percent, err)
+		}
+		if deposit, err = s.Finalize(1, deposit.ID); err != nil {
+			t.Fatalf("Finalize(deposit) error = %v", err)
+		}
+		deposits = append(deposits, deposit)
+	}
+
+	// The first deposit is cancelled, half of the 20% line of the second
+	// is refunded: 100.00 at 20% and 20.00 at 5.5% are left to deduct
+	if _, err := creditNotes.Issue(1, deposits[0].ID, CreditNoteRequest{Full: true}); err != nil {
+		t.Fatalf("Issue(full) error = %v", err)
+	}
+	line := deposits[1].Items[0].ID
+	if _, err := creditNotes.Issue(1, deposits[1].ID, CreditNoteRequest{Quantities: map[uint]float64{line: 0.5}}); err != nil {
+		t.Fatalf("Issue(partial) error = %v", err)
+	}
+
+	// Credited deposits no longer count against new ones
+	extra, err := s.CreateDeposit(1, DepositRequest{ParentInvoiceID: invoice.ID, Percent: 80})
+	if err != nil {
+		t.Fatalf("CreateDeposit() after credited deposits error = %v", err)
+	}
+	s.db.Select("Items").Delete(extra)
+
+	final, err := s.Finalize(1, invoice.ID)
+	if err != nil {
+		t.Fatalf("Finalize(final) error = %v", err)
+	}
+	if final.TotalHT() != 98000 {
+		t.Errorf("final TotalHT() = %s, want 980.00", final.TotalHT())
+	}
+	for _, item := range final.Items {
+		if item.DepositInvoiceID != nil && *item.DepositInvoiceID == deposits[0].ID {
+			t.Errorf("the cancelled deposit was deducted: %+v", item)
+		}
+	}
+}
+
+func TestInvoiceService_DepositLimits(t *testing.T) {
+	_, s, quotes, quote := setupDepositTest(t)
+
+	for _, percent := range []float64{0, -10, 120} {
+		if _, err := s.CreateDeposit(1, DepositRequest{QuoteID: quote.ID, Percent: percent}); !errors.Is(err, ErrInvalidDepositPercent) {
+			t.Errorf("CreateDeposit(%v%%) error = %v, want ErrInvalidDepositPercent", percent, err)
+		}
+	}
+
+	if _, err := s.CreateDeposit(1, DepositRequest{QuoteID: quote.ID, Percent: 60}); err != nil {
+		t.Fatalf("CreateDeposit() error = %v", err)
+	}
+	if _, err := s.CreateDeposit(1, DepositRequest{QuoteID: quote.ID, Percent: 50}); !errors.Is(err, ErrDepositExceeds) {
+		t.Errorf("CreateDeposit() over 100%% error = %v, want ErrDepositExceeds", err)
+	}
+	if _, err := s.CreateDeposit(2, DepositRequest{QuoteID: quote.ID, Percent: 10}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("CreateDeposit() by another user error = %v, want ErrRecordNotFound", err)
+	}
+
+	quotes.Convert(1, quote.ID)
+	if _, err := s.CreateDeposit(1, DepositRequest{QuoteID: quote.ID, Percent: 10}); !errors.Is(err, ErrDepositNotAllowed) {
+		t.Errorf("CreateDeposit() on a converted quote error = %v, want ErrDepositNotAllowed", err)
+	}
+}
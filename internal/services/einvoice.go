@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/einvoice"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/validation"
+	"gorm.io/gorm"
+)
+
+// E-invoice import errors.
+var (
+	ErrInvalidEInvoice = errors.New("invalid e-invoice document")
+	// ErrImportCreditNote: credit notes are only issued here against one of
+	// our own invoices.
+	ErrImportCreditNote = errors.New("credit notes cannot be imported")
+)
+
+// EInvoiceService exchanges invoices as UBL 2.1 (Peppol BIS Billing 3.0)
+// documents.
+type EInvoiceService struct {
+	db *gorm.DB
+}
+
+func NewEInvoiceService(db *gorm.DB) *EInvoiceService {
+	return &EInvoiceService{db: db}
+}
+
+// UBL renders a finalized document as UBL XML, with the parties and
+// products as they were at finalization. The invoice must have Client,
+// Items and, for credit notes, OriginalInvoice preloaded. It returns an
+// *einvoice.ValidationError when the invoice lacks Peppol mandatory data.
+func (s *EInvoiceService) UBL(invoice *models.Invoice) ([]byte, error) {
+	if invoice.IsDraft() {
+		return nil, ErrInvoiceNotFinal
+	}
+	invoice.UseSnapshots()
+	company := companySettings(s.db, invoice.UserID)
+	return einvoice.UBL(invoice, invoice.Seller(&company))
+}
+
+// ImportUBL creates a draft invoice from a UBL invoice. Its customer is
+// matched to an existing client by VAT number, then SIRET; a new client is
+// created when none matches. The imported invoice gets a draft number and
+// keeps the original number as its reference when it has no buyer reference.
+func (s *EInvoiceService) ImportUBL(userID uint, data []byte) (*models.Invoice, error) {
+	imported, err := einvoice.ParseUBL(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEInvoice, err)
+	}
+	invoice := imported.Invoice
+	if invoice.IsCreditNote() {
+		return nil, ErrImportCreditNote
+	}
+	if len(invoice.Items) == 0 {
+		return nil, ErrInvoiceEmpty
+	}
+	// Imported lines follow the rules of the lines typed in
+	for n := range invoice.Items {
+		v := make(validation.Violations)
+		ValidateItem(&invoice.Items[n], v)
+		if !v.Empty() {
+			fields := slices.Sorted(maps.Keys(v))
+			return nil, fmt.Errorf("%w: line %d: %s %s", ErrInvalidEInvoice, n+1, fields[0], v[fields[0]])
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		client, err := s.matchClient(tx, userID, imported.Customer)
+		if err != nil {
+			return err
+		}
+
+		invoice.UserID = userID
+		invoice.ClientID = client.ID
+		invoice.Client = client
+		invoice.Number = "DRAFT-" + time.Now().Format("20060102-150405")
+		invoice.Rounding = companySettings(tx, userID).Rounding.OrDefault()
+		if invoice.Reference == "" {
+			invoice.Reference = imported.Number
+		}
+		return tx.Create(invoice).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// matchClient finds the client of a user with the party's VAT number or
+// SIRET, ignoring spaces and case, or creates it.
+func (s *EInvoiceService) matchClient(tx *gorm.DB, userID uint, party einvoice.Party) (*models.Client, error) {
+	keys := []struct{ column, value string }{
+		{"vat_number", normalizeID(party.VATNumber)},
+		{"siret", normalizeID(party.SIRET)},
+	}
+	for _, key := range keys {
+		if key.value == "" {
+			continue
+		}
+		var clients []models.Client
+		err := tx.Where("user_id = ? AND UPPER(REPLACE("+key.column+", ' ', '')) = ?", userID, key.value).
+			Order("id").Limit(1).Find(&clients).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(clients) > 0 {
+			return &clients[0], nil
+		}
+	}
+
+	client := &models.Client{
+		UserID:      userID,
+		Name:        party.Name,
+		Email:       party.Email,
+		Address:     party.Address,
+		City:        party.City,
+		PostalCode:  party.PostalCode,
+		Country:     party.Country,
+		CountryCode: party.Country,
+		SIRET:       party.SIRET,
+		VATNumber:   party.VATNumber,
+	}
+	if client.Name == "" {
+		client.Name = "Imported client"
+	}
+	if err := tx.Create(client).Error; err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func normalizeID(id string) string {
+	return strings.ToUpper(strings.ReplaceAll(id, " ", ""))
+}
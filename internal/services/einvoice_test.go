@@ -0,0 +1,72 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/einvoice"
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupEInvoiceTest returns an e-invoice service over an empty database,
+// and the UBL of a one-line invoice of Acme SARL to Globex.
+func setupEInvoiceTest(t *testing.T) (*gorm.DB, *EInvoiceService, []byte) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	invoice := &models.Invoice{
+		Number: "FA-2025-00001", Status: models.InvoiceStatusFinal,
+		IssueDate: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), DueDate: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+		Client: &models.Client{Name: "Globex", Country: "France", SIRET: "98765432100019"},
+		Items:  []models.InvoiceItem{{Description: "Consulting", Quantity: 2, UnitPrice: 50000, VATRate: 0.20}},
+	}
+	company := &models.CompanySettings{Name: "Acme SARL", Country: "France", SIRET: "12345678900012", VATNumber: "FR12345678900"}
+	ubl, err := einvoice.UBL(invoice, company)
+	if err != nil {
+		t.Fatalf("UBL() error = %v", err)
+	}
+	return db, NewEInvoiceService(db), ubl
+}
+
+func TestEInvoiceService_ImportUBL(t *testing.T) {
+	db, s, ubl := setupEInvoiceTest(t)
+
+	// Lines break the rules of the invoice form
+	for _, tc := range []struct{ old, new string }{
+		{"<cbc:Percent>20</cbc:Percent>", "<cbc:Percent>150</cbc:Percent>"},
+		{"<cbc:Percent>20</cbc:Percent>", "<cbc:Percent>-20</cbc:Percent>"},
+		{`unitCode="C62">2<`, `unitCode="C62">-2<`},
+		{`unitCode="C62">2<`, `unitCode="C62">1e300<`},
+	} {
+		doc := bytes.ReplaceAll(ubl, []byte(tc.old), []byte(tc.new))
+		if bytes.Equal(doc, ubl) {
+			t.Fatalf("%q not found in the UBL", tc.old)
+		}
+		if _, err := s.ImportUBL(1, doc); !errors.Is(err, ErrInvalidEInvoice) {
+			t.Errorf("ImportUBL() with %s error = %v, want ErrInvalidEInvoice", tc.new, err)
+		}
+	}
+	var count int64
+	db.Model(&models.Invoice{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("invalid imports created %d invoices", count)
+	}
+
+	invoice, err := s.ImportUBL(1, ubl)
+	if err != nil {
+		t.Fatalf("ImportUBL() error = %v", err)
+	}
+	if !invoice.IsDraft() || invoice.Client.Name != "Globex" || invoice.TotalTTC() != 120000 {
+		t.Errorf("imported invoice = %+v, total %s", invoice, invoice.TotalTTC())
+	}
+}
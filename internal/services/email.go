@@ -0,0 +1,50 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/diewo77/go-invoices/i18n"
+	"github.com/diewo77/go-invoices/view"
+)
+
+// EmailTemplateDir holds the email templates. Each one defines a
+// "subject" and a "body" template, translated with the same t function as
+// the pages.
+const EmailTemplateDir = "templates/emails"
+
+// emailLanguage is the language of the emails sent to clients, the
+// default language of the application.
+const emailLanguage = "fr"
+
+// renderEmail executes the email template name of dir in lang and returns
+// the subject and the plain text body.
+func renderEmail(dir, name, lang string, data any) (subject, body string, err error) {
+	// The view functions read the language from the request context
+	req := &http.Request{Header: http.Header{}, URL: &url.URL{Path: "/"}}
+	req = req.WithContext(i18n.WithLang(context.Background(), lang))
+	funcs := template.FuncMap{}
+	for name, fn := range view.Funcs(req) {
+		funcs[name] = fn
+	}
+
+	tpl, err := template.New(name).Funcs(funcs).ParseFiles(filepath.Join(dir, name))
+	if err != nil {
+		return "", "", err
+	}
+	var buf bytes.Buffer
+	if err := tpl.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", err
+	}
+	subject = strings.Join(strings.Fields(buf.String()), " ")
+	buf.Reset()
+	if err := tpl.ExecuteTemplate(&buf, "body", data); err != nil {
+		return "", "", err
+	}
+	return subject, strings.TrimSpace(buf.String()) + "\n", nil
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Exchange rate errors.
+var (
+	ErrNoExchangeRate      = errors.New("no exchange rate for the invoice currency")
+	ErrInvalidExchangeRate = errors.New("invalid exchange rate")
+)
+
+// RateProvider supplies the exchange rates used to convert invoices to the
+// base currency of their issuer when they are finalized.
+type RateProvider interface {
+	// Rate returns the value of one unit of from in to, in force at date
+	// for the user. It returns ErrNoExchangeRate if there is none.
+	Rate(userID uint, from, to models.Currency, date time.Time) (float64, error)
+}
+
+// ManualRateProvider serves the exchange rates entered by each user. A
+// rate applies from its date until the next one.
+type ManualRateProvider struct {
+	db *gorm.DB
+}
+
+func NewManualRateProvider(db *gorm.DB) *ManualRateProvider {
+	return &ManualRateProvider{db: db}
+}
+
+// Rate implements RateProvider. Rates entered in the other direction are
+// inverted.
+func (p *ManualRateProvider) Rate(userID uint, from, to models.Currency, date time.Time) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+
+	var rates []models.ExchangeRate
+	err := p.db.Where("user_id = ? AND date <= ? AND ((currency = ? AND base_currency = ?) OR (currency = ? AND base_currency = ?))",
+		userID, day, from, to, to, from).
+		Order("date DESC, id DESC").
+		Limit(1).
+		Find(&rates).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(rates) == 0 || rates[0].Rate <= 0 {
+		return 0, ErrNoExchangeRate
+	}
+	if rates[0].Currency == from {
+		return rates[0].Rate, nil
+	}
+	return 1 / rates[0].Rate, nil
+}
+
+// List returns the rates entered by a user, most recent first.
+func (p *ManualRateProvider) List(userID uint) ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := p.db.Where("user_id = ?", userID).Order("date DESC, currency").Find(&rates).Error
+	return rates, err
+}
+
+// Set records the rate of a currency at a date, replacing the one entered
+// for the same day.
+func (p *ManualRateProvider) Set(userID uint, currency, base models.Currency, date time.Time, rate float64) (*models.ExchangeRate, error) {
+	if !currency.IsValid() || !base.IsValid() || currency == base || rate <= 0 {
+		return nil, ErrInvalidExchangeRate
+	}
+	r := &models.ExchangeRate{
+		UserID:       userID,
+		Currency:     currency,
+		BaseCurrency: base,
+		Date:         time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+		Rate:         rate,
+	}
+	err := p.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "currency"}, {Name: "base_currency"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).Create(r).Error
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Delete removes a rate of the user.
+func (p *ManualRateProvider) Delete(userID, id uint) error {
+	res := p.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.ExchangeRate{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupExchangeRateTest returns an invoice service over a database holding
+// a compliant company of user 1, billing in euros, a client billed in US
+// dollars and a draft invoice of 1000.00 USD excluding VAT to that client.
+func setupExchangeRateTest(t *testing.T) (*gorm.DB, *InvoiceService, *ManualRateProvider, *models.Invoice) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.Payment{}, &models.NumberingSequence{}, &models.NumberingCounter{}, &models.ExchangeRate{}, &models.InvoiceSealHead{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	db.Create(&models.CompanySettings{
+		UserID: 1, Name: "Acme SARL", Country: "France", SIRET: "12345678900012", VATNumber: "FR12345678900",
+	})
+	client := models.Client{UserID: 1, Name: "Initech", Country: "US", Currency: models.CurrencyUSD}
+	db.Create(&client)
+
+	rates := NewManualRateProvider(db)
+	s := NewInvoiceService(db, NewNumberingService(db), rates)
+	invoice := models.Invoice{
+		UserID: 1, ClientID: client.ID, Number: "DRAFT-1", Status: models.InvoiceStatusDraft,
+		Currency:  s.Currency(1, client.ID),
+		IssueDate: time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC),
+		DueDate:   time.Date(2025, 4, 10, 0, 0, 0, 0, time.UTC),
+		Items:     []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 100000}},
+	}
+	db.Create(&invoice)
+	return db, s, rates, &invoice
+}
+
+func TestManualRateProvider_Rate(t *testing.T) {
+	_, _, rates, _ := setupExchangeRateTest(t)
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	if _, err := rates.Rate(1, models.CurrencyUSD, models.CurrencyEUR, day(10)); !errors.Is(err, ErrNoExchangeRate) {
+		t.Errorf("Rate() without rates error = %v, want ErrNoExchangeRate", err)
+	}
+
+	rates.Set(1, models.CurrencyUSD, models.CurrencyEUR, day(1), 0.95)
+	rates.Set(1, models.CurrencyUSD, models.CurrencyEUR, day(5), 0.90)
+	rates.Set(1, models.CurrencyUSD, models.CurrencyEUR, day(5), 0.92)
+	rates.Set(1, models.CurrencyGBP, models.CurrencyEUR, day(1), 1.25)
+
+	tests := []struct {
+		from, to models.Currency
+		date     time.Time
+		want     float64
+	}{
+		{models.CurrencyUSD, models.CurrencyEUR, day(3), 0.95},
+		// The rate of the day was replaced
+		{models.CurrencyUSD, models.CurrencyEUR, day(10), 0.92},
+		{models.CurrencyEUR, models.CurrencyGBP, day(10), 0.8},
+		{models.CurrencyEUR, models.CurrencyEUR, day(10), 1},
+	}
+	for _, tt := range tests {
+		if got, err := rates.Rate(1, tt.from, tt.to, tt.date); err != nil || got != tt.want {
+			t.Errorf("Rate(%s, %s, %s) = %v, %v; want %v", tt.from, tt.to, tt.date.Format(time.DateOnly), got, err, tt.want)
+		}
+	}
+	if _, err := rates.Rate(2, models.CurrencyUSD, models.CurrencyEUR, day(10)); !errors.Is(err, ErrNoExchangeRate) {
+		t.Errorf("Rate() of another user error = %v, want ErrNoExchangeRate", err)
+	}
+
+	if _, err := rates.Set(1, models.CurrencyUSD, models.CurrencyEUR, day(1), 0); !errors.Is(err, ErrInvalidExchangeRate) {
+		t.Errorf("Set() zero rate error = %v, want ErrInvalidExchangeRate", err)
+	}
+}
+
+func TestInvoiceService_FinalizeForeignCurrency(t *testing.T) {
+	db, s, rates, invoice := setupExchangeRateTest(t)
+	if invoice.Currency != models.CurrencyUSD {
+		t.Fatalf("Currency = %q, want the client's", invoice.Currency)
+	}
+
+	if _, err := s.Finalize(1, invoice.ID); !errors.Is(err, ErrNoExchangeRate) {
+		t.Fatalf("Finalize() without rate error = %v, want ErrNoExchangeRate", err)
+	}
+
+	rates.Set(1, models.CurrencyUSD, models.CurrencyEUR, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), 0.92)
+	final, err := s.Finalize(1, invoice.ID)
+	if err != nil {
+		t.Fatalf("Finalize() error = %v", err)
+	}
+
+	// Later rates do not change finalized invoices
+	rates.Set(1, models.CurrencyUSD, models.CurrencyEUR, time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC), 0.5)
+	var saved models.Invoice
+	db.First(&saved, final.ID)
+	if saved.BaseCurrency != models.CurrencyEUR || saved.ExchangeRate != 0.92 || !saved.IsForeignCurrency() {
+		t.Errorf("saved = %s %s %v", saved.Currency, saved.BaseCurrency, saved.ExchangeRate)
+	}
+
+	// Revenue adds up payments in the base currency
+	db.Create(&models.Payment{UserID: 1, InvoiceID: final.ID, Amount: 50000, Method: models.PaymentMethodBankTransfer, Date: time.Now()})
+	other := models.Invoice{UserID: 1, ClientID: final.ClientID, Number: "FA-EUR", Status: models.InvoiceStatusFinal,
+		Currency: models.CurrencyEUR, IssueDate: time.Now(), DueDate: time.Now()}
+	db.Create(&other)
+	db.Create(&models.Payment{UserID: 1, InvoiceID: other.ID, Amount: 10000, Method: models.PaymentMethodBankTransfer, Date: time.Now()})
+	if revenue, err := s.GetRevenue(1); err != nil || revenue != 56000 {
+		t.Errorf("GetRevenue() = %v, %v; want 560.00", revenue, err)
+	}
+}
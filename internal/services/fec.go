@@ -0,0 +1,287 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+)
+
+// Journals of the FEC export.
+const (
+	FECSalesJournal = "VT"
+	FECBankJournal  = "BQ"
+)
+
+// fecHeader lists the 18 columns of the FEC (art. A47 A-1 du LPF).
+var fecHeader = []string{
+	"JournalCode", "JournalLib", "EcritureNum", "EcritureDate", "CompteNum", "CompteLib",
+	"CompAuxNum", "CompAuxLib", "PieceRef", "PieceDate", "EcritureLib", "Debit", "Credit",
+	"EcritureLet", "DateLet", "ValidDate", "Montantdevise", "Idevise",
+}
+
+// fecSanitizer blanks the separators out of the fields.
+var fecSanitizer = strings.NewReplacer("|", " ", "\r", " ", "\n", " ")
+
+// FECLine is one line of a journal entry of the FEC. Amounts are in the
+// base currency; ForeignAmount and Currency give the amount in the
+// invoice's currency when it differs.
+type FECLine struct {
+	Journal       string
+	JournalLabel  string
+	EntryNumber   int
+	Date          time.Time
+	Account       string
+	AccountLabel  string
+	AuxAccount    string
+	AuxLabel      string
+	PieceRef      string
+	PieceDate     time.Time
+	Label         string
+	Debit         models.Money
+	Credit        models.Money
+	ForeignAmount models.Money
+	Currency      models.Currency
+}
+
+// fecEntry is a balanced journal entry, one per invoice or payment.
+type fecEntry struct {
+	journal string
+	date    time.Time
+	lines   []FECLine
+}
+
+// add appends a line of amount, debit if positive and credit if negative.
+func (e *fecEntry) add(line FECLine, amount, foreign models.Money) {
+	if amount == 0 {
+		return
+	}
+	if amount > 0 {
+		line.Debit = amount
+	} else {
+		line.Credit = -amount
+	}
+	if line.Currency != "" {
+		line.ForeignAmount = max(foreign, -foreign)
+	}
+	e.lines = append(e.lines, line)
+}
+
+// FECService exports the sales and bank journals of a user as a Fichier
+// des Écritures Comptables, the accounting file French companies hand over
+// to the tax administration.
+type FECService struct {
+	db *gorm.DB
+}
+
+func NewFECService(db *gorm.DB) *FECService {
+	return &FECService{db: db}
+}
+
+// Lines returns the journal entries of the invoices and credit notes
+// issued, and of the payments received, from from included to to
+// excluded, in chronological order and numbered per journal.
+//
+// Each invoice debits the client account of its total, and credits revenue
+// and VAT collected for each rate; credit notes are reversed. Each payment
+// debits the bank account and credits the client account.
+func (s *FECService) Lines(userID uint, from, to time.Time) ([]FECLine, error) {
+	company := companySettings(s.db, userID)
+	accounts := company.Accounts()
+
+	var invoices []models.Invoice
+	if err := s.db.Where("user_id = ? AND status <> ? AND issue_date >= ? AND issue_date < ?",
+		userID, models.InvoiceStatusDraft, from, to).
+		Preload("Client", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("Items").
+		Order("issue_date, number").
+		Find(&invoices).Error; err != nil {
+		return nil, err
+	}
+
+	var payments []models.Payment
+	if err := s.db.Where("user_id = ? AND date >= ? AND date < ?", userID, from, to).
+		Preload("Invoice.Client", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Order("date, id").
+		Find(&payments).Error; err != nil {
+		return nil, err
+	}
+
+	var entries []fecEntry
+	for i := range invoices {
+		entries = append(entries, invoiceEntry(&invoices[i], accounts))
+	}
+	for i := range payments {
+		if payments[i].Invoice != nil {
+			entries = append(entries, paymentEntry(&payments[i], accounts))
+		}
+	}
+	sort.SliceStable(entries, func(a, b int) bool { return entries[a].date.Before(entries[b].date) })
+
+	var lines []FECLine
+	numbers := make(map[string]int)
+	for _, e := range entries {
+		if len(e.lines) == 0 {
+			continue
+		}
+		numbers[e.journal]++
+		for _, line := range e.lines {
+			line.EntryNumber = numbers[e.journal]
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// invoiceEntry returns the sales journal entry of an invoice.
+func invoiceEntry(invoice *models.Invoice, accounts models.Accounts) fecEntry {
+	kind := "Facture"
+	if invoice.IsCreditNote() {
+		kind = "Avoir"
+	}
+	line := FECLine{
+		Journal:      FECSalesJournal,
+		JournalLabel: "Journal des ventes",
+		Date:         invoice.IssueDate,
+		AuxAccount:   clientAuxAccount(invoice.ClientID),
+		PieceRef:     invoice.Number,
+		PieceDate:    invoice.IssueDate,
+		Label:        kind + " " + invoice.Number,
+	}
+	if invoice.Client != nil {
+		line.AuxLabel = invoice.Client.Name
+		line.Label += " " + invoice.Client.Name
+	}
+	if invoice.IsForeignCurrency() {
+		line.Currency = invoice.Currency
+	}
+
+	// The client line is the sum of the converted lines, so that the
+	// entry stays balanced whatever the rounding
+	breakdown := invoice.VATBreakdown()
+	var total, foreignTotal models.Money
+	for _, vat := range breakdown {
+		total += invoice.ToBase(vat.Base) + invoice.ToBase(vat.VAT)
+		foreignTotal += vat.Base + vat.VAT
+	}
+
+	entry := fecEntry{journal: FECSalesJournal, date: invoice.IssueDate}
+	client := line
+	client.Account, client.AccountLabel = accounts.Client, "Clients"
+	entry.add(client, total, foreignTotal)
+
+	line.AuxAccount, line.AuxLabel = "", ""
+	for _, vat := range breakdown {
+		revenue := line
+		revenue.Account, revenue.AccountLabel = accounts.Revenue, "Ventes"
+		entry.add(revenue, -invoice.ToBase(vat.Base), vat.Base)
+
+		collected := line
+		collected.Account = accounts.VATFor(vat.Rate)
+		percent := strings.Replace(strconv.FormatFloat(vat.RatePercent(), 'f', -1, 64), ".", ",", 1)
+		collected.AccountLabel = "TVA collectée " + percent + " %"
+		entry.add(collected, -invoice.ToBase(vat.VAT), vat.VAT)
+	}
+	return entry
+}
+
+// paymentEntry returns the bank journal entry of a payment.
+func paymentEntry(payment *models.Payment, accounts models.Accounts) fecEntry {
+	invoice := payment.Invoice
+	ref := payment.Reference
+	if ref == "" {
+		ref = invoice.Number
+	}
+	line := FECLine{
+		Journal:      FECBankJournal,
+		JournalLabel: "Journal de banque",
+		Date:         payment.Date,
+		PieceRef:     ref,
+		PieceDate:    payment.Date,
+		Label:        "Règlement " + invoice.Number,
+	}
+	if invoice.Client != nil {
+		line.Label += " " + invoice.Client.Name
+	}
+	if invoice.IsForeignCurrency() {
+		line.Currency = invoice.Currency
+	}
+	amount := invoice.ToBase(payment.Amount)
+
+	entry := fecEntry{journal: FECBankJournal, date: payment.Date}
+	bank := line
+	bank.Account, bank.AccountLabel = accounts.Bank, "Banque"
+	entry.add(bank, amount, payment.Amount)
+
+	client := line
+	client.Account, client.AccountLabel = accounts.Client, "Clients"
+	client.AuxAccount = clientAuxAccount(invoice.ClientID)
+	if invoice.Client != nil {
+		client.AuxLabel = invoice.Client.Name
+	}
+	entry.add(client, -amount, payment.Amount)
+	return entry
+}
+
+// clientAuxAccount returns the subsidiary account of a client in the
+// client ledger.
+func clientAuxAccount(clientID uint) string {
+	return fmt.Sprintf("C%06d", clientID)
+}
+
+// WriteFEC writes the lines as a FEC text file: pipe-separated columns,
+// dates as YYYYMMDD and amounts with a decimal comma.
+func WriteFEC(w io.Writer, lines []FECLine) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(strings.Join(fecHeader, "|") + "\r\n")
+	for _, l := range lines {
+		foreign := ""
+		if l.Currency != "" {
+			foreign = fecAmount(l.ForeignAmount)
+		}
+		fields := []string{
+			l.Journal, l.JournalLabel, strconv.Itoa(l.EntryNumber), fecDate(l.Date), l.Account, l.AccountLabel,
+			l.AuxAccount, l.AuxLabel, l.PieceRef, fecDate(l.PieceDate), l.Label, fecAmount(l.Debit), fecAmount(l.Credit),
+			"", "", fecDate(l.Date), foreign, string(l.Currency),
+		}
+		for i, f := range fields {
+			fields[i] = fecSanitizer.Replace(f)
+		}
+		bw.WriteString(strings.Join(fields, "|") + "\r\n")
+	}
+	return bw.Flush()
+}
+
+// Export writes the FEC of a user for the period from from included to to
+// excluded.
+func (s *FECService) Export(w io.Writer, userID uint, from, to time.Time) error {
+	lines, err := s.Lines(userID, from, to)
+	if err != nil {
+		return err
+	}
+	return WriteFEC(w, lines)
+}
+
+// FileName returns the regulatory name of the FEC of a user closing on
+// closing: the SIREN, "FEC" and the closing date.
+func (s *FECService) FileName(userID uint, closing time.Time) string {
+	siren := companySettings(s.db, userID).SIRET
+	if len(siren) > 9 {
+		siren = siren[:9]
+	}
+	return siren + "FEC" + fecDate(closing) + ".txt"
+}
+
+func fecDate(t time.Time) string {
+	return t.Format("20060102")
+}
+
+func fecAmount(m models.Money) string {
+	return strings.Replace(m.String(), ".", ",", 1)
+}
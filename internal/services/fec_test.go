@@ -0,0 +1,148 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupFECTest returns a FEC service over a database holding, for user 1
+// in January 2025, an invoice, its partial credit note and its payment,
+// and an invoice in US dollars.
+func setupFECTest(t *testing.T) *FECService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.Payment{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	db.Create(&models.CompanySettings{UserID: 1, Name: "Acme SARL", SIRET: "12345678900012", VATAccounts: "20=445711"})
+	globex := models.Client{UserID: 1, Name: "Globex"}
+	initech := models.Client{UserID: 1, Name: "Initech", Currency: models.CurrencyUSD}
+	db.Create(&globex)
+	db.Create(&initech)
+
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+	invoice := models.Invoice{
+		UserID: 1, ClientID: globex.ID, Number: "FA-2025-00001", Status: models.InvoiceStatusFinal, IssueDate: day(10),
+		Items: []models.InvoiceItem{
+			{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20},
+			{Description: "Book", Quantity: 1, UnitPrice: 2000, VATRate: 0.055},
+		},
+	}
+	db.Create(&invoice)
+	db.Create(&models.Invoice{
+		UserID: 1, ClientID: globex.ID, Number: "AV-2025-00001", Type: models.InvoiceTypeCreditNote, Status: models.InvoiceStatusFinal,
+		IssueDate: day(20), OriginalInvoiceID: &invoice.ID,
+		Items: []models.InvoiceItem{{Description: "Consulting", Quantity: -1, UnitPrice: 10000, VATRate: 0.20}},
+	})
+	db.Create(&models.Payment{UserID: 1, InvoiceID: invoice.ID, Amount: 50000, Date: day(15), Method: models.PaymentMethodBankTransfer})
+	db.Create(&models.Invoice{
+		UserID: 1, ClientID: initech.ID, Number: "FA-2025-00002", Status: models.InvoiceStatusFinal, IssueDate: day(12),
+		Currency: models.CurrencyUSD, BaseCurrency: models.CurrencyEUR, ExchangeRate: 0.9,
+		Items: []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20}},
+	})
+	db.Create(&models.Invoice{
+		UserID: 1, ClientID: globex.ID, Number: "DRAFT-1", Status: models.InvoiceStatusDraft, IssueDate: day(25),
+		Items: []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20}},
+	})
+	return NewFECService(db)
+}
+
+func TestFECService_Lines(t *testing.T) {
+	s := setupFECTest(t)
+
+	lines, err := s.Lines(1, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Lines() error = %v", err)
+	}
+
+	type key struct {
+		journal string
+		number  int
+		account string
+	}
+	got := make(map[key]FECLine)
+	balance := make(map[key]models.Money)
+	for _, l := range lines {
+		got[key{l.Journal, l.EntryNumber, l.Account}] = l
+		balance[key{l.Journal, l.EntryNumber, ""}] += l.Debit - l.Credit
+	}
+	for k, b := range balance {
+		if b != 0 {
+			t.Errorf("entry %s %d is unbalanced by %v", k.journal, k.number, b)
+		}
+	}
+	if len(balance) != 4 || len(lines) != 13 {
+		t.Fatalf("Lines() = %d lines in %d entries, want 13 in 4", len(lines), len(balance))
+	}
+
+	tests := []struct {
+		key           key
+		debit, credit models.Money
+		piece         string
+	}{
+		// Invoice: 1020.00 HT, VAT 200.00 at 20% and 1.10 at 5.5%
+		{key{"VT", 1, "411"}, 122110, 0, "FA-2025-00001"},
+		{key{"VT", 1, "445711"}, 0, 20000, "FA-2025-00001"},
+		{key{"VT", 1, "44571"}, 0, 110, "FA-2025-00001"},
+		// Dollar invoice at 0.9
+		{key{"VT", 2, "411"}, 108000, 0, "FA-2025-00002"},
+		{key{"VT", 2, "706"}, 0, 90000, "FA-2025-00002"},
+		// Payment
+		{key{"BQ", 1, "512"}, 50000, 0, "FA-2025-00001"},
+		{key{"BQ", 1, "411"}, 0, 50000, "FA-2025-00001"},
+		// Credit note, reversed
+		{key{"VT", 3, "411"}, 0, 12000, "AV-2025-00001"},
+		{key{"VT", 3, "706"}, 10000, 0, "AV-2025-00001"},
+	}
+	for _, tt := range tests {
+		l, ok := got[tt.key]
+		if !ok {
+			t.Errorf("no line %+v", tt.key)
+			continue
+		}
+		if l.Debit != tt.debit || l.Credit != tt.credit || l.PieceRef != tt.piece {
+			t.Errorf("line %+v = %v/%v %s, want %v/%v %s", tt.key, l.Debit, l.Credit, l.PieceRef, tt.debit, tt.credit, tt.piece)
+		}
+	}
+
+	client := got[key{"VT", 2, "411"}]
+	if client.AuxLabel != "Initech" || client.AuxAccount == "" || client.Currency != models.CurrencyUSD || client.ForeignAmount != 120000 {
+		t.Errorf("client line of the dollar invoice = %+v", client)
+	}
+}
+
+func TestWriteFEC(t *testing.T) {
+	s := setupFECTest(t)
+
+	var b strings.Builder
+	if err := s.Export(&b, 1, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 11, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	rows := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+	if len(rows) != 6 || !strings.HasPrefix(rows[0], "JournalCode|JournalLib|EcritureNum|EcritureDate|") {
+		t.Fatalf("Export() = %q", b.String())
+	}
+	want := "VT|Journal des ventes|1|20250110|411|Clients|C000001|Globex|FA-2025-00001|20250110|Facture FA-2025-00001 Globex|1221,10|0,00|||20250110||"
+	if rows[1] != want {
+		t.Errorf("first line = %q, want %q", rows[1], want)
+	}
+	for _, row := range rows {
+		if n := strings.Count(row, "|"); n != 17 {
+			t.Errorf("row %q has %d separators, want 17", row, n)
+		}
+	}
+
+	if name := s.FileName(1, time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)); name != "123456789FEC20251231.txt" {
+		t.Errorf("FileName() = %q", name)
+	}
+}
@@ -0,0 +1,446 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/validation"
+	"gorm.io/gorm"
+)
+
+// Import errors.
+var (
+	ErrImportFormat    = errors.New("file is not a CSV or XLSX table")
+	ErrImportEmpty     = errors.New("file has no rows to import")
+	ErrImportTooLarge  = errors.New("file has too many rows")
+	ErrImportUnmapped  = errors.New("a required field is not mapped to a column")
+	ErrImportRowErrors = errors.New("some rows are invalid")
+)
+
+// MaxImportRows is the number of rows imported at once.
+const MaxImportRows = 5000
+
+// ImportKind is the kind of records imported.
+type ImportKind string
+
+const (
+	ImportClients  ImportKind = "clients"
+	ImportProducts ImportKind = "products"
+)
+
+// importFields lists the fields that can be imported for each kind, in
+// display order, and the header names recognized for them.
+var importFields = map[ImportKind][]struct {
+	Name     string
+	Required bool
+	Aliases  []string
+}{
+	ImportClients: {
+		{"name", true, []string{"nom", "raison sociale", "client"}},
+		{"company", false, []string{"societe", "entreprise"}},
+		{"email", false, []string{"e-mail", "mail", "courriel"}},
+		{"phone", false, []string{"telephone", "tel"}},
+		{"address", false, []string{"adresse"}},
+		{"postal_code", false, []string{"code postal", "cp", "zip"}},
+		{"city", false, []string{"ville"}},
+		{"country", false, []string{"pays"}},
+		{"country_code", false, []string{"code pays"}},
+		{"siret", false, nil},
+		{"vat_number", false, []string{"tva intracommunautaire", "numero de tva", "n tva"}},
+		{"currency", false, []string{"devise"}},
+	},
+	ImportProducts: {
+		{"code", true, []string{"reference", "ref", "sku"}},
+		{"name", true, []string{"nom", "designation", "libelle"}},
+		{"description", false, nil},
+		{"unit_price", true, []string{"prix", "prix unitaire", "prix ht", "price"}},
+		{"unit", false, []string{"unite"}},
+		{"vat_rate", false, []string{"tva", "taux de tva", "vat"}},
+		{"category", false, []string{"categorie"}},
+	},
+}
+
+// Fields returns the names of the fields that can be imported.
+func (k ImportKind) Fields() []string {
+	var names []string
+	for _, f := range importFields[k] {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// IsRequired returns true if field must be mapped to a column.
+func (k ImportKind) IsRequired(field string) bool {
+	for _, f := range importFields[k] {
+		if f.Name == field {
+			return f.Required
+		}
+	}
+	return false
+}
+
+// ImportTable is the content of an uploaded file: a header row and the
+// rows below it.
+type ImportTable struct {
+	Headers []string   `json:"headers"`
+	Rows    [][]string `json:"rows"`
+}
+
+// ImportMapping maps field names to the index of their column.
+type ImportMapping map[string]int
+
+// ImportRow is the outcome of one row of the table.
+type ImportRow struct {
+	// Line is the line of the row in the file, the header being line 1.
+	Line   int
+	Values map[string]string
+	// Update is true when the row updates an existing record.
+	Update bool
+	Errors validation.Violations
+}
+
+// ImportResult summarizes the rows of an import.
+type ImportResult struct {
+	Rows    []ImportRow
+	Created int
+	Updated int
+	Invalid int
+}
+
+// Valid returns true if every row can be imported.
+func (r *ImportResult) Valid() bool {
+	return r.Invalid == 0
+}
+
+// ImportService imports clients and products from CSV and XLSX files.
+type ImportService struct {
+	db *gorm.DB
+}
+
+func NewImportService(db *gorm.DB) *ImportService {
+	return &ImportService{db: db}
+}
+
+// ReadTable reads an uploaded file, as XLSX if its name says so and as CSV
+// otherwise. The separator of CSV files is detected among comma,
+// semicolon and tab. Blank rows are skipped.
+func ReadTable(filename string, data []byte) (*ImportTable, error) {
+	var records [][]string
+	if strings.HasSuffix(strings.ToLower(filename), ".xlsx") {
+		var err error
+		if records, err = readXLSX(data); err != nil {
+			return nil, err
+		}
+	} else {
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+		r := csv.NewReader(bytes.NewReader(data))
+		r.Comma = csvSeparator(data)
+		r.FieldsPerRecord = -1
+		var err error
+		if records, err = r.ReadAll(); err != nil {
+			return nil, ErrImportFormat
+		}
+	}
+
+	table := &ImportTable{}
+	for _, record := range records {
+		blank := true
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+			blank = blank && record[i] == ""
+		}
+		switch {
+		case blank:
+		case table.Headers == nil:
+			table.Headers = record
+		default:
+			table.Rows = append(table.Rows, record)
+		}
+	}
+	if len(table.Rows) == 0 {
+		return nil, ErrImportEmpty
+	}
+	if len(table.Rows) > MaxImportRows {
+		return nil, ErrImportTooLarge
+	}
+	return table, nil
+}
+
+// csvSeparator guesses the separator from the first line.
+func csvSeparator(data []byte) rune {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	best, count := ',', bytes.Count(line, []byte(","))
+	for _, sep := range []rune{';', '\t'} {
+		if n := bytes.Count(line, []byte(string(sep))); n > count {
+			best, count = sep, n
+		}
+	}
+	return best
+}
+
+// GuessMapping maps the fields of kind to the columns whose header names
+// them, in English or French.
+func (k ImportKind) GuessMapping(headers []string) ImportMapping {
+	mapping := make(ImportMapping)
+	for col, header := range headers {
+		h := normalizeHeader(header)
+		for _, f := range importFields[k] {
+			if _, done := mapping[f.Name]; done {
+				continue
+			}
+			match := h == f.Name || h == strings.ReplaceAll(f.Name, "_", " ")
+			for _, alias := range f.Aliases {
+				match = match || h == alias
+			}
+			if match {
+				mapping[f.Name] = col
+				break
+			}
+		}
+	}
+	return mapping
+}
+
+// normalizeHeader lowercases a header and strips its accents and
+// punctuation.
+func normalizeHeader(s string) string {
+	replacer := strings.NewReplacer("é", "e", "è", "e", "ê", "e", "à", "a", "ô", "o", "ç", "c", "°", "")
+	s = replacer.Replace(strings.ToLower(strings.TrimSpace(s)))
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	}), " ")
+}
+
+// Preview validates the rows of a table as they would be imported, and
+// tells which ones update an existing record.
+func (s *ImportService) Preview(userID uint, kind ImportKind, table *ImportTable, mapping ImportMapping) (*ImportResult, error) {
+	result, _, err := s.prepare(s.db, userID, kind, table, mapping)
+	return result, err
+}
+
+// Import creates or updates the records of every row of a table, in a
+// single transaction. Clients are matched by email, then by SIRET, and
+// products by code. Nothing is imported if a row is invalid: the result
+// and ErrImportRowErrors are returned instead.
+func (s *ImportService) Import(userID uint, kind ImportKind, table *ImportTable, mapping ImportMapping) (*ImportResult, error) {
+	var result *ImportResult
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var records []any
+		var err error
+		result, records, err = s.prepare(tx, userID, kind, table, mapping)
+		if err != nil {
+			return err
+		}
+		if !result.Valid() {
+			return ErrImportRowErrors
+		}
+		for _, record := range records {
+			if err := tx.Save(record).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// prepare builds the record of every row, merged into the existing record
+// it matches, and validates it.
+func (s *ImportService) prepare(tx *gorm.DB, userID uint, kind ImportKind, table *ImportTable, mapping ImportMapping) (*ImportResult, []any, error) {
+	for _, f := range importFields[kind] {
+		if col, ok := mapping[f.Name]; f.Required && (!ok || col < 0 || col >= len(table.Headers)) {
+			return nil, nil, ErrImportUnmapped
+		}
+	}
+
+	var match func(values map[string]string) (record any, key string, update bool)
+	switch kind {
+	case ImportClients:
+		var clients []models.Client
+		if err := tx.Where("user_id = ?", userID).Find(&clients).Error; err != nil {
+			return nil, nil, err
+		}
+		byEmail := make(map[string]*models.Client)
+		bySIRET := make(map[string]*models.Client)
+		for i := range clients {
+			if c := &clients[i]; c.Email != "" {
+				byEmail[strings.ToLower(c.Email)] = c
+			}
+			if c := &clients[i]; c.SIRET != "" {
+				bySIRET[c.SIRET] = c
+			}
+		}
+		match = func(values map[string]string) (any, string, bool) {
+			email, siret := strings.ToLower(values["email"]), strings.ReplaceAll(values["siret"], " ", "")
+			if c, ok := byEmail[email]; ok && email != "" {
+				return c, "email:" + email, true
+			}
+			if c, ok := bySIRET[siret]; ok && siret != "" {
+				return c, "siret:" + siret, true
+			}
+			c := &models.Client{UserID: userID}
+			if email != "" {
+				byEmail[email] = c
+				return c, "email:" + email, false
+			}
+			if siret != "" {
+				bySIRET[siret] = c
+				return c, "siret:" + siret, false
+			}
+			return c, "", false
+		}
+	case ImportProducts:
+		var products []models.Product
+		if err := tx.Where("user_id = ?", userID).Find(&products).Error; err != nil {
+			return nil, nil, err
+		}
+		byCode := make(map[string]*models.Product)
+		for i := range products {
+			byCode[products[i].Code] = &products[i]
+		}
+		match = func(values map[string]string) (any, string, bool) {
+			code := strings.ToUpper(values["code"])
+			if p, ok := byCode[code]; ok {
+				return p, code, true
+			}
+			p := &models.Product{UserID: userID, Unit: "unit", VATRate: 0.20, IsActive: true}
+			if code != "" {
+				byCode[code] = p
+			}
+			return p, code, false
+		}
+	default:
+		return nil, nil, ErrImportFormat
+	}
+
+	result := &ImportResult{}
+	var records []any
+	seen := make(map[string]int)
+	for i, cells := range table.Rows {
+		row := ImportRow{Line: i + 2, Values: make(map[string]string), Errors: make(validation.Violations)}
+		for field, col := range mapping {
+			if col >= 0 && col < len(cells) {
+				row.Values[field] = cells[col]
+			}
+		}
+
+		record, key, update := match(row.Values)
+		row.Update = update
+		if line, dup := seen[key]; dup && key != "" {
+			row.Errors["file"] = "duplicate of line " + strconv.Itoa(line)
+		} else if key != "" {
+			seen[key] = row.Line
+		}
+		switch r := record.(type) {
+		case *models.Client:
+			applyClientRow(r, row.Values, row.Errors)
+		case *models.Product:
+			applyProductRow(r, row.Values, row.Errors)
+		}
+
+		if row.Errors.Empty() {
+			records = append(records, record)
+			if row.Update {
+				result.Updated++
+			} else {
+				result.Created++
+			}
+		} else {
+			result.Invalid++
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, records, nil
+}
+
+// applyClientRow sets the mapped fields of a client and validates it.
+func applyClientRow(c *models.Client, values map[string]string, v validation.Violations) {
+	set := func(field string, dst *string) {
+		if value, ok := values[field]; ok {
+			*dst = value
+		}
+	}
+	set("name", &c.Name)
+	set("company", &c.Company)
+	set("email", &c.Email)
+	set("phone", &c.Phone)
+	set("address", &c.Address)
+	set("postal_code", &c.PostalCode)
+	set("city", &c.City)
+	set("country", &c.Country)
+	set("vat_number", &c.VATNumber)
+	if siret, ok := values["siret"]; ok {
+		c.SIRET = strings.ReplaceAll(siret, " ", "")
+	}
+
+	validation.Required("name", c.Name, v)
+	if c.Email != "" && !strings.Contains(c.Email, "@") {
+		v["email"] = "invalid"
+	}
+	if _, err := strconv.ParseUint(c.SIRET, 10, 64); c.SIRET != "" && (len(c.SIRET) != 14 || err != nil) {
+		v["siret"] = "must be 14 digits"
+	}
+	if value, ok := values["country_code"]; ok {
+		code, valid := models.ParseCountryCode(value)
+		if !valid {
+			v["country_code"] = "must be 2 letters"
+		}
+		c.CountryCode = code
+	}
+	if value := values["currency"]; value != "" {
+		currency, ok := models.ParseCurrency(value)
+		if !ok {
+			v["currency"] = "unsupported"
+		}
+		c.Currency = currency
+	}
+}
+
+// applyProductRow sets the mapped fields of a product and validates it,
+// as the product form does.
+func applyProductRow(p *models.Product, values map[string]string, v validation.Violations) {
+	if code, ok := values["code"]; ok {
+		p.Code = strings.ToUpper(code)
+	}
+	if name, ok := values["name"]; ok {
+		p.Name = name
+	}
+	if description, ok := values["description"]; ok {
+		p.Description = description
+	}
+	if unit := values["unit"]; unit != "" {
+		p.Unit = unit
+	}
+	if category, ok := values["category"]; ok {
+		p.Category = category
+	}
+	if value, ok := values["unit_price"]; ok {
+		price, err := models.ParseMoney(strings.TrimSpace(strings.TrimSuffix(value, "€")))
+		if err != nil {
+			v["unit_price"] = "invalid"
+		}
+		p.UnitPrice = price
+	}
+	if value := strings.TrimSpace(strings.TrimSuffix(values["vat_rate"], "%")); value != "" {
+		rate, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		// Rates are accepted in percent too (20 -> 0.20)
+		if rate > 1 {
+			rate = rate / 100
+		}
+		if err != nil || rate < 0 || rate >= 1 {
+			v["vat_rate"] = "must be a fraction between 0 and 1"
+		}
+		p.VATRate = rate
+	}
+
+	validation.Required("code", p.Code, v)
+	validation.Required("name", p.Name, v)
+	if _, invalid := v["unit_price"]; !invalid {
+		validation.PositiveFloat("unit_price", p.UnitPrice.Float64(), v)
+	}
+}
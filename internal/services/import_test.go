@@ -0,0 +1,173 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupImportTest returns an import service over a database holding, for
+// user 1, a client with an email and a product.
+func setupImportTest(t *testing.T) (*ImportService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Client{}, &models.Product{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	db.Create(&models.Client{UserID: 1, Name: "Globex", Email: "billing@globex.test"})
+	db.Create(&models.Product{UserID: 1, Code: "CONS", Name: "Consulting", UnitPrice: 50000, Unit: "day", VATRate: 0.20, IsActive: true})
+	return NewImportService(db), db
+}
+
+func TestReadTable_CSV(t *testing.T) {
+	data := []byte("\xef\xbb\xbfNom;E-mail;Ville\nInitech;contact@initech.test;Lyon\n;;\nHooli;;Paris\n")
+	table, err := ReadTable("clients.csv", data)
+	if err != nil {
+		t.Fatalf("ReadTable() error = %v", err)
+	}
+	want := &ImportTable{
+		Headers: []string{"Nom", "E-mail", "Ville"},
+		Rows:    [][]string{{"Initech", "contact@initech.test", "Lyon"}, {"Hooli", "", "Paris"}},
+	}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("ReadTable() = %+v, want %+v", table, want)
+	}
+
+	mapping := ImportClients.GuessMapping(table.Headers)
+	if !reflect.DeepEqual(mapping, ImportMapping{"name": 0, "email": 1, "city": 2}) {
+		t.Errorf("GuessMapping() = %v", mapping)
+	}
+
+	if _, err := ReadTable("empty.csv", []byte("name,email\n")); !errors.Is(err, ErrImportEmpty) {
+		t.Errorf("ReadTable() of a header only error = %v, want ErrImportEmpty", err)
+	}
+}
+
+func TestReadTable_XLSX(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]string{
+		"xl/sharedStrings.xml": `<sst><si><t>Code</t></si><si><t>Prix</t></si><si><r><t>Dev</t></r><r><t>elopment</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>
+			<row r="3"><c r="A3" t="inlineStr"><is><t>DEV</t></is></c><c r="B3" t="s"><v>2</v></c><c r="C3"><v>450.5</v></c></row>
+		</sheetData></worksheet>`,
+	}
+	for name, content := range files {
+		f, _ := zw.Create(name)
+		f.Write([]byte(content))
+	}
+	zw.Close()
+
+	table, err := ReadTable("products.xlsx", buf.Bytes())
+	if err != nil {
+		t.Fatalf("ReadTable() error = %v", err)
+	}
+	want := &ImportTable{
+		Headers: []string{"Code", "", "Prix"},
+		Rows:    [][]string{{"DEV", "Development", "450.5"}},
+	}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("ReadTable() = %+v, want %+v", table, want)
+	}
+
+	if _, err := ReadTable("products.xlsx", []byte("not a zip")); !errors.Is(err, ErrImportFormat) {
+		t.Errorf("ReadTable() of a bad file error = %v, want ErrImportFormat", err)
+	}
+}
+
+func TestImportService_Import(t *testing.T) {
+	s, db := setupImportTest(t)
+
+	table := &ImportTable{
+		Headers: []string{"code", "name", "unit_price", "vat_rate"},
+		Rows: [][]string{
+			{"cons", "Consulting", "600", "20"},
+			{"TRAIN", "Training", "1200,50", "0.2"},
+		},
+	}
+	mapping := ImportProducts.GuessMapping(table.Headers)
+
+	result, err := s.Import(1, ImportProducts, table, mapping)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if result.Created != 1 || result.Updated != 1 || !result.Valid() {
+		t.Errorf("Import() = %+v, want 1 created and 1 updated", result)
+	}
+	var products []models.Product
+	db.Where("user_id = ?", 1).Order("code").Find(&products)
+	if len(products) != 2 || products[0].Code != "CONS" || products[0].UnitPrice != 60000 || products[0].Unit != "day" ||
+		products[1].Code != "TRAIN" || products[1].UnitPrice != 120050 {
+		t.Errorf("products = %+v", products)
+	}
+
+	// An invalid row rolls the whole import back
+	table.Rows = [][]string{
+		{"NEW", "New", "10", ""},
+		{"BAD", "", "-5", "150"},
+		{"new", "Again", "10", ""},
+	}
+	result, err = s.Import(1, ImportProducts, table, mapping)
+	if !errors.Is(err, ErrImportRowErrors) {
+		t.Fatalf("Import() error = %v, want ErrImportRowErrors", err)
+	}
+	if result.Invalid != 2 {
+		t.Errorf("Import() invalid = %d, want 2", result.Invalid)
+	}
+	for _, field := range []string{"name", "unit_price", "vat_rate"} {
+		if _, ok := result.Rows[1].Errors[field]; !ok {
+			t.Errorf("row 3 has no error on %s: %v", field, result.Rows[1].Errors)
+		}
+	}
+	if _, ok := result.Rows[2].Errors["file"]; !ok {
+		t.Errorf("duplicate row has no error: %v", result.Rows[2].Errors)
+	}
+	var count int64
+	db.Model(&models.Product{}).Count(&count)
+	if count != 2 {
+		t.Errorf("%d products after a failed import, want 2", count)
+	}
+
+	if _, err := s.Preview(1, ImportProducts, table, ImportMapping{"code": 0}); !errors.Is(err, ErrImportUnmapped) {
+		t.Errorf("Preview() error = %v, want ErrImportUnmapped", err)
+	}
+}
+
+func TestImportService_Preview_Clients(t *testing.T) {
+	s, _ := setupImportTest(t)
+
+	table := &ImportTable{
+		Headers: []string{"Raison sociale", "Courriel", "SIRET"},
+		Rows: [][]string{
+			{"Globex Corp", "Billing@Globex.test", ""},
+			{"Initech", "", "123 456 789 00012"},
+			{"Hooli", "hooli", "123"},
+		},
+	}
+	result, err := s.Preview(1, ImportClients, table, ImportClients.GuessMapping(table.Headers))
+	if err != nil {
+		t.Fatalf("Preview() error = %v", err)
+	}
+	if !result.Rows[0].Update || result.Rows[1].Update {
+		t.Errorf("Preview() updates = %v %v, want true false", result.Rows[0].Update, result.Rows[1].Update)
+	}
+	if _, ok := result.Rows[2].Errors["email"]; !ok {
+		t.Errorf("row 4 has no error on email: %v", result.Rows[2].Errors)
+	}
+	if _, ok := result.Rows[2].Errors["siret"]; !ok {
+		t.Errorf("row 4 has no error on siret: %v", result.Rows[2].Errors)
+	}
+	if result.Created != 1 || result.Updated != 1 || result.Invalid != 1 {
+		t.Errorf("Preview() = %+v", result)
+	}
+}
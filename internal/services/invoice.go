@@ -1,42 +1,259 @@
 package services
 
 import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/einvoice"
 	"github.com/diewo77/go-invoices/internal/models"
 	"gorm.io/gorm"
 )
 
+// Invoice lifecycle errors.
+var (
+	ErrInvoiceNotDraft = errors.New("invoice is not a draft")
+	ErrInvoiceEmpty    = errors.New("invoice has no items")
+	ErrInvoiceNotFinal = errors.New("invoice is not finalized")
+)
+
 type InvoiceService struct {
-	db *gorm.DB
+	db        *gorm.DB
+	numbering *NumberingService
+	rates     RateProvider
 }
 
-func NewInvoiceService(db *gorm.DB) *InvoiceService {
-	return &InvoiceService{db: db}
+func NewInvoiceService(db *gorm.DB, numbering *NumberingService, rates RateProvider) *InvoiceService {
+	return &InvoiceService{db: db, numbering: numbering, rates: rates}
 }
 
-// ComputeTotals calculates HT, TVA, and TTC for an invoice.
-func (s *InvoiceService) ComputeTotals(inv *models.Invoice) (ht, tva, ttc float64) {
-	for _, item := range inv.Items {
-		ht += item.TotalHT()
-		tva += item.TotalVAT()
-	}
+// ComputeTotals calculates HT, TVA, and TTC for an invoice, applying its
+// rounding policy.
+func (s *InvoiceService) ComputeTotals(inv *models.Invoice) (ht, tva, ttc models.Money) {
+	ht = inv.TotalHT()
+	tva = inv.TotalVAT()
 	ttc = ht + tva
 	return
 }
 
-// GetRevenue calculates the total revenue from paid invoices for a user.
-func (s *InvoiceService) GetRevenue(userID uint) (float64, error) {
+// VATBreakdown returns the VAT summary of an invoice, one line per rate.
+func (s *InvoiceService) VATBreakdown(inv *models.Invoice) []models.VATLine {
+	return inv.VATBreakdown()
+}
+
+// Finalize assigns the next number of the user's invoice sequence and locks the invoice,
+// freezing the rounding policy in force at that time and the exchange rate
+// of its currency to the company's. Deposits taken on the invoice are
+// deducted first.
+// Numbering, the status change and the seal share one transaction, so a
+// failed finalization never consumes a number.
+func (s *InvoiceService) Finalize(userID, invoiceID uint) (*models.Invoice, error) {
+	// Rate providers may query outside the database, so the rate is looked
+	// up before the transaction
+	currency, base, rate, err := s.exchangeRate(userID, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var invoice models.Invoice
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", invoiceID, userID).Preload("Client").Preload("Items").First(&invoice).Error; err != nil {
+			return err
+		}
+		if !invoice.IsDraft() {
+			return ErrInvoiceNotDraft
+		}
+		if !invoice.HasLines() {
+			return ErrInvoiceEmpty
+		}
+
+		switch {
+		case invoice.IsDeposit() && invoice.ParentInvoiceID != nil:
+			var parent models.Invoice
+			if err := tx.Select("status").First(&parent, *invoice.ParentInvoiceID).Error; err == nil && !parent.IsDraft() {
+				return ErrDepositParentFinal
+			}
+		case invoice.CanTakeDeposits():
+			if err := s.deductDeposits(tx, &invoice); err != nil {
+				return err
+			}
+		}
+
+		date := invoice.IssueDate
+		if date.IsZero() {
+			date = time.Now()
+			invoice.IssueDate = date
+		}
+
+		// Every finalized invoice must be exportable as an e-invoice
+		company := companySettings(tx, userID)
+		if err := einvoice.Validate(&invoice, &company); err != nil {
+			return err
+		}
+
+		number, err := s.numbering.Next(tx, userID, models.DocumentTypeInvoice, date)
+		if err != nil {
+			return err
+		}
+
+		rounding := company.Rounding.OrDefault()
+
+		// Guard on the status so a concurrent finalization of the same draft
+		// cannot allocate a second number.
+		res := tx.Model(&models.Invoice{}).
+			Where("id = ? AND status = ?", invoice.ID, models.InvoiceStatusDraft).
+			Updates(map[string]any{
+				"number": number, "status": models.InvoiceStatusFinal, "rounding": rounding,
+				"currency": currency, "base_currency": base, "exchange_rate": rate,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvoiceNotDraft
+		}
+
+		invoice.Number = number
+		invoice.Status = models.InvoiceStatusFinal
+		invoice.Rounding = rounding
+		invoice.Currency, invoice.BaseCurrency, invoice.ExchangeRate = currency, base, rate
+
+		sealed, err := sealInvoice(tx, invoice.ID)
+		if err != nil {
+			return err
+		}
+		invoice.ClientSnapshot, invoice.CompanySnapshot = sealed.ClientSnapshot, sealed.CompanySnapshot
+		invoice.Items = sealed.Items
+		invoice.SealSequence, invoice.SealHash, invoice.SealPrevHash, invoice.SealedAt =
+			sealed.SealSequence, sealed.SealHash, sealed.SealPrevHash, sealed.SealedAt
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// exchangeRate returns the currency of a draft invoice, the base currency
+// of its issuer and the rate between them at the issue date.
+func (s *InvoiceService) exchangeRate(userID, invoiceID uint) (currency, base models.Currency, rate float64, err error) {
+	var invoice models.Invoice
+	if err = s.db.Select("status", "currency", "issue_date").Where("id = ? AND user_id = ?", invoiceID, userID).First(&invoice).Error; err != nil {
+		return "", "", 0, err
+	}
+	if !invoice.IsDraft() {
+		return "", "", 0, ErrInvoiceNotDraft
+	}
+	company := companySettings(s.db, userID)
+	currency, base, rate = invoice.Currency.OrDefault(), company.Currency.OrDefault(), 1
+	if currency == base {
+		return currency, base, rate, nil
+	}
+	date := invoice.IssueDate
+	if date.IsZero() {
+		date = time.Now()
+	}
+	rate, err = s.rates.Rate(userID, currency, base, date)
+	return currency, base, rate, err
+}
+
+// RoundingPolicy returns the VAT rounding policy configured by a user,
+// applied to their new invoices.
+func (s *InvoiceService) RoundingPolicy(userID uint) models.RoundingPolicy {
+	company := companySettings(s.db, userID)
+	return company.Rounding.OrDefault()
+}
+
+// Currency returns the currency of new invoices of a user for a client:
+// the client's, or the company's if the client has none.
+func (s *InvoiceService) Currency(userID, clientID uint) models.Currency {
+	return invoiceCurrency(s.db, userID, clientID)
+}
+
+func invoiceCurrency(db *gorm.DB, userID, clientID uint) models.Currency {
+	var client models.Client
+	db.Select("currency").Where("id = ? AND user_id = ?", clientID, userID).Limit(1).Find(&client)
+	if client.Currency != "" {
+		return client.Currency
+	}
+	company := companySettings(db, userID)
+	return company.Currency.OrDefault()
+}
+
+// BaseCurrency returns the currency in which a user's revenue is reported.
+func (s *InvoiceService) BaseCurrency(userID uint) models.Currency {
+	company := companySettings(s.db, userID)
+	return company.Currency.OrDefault()
+}
+
+// companySettings loads the settings of a user, or zero settings if they
+// were never saved.
+func companySettings(db *gorm.DB, userID uint) models.CompanySettings {
+	var company models.CompanySettings
+	db.Where("user_id = ?", userID).Limit(1).Find(&company)
+	return company
+}
+
+// GetRevenue returns the cash actually collected by a user, i.e. the sum of
+// all payments received, in the base currency at the exchange rate of
+// their invoice.
+func (s *InvoiceService) GetRevenue(userID uint) (models.Money, error) {
+	var payments []struct {
+		Amount       models.Money
+		Currency     models.Currency
+		BaseCurrency models.Currency
+		ExchangeRate float64
+	}
+	err := s.db.Model(&models.Payment{}).
+		Select("payments.amount, invoices.currency, invoices.base_currency, invoices.exchange_rate").
+		Joins("JOIN invoices ON invoices.id = payments.invoice_id").
+		Where("payments.user_id = ?", userID).
+		Scan(&payments).Error
+	if err != nil {
+		return 0, err
+	}
+
+	// Each payment is converted and rounded to the cent on its own, the
+	// way it was booked, and the cents are added up exactly
+	var total models.Money
+	for _, p := range payments {
+		invoice := models.Invoice{Currency: p.Currency, BaseCurrency: p.BaseCurrency, ExchangeRate: p.ExchangeRate}
+		amount := invoice.ToBase(p.Amount)
+		if (amount > 0 && total > math.MaxInt64-amount) || (amount < 0 && total < math.MinInt64-amount) {
+			return 0, models.ErrMoneyOverflow
+		}
+		total += amount
+	}
+	return total, nil
+}
+
+// ClientBalance returns what a client still owes: everything issued to them
+// (invoices net of credit notes) minus what they paid. A negative balance
+// means a refund is due.
+func (s *InvoiceService) ClientBalance(userID, clientID uint) (models.Money, error) {
 	var invoices []models.Invoice
-	err := s.db.Where("user_id = ? AND status = ?", userID, models.InvoiceStatusPaid).
+	err := s.db.Where("user_id = ? AND client_id = ? AND status != ?", userID, clientID, models.InvoiceStatusDraft).
 		Preload("Items").
 		Find(&invoices).Error
 	if err != nil {
 		return 0, err
 	}
 
-	var total float64
+	var issued models.Money
 	for _, inv := range invoices {
 		_, _, ttc := s.ComputeTotals(&inv)
-		total += ttc
+		issued += ttc
 	}
-	return total, nil
+
+	var paid models.Money
+	err = s.db.Model(&models.Payment{}).
+		Select("COALESCE(SUM(payments.amount), 0)").
+		Joins("JOIN invoices ON invoices.id = payments.invoice_id").
+		Where("payments.user_id = ? AND invoices.client_id = ?", userID, clientID).
+		Scan(&paid).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return issued - paid, nil
 }
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"errors"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/mail"
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+)
+
+// Invoice email errors.
+var (
+	// ErrNoClientEmail is returned when emailing a client without address.
+	ErrNoClientEmail    = errors.New("client has no email address")
+	ErrInvalidRecipient = errors.New("invalid recipient email address")
+)
+
+// invoiceTemplate is the email template of invoices sent from the app.
+const invoiceTemplate = "invoice.txt"
+
+// SendInvoiceRequest describes an invoice email.
+type SendInvoiceRequest struct {
+	// To overrides the client's email address.
+	To string
+	// Message is an optional note added to the templated text.
+	Message string
+	// MarkSent records the invoice as sent to the client.
+	MarkSent bool
+}
+
+// InvoiceEmailService emails finalized invoices to clients with their PDF
+// and keeps the history of the emails sent.
+type InvoiceEmailService struct {
+	db        *gorm.DB
+	archive   *ArchiveService
+	mailer    mail.Mailer
+	from      string
+	templates string
+}
+
+func NewInvoiceEmailService(db *gorm.DB, archive *ArchiveService, mailer mail.Mailer, from string) *InvoiceEmailService {
+	return &InvoiceEmailService{db: db, archive: archive, mailer: mailer, from: from, templates: EmailTemplateDir}
+}
+
+// Send emails an invoice of userID on behalf of senderID. The attempt is
+// recorded whatever its outcome; when the mail server refuses the
+// message, the record is returned along with the error.
+func (s *InvoiceEmailService) Send(ctx context.Context, userID, senderID, invoiceID uint, req SendInvoiceRequest) (*models.InvoiceEmail, error) {
+	var invoice models.Invoice
+	if err := s.db.Where("id = ? AND user_id = ?", invoiceID, userID).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("OriginalInvoice").
+		Preload("PenalizedInvoice").
+		First(&invoice).Error; err != nil {
+		return nil, err
+	}
+	if invoice.IsDraft() {
+		return nil, ErrInvoiceNotFinal
+	}
+
+	to := strings.TrimSpace(req.To)
+	if to == "" && invoice.Client != nil {
+		to = invoice.Client.Email
+	}
+	if to == "" {
+		return nil, ErrNoClientEmail
+	}
+	address, err := netmail.ParseAddress(to)
+	if err != nil {
+		return nil, ErrInvalidRecipient
+	}
+	to = address.Address
+
+	company := companySettings(s.db, userID)
+	subject, body, err := renderEmail(s.templates, invoiceTemplate, emailLanguage, map[string]any{
+		"Company": &company,
+		"Client":  invoice.Client,
+		"Invoice": &invoice,
+		"Message": strings.TrimSpace(req.Message),
+	})
+	if err != nil {
+		return nil, err
+	}
+	pdf, err := s.archive.PDF(ctx, &invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &mail.Message{
+		ID:      mail.NewMessageID(s.from),
+		From:    s.from,
+		To:      []string{to},
+		ReplyTo: company.Email,
+		Subject: subject,
+		Text:    body,
+		Attachments: []mail.Attachment{
+			{Filename: invoice.Number + ".pdf", ContentType: "application/pdf", Data: pdf},
+		},
+	}
+	sendErr := s.mailer.Send(ctx, msg)
+
+	record := models.InvoiceEmail{
+		UserID:    userID,
+		InvoiceID: invoice.ID,
+		SentByID:  senderID,
+		Recipient: to,
+		Subject:   subject,
+		MessageID: msg.ID,
+	}
+	if sendErr != nil {
+		record.Error = truncate(sendErr.Error(), 500)
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+	if sendErr != nil {
+		return &record, sendErr
+	}
+
+	if req.MarkSent && invoice.SentAt == nil {
+		if err := s.db.Model(&models.Invoice{}).
+			Where("id = ? AND sent_at IS NULL", invoice.ID).
+			Update("sent_at", time.Now()).Error; err != nil {
+			return &record, err
+		}
+	}
+	return &record, nil
+}
+
+// History returns the emails sent for an invoice, newest first, with the
+// user who sent them.
+func (s *InvoiceEmailService) History(userID, invoiceID uint) ([]models.InvoiceEmail, error) {
+	var emails []models.InvoiceEmail
+	err := s.db.Where("user_id = ? AND invoice_id = ?", userID, invoiceID).
+		Preload("SentBy").
+		Order("id DESC").
+		Find(&emails).Error
+	return emails, err
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/mail"
+	"github.com/diewo77/go-invoices/internal/mail/mailtest"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupInvoiceEmailTest returns an invoice email service sending through a
+// fake SMTP server, over a database holding a final invoice of user 1.
+func setupInvoiceEmailTest(t *testing.T) (*gorm.DB, *InvoiceEmailService, *mailtest.Server, *models.Invoice) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.CompanySettings{}, &models.Client{}, &models.Invoice{},
+		&models.InvoiceItem{}, &models.InvoiceEmail{}, &models.ArchivedDocument{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	db.Create(&models.User{ID: 1, Email: "owner@acme.test", Name: "Owner", Password: "x"})
+	db.Create(&models.CompanySettings{UserID: 1, Name: "Acme SARL", Email: "contact@acme.test"})
+	client := models.Client{UserID: 1, Name: "Globex", Email: "ap@globex.test"}
+	db.Create(&client)
+	invoice := models.Invoice{
+		UserID: 1, ClientID: client.ID, Number: "FA-2025-00001", Status: models.InvoiceStatusFinal,
+		IssueDate: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		DueDate:   time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		Items:     []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20}},
+	}
+	db.Create(&invoice)
+
+	server := mailtest.NewServer(t)
+	mailer := mail.NewSMTPMailer(server.Host, server.Port, "", "")
+	s := NewInvoiceEmailService(db, NewArchiveService(db, NewPDFService(db), storage.NewMemoryStore()), mailer, "Acme <billing@acme.test>")
+	s.templates = "../../templates/emails"
+	return db, s, server, &invoice
+}
+
+func TestInvoiceEmailService_Send(t *testing.T) {
+	db, s, server, invoice := setupInvoiceEmailTest(t)
+
+	record, err := s.Send(context.Background(), 1, 1, invoice.ID, SendInvoiceRequest{Message: "Merci pour votre confiance", MarkSent: true})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !record.Sent() || record.Recipient != "ap@globex.test" || record.MessageID == "" || record.SentByID != 1 {
+		t.Errorf("record = %+v", record)
+	}
+
+	received := server.Messages()
+	if len(received) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(received))
+	}
+	data := received[0].Data
+	for _, want := range []string{"Message-ID: " + record.MessageID, "Reply-To: contact@acme.test", "filename=FA-2025-00001.pdf"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("message lacks %q", want)
+		}
+	}
+	if !strings.Contains(record.Subject, "FA-2025-00001") || !strings.Contains(record.Subject, "Acme SARL") {
+		t.Errorf("Subject = %q", record.Subject)
+	}
+
+	var saved models.Invoice
+	db.First(&saved, invoice.ID)
+	if saved.SentAt == nil {
+		t.Error("invoice not marked as sent")
+	}
+
+	history, err := s.History(1, invoice.ID)
+	if err != nil || len(history) != 1 || history[0].SentBy == nil || history[0].SentBy.Name != "Owner" {
+		t.Errorf("History() = %+v, %v", history, err)
+	}
+}
+
+func TestInvoiceEmailService_SendErrors(t *testing.T) {
+	db, s, server, invoice := setupInvoiceEmailTest(t)
+	ctx := context.Background()
+
+	if _, err := s.Send(ctx, 2, 2, invoice.ID, SendInvoiceRequest{}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Send() by another user error = %v, want ErrRecordNotFound", err)
+	}
+
+	db.Model(&models.Client{}).Where("id = ?", invoice.ClientID).Update("email", "")
+	if _, err := s.Send(ctx, 1, 1, invoice.ID, SendInvoiceRequest{}); !errors.Is(err, ErrNoClientEmail) {
+		t.Errorf("Send() without address error = %v, want ErrNoClientEmail", err)
+	}
+
+	for _, to := range []string{"not an address", "ap@globex.test\r\nBcc: all@example.com"} {
+		if _, err := s.Send(ctx, 1, 1, invoice.ID, SendInvoiceRequest{To: to}); !errors.Is(err, ErrInvalidRecipient) {
+			t.Errorf("Send(to %q) error = %v, want ErrInvalidRecipient", to, err)
+		}
+	}
+
+	// Refused messages are recorded, and the invoice is not marked as sent
+	server.Reject("550 mailbox unavailable")
+	record, err := s.Send(ctx, 1, 1, invoice.ID, SendInvoiceRequest{To: "typo@globex.test", MarkSent: true})
+	if err == nil || record == nil || record.Sent() || !strings.Contains(record.Error, "mailbox unavailable") {
+		t.Errorf("Send() refused = %+v, %v", record, err)
+	}
+	var saved models.Invoice
+	db.First(&saved, invoice.ID)
+	if saved.SentAt != nil {
+		t.Error("invoice marked as sent after a failure")
+	}
+
+	db.Model(invoice).Update("status", models.InvoiceStatusDraft)
+	if _, err := s.Send(ctx, 1, 1, invoice.ID, SendInvoiceRequest{To: "ap@globex.test"}); !errors.Is(err, ErrInvoiceNotFinal) {
+		t.Errorf("Send() of a draft error = %v, want ErrInvoiceNotFinal", err)
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/validation"
+)
+
+// ValidateItem normalizes and validates an invoice item before it is
+// saved, from the web, the API or an imported e-invoice. Section titles
+// and subtotals keep their description only.
+func ValidateItem(item *models.InvoiceItem, v validation.Violations) {
+	item.Description = strings.TrimSpace(item.Description)
+	if item.Kind == "" {
+		item.Kind = models.ItemKindLine
+	}
+	if !item.Kind.IsValid() {
+		v["kind"] = "must be line, section or subtotal"
+		return
+	}
+
+	if !item.IsLine() {
+		if item.IsSection() {
+			validation.Required("description", item.Description, v)
+		}
+		item.ProductID = nil
+		item.UnitPrice, item.VATRate = 0, 0
+		item.DiscountRate, item.DiscountAmount = 0, 0
+		return
+	}
+
+	// Ranges are checked so that NaN, which fails every comparison, is out
+	validation.Required("description", item.Description, v)
+	if item.UnitPrice < 0 {
+		v["unit_price"] = "must not be negative"
+	}
+	if !(item.Quantity > 0) {
+		v["quantity"] = "must be positive"
+	} else if _, err := item.UnitPrice.MulChecked(item.Quantity); err != nil {
+		v["quantity"] = "is too large"
+	}
+	if !(item.VATRate >= 0 && item.VATRate < 1) {
+		v["vat_rate"] = "must be a fraction between 0 and 1"
+	}
+	switch {
+	case !(item.DiscountRate >= 0 && item.DiscountRate <= 1):
+		v["discount_rate"] = "must be a fraction between 0 and 1"
+	case item.DiscountRate != 0 && item.DiscountAmount != 0:
+		v["discount_amount"] = "cannot be combined with a discount rate"
+	case item.DiscountAmount < 0 || item.DiscountAmount > item.GrossHT():
+		v["discount_amount"] = "must be between 0 and the line total"
+	}
+}
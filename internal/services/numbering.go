@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrResetLocked is returned when the reset policy of a sequence changes
+// after numbers were issued from it.
+var ErrResetLocked = errors.New("reset cannot change once numbers have been issued")
+
+// NumberingService allocates gap-free document numbers from per-user sequences.
+type NumberingService struct {
+	db *gorm.DB
+}
+
+func NewNumberingService(db *gorm.DB) *NumberingService {
+	return &NumberingService{db: db}
+}
+
+// Sequence returns the user's configuration for docType, or the default one if none was saved.
+func (s *NumberingService) Sequence(userID uint, docType models.DocumentType) (models.NumberingSequence, error) {
+	return s.sequence(s.db, userID, docType)
+}
+
+// CheckSequence validates a sequence configuration before it is saved.
+// Counters are kept per period, so the pattern may change at any time. The
+// reset policy may not once numbers were issued: the next document would
+// count in another period, from 1 again, and could repeat a number.
+func (s *NumberingService) CheckSequence(seq *models.NumberingSequence) error {
+	if err := seq.Validate(); err != nil {
+		return err
+	}
+	current, err := s.sequence(s.db, seq.UserID, seq.DocumentType)
+	if err != nil || current.Reset == seq.Reset {
+		return err
+	}
+	var issued int64
+	if err := s.db.Model(&models.NumberingCounter{}).
+		Where("user_id = ? AND document_type = ? AND last_value > 0", seq.UserID, seq.DocumentType).
+		Count(&issued).Error; err != nil {
+		return err
+	}
+	if issued > 0 {
+		return ErrResetLocked
+	}
+	return nil
+}
+
+// SaveSequence checks and stores a sequence configuration.
+func (s *NumberingService) SaveSequence(seq *models.NumberingSequence) error {
+	if err := s.CheckSequence(seq); err != nil {
+		return err
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "document_type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"pattern", "prefix", "reset", "updated_at"}),
+	}).Create(seq).Error
+}
+
+// Peek returns the number the next allocation would produce, without consuming it.
+func (s *NumberingService) Peek(userID uint, docType models.DocumentType, date time.Time) (string, error) {
+	seq, err := s.sequence(s.db, userID, docType)
+	if err != nil {
+		return "", err
+	}
+	var counter models.NumberingCounter
+	err = s.db.Where("user_id = ? AND document_type = ? AND period = ?", userID, docType, seq.Period(date)).
+		First(&counter).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	return seq.FormatNumber(date, counter.LastValue+1), nil
+}
+
+// Next allocates the next number for a document dated at date.
+// It must run inside the transaction that stores the numbered document: if that
+// transaction rolls back, so does the counter, which keeps the sequence gap-free.
+func (s *NumberingService) Next(tx *gorm.DB, userID uint, docType models.DocumentType, date time.Time) (string, error) {
+	seq, err := s.sequence(tx, userID, docType)
+	if err != nil {
+		return "", err
+	}
+
+	counter := models.NumberingCounter{
+		UserID:       userID,
+		DocumentType: docType,
+		Period:       seq.Period(date),
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&counter).Error; err != nil {
+		return "", err
+	}
+
+	// The increment row-locks the counter until the surrounding transaction ends,
+	// which serializes concurrent allocations on the same sequence.
+	scope := tx.Model(&models.NumberingCounter{}).
+		Where("user_id = ? AND document_type = ? AND period = ?", userID, docType, counter.Period)
+	if err := scope.Update("last_value", gorm.Expr("last_value + 1")).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Where("user_id = ? AND document_type = ? AND period = ?", userID, docType, counter.Period).
+		First(&counter).Error; err != nil {
+		return "", err
+	}
+
+	return seq.FormatNumber(date, counter.LastValue), nil
+}
+
+func (s *NumberingService) sequence(db *gorm.DB, userID uint, docType models.DocumentType) (models.NumberingSequence, error) {
+	var seq models.NumberingSequence
+	err := db.Where("user_id = ? AND document_type = ?", userID, docType).First(&seq).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DefaultNumberingSequence(userID, docType), nil
+	}
+	return seq, err
+}
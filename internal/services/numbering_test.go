@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupNumberingTest returns the numbering and invoice services over a
+// database holding the settings and a client of user 1, and a function
+// creating a one-line draft for that client.
+func setupNumberingTest(t *testing.T) (*NumberingService, *InvoiceService, func(number string, date time.Time, items []models.InvoiceItem) *models.Invoice) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.Payment{}, &models.NumberingSequence{}, &models.NumberingCounter{}, &models.InvoiceSealHead{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	db.Create(&models.CompanySettings{
+		UserID: 1, Name: "Acme SARL", Country: "France", SIRET: "12345678900012", VATNumber: "FR12345678900",
+	})
+	client := models.Client{UserID: 1, Name: "Globex", Country: "France", SIRET: "98765432100019"}
+	db.Create(&client)
+
+	draft := func(number string, date time.Time, items []models.InvoiceItem) *models.Invoice {
+		if items == nil {
+			items = []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20}}
+		}
+		invoice := models.Invoice{
+			UserID: 1, ClientID: client.ID, Number: number, Status: models.InvoiceStatusDraft,
+			IssueDate: date, DueDate: date.AddDate(0, 1, 0), Items: items,
+		}
+		db.Create(&invoice)
+		return &invoice
+	}
+	numbering := NewNumberingService(db)
+	return numbering, NewInvoiceService(db, numbering, NewManualRateProvider(db)), draft
+}
+
+func TestInvoiceService_FinalizeNumbering(t *testing.T) {
+	numbering, s, draft := setupNumberingTest(t)
+	march := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Numbers follow each other within a year and restart the next one
+	for _, tc := range []struct {
+		draft string
+		date  time.Time
+		want  string
+	}{
+		{"DRAFT-1", march, "FA-2025-00001"},
+		{"DRAFT-2", time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC), "FA-2025-00002"},
+		{"DRAFT-3", time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC), "FA-2026-00001"},
+	} {
+		final, err := s.Finalize(1, draft(tc.draft, tc.date, nil).ID)
+		if err != nil {
+			t.Fatalf("Finalize() error = %v", err)
+		}
+		if final.Number != tc.want {
+			t.Errorf("Number = %q, want %q", final.Number, tc.want)
+		}
+	}
+
+	// A failed finalization does not consume a number
+	empty := draft("DRAFT-4", march, []models.InvoiceItem{})
+	if _, err := s.Finalize(1, empty.ID); !errors.Is(err, ErrInvoiceEmpty) {
+		t.Fatalf("Finalize(empty) error = %v, want ErrInvoiceEmpty", err)
+	}
+	if next, _ := numbering.Peek(1, models.DocumentTypeInvoice, time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)); next != "FA-2025-00003" {
+		t.Errorf("Peek() = %q, want FA-2025-00003", next)
+	}
+
+	// The pattern may change, the counter goes on
+	seq, _ := numbering.Sequence(1, models.DocumentTypeInvoice)
+	seq.Pattern = "{YYYY}/{PREFIX}{SEQ:4}"
+	if err := numbering.SaveSequence(&seq); err != nil {
+		t.Fatalf("SaveSequence(pattern) error = %v", err)
+	}
+	final, err := s.Finalize(1, draft("DRAFT-5", march, nil).ID)
+	if err != nil {
+		t.Fatalf("Finalize() error = %v", err)
+	}
+	if final.Number != "2025/FA0003" {
+		t.Errorf("Number = %q, want 2025/FA0003", final.Number)
+	}
+
+	// The reset policy may not: the counter would start over
+	seq.Reset = models.SequenceResetNever
+	if err := numbering.SaveSequence(&seq); !errors.Is(err, ErrResetLocked) {
+		t.Errorf("SaveSequence(reset) error = %v, want ErrResetLocked", err)
+	}
+
+	// Until a number was issued
+	quotes := models.DefaultNumberingSequence(1, models.DocumentTypeQuote)
+	quotes.Reset = models.SequenceResetNever
+	if err := numbering.SaveSequence(&quotes); err != nil {
+		t.Errorf("SaveSequence(unused) error = %v", err)
+	}
+}
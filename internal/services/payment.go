@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Payment errors.
+var (
+	ErrInvoiceNotPayable     = errors.New("payments can only be recorded on finalized invoices")
+	ErrInvalidPaymentAmount  = errors.New("payment amount must be positive")
+	ErrInvalidPaymentMethod  = errors.New("unknown payment method")
+	ErrPaymentExceedsBalance = errors.New("payment exceeds the outstanding balance")
+)
+
+// PaymentService records payments and keeps invoice paid status in sync.
+type PaymentService struct {
+	db *gorm.DB
+}
+
+func NewPaymentService(db *gorm.DB) *PaymentService {
+	return &PaymentService{db: db}
+}
+
+// Record adds a payment to an invoice. When the outstanding balance reaches
+// zero the invoice switches to paid, with PaidDate set to the payment date.
+func (s *PaymentService) Record(userID, invoiceID uint, payment *models.Payment) error {
+	if payment.Amount <= 0 {
+		return ErrInvalidPaymentAmount
+	}
+	if !payment.Method.IsValid() {
+		return ErrInvalidPaymentMethod
+	}
+	if payment.Date.IsZero() {
+		payment.Date = time.Now()
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// The lock serializes payments on the same invoice, which would
+		// otherwise both pass the balance check
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ? AND user_id = ?", invoiceID, userID).First(&models.Invoice{}).Error; err != nil {
+			return err
+		}
+		invoice, err := loadForBalance(tx, userID, invoiceID)
+		if err != nil {
+			return err
+		}
+		if invoice.IsCreditNote() || !invoice.IsFinal() {
+			return ErrInvoiceNotPayable
+		}
+		if payment.Amount > invoice.Balance() {
+			return ErrPaymentExceedsBalance
+		}
+
+		payment.UserID = userID
+		payment.InvoiceID = invoice.ID
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		return refreshPaymentStatus(tx, userID, invoice.ID)
+	})
+}
+
+// Delete removes a payment recorded by mistake and reopens the invoice if needed.
+func (s *PaymentService) Delete(userID, invoiceID, paymentID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Same lock as Record, so that the status is refreshed from the
+		// payments left once concurrent changes are done
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ? AND user_id = ?", invoiceID, userID).First(&models.Invoice{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("id = ? AND invoice_id = ? AND user_id = ?", paymentID, invoiceID, userID).
+			Delete(&models.Payment{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return refreshPaymentStatus(tx, userID, invoiceID)
+	})
+}
+
+// List returns the payments of an invoice, oldest first.
+func (s *PaymentService) List(userID, invoiceID uint) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := s.db.Where("invoice_id = ? AND user_id = ?", invoiceID, userID).
+		Order("date, id").
+		Find(&payments).Error
+	return payments, err
+}
+
+// loadForBalance loads an invoice with everything Invoice.Balance needs.
+func loadForBalance(tx *gorm.DB, userID, invoiceID uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := tx.Where("id = ? AND user_id = ?", invoiceID, userID).
+		Preload("Items").
+		Preload("Payments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("date, id")
+		}).
+		Preload("CreditNotes.Items").
+		First(&invoice).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// refreshPaymentStatus moves an invoice between final and paid according to
+// its outstanding balance. Cancelled invoices and credit notes are left alone.
+func refreshPaymentStatus(tx *gorm.DB, userID, invoiceID uint) error {
+	invoice, err := loadForBalance(tx, userID, invoiceID)
+	if err != nil {
+		return err
+	}
+	if invoice.IsCreditNote() || !invoice.IsFinal() {
+		return nil
+	}
+
+	settled := invoice.Balance() <= 0
+	switch {
+	case settled && invoice.Status != models.InvoiceStatusPaid:
+		// Settled by the last payment, or by a credit note when nothing was paid
+		paidDate := time.Now()
+		if n := len(invoice.Payments); n > 0 {
+			paidDate = invoice.Payments[n-1].Date
+		}
+		return tx.Model(invoice).Updates(map[string]any{
+			"status":    models.InvoiceStatusPaid,
+			"paid_date": paidDate,
+		}).Error
+	case !settled && invoice.Status == models.InvoiceStatusPaid:
+		return tx.Model(invoice).Updates(map[string]any{
+			"status":    models.InvoiceStatusFinal,
+			"paid_date": nil,
+		}).Error
+	}
+	return nil
+}
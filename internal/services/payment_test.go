@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupPaymentTest returns a payment service over a database holding a
+// draft and a final invoice of user 1, both for 1200.00 including VAT.
+func setupPaymentTest(t *testing.T) (*gorm.DB, *PaymentService, *models.Invoice, *models.Invoice) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Client{}, &models.Invoice{}, &models.InvoiceItem{}, &models.Payment{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	client := models.Client{UserID: 1, Name: "Globex"}
+	db.Create(&client)
+	invoice := func(number string, status models.InvoiceStatus) *models.Invoice {
+		invoice := models.Invoice{
+			UserID: 1, ClientID: client.ID, Number: number, Status: status,
+			IssueDate: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), DueDate: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+			Items: []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20}},
+		}
+		db.Create(&invoice)
+		return &invoice
+	}
+	draft := invoice("DRAFT-1", models.InvoiceStatusDraft)
+	return db, NewPaymentService(db), draft, invoice("FA-2025-00001", models.InvoiceStatusFinal)
+}
+
+func TestPaymentService_Record(t *testing.T) {
+	db, s, draft, invoice := setupPaymentTest(t)
+
+	transfer := func(amount models.Money, date time.Time) *models.Payment {
+		return &models.Payment{Amount: amount, Date: date, Method: models.PaymentMethodBankTransfer}
+	}
+	march := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name    string
+		id      uint
+		payment *models.Payment
+		want    error
+	}{
+		{"draft", draft.ID, transfer(1000, march), ErrInvoiceNotPayable},
+		{"zero amount", invoice.ID, transfer(0, march), ErrInvalidPaymentAmount},
+		{"unknown method", invoice.ID, &models.Payment{Amount: 1000, Method: "barter"}, ErrInvalidPaymentMethod},
+		{"over the balance", invoice.ID, transfer(120001, march), ErrPaymentExceedsBalance},
+	} {
+		if err := s.Record(1, tc.id, tc.payment); !errors.Is(err, tc.want) {
+			t.Errorf("Record(%s) error = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	// A partial payment leaves the invoice final
+	if err := s.Record(1, invoice.ID, transfer(20000, march)); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	var reloaded models.Invoice
+	db.First(&reloaded, invoice.ID)
+	if reloaded.Status != models.InvoiceStatusFinal {
+		t.Errorf("Status after a partial payment = %q, want final", reloaded.Status)
+	}
+
+	// Paying the balance marks it paid at the payment date
+	paid := march.AddDate(0, 0, 5)
+	if err := s.Record(1, invoice.ID, transfer(100000, paid)); err != nil {
+		t.Fatalf("Record() balance error = %v", err)
+	}
+	db.First(&reloaded, invoice.ID)
+	if reloaded.Status != models.InvoiceStatusPaid || reloaded.PaidDate == nil || !reloaded.PaidDate.Equal(paid) {
+		t.Errorf("invoice = %s paid on %v, want paid on %v", reloaded.Status, reloaded.PaidDate, paid)
+	}
+	if err := s.Record(1, invoice.ID, transfer(100, march)); !errors.Is(err, ErrPaymentExceedsBalance) {
+		t.Errorf("Record() on a paid invoice error = %v, want ErrPaymentExceedsBalance", err)
+	}
+	if err := s.Record(2, invoice.ID, transfer(100, march)); err == nil {
+		t.Error("Record() by another user succeeded")
+	}
+}
+
+func TestPaymentService_Delete(t *testing.T) {
+	db, s, _, invoice := setupPaymentTest(t)
+	payment := &models.Payment{Amount: 120000, Date: time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), Method: models.PaymentMethodBankTransfer}
+	if err := s.Record(1, invoice.ID, payment); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	if err := s.Delete(2, invoice.ID, payment.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Delete() by another user error = %v, want ErrRecordNotFound", err)
+	}
+	if err := s.Delete(1, invoice.ID, payment.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	// Removing the payment reopens the invoice
+	var reloaded models.Invoice
+	db.First(&reloaded, invoice.ID)
+	if reloaded.Status != models.InvoiceStatusFinal || reloaded.PaidDate != nil {
+		t.Errorf("invoice = %s paid on %v, want final", reloaded.Status, reloaded.PaidDate)
+	}
+	if err := s.Delete(1, invoice.ID, payment.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Delete() twice error = %v, want ErrRecordNotFound", err)
+	}
+}
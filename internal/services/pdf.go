@@ -0,0 +1,251 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/diewo77/go-invoices/internal/einvoice"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/pdfa"
+	"github.com/diewo77/go-pdf"
+	"gorm.io/gorm"
+)
+
+// PDFService renders invoices, credit notes and quotes with go-pdf.
+type PDFService struct {
+	db *gorm.DB
+}
+
+func NewPDFService(db *gorm.DB) *PDFService {
+	return &PDFService{db: db}
+}
+
+// Render generates the PDF of a document. The invoice must have Client,
+// Items and, for credit notes, OriginalInvoice preloaded; PenalizedInvoice
+// is mentioned on penalty invoices when preloaded.
+func (s *PDFService) Render(invoice *models.Invoice) ([]byte, error) {
+	company, err := s.issuer(invoice)
+	if err != nil {
+		return nil, err
+	}
+	return s.render(invoice, company)
+}
+
+// RenderFacturX generates a Factur-X document: a PDF/A-3 embedding the
+// EN 16931 CII XML of the invoice. It returns an *einvoice.ValidationError
+// when the invoice lacks mandatory data, so no non-compliant file is emitted.
+func (s *PDFService) RenderFacturX(invoice *models.Invoice) ([]byte, error) {
+	if invoice.IsDraft() {
+		return nil, ErrInvoiceNotFinal
+	}
+	company, err := s.issuer(invoice)
+	if err != nil {
+		return nil, err
+	}
+	xml, xmp, err := einvoice.FacturX(invoice, company)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := s.render(invoice, company)
+	if err != nil {
+		return nil, err
+	}
+	title := "Facture " + invoice.Number
+	if invoice.IsCreditNote() {
+		title = "Avoir " + invoice.Number
+	}
+	return pdfa.Convert(doc, pdfa.Metadata{
+		Title:     title,
+		Producer:  "go-invoices",
+		Date:      invoice.IssueDate,
+		Extension: xmp,
+	}, pdfa.File{
+		Name:         einvoice.FacturXFilename,
+		Description:  "Factur-X invoice",
+		MimeType:     "text/xml",
+		Relationship: einvoice.FacturXRelationship,
+		Data:         xml,
+	})
+}
+
+// RenderQuote generates the PDF of a quote. The quote must have Client and
+// Items preloaded.
+func (s *PDFService) RenderQuote(quote *models.Quote) ([]byte, error) {
+	company, err := s.company(quote.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	document := quote.Lines()
+	document.UserID = quote.UserID
+	document.Number = quote.Number
+	document.IssueDate = quote.IssueDate
+	document.DueDate = quote.ValidUntil
+	document.Client = quote.Client
+	document.Currency = invoiceCurrency(s.db, quote.UserID, quote.ClientID)
+
+	doc, err := pdf.InvoicePDF(s.data(document, company))
+	if err != nil {
+		return nil, err
+	}
+	blocks := append(summary(document, company), pdfa.Block{Title: "Acceptation", Lines: []string{
+		"Devis valable jusqu'au " + quote.ValidUntil.Format("02/01/2006"),
+		"Bon pour accord : date et signature du client",
+	}})
+	return pdfa.AppendPages(doc, "DEVIS n° "+quote.Number, blocks...)
+}
+
+// render generates the PDF of an invoice: go-pdf lays out the parties, the
+// lines and the totals, and a page appended after them carries the title
+// of the document, its VAT breakdown and its mentions.
+func (s *PDFService) render(invoice *models.Invoice, company *models.CompanySettings) ([]byte, error) {
+	doc, err := pdf.InvoicePDF(s.data(invoice, company))
+	if err != nil {
+		return nil, err
+	}
+	blocks := summary(invoice, company)
+	if mentions := paymentMentions(invoice, company); len(mentions) > 0 {
+		blocks = append(blocks, pdfa.Block{Title: "Paiement", Lines: mentions})
+	}
+	return pdfa.AppendPages(doc, documentTitle(invoice)+" n° "+invoice.Number, blocks...)
+}
+
+// documentTitle returns the title of an invoice as printed.
+func documentTitle(invoice *models.Invoice) string {
+	switch {
+	case invoice.IsCreditNote():
+		return "AVOIR"
+	case invoice.IsDeposit():
+		return "FACTURE D'ACOMPTE"
+	}
+	return "FACTURE"
+}
+
+// issuer returns the company of an invoice as rendered, and switches the
+// invoice to its client and product snapshots: a finalized invoice shows
+// the details it was issued with, only drafts follow the live records.
+func (s *PDFService) issuer(invoice *models.Invoice) (*models.CompanySettings, error) {
+	invoice.UseSnapshots()
+	if !invoice.IsDraft() && invoice.CompanySnapshot != nil {
+		return invoice.Seller(nil), nil
+	}
+	return s.company(invoice.UserID)
+}
+
+// company loads the issuer settings of a document.
+func (s *PDFService) company(userID uint) (*models.CompanySettings, error) {
+	var company models.CompanySettings
+	err := s.db.Where("user_id = ?", userID).First(&company).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		// Fallback if company settings are not configured yet
+		company.Name = "My Company"
+	}
+	return &company, nil
+}
+
+// paymentMentions returns the payment terms and the late-payment mentions
+// required on invoices (art. L441-9 du Code de commerce). Credit notes
+// carry none.
+func paymentMentions(invoice *models.Invoice, company *models.CompanySettings) []string {
+	if invoice.IsCreditNote() {
+		return nil
+	}
+	terms := invoice.PaymentTerms
+	if terms == "" {
+		terms = company.PaymentTermsText()
+	}
+	return append([]string{"Conditions de paiement : " + terms}, company.LatePaymentMentions()...)
+}
+
+// data maps a document to the go-pdf input.
+func (s *PDFService) data(invoice *models.Invoice, company *models.CompanySettings) pdf.InvoiceData {
+	data := pdf.InvoiceData{
+		InvoiceNumber: invoice.Number,
+		Date:          invoice.IssueDate.Format("02/01/2006"),
+		DueDate:       invoice.DueDate.Format("02/01/2006"),
+		Total:         invoice.TotalHT().Float64(),
+		VAT:           invoice.TotalVAT().Float64(),
+		GrandTotal:    invoice.TotalTTC().Float64(),
+		Client: pdf.ClientData{
+			Name:    invoice.Client.Name,
+			Address: invoice.Client.FullAddress(),
+			Email:   invoice.Client.Email,
+		},
+		Company: pdf.CompanyData{
+			Name:    company.Name,
+			Address: company.Address + "\n" + company.PostalCode + " " + company.City,
+			LogoURL: company.LogoURL,
+		},
+	}
+
+	// Section titles and subtotals are rows without quantity nor price
+	for n, item := range invoice.Items {
+		switch {
+		case item.IsSection():
+			data.Items = append(data.Items, pdf.InvoiceItem{Description: item.Description})
+		case item.IsSubtotal():
+			description := item.Description
+			if description == "" {
+				description = "Sous-total"
+			}
+			data.Items = append(data.Items, pdf.InvoiceItem{Description: description, Total: invoice.Subtotal(n).Float64()})
+		default:
+			description := item.Description
+			if item.DiscountRate != 0 {
+				description += " (remise " + strconv.FormatFloat(item.DiscountPercent(), 'f', -1, 64) + " %)"
+			} else if item.HasDiscount() {
+				description += " (remise " + invoice.Format(item.Discount()) + ")"
+			}
+			data.Items = append(data.Items, pdf.InvoiceItem{
+				Description: description,
+				Quantity:    int(item.Quantity),
+				UnitPrice:   item.UnitPrice.Float64(),
+				Total:       item.TotalHT().Float64(),
+			})
+		}
+	}
+
+	return data
+}
+
+// summary returns what go-pdf does not lay out: the VAT breakdown, the
+// currency, the documents referred to and the VAT mentions.
+func summary(invoice *models.Invoice, company *models.CompanySettings) []pdfa.Block {
+	var vat []string
+	for _, line := range invoice.VATBreakdown() {
+		vat = append(vat, fmt.Sprintf("TVA %s %% sur %s : %s",
+			strconv.FormatFloat(line.RatePercent(), 'f', -1, 64), invoice.Format(line.Base), invoice.Format(line.VAT)))
+	}
+	vat = append(vat, company.VATMentions()...)
+
+	var currency []string
+	if code := invoice.Currency.OrDefault(); code != models.DefaultCurrency {
+		currency = append(currency, "Montants exprimés en "+string(code))
+	}
+	if invoice.IsForeignCurrency() {
+		currency = append(currency, fmt.Sprintf("Taux de change : 1 %s = %s %s, soit %s",
+			invoice.Currency, strconv.FormatFloat(invoice.ExchangeRate, 'f', -1, 64), invoice.BaseCurrency,
+			invoice.BaseCurrency.Format(invoice.ToBase(invoice.TotalTTC()))))
+	}
+
+	var references []string
+	if invoice.IsCreditNote() && invoice.OriginalInvoice != nil {
+		references = append(references, "Avoir sur facture n° "+invoice.OriginalInvoice.Number+
+			" du "+invoice.OriginalInvoice.IssueDate.Format("02/01/2006"))
+	}
+	if invoice.PenalizedInvoice != nil {
+		references = append(references, "Pénalités de retard sur facture n° "+invoice.PenalizedInvoice.Number+
+			" du "+invoice.PenalizedInvoice.IssueDate.Format("02/01/2006"))
+	}
+
+	return []pdfa.Block{
+		{Title: "Références", Lines: references},
+		{Title: "Récapitulatif de la TVA", Lines: vat},
+		{Title: "Devise", Lines: currency},
+	}
+}
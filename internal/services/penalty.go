@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+)
+
+// Late-payment penalty errors.
+var (
+	ErrInvoiceNotOverdue = errors.New("invoice is not overdue")
+	ErrNoPenaltyDue      = errors.New("penalties accrued so far were already invoiced")
+	// ErrNoPenaltyRate: the legal default rate follows the ECB rate, which
+	// is not known here, so penalties need the rate of the company settings.
+	ErrNoPenaltyRate = errors.New("set the late-payment penalty rate in the company settings to compute penalties")
+)
+
+// PaymentTerms returns the due date and the payment terms text of an
+// invoice issued on issueDate, under the user's company settings.
+func (s *InvoiceService) PaymentTerms(userID uint, issueDate time.Time) (time.Time, string) {
+	company := companySettings(s.db, userID)
+	return company.DueDate(issueDate), company.PaymentTermsText()
+}
+
+// LatePenalty computes the penalties accrued at now on an overdue invoice
+// at the user's penalty rate, and what earlier penalty invoices already
+// charged. Interest is computed on the balance still due. It returns
+// ErrNoPenaltyRate if the user has not set a penalty rate.
+func (s *InvoiceService) LatePenalty(userID, invoiceID uint, now time.Time) (*models.LatePenalty, error) {
+	var invoice models.Invoice
+	if err := s.db.Where("id = ? AND user_id = ?", invoiceID, userID).
+		Preload("Items").
+		Preload("Payments").
+		Preload("CreditNotes.Items").
+		First(&invoice).Error; err != nil {
+		return nil, err
+	}
+	return s.latePenalty(s.db, &invoice, now)
+}
+
+func (s *InvoiceService) latePenalty(tx *gorm.DB, invoice *models.Invoice, now time.Time) (*models.LatePenalty, error) {
+	balance := invoice.Balance()
+	if !invoice.IsOverdue(now) || balance <= 0 {
+		return nil, ErrInvoiceNotOverdue
+	}
+
+	company := companySettings(tx, invoice.UserID)
+	if company.LatePenaltyRate <= 0 {
+		return nil, ErrNoPenaltyRate
+	}
+	penalty := models.ComputeLatePenalty(balance, company.LatePenaltyRate, invoice.DaysOverdue(now))
+
+	var charged []models.Invoice
+	if err := tx.Where("penalized_invoice_id = ? AND status <> ?", invoice.ID, models.InvoiceStatusCancelled).
+		Preload("Items").
+		Find(&charged).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range charged {
+		penalty.Invoiced += c.TotalTTC()
+	}
+	return &penalty, nil
+}
+
+// CreatePenaltyInvoice creates a draft invoice charging the penalties of
+// an overdue invoice not charged yet: the interest accrued since the last
+// penalty invoice, and the recovery indemnity on the first one. Penalties
+// are damages, outside the scope of VAT.
+func (s *InvoiceService) CreatePenaltyInvoice(userID, invoiceID uint, now time.Time) (*models.Invoice, error) {
+	var penaltyInvoice *models.Invoice
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var invoice models.Invoice
+		if err := tx.Where("id = ? AND user_id = ?", invoiceID, userID).
+			Preload("Items").
+			Preload("Payments").
+			Preload("CreditNotes.Items").
+			First(&invoice).Error; err != nil {
+			return err
+		}
+		penalty, err := s.latePenalty(tx, &invoice, now)
+		if err != nil {
+			return err
+		}
+		if penalty.Due() == 0 {
+			return ErrNoPenaltyDue
+		}
+
+		// The first penalty invoice carries the indemnity
+		interest := penalty.Interest
+		if penalty.Invoiced > 0 {
+			interest = penalty.Interest - (penalty.Invoiced - penalty.Indemnity)
+		}
+
+		penaltyInvoice = &models.Invoice{
+			UserID:             userID,
+			ClientID:           invoice.ClientID,
+			Number:             "DRAFT-" + now.Format("20060102-150405.000000"),
+			Reference:          invoice.Reference,
+			IssueDate:          now,
+			DueDate:            now,
+			Status:             models.InvoiceStatusDraft,
+			Rounding:           invoice.Rounding,
+			Currency:           invoice.Currency,
+			PaymentTerms:       "Paiement à réception de facture",
+			PenalizedInvoiceID: &invoice.ID,
+		}
+		if interest > 0 {
+			penaltyInvoice.Items = append(penaltyInvoice.Items, models.InvoiceItem{
+				Description: fmt.Sprintf("Pénalités de retard sur facture n° %s : %d jours au taux annuel de %s %% sur %s",
+					invoice.Number, penalty.DaysLate, strconv.FormatFloat(penalty.Rate*100, 'f', -1, 64), invoice.Format(penalty.Base)),
+				Quantity:  1,
+				UnitPrice: interest,
+			})
+		}
+		if penalty.Invoiced == 0 {
+			penaltyInvoice.Items = append(penaltyInvoice.Items, models.InvoiceItem{
+				Description: "Indemnité forfaitaire pour frais de recouvrement, facture n° " + invoice.Number,
+				Quantity:    1,
+				UnitPrice:   penalty.Indemnity,
+				Position:    1,
+			})
+		}
+		if len(penaltyInvoice.Items) == 0 {
+			return ErrNoPenaltyDue
+		}
+		return tx.Create(penaltyInvoice).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return penaltyInvoice, nil
+}
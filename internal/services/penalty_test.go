@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupPenaltyTest returns an invoice service over a database holding a
+// final invoice of user 1 for 1200.00 including VAT, due on 2025-01-01,
+// under a 10% penalty rate.
+func setupPenaltyTest(t *testing.T) (*gorm.DB, *InvoiceService, *models.Invoice) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.Payment{}, &models.NumberingSequence{}, &models.NumberingCounter{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	db.Create(&models.CompanySettings{UserID: 1, Name: "Acme SARL", PaymentTermDays: 30, LatePenaltyRate: 0.10})
+	client := models.Client{UserID: 1, Name: "Globex"}
+	db.Create(&client)
+	invoice := models.Invoice{
+		UserID: 1, ClientID: client.ID, Number: "FA-2024-00042", Status: models.InvoiceStatusFinal,
+		IssueDate: time.Date(2024, 12, 2, 0, 0, 0, 0, time.UTC),
+		DueDate:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Items:     []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20}},
+	}
+	db.Create(&invoice)
+	return db, NewInvoiceService(db, NewNumberingService(db), NewManualRateProvider(db)), &invoice
+}
+
+func TestInvoiceService_LatePenalty(t *testing.T) {
+	db, s, invoice := setupPenaltyTest(t)
+	now := time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	penalty, err := s.LatePenalty(1, invoice.ID, now)
+	if err != nil {
+		t.Fatalf("LatePenalty() error = %v", err)
+	}
+	// 1200.00 at 10% over 73 days
+	if penalty.DaysLate != 73 || penalty.Base != 120000 || penalty.Interest != 2400 || penalty.Due() != 6400 {
+		t.Errorf("LatePenalty() = %+v", penalty)
+	}
+
+	// Interest runs on the balance still due
+	db.Create(&models.Payment{UserID: 1, InvoiceID: invoice.ID, Amount: 60000, Method: models.PaymentMethodBankTransfer, Date: now})
+	if penalty, _ := s.LatePenalty(1, invoice.ID, now); penalty.Interest != 1200 {
+		t.Errorf("LatePenalty() after partial payment = %+v", penalty)
+	}
+
+	if _, err := s.LatePenalty(1, invoice.ID, invoice.DueDate); !errors.Is(err, ErrInvoiceNotOverdue) {
+		t.Errorf("LatePenalty() on due date error = %v, want ErrInvoiceNotOverdue", err)
+	}
+	if _, err := s.LatePenalty(2, invoice.ID, now); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("LatePenalty() by another user error = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestInvoiceService_LatePenaltyWithoutRate(t *testing.T) {
+	db, s, invoice := setupPenaltyTest(t)
+	now := time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	// The legal default is printed on invoices, but cannot be computed
+	db.Model(&models.CompanySettings{}).Where("user_id = ?", 1).Update("late_penalty_rate", 0)
+	if _, err := s.LatePenalty(1, invoice.ID, now); !errors.Is(err, ErrNoPenaltyRate) {
+		t.Errorf("LatePenalty() error = %v, want ErrNoPenaltyRate", err)
+	}
+	if _, err := s.CreatePenaltyInvoice(1, invoice.ID, now); !errors.Is(err, ErrNoPenaltyRate) {
+		t.Errorf("CreatePenaltyInvoice() error = %v, want ErrNoPenaltyRate", err)
+	}
+}
+
+func TestInvoiceService_CreatePenaltyInvoice(t *testing.T) {
+	_, s, invoice := setupPenaltyTest(t)
+	now := time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	first, err := s.CreatePenaltyInvoice(1, invoice.ID, now)
+	if err != nil {
+		t.Fatalf("CreatePenaltyInvoice() error = %v", err)
+	}
+	if !first.IsDraft() || *first.PenalizedInvoiceID != invoice.ID || len(first.Items) != 2 {
+		t.Fatalf("penalty invoice = %+v", first)
+	}
+	// Penalties are outside the scope of VAT
+	if first.TotalTTC() != 6400 || first.TotalVAT() != 0 {
+		t.Errorf("penalty invoice totals = %v TTC, %v VAT", first.TotalTTC(), first.TotalVAT())
+	}
+
+	if _, err := s.CreatePenaltyInvoice(1, invoice.ID, now); !errors.Is(err, ErrNoPenaltyDue) {
+		t.Errorf("CreatePenaltyInvoice() twice error = %v, want ErrNoPenaltyDue", err)
+	}
+
+	// A later penalty invoice charges the interest accrued since, without
+	// the indemnity
+	second, err := s.CreatePenaltyInvoice(1, invoice.ID, now.AddDate(0, 0, 73))
+	if err != nil {
+		t.Fatalf("CreatePenaltyInvoice() later error = %v", err)
+	}
+	if len(second.Items) != 1 || second.TotalTTC() != 2400 {
+		t.Errorf("second penalty invoice = %v with %d lines", second.TotalTTC(), len(second.Items))
+	}
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+)
+
+// Quote lifecycle errors.
+var (
+	ErrQuoteNotDraft       = errors.New("quote is not a draft")
+	ErrQuoteEmpty          = errors.New("quote has no items")
+	ErrQuoteNotSent        = errors.New("quote is not awaiting an answer")
+	ErrQuoteNotConvertible = errors.New("quote cannot be converted into an invoice")
+)
+
+// quoteInvoiceDueDays is the payment delay of invoices converted from quotes.
+const quoteInvoiceDueDays = 30
+
+// QuoteService manages the lifecycle of quotes (devis): numbering when
+// sent, the client's answer, expiry and conversion into invoices.
+type QuoteService struct {
+	db        *gorm.DB
+	numbering *NumberingService
+}
+
+func NewQuoteService(db *gorm.DB, numbering *NumberingService) *QuoteService {
+	return &QuoteService{db: db, numbering: numbering}
+}
+
+// Send assigns the next number of the user's quote sequence and locks the
+// quote, freezing its rounding policy. As for invoices, numbering and the
+// status change share one transaction.
+func (s *QuoteService) Send(userID, quoteID uint) (*models.Quote, error) {
+	var quote models.Quote
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", quoteID, userID).Preload("Items").First(&quote).Error; err != nil {
+			return err
+		}
+		if !quote.IsDraft() {
+			return ErrQuoteNotDraft
+		}
+		if len(quote.Items) == 0 {
+			return ErrQuoteEmpty
+		}
+
+		date := quote.IssueDate
+		if date.IsZero() {
+			date = time.Now()
+			quote.IssueDate = date
+		}
+
+		number, err := s.numbering.Next(tx, userID, models.DocumentTypeQuote, date)
+		if err != nil {
+			return err
+		}
+
+		rounding := companySettings(tx, userID).Rounding.OrDefault()
+		res := tx.Model(&models.Quote{}).
+			Where("id = ? AND status = ?", quote.ID, models.QuoteStatusDraft).
+			Updates(map[string]any{"number": number, "status": models.QuoteStatusSent, "rounding": rounding, "issue_date": date})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrQuoteNotDraft
+		}
+
+		quote.Number = number
+		quote.Status = models.QuoteStatusSent
+		quote.Rounding = rounding
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// Answer records the client's answer to a sent quote.
+func (s *QuoteService) Answer(userID, quoteID uint, accepted bool) error {
+	status := models.QuoteStatusRefused
+	if accepted {
+		status = models.QuoteStatusAccepted
+	}
+	res := s.db.Model(&models.Quote{}).
+		Where("id = ? AND user_id = ? AND status = ?", quoteID, userID, models.QuoteStatusSent).
+		Update("status", status)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return s.notFoundOr(userID, quoteID, ErrQuoteNotSent)
+	}
+	return nil
+}
+
+// Run expires the quotes past their validity every interval until ctx is
+// done.
+func (s *QuoteService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.ExpireDue(ctx, time.Now()); err != nil {
+			log.Printf("quotes: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireDue marks the sent quotes of all users whose validity ended before
+// now as expired, and returns how many were.
+func (s *QuoteService) ExpireDue(ctx context.Context, now time.Time) (int64, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	result := s.db.WithContext(ctx).Model(&models.Quote{}).
+		Where("status = ? AND valid_until < ?", models.QuoteStatusSent, today).
+		Update("status", models.QuoteStatusExpired)
+	return result.RowsAffected, result.Error
+}
+
+// Convert creates a draft invoice from a sent or accepted quote, copying
+// its client, references, terms and lines, and marks the quote accepted.
+// Deposits already taken on the quote will be deducted from the invoice.
+// A quote is converted once.
+func (s *QuoteService) Convert(userID, quoteID uint) (*models.Invoice, error) {
+	var invoice *models.Invoice
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var quote models.Quote
+		if err := tx.Where("id = ? AND user_id = ?", quoteID, userID).
+			Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+			First(&quote).Error; err != nil {
+			return err
+		}
+		if !quote.CanConvert() {
+			return ErrQuoteNotConvertible
+		}
+
+		now := time.Now()
+		invoice = &models.Invoice{
+			UserID:       userID,
+			ClientID:     quote.ClientID,
+			Number:       "DRAFT-" + quote.Number,
+			Reference:    quote.Reference,
+			IssueDate:    now,
+			DueDate:      now.AddDate(0, 0, quoteInvoiceDueDays),
+			Status:       models.InvoiceStatusDraft,
+			Rounding:     quote.Rounding,
+			Currency:     invoiceCurrency(tx, userID, quote.ClientID),
+			Notes:        quote.Notes,
+			PaymentTerms: quote.PaymentTerms,
+			QuoteID:      &quote.ID,
+		}
+		for _, item := range quote.Items {
+			line := item.InvoiceItem()
+			line.Product = nil
+			invoice.Items = append(invoice.Items, line)
+		}
+		if err := tx.Create(invoice).Error; err != nil {
+			return err
+		}
+
+		res := tx.Model(&models.Quote{}).
+			Where("id = ? AND invoice_id IS NULL", quote.ID).
+			Updates(map[string]any{"invoice_id": invoice.ID, "status": models.QuoteStatusAccepted})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrQuoteNotConvertible
+		}
+
+		// Deposits taken on the quote are deducted from this invoice
+		return tx.Model(&models.Invoice{}).
+			Where("quote_id = ? AND type = ? AND parent_invoice_id IS NULL", quote.ID, models.InvoiceTypeDeposit).
+			Update("parent_invoice_id", invoice.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// notFoundOr returns gorm.ErrRecordNotFound if the user has no such quote,
+// err otherwise.
+func (s *QuoteService) notFoundOr(userID, quoteID uint, err error) error {
+	var count int64
+	if e := s.db.Model(&models.Quote{}).Where("id = ? AND user_id = ?", quoteID, userID).Count(&count).Error; e != nil {
+		return e
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupQuoteTest returns a service over a database holding a draft quote
+// of user 1 with one line.
+func setupQuoteTest(t *testing.T) (*gorm.DB, *QuoteService, *models.Quote) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.NumberingSequence{}, &models.NumberingCounter{}, &models.Quote{}, &models.QuoteItem{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	client := models.Client{UserID: 1, Name: "Globex"}
+	db.Create(&client)
+	quote := models.Quote{
+		UserID: 1, ClientID: client.ID, Number: "DRAFT-1", Reference: "PO-42", PaymentTerms: "30 days",
+		Status: models.QuoteStatusDraft, Rounding: models.RoundingPerRate,
+		IssueDate:  time.Date(2025, time.March, 3, 0, 0, 0, 0, time.UTC),
+		ValidUntil: time.Date(2025, time.April, 2, 0, 0, 0, 0, time.UTC),
+		Items:      []models.QuoteItem{{Description: "Consulting", Quantity: 2, UnitPrice: 50000, VATRate: 0.20}},
+	}
+	db.Create(&quote)
+
+	return db, NewQuoteService(db, NewNumberingService(db)), &quote
+}
+
+func TestQuoteService_Send(t *testing.T) {
+	_, s, quote := setupQuoteTest(t)
+
+	sent, err := s.Send(1, quote.ID)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if sent.Number != "DE-2025-00001" || sent.Status != models.QuoteStatusSent {
+		t.Errorf("sent quote = %s %s, want DE-2025-00001 sent", sent.Number, sent.Status)
+	}
+	if _, err := s.Send(1, quote.ID); !errors.Is(err, ErrQuoteNotDraft) {
+		t.Errorf("second Send() error = %v, want ErrQuoteNotDraft", err)
+	}
+}
+
+func TestQuoteService_SendEmpty(t *testing.T) {
+	db, s, quote := setupQuoteTest(t)
+	db.Where("quote_id = ?", quote.ID).Delete(&models.QuoteItem{})
+
+	if _, err := s.Send(1, quote.ID); !errors.Is(err, ErrQuoteEmpty) {
+		t.Errorf("Send() error = %v, want ErrQuoteEmpty", err)
+	}
+}
+
+func TestQuoteService_Answer(t *testing.T) {
+	db, s, quote := setupQuoteTest(t)
+
+	if err := s.Answer(1, quote.ID, true); !errors.Is(err, ErrQuoteNotSent) {
+		t.Errorf("Answer() on a draft error = %v, want ErrQuoteNotSent", err)
+	}
+	if err := s.Answer(2, quote.ID, true); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Answer() by another user error = %v, want ErrRecordNotFound", err)
+	}
+
+	s.Send(1, quote.ID)
+	if err := s.Answer(1, quote.ID, false); err != nil {
+		t.Fatalf("Answer() error = %v", err)
+	}
+	db.First(quote, quote.ID)
+	if quote.Status != models.QuoteStatusRefused {
+		t.Errorf("status = %s, want refused", quote.Status)
+	}
+}
+
+func TestQuoteService_Expire(t *testing.T) {
+	db, s, quote := setupQuoteTest(t)
+	s.Send(1, quote.ID)
+
+	// Still valid on its last day
+	if n, err := s.ExpireDue(context.Background(), time.Date(2025, time.April, 2, 18, 0, 0, 0, time.UTC)); err != nil || n != 0 {
+		t.Fatalf("ExpireDue() = %d, %v, want 0", n, err)
+	}
+	db.First(quote, quote.ID)
+	if quote.Status != models.QuoteStatusSent {
+		t.Fatalf("status = %s on the last valid day, want sent", quote.Status)
+	}
+
+	if n, err := s.ExpireDue(context.Background(), time.Date(2025, time.April, 3, 8, 0, 0, 0, time.UTC)); err != nil || n != 1 {
+		t.Fatalf("ExpireDue() = %d, %v, want 1", n, err)
+	}
+	db.First(quote, quote.ID)
+	if quote.Status != models.QuoteStatusExpired {
+		t.Errorf("status = %s, want expired", quote.Status)
+	}
+}
+
+func TestQuoteService_Convert(t *testing.T) {
+	db, s, quote := setupQuoteTest(t)
+
+	if _, err := s.Convert(1, quote.ID); !errors.Is(err, ErrQuoteNotConvertible) {
+		t.Fatalf("Convert() on a draft error = %v, want ErrQuoteNotConvertible", err)
+	}
+
+	s.Send(1, quote.ID)
+	invoice, err := s.Convert(1, quote.ID)
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	var saved models.Invoice
+	db.Preload("Items").First(&saved, invoice.ID)
+	if !saved.IsDraft() || saved.ClientID != quote.ClientID || saved.Reference != "PO-42" || saved.PaymentTerms != "30 days" {
+		t.Errorf("invoice = %+v", saved)
+	}
+	if len(saved.Items) != 1 || saved.TotalTTC() != 120000 {
+		t.Errorf("invoice items = %+v, total %v; want the quote lines", saved.Items, saved.TotalTTC())
+	}
+
+	db.First(quote, quote.ID)
+	if quote.Status != models.QuoteStatusAccepted || quote.InvoiceID == nil || *quote.InvoiceID != invoice.ID {
+		t.Errorf("quote = %s, invoice %v; want accepted and linked", quote.Status, quote.InvoiceID)
+	}
+	if _, err := s.Convert(1, quote.ID); !errors.Is(err, ErrQuoteNotConvertible) {
+		t.Errorf("second Convert() error = %v, want ErrQuoteNotConvertible", err)
+	}
+}
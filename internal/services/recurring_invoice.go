@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+)
+
+// errOccurrenceTaken reports an occurrence generated by another worker.
+var errOccurrenceTaken = errors.New("occurrence already generated")
+
+// RecurringInvoiceService generates the invoices of recurring invoices.
+//
+// Every occurrence is generated once: the occurrence counter of the
+// recurring invoice is advanced in the transaction that creates the
+// invoice, only if nobody advanced it first, and generated invoices carry
+// a unique (recurring invoice, occurrence date) key. Occurrences missed
+// while the server was down are generated on the next run.
+type RecurringInvoiceService struct {
+	db       *gorm.DB
+	invoices *InvoiceService
+	webhooks *WebhookService
+	archive  *ArchiveService
+}
+
+func NewRecurringInvoiceService(db *gorm.DB, invoices *InvoiceService, webhooks *WebhookService, archive *ArchiveService) *RecurringInvoiceService {
+	return &RecurringInvoiceService{db: db, invoices: invoices, webhooks: webhooks, archive: archive}
+}
+
+// Preview returns the invoices of the next n occurrences, as they would be
+// generated today. Nothing is saved.
+func (s *RecurringInvoiceService) Preview(rec *models.RecurringInvoice, n int) []*models.Invoice {
+	rounding := s.invoices.RoundingPolicy(rec.UserID)
+	currency := s.invoices.Currency(rec.UserID, rec.ClientID)
+	var invoices []*models.Invoice
+	for _, date := range rec.Upcoming(n) {
+		invoice := rec.Invoice(date, rounding)
+		invoice.Currency = currency
+		invoices = append(invoices, invoice)
+	}
+	return invoices
+}
+
+// Run generates the due invoices every interval until ctx is done.
+func (s *RecurringInvoiceService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.GenerateDue(ctx, time.Now()); err != nil {
+			log.Printf("recurring invoices: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GenerateDue generates the invoices of all occurrences up to now, and
+// returns how many were generated.
+func (s *RecurringInvoiceService) GenerateDue(ctx context.Context, now time.Time) (int, error) {
+	var due []models.RecurringInvoice
+	err := s.db.Where("active = ? AND next_date <= ?", true, now).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Order("next_date, id").
+		Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	generated := 0
+	for i := range due {
+		rec := &due[i]
+		for ctx.Err() == nil {
+			date := rec.Occurrence(rec.Generated)
+			if date.After(now) {
+				break
+			}
+			if rec.Ended(date) {
+				if err := s.db.Model(rec).Update("active", false).Error; err != nil {
+					return generated, err
+				}
+				break
+			}
+
+			invoice, err := s.generate(rec, date)
+			if errors.Is(err, errOccurrenceTaken) {
+				break
+			}
+			if err != nil {
+				return generated, err
+			}
+			generated++
+			if invoice != nil {
+				s.publish(rec, invoice)
+			}
+		}
+	}
+	return generated, nil
+}
+
+// generate creates the invoice of the occurrence at date and moves rec to
+// the next occurrence. It returns a nil invoice when the occurrence
+// already had one.
+func (s *RecurringInvoiceService) generate(rec *models.RecurringInvoice, date time.Time) (*models.Invoice, error) {
+	var invoice *models.Invoice
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.RecurringInvoice{}).
+			Where("id = ? AND generated = ?", rec.ID, rec.Generated).
+			Updates(map[string]any{
+				"generated": rec.Generated + 1,
+				"next_date": rec.Occurrence(rec.Generated + 1),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errOccurrenceTaken
+		}
+
+		var existing int64
+		if err := tx.Unscoped().Model(&models.Invoice{}).
+			Where("recurring_invoice_id = ? AND recurrence_date = ?", rec.ID, date).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return nil
+		}
+
+		invoice = rec.Invoice(date, s.invoices.RoundingPolicy(rec.UserID))
+		invoice.Currency = invoiceCurrency(tx, rec.UserID, rec.ClientID)
+		return tx.Create(invoice).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	rec.Generated++
+	rec.NextDate = rec.Occurrence(rec.Generated)
+	return invoice, nil
+}
+
+// publish finalizes a generated invoice if requested, and emits its events.
+// A failed finalization leaves a draft and is reported on the recurring
+// invoice.
+func (s *RecurringInvoiceService) publish(rec *models.RecurringInvoice, invoice *models.Invoice) {
+	s.webhooks.Emit(rec.UserID, models.WebhookInvoiceCreated, invoice.ID)
+	if !rec.AutoFinalize {
+		return
+	}
+
+	lastError := ""
+	if _, err := s.invoices.Finalize(rec.UserID, invoice.ID); err != nil {
+		lastError = truncate("invoice "+invoice.Number+" left as draft: "+err.Error(), 500)
+	} else {
+		s.archive.ArchiveFinalized(context.Background(), rec.UserID, invoice.ID)
+		s.webhooks.Emit(rec.UserID, models.WebhookInvoiceFinalized, invoice.ID)
+	}
+	if lastError != rec.LastError {
+		rec.LastError = lastError
+		s.db.Model(rec).Update("last_error", lastError)
+	}
+}
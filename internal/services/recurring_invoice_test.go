@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupRecurringTest returns a service over a database holding a monthly
+// recurring invoice of user 1, starting on January 15th 2024.
+func setupRecurringTest(t *testing.T) (*gorm.DB, *RecurringInvoiceService, *models.RecurringInvoice) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.NumberingSequence{}, &models.WebhookEndpoint{}, &models.WebhookDelivery{},
+		&models.RecurringInvoice{}, &models.RecurringInvoiceItem{}, &models.ArchivedDocument{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	client := models.Client{UserID: 1, Name: "Globex"}
+	db.Create(&client)
+	rec := models.RecurringInvoice{
+		UserID: 1, ClientID: client.ID, Name: "Hosting", Frequency: models.FrequencyMonthly,
+		StartDate: time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC), DueDays: 30, Active: true,
+		Items: []models.RecurringInvoiceItem{{Description: "Hosting", Quantity: 1, UnitPrice: 10000, VATRate: 0.20}},
+	}
+	rec.NextDate = rec.Occurrence(0)
+	db.Create(&rec)
+
+	invoices := NewInvoiceService(db, NewNumberingService(db), NewManualRateProvider(db))
+	return db, NewRecurringInvoiceService(db, invoices, NewWebhookService(db), NewArchiveService(db, NewPDFService(db), storage.NewMemoryStore())), &rec
+}
+
+func TestRecurringInvoiceService_GeneratesOncePerOccurrence(t *testing.T) {
+	db, s, rec := setupRecurringTest(t)
+	now := time.Date(2024, time.March, 20, 9, 0, 0, 0, time.UTC)
+
+	// Missed occurrences are caught up: January, February and March
+	n, err := s.GenerateDue(context.Background(), now)
+	if err != nil || n != 3 {
+		t.Fatalf("GenerateDue() = %d, %v; want 3 invoices", n, err)
+	}
+	n, err = s.GenerateDue(context.Background(), now)
+	if err != nil || n != 0 {
+		t.Fatalf("second GenerateDue() = %d, %v; want nothing", n, err)
+	}
+
+	var invoices []models.Invoice
+	db.Preload("Items").Where("recurring_invoice_id = ?", rec.ID).Order("recurrence_date").Find(&invoices)
+	if len(invoices) != 3 {
+		t.Fatalf("got %d invoices, want 3", len(invoices))
+	}
+	first := invoices[0]
+	if !first.IsDraft() || first.IssueDate.Day() != 15 || len(first.Items) != 1 || first.TotalTTC() != 12000 {
+		t.Errorf("first invoice = %+v", first)
+	}
+
+	db.First(rec, rec.ID)
+	if rec.Generated != 3 || !rec.NextDate.Equal(time.Date(2024, time.April, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("recurring invoice at %d, next %v; want 3, April 15th", rec.Generated, rec.NextDate)
+	}
+}
+
+func TestRecurringInvoiceService_KeepsDeletedOccurrences(t *testing.T) {
+	db, s, rec := setupRecurringTest(t)
+	now := time.Date(2024, time.January, 20, 0, 0, 0, 0, time.UTC)
+
+	if n, _ := s.GenerateDue(context.Background(), now); n != 1 {
+		t.Fatalf("GenerateDue() = %d, want 1", n)
+	}
+	db.Where("recurring_invoice_id = ?", rec.ID).Delete(&models.Invoice{})
+
+	// Rewinding the counter must not regenerate the deleted draft
+	db.Model(rec).Updates(map[string]any{"generated": 0, "next_date": rec.Occurrence(0)})
+	if _, err := s.GenerateDue(context.Background(), now); err != nil {
+		t.Fatalf("GenerateDue() error = %v", err)
+	}
+	var count int64
+	db.Unscoped().Model(&models.Invoice{}).Where("recurring_invoice_id = ?", rec.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("got %d invoices, want 1", count)
+	}
+}
+
+func TestRecurringInvoiceService_StopsAtEndDate(t *testing.T) {
+	db, s, rec := setupRecurringTest(t)
+	end := time.Date(2024, time.February, 20, 0, 0, 0, 0, time.UTC)
+	db.Model(rec).Update("end_date", end)
+
+	n, err := s.GenerateDue(context.Background(), time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || n != 2 {
+		t.Fatalf("GenerateDue() = %d, %v; want 2 invoices", n, err)
+	}
+	db.First(rec, rec.ID)
+	if rec.Active {
+		t.Error("recurring invoice still active after its end date")
+	}
+}
+
+func TestRecurringInvoiceService_ReportsFinalizationErrors(t *testing.T) {
+	db, s, rec := setupRecurringTest(t)
+	// Without company settings, the invoice is not a valid e-invoice
+	db.Model(rec).Update("auto_finalize", true)
+
+	if n, _ := s.GenerateDue(context.Background(), time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)); n != 1 {
+		t.Fatalf("GenerateDue() = %d, want 1", n)
+	}
+
+	var invoice models.Invoice
+	db.Where("recurring_invoice_id = ?", rec.ID).First(&invoice)
+	if !invoice.IsDraft() {
+		t.Errorf("invoice status = %s, want draft", invoice.Status)
+	}
+	db.First(rec, rec.ID)
+	if rec.LastError == "" {
+		t.Error("LastError is empty, want the finalization error")
+	}
+}
+
+func TestRecurringInvoiceService_Preview(t *testing.T) {
+	_, s, rec := setupRecurringTest(t)
+
+	preview := s.Preview(rec, 3)
+	if len(preview) != 3 {
+		t.Fatalf("Preview(3) returned %d invoices", len(preview))
+	}
+	if preview[2].IssueDate.Month() != time.March || preview[2].TotalHT() != 10000 {
+		t.Errorf("third preview = %+v", preview[2])
+	}
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/mail"
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+)
+
+// reminderTemplate is the email template of payment reminders. Its
+// wording escalates with the reminder level.
+const reminderTemplate = "reminder.txt"
+
+// reminderLease is how long a pending reminder belongs to the worker that
+// claimed it. Past it, the worker is assumed to have stopped before
+// recording the outcome, and another one takes the reminder over.
+const reminderLease = 15 * time.Minute
+
+// OverdueInvoice is an unpaid invoice past its due date.
+type OverdueInvoice struct {
+	Invoice  models.Invoice
+	DaysLate int
+	Balance  models.Money
+	// Level is the last reminder level sent, 0 if none was.
+	Level int
+}
+
+// ReminderService detects overdue invoices and emails payment reminders
+// following the schedule of each user's company settings.
+//
+// An invoice reaching a step of the schedule gets the reminder of that
+// level, with its PDF attached; steps missed while the server was down
+// are not sent afterwards, only the current one. Each level is sent once
+// per invoice: the reminder is recorded before sending, under a unique
+// (invoice, level) key, and failed sends are retried on the next run, as
+// are pending ones left behind past their lease.
+type ReminderService struct {
+	db        *gorm.DB
+	archive   *ArchiveService
+	mailer    mail.Mailer
+	from      string
+	templates string
+}
+
+func NewReminderService(db *gorm.DB, archive *ArchiveService, mailer mail.Mailer, from string) *ReminderService {
+	return &ReminderService{db: db, archive: archive, mailer: mailer, from: from, templates: EmailTemplateDir}
+}
+
+// Overdue returns the user's overdue invoices, most late first.
+func (s *ReminderService) Overdue(userID uint, now time.Time) ([]OverdueInvoice, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var invoices []models.Invoice
+	err := s.db.Where("user_id = ? AND status = ? AND type <> ? AND due_date < ?",
+		userID, models.InvoiceStatusFinal, models.InvoiceTypeCreditNote, today).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("Payments").
+		Preload("CreditNotes.Items").
+		Order("due_date, id").
+		Find(&invoices).Error
+	if err != nil || len(invoices) == 0 {
+		return nil, err
+	}
+
+	ids := make([]uint, len(invoices))
+	for i := range invoices {
+		ids[i] = invoices[i].ID
+	}
+	var sent []models.Reminder
+	if err := s.db.Where("invoice_id IN ? AND status = ?", ids, models.ReminderSent).Find(&sent).Error; err != nil {
+		return nil, err
+	}
+	levels := make(map[uint]int)
+	for _, r := range sent {
+		levels[r.InvoiceID] = max(levels[r.InvoiceID], r.Level)
+	}
+
+	var overdue []OverdueInvoice
+	for _, invoice := range invoices {
+		balance := invoice.Balance()
+		if balance <= 0 {
+			continue
+		}
+		overdue = append(overdue, OverdueInvoice{
+			Invoice:  invoice,
+			DaysLate: invoice.DaysOverdue(now),
+			Balance:  balance,
+			Level:    levels[invoice.ID],
+		})
+	}
+	return overdue, nil
+}
+
+// Run sends the due reminders every interval until ctx is done.
+func (s *ReminderService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.SendDue(ctx, time.Now()); err != nil {
+			log.Printf("reminders: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDue sends the reminders due at now for all users with a reminder
+// schedule, and returns how many were sent. A failed reminder is logged
+// and does not stop the others.
+func (s *ReminderService) SendDue(ctx context.Context, now time.Time) (int, error) {
+	var companies []models.CompanySettings
+	if err := s.db.Where("reminder_schedule <> ''").Find(&companies).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range companies {
+		company := &companies[i]
+		schedule := company.ReminderDays()
+		if len(schedule) == 0 {
+			continue
+		}
+		overdue, err := s.Overdue(company.UserID, now)
+		if err != nil {
+			return sent, err
+		}
+		for _, o := range overdue {
+			if ctx.Err() != nil {
+				return sent, ctx.Err()
+			}
+			level := models.ReminderLevel(schedule, o.DaysLate)
+			if level <= o.Level {
+				continue
+			}
+			ok, err := s.remind(ctx, company, &o, level)
+			if err != nil {
+				log.Printf("reminders: invoice %d level %d: %v", o.Invoice.ID, level, err)
+				continue
+			}
+			if ok {
+				sent++
+			}
+		}
+	}
+	return sent, nil
+}
+
+// remind sends the reminder of the given level for an overdue invoice,
+// unless it was already sent or is being sent by another worker. It
+// returns true if the reminder was sent.
+func (s *ReminderService) remind(ctx context.Context, company *models.CompanySettings, o *OverdueInvoice, level int) (bool, error) {
+	invoice := &o.Invoice
+	now := time.Now()
+	reminder := models.Reminder{
+		UserID:    invoice.UserID,
+		InvoiceID: invoice.ID,
+		Level:     level,
+		DaysLate:  o.DaysLate,
+		Status:    models.ReminderPending,
+		ClaimedAt: &now,
+	}
+	if invoice.Client != nil {
+		reminder.Recipient = invoice.Client.Email
+	}
+	if claimed, err := s.claim(&reminder); err != nil || !claimed {
+		return false, err
+	}
+
+	err := s.send(ctx, company, o, level)
+	updates := map[string]any{"status": models.ReminderSent, "last_error": ""}
+	if err != nil {
+		updates = map[string]any{"status": models.ReminderFailed, "last_error": truncate(err.Error(), 500)}
+	} else {
+		updates["sent_at"] = time.Now()
+	}
+	if e := s.db.Model(&reminder).Updates(updates).Error; e != nil && err == nil {
+		err = e
+	}
+	return err == nil, err
+}
+
+// claim records a pending reminder, or takes over a failed one or a pending
+// one past its lease. It returns false if the reminder was sent or is being
+// sent by another worker.
+func (s *ReminderService) claim(reminder *models.Reminder) (bool, error) {
+	var existing models.Reminder
+	err := s.db.Where("invoice_id = ? AND level = ?", reminder.InvoiceID, reminder.Level).First(&existing).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if err := s.db.Create(reminder).Error; err != nil {
+			// Lost to a concurrent worker if the unique key is now taken
+			var count int64
+			s.db.Model(&models.Reminder{}).Where("invoice_id = ? AND level = ?", reminder.InvoiceID, reminder.Level).Count(&count)
+			if count > 0 {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	case err != nil:
+		return false, err
+	case existing.Status == models.ReminderSent:
+		return false, nil
+	}
+
+	// The conditions hold for one worker only: the first update renews the
+	// lease
+	stale := reminder.ClaimedAt.Add(-reminderLease)
+	res := s.db.Model(&models.Reminder{}).
+		Where("id = ? AND (status = ? OR (status = ? AND (claimed_at IS NULL OR claimed_at < ?)))",
+			existing.ID, models.ReminderFailed, models.ReminderPending, stale).
+		Updates(map[string]any{
+			"status": models.ReminderPending, "claimed_at": reminder.ClaimedAt,
+			"days_late": reminder.DaysLate, "recipient": reminder.Recipient,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	reminder.ID = existing.ID
+	return res.RowsAffected == 1, nil
+}
+
+// send renders and emails a reminder with the invoice PDF attached.
+func (s *ReminderService) send(ctx context.Context, company *models.CompanySettings, o *OverdueInvoice, level int) error {
+	invoice := &o.Invoice
+	if invoice.Client == nil || invoice.Client.Email == "" {
+		return ErrNoClientEmail
+	}
+
+	subject, body, err := renderEmail(s.templates, reminderTemplate, emailLanguage, map[string]any{
+		"Company":  company,
+		"Client":   invoice.Client,
+		"Invoice":  invoice,
+		"DaysLate": o.DaysLate,
+		"Balance":  o.Balance,
+		// Wording escalates up to the third level
+		"Level": min(level, 3),
+	})
+	if err != nil {
+		return err
+	}
+	pdf, err := s.archive.PDF(ctx, invoice)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, &mail.Message{
+		ID:      mail.NewMessageID(s.from),
+		From:    s.from,
+		To:      []string{invoice.Client.Email},
+		ReplyTo: company.Email,
+		Subject: subject,
+		Text:    body,
+		Attachments: []mail.Attachment{
+			{Filename: invoice.Number + ".pdf", ContentType: "application/pdf", Data: pdf},
+		},
+	})
+}
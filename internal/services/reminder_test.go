@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/mail"
+	"github.com/diewo77/go-invoices/internal/models"
+	"github.com/diewo77/go-invoices/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupReminderTest returns a reminder service over a database holding a
+// company of user 1 reminding at 7, 15 and 30 days, and a final invoice
+// due on 2025-03-01.
+func setupReminderTest(t *testing.T) (*gorm.DB, *ReminderService, *mail.MemoryMailer, *models.Invoice) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.Payment{}, &models.Reminder{}, &models.ArchivedDocument{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	db.Create(&models.CompanySettings{UserID: 1, Name: "Acme SARL", Email: "contact@acme.test", ReminderSchedule: "7,15,30"})
+	client := models.Client{UserID: 1, Name: "Globex", Email: "ap@globex.test"}
+	db.Create(&client)
+	invoice := models.Invoice{
+		UserID: 1, ClientID: client.ID, Number: "FA-2025-00001", Status: models.InvoiceStatusFinal,
+		IssueDate: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		DueDate:   time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		Items:     []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20}},
+	}
+	db.Create(&invoice)
+
+	mailer := &mail.MemoryMailer{}
+	s := NewReminderService(db, NewArchiveService(db, NewPDFService(db), storage.NewMemoryStore()), mailer, "billing@example.com")
+	s.templates = "../../templates/emails"
+	return db, s, mailer, &invoice
+}
+
+func TestReminderService_Overdue(t *testing.T) {
+	db, s, _, invoice := setupReminderTest(t)
+
+	overdue, err := s.Overdue(1, time.Date(2025, 3, 1, 18, 0, 0, 0, time.UTC))
+	if err != nil || len(overdue) != 0 {
+		t.Fatalf("Overdue() on the due date = %v, %v; want none", overdue, err)
+	}
+
+	overdue, err = s.Overdue(1, time.Date(2025, 3, 11, 9, 0, 0, 0, time.UTC))
+	if err != nil || len(overdue) != 1 {
+		t.Fatalf("Overdue() = %v, %v; want the invoice", overdue, err)
+	}
+	if overdue[0].DaysLate != 10 || overdue[0].Balance != 120000 {
+		t.Errorf("Overdue() = %d days, balance %v; want 10 days, 1200.00", overdue[0].DaysLate, overdue[0].Balance)
+	}
+
+	// Partly paid invoices stay overdue for their balance, paid ones are not
+	db.Create(&models.Payment{UserID: 1, InvoiceID: invoice.ID, Amount: 20000, Date: time.Now(), Method: models.PaymentMethodBankTransfer})
+	overdue, _ = s.Overdue(1, time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC))
+	if len(overdue) != 1 || overdue[0].Balance != 100000 {
+		t.Errorf("Overdue() after a partial payment = %+v", overdue)
+	}
+	db.Model(invoice).Update("status", models.InvoiceStatusPaid)
+	if overdue, _ = s.Overdue(1, time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)); len(overdue) != 0 {
+		t.Errorf("Overdue() of a paid invoice = %+v", overdue)
+	}
+}
+
+func TestReminderService_SendDue(t *testing.T) {
+	db, s, mailer, _ := setupReminderTest(t)
+	ctx := context.Background()
+
+	// Before the first step: nothing to send
+	if n, err := s.SendDue(ctx, time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC)); err != nil || n != 0 {
+		t.Fatalf("SendDue() at 4 days = %d, %v", n, err)
+	}
+
+	// First step, sent once
+	for range 2 {
+		if _, err := s.SendDue(ctx, time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC)); err != nil {
+			t.Fatalf("SendDue() error = %v", err)
+		}
+	}
+	messages := mailer.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sent %d reminders at 8 days, want 1", len(messages))
+	}
+	msg := messages[0]
+	if msg.To[0] != "ap@globex.test" || msg.ReplyTo != "contact@acme.test" || msg.From != "billing@example.com" {
+		t.Errorf("message addresses = %q %q %q", msg.To, msg.ReplyTo, msg.From)
+	}
+	if !strings.Contains(msg.Subject, "reminder_subject_1") || !strings.Contains(msg.Subject, "FA-2025-00001") {
+		t.Errorf("Subject = %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "reminder_body_1") || !strings.Contains(msg.Text, "8 days_late") || !strings.Contains(msg.Text, "1200.00") {
+		t.Errorf("Text = %q", msg.Text)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Filename != "FA-2025-00001.pdf" {
+		t.Errorf("Attachments = %+v", msg.Attachments)
+	}
+
+	// Steps missed while down are skipped: at 40 days only the last one is sent
+	if n, _ := s.SendDue(ctx, time.Date(2025, 4, 10, 0, 0, 0, 0, time.UTC)); n != 1 {
+		t.Fatalf("SendDue() at 40 days sent %d, want 1", n)
+	}
+	if subject := mailer.Messages()[1].Subject; !strings.Contains(subject, "reminder_subject_3") {
+		t.Errorf("escalated Subject = %q", subject)
+	}
+
+	var reminders []models.Reminder
+	db.Order("level").Find(&reminders)
+	if len(reminders) != 2 || reminders[0].Level != 1 || reminders[1].Level != 3 || reminders[1].Status != models.ReminderSent {
+		t.Errorf("reminders = %+v", reminders)
+	}
+}
+
+func TestReminderService_SendDueRetriesFailures(t *testing.T) {
+	db, s, mailer, invoice := setupReminderTest(t)
+	ctx := context.Background()
+	now := time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC)
+
+	db.Model(&models.Client{}).Where("id = ?", invoice.ClientID).Update("email", "")
+	if n, _ := s.SendDue(ctx, now); n != 0 {
+		t.Fatalf("SendDue() without client email sent %d", n)
+	}
+	var reminder models.Reminder
+	db.First(&reminder)
+	if reminder.Status != models.ReminderFailed || reminder.LastError == "" {
+		t.Errorf("reminder = %+v, want failed", reminder)
+	}
+
+	db.Model(&models.Client{}).Where("id = ?", invoice.ClientID).Update("email", "ap@globex.test")
+	if n, _ := s.SendDue(ctx, now); n != 1 || len(mailer.Messages()) != 1 {
+		t.Fatalf("SendDue() retry sent %d", n)
+	}
+	db.First(&reminder)
+	if reminder.Status != models.ReminderSent || reminder.SentAt == nil || reminder.LastError != "" {
+		t.Errorf("reminder = %+v, want sent", reminder)
+	}
+}
+
+func TestReminderService_SendDueTakesOverStaleClaims(t *testing.T) {
+	db, s, mailer, invoice := setupReminderTest(t)
+	ctx := context.Background()
+	now := time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC)
+
+	// Another worker is sending the reminder
+	claimed := time.Now()
+	db.Create(&models.Reminder{UserID: 1, InvoiceID: invoice.ID, Level: 1, Status: models.ReminderPending, ClaimedAt: &claimed})
+	if n, _ := s.SendDue(ctx, now); n != 0 || len(mailer.Messages()) != 0 {
+		t.Fatalf("SendDue() during a claim sent %d", n)
+	}
+
+	// It stopped before recording the outcome
+	claimed = claimed.Add(-reminderLease - time.Minute)
+	db.Model(&models.Reminder{}).Where("invoice_id = ?", invoice.ID).Update("claimed_at", claimed)
+	if n, _ := s.SendDue(ctx, now); n != 1 || len(mailer.Messages()) != 1 {
+		t.Fatalf("SendDue() after the lease sent %d", n)
+	}
+	var reminder models.Reminder
+	db.First(&reminder)
+	if reminder.Status != models.ReminderSent || !reminder.ClaimedAt.After(claimed) {
+		t.Errorf("reminder = %+v, want sent", reminder)
+	}
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+)
+
+// ReportPeriod is the granularity of revenue reports.
+type ReportPeriod string
+
+const (
+	ReportMonthly   ReportPeriod = "month"
+	ReportQuarterly ReportPeriod = "quarter"
+)
+
+// ParseReportPeriod returns the period named s, monthly by default.
+func ParseReportPeriod(s string) ReportPeriod {
+	if ReportPeriod(s) == ReportQuarterly {
+		return ReportQuarterly
+	}
+	return ReportMonthly
+}
+
+// ReportFilter selects the invoices covered by a report: those issued from
+// From included to To excluded, to ClientID if set.
+type ReportFilter struct {
+	From     time.Time
+	To       time.Time
+	Period   ReportPeriod
+	ClientID uint
+}
+
+// YearFilter returns the filter covering a calendar year.
+func YearFilter(year int, period ReportPeriod) ReportFilter {
+	return ReportFilter{
+		From:   time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Period: period,
+	}
+}
+
+// PreviousYear returns the same filter one year earlier.
+func (f ReportFilter) PreviousYear() ReportFilter {
+	f.From = f.From.AddDate(-1, 0, 0)
+	f.To = f.To.AddDate(-1, 0, 0)
+	return f
+}
+
+// RevenueRow is the revenue of one month or quarter.
+type RevenueRow struct {
+	Year int
+	// Number is the month (1-12) or the quarter (1-4) in the year.
+	Number int
+	Period ReportPeriod
+	HT     models.Money
+	VAT    models.Money
+}
+
+// TTC returns the revenue including VAT.
+func (r RevenueRow) TTC() models.Money {
+	return r.HT + r.VAT
+}
+
+// Label names the period, e.g. "2025-03" or "2025-Q1".
+func (r RevenueRow) Label() string {
+	if r.Period == ReportQuarterly {
+		return fmt.Sprintf("%d-Q%d", r.Year, r.Number)
+	}
+	return fmt.Sprintf("%d-%02d", r.Year, r.Number)
+}
+
+// ClientRevenue is the revenue made with one client.
+type ClientRevenue struct {
+	ClientID   uint
+	ClientName string
+	Invoices   int `gorm:"column:invoice_count"`
+	HT         models.Money
+	VAT        models.Money
+}
+
+// TTC returns the revenue including VAT.
+func (r ClientRevenue) TTC() models.Money {
+	return r.HT + r.VAT
+}
+
+// ProductRevenue is the revenue made on one product. Lines not linked to a
+// product are grouped in a row without ProductID.
+type ProductRevenue struct {
+	ProductID   *uint
+	ProductName string
+	Quantity    float64
+	HT          models.Money
+}
+
+// RevenueComparison compares the revenue excluding VAT of a period with the
+// same period one year earlier.
+type RevenueComparison struct {
+	RevenueRow
+	Previous models.Money
+}
+
+// Change returns the change from the previous year, in percent. It is
+// meaningless when HasPrevious is false.
+func (c RevenueComparison) Change() float64 {
+	if c.Previous == 0 {
+		return 0
+	}
+	return float64(c.HT-c.Previous) / math.Abs(float64(c.Previous)) * 100
+}
+
+// HasPrevious returns true if there was revenue one year earlier.
+func (c RevenueComparison) HasPrevious() bool {
+	return c.Previous != 0
+}
+
+// ReportService computes the revenue and VAT reports of a user. Reports
+// cover issued invoices, net of credit notes, by issue date; amounts are
+// in the base currency at the rate frozen on each invoice.
+type ReportService struct {
+	db *gorm.DB
+}
+
+func NewReportService(db *gorm.DB) *ReportService {
+	return &ReportService{db: db}
+}
+
+// Amounts of a line excluding VAT after discount, and the invoice rate as
+// an exact number so that rounding works on every database.
+const (
+	reportLineGross = "ROUND(invoice_items.quantity * invoice_items.unit_price, 2)"
+	reportLineHT    = "(" + reportLineGross + " - ROUND(" + reportLineGross + " * invoice_items.discount_rate, 2) - " +
+		"CASE WHEN invoice_items.discount_rate = 0 THEN invoice_items.discount_amount ELSE 0 END)"
+	reportRate = "CAST(invoices.exchange_rate AS NUMERIC)"
+)
+
+// issued scopes a query on invoices to the issued invoices of the user
+// matching the filter.
+func (s *ReportService) issued(userID uint, f ReportFilter) *gorm.DB {
+	q := s.db.Table("invoices").
+		Joins("JOIN invoice_items ON invoice_items.invoice_id = invoices.id AND invoice_items.deleted_at IS NULL "+
+			"AND invoice_items.kind NOT IN ?", []models.ItemKind{models.ItemKindSection, models.ItemKindSubtotal}).
+		Where("invoices.user_id = ? AND invoices.status <> ? AND invoices.deleted_at IS NULL", userID, models.InvoiceStatusDraft).
+		Where("invoices.issue_date >= ? AND invoices.issue_date < ?", f.From, f.To)
+	if f.ClientID != 0 {
+		q = q.Where("invoices.client_id = ?", f.ClientID)
+	}
+	return q
+}
+
+// vatLines returns a subquery with the taxable base and the VAT of every
+// invoice and rate, VAT rounded under the invoice's rounding policy as on
+// the invoice itself.
+func (s *ReportService) vatLines(userID uint, f ReportFilter) *gorm.DB {
+	return s.issued(userID, f).
+		Select("invoices.id AS invoice_id, invoices.client_id, invoices.issue_date, invoice_items.vat_rate, "+
+			"ROUND(SUM("+reportLineHT+") * "+reportRate+", 2) AS base, "+
+			"ROUND(CASE WHEN invoices.rounding = ? "+
+			"THEN SUM(ROUND("+reportLineHT+" * invoice_items.vat_rate, 2)) "+
+			"ELSE ROUND(SUM("+reportLineHT+") * invoice_items.vat_rate, 2) END * "+reportRate+", 2) AS vat",
+			models.RoundingPerLine).
+		Group("invoices.id, invoices.client_id, invoices.issue_date, invoices.exchange_rate, invoices.rounding, invoice_items.vat_rate")
+}
+
+// datePart returns the SQL expression of the year, month or quarter of a
+// date column, in the dialect of the database.
+func (s *ReportService) datePart(column, part string) string {
+	if s.db.Dialector.Name() == "sqlite" {
+		switch part {
+		case "year":
+			return "CAST(strftime('%Y', " + column + ") AS INTEGER)"
+		case "quarter":
+			return "((CAST(strftime('%m', " + column + ") AS INTEGER) + 2) / 3)"
+		default:
+			return "CAST(strftime('%m', " + column + ") AS INTEGER)"
+		}
+	}
+	return "CAST(EXTRACT(" + part + " FROM " + column + ") AS INTEGER)"
+}
+
+// Revenue returns the revenue of every month or quarter of the filter,
+// including those without invoices.
+func (s *ReportService) Revenue(userID uint, f ReportFilter) ([]RevenueRow, error) {
+	part := "month"
+	if f.Period == ReportQuarterly {
+		part = "quarter"
+	}
+	var totals []RevenueRow
+	err := s.db.Table("(?) AS lines", s.vatLines(userID, f)).
+		Select(s.datePart("lines.issue_date", "year") + " AS year, " +
+			s.datePart("lines.issue_date", part) + " AS number, " +
+			"SUM(lines.base) AS ht, SUM(lines.vat) AS vat").
+		Group("year, number").
+		Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rows := reportPeriods(f)
+	for _, t := range totals {
+		for i := range rows {
+			if rows[i].Year == t.Year && rows[i].Number == t.Number {
+				rows[i].HT, rows[i].VAT = t.HT, t.VAT
+			}
+		}
+	}
+	return rows, nil
+}
+
+// reportPeriods lists the empty periods overlapping the filter's dates.
+func reportPeriods(f ReportFilter) []RevenueRow {
+	months := 1
+	if f.Period == ReportQuarterly {
+		months = 3
+	}
+	start := time.Date(f.From.Year(), f.From.Month()-(f.From.Month()-1)%time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+
+	var rows []RevenueRow
+	for d := start; d.Before(f.To); d = d.AddDate(0, months, 0) {
+		rows = append(rows, RevenueRow{
+			Year:   d.Year(),
+			Number: (int(d.Month())-1)/months + 1,
+			Period: f.Period,
+		})
+	}
+	return rows
+}
+
+// VAT returns the VAT collected per rate, highest rate first, as reported
+// on the CA3 return.
+func (s *ReportService) VAT(userID uint, f ReportFilter) ([]models.VATLine, error) {
+	var lines []models.VATLine
+	err := s.db.Table("(?) AS lines", s.vatLines(userID, f)).
+		Select("lines.vat_rate AS rate, SUM(lines.base) AS base, SUM(lines.vat) AS vat").
+		Group("lines.vat_rate").
+		Order("lines.vat_rate DESC").
+		Scan(&lines).Error
+	return lines, err
+}
+
+// ByClient returns the revenue per client, largest first.
+func (s *ReportService) ByClient(userID uint, f ReportFilter) ([]ClientRevenue, error) {
+	var rows []ClientRevenue
+	err := s.db.Table("(?) AS lines", s.vatLines(userID, f)).
+		Select("lines.client_id, clients.name AS client_name, COUNT(DISTINCT lines.invoice_id) AS invoice_count, " +
+			"SUM(lines.base) AS ht, SUM(lines.vat) AS vat").
+		Joins("JOIN clients ON clients.id = lines.client_id").
+		Group("lines.client_id, clients.name").
+		Order("ht DESC, clients.name").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// ByProduct returns the revenue excluding VAT per product, largest first.
+func (s *ReportService) ByProduct(userID uint, f ReportFilter) ([]ProductRevenue, error) {
+	var rows []ProductRevenue
+	err := s.issued(userID, f).
+		Select("invoice_items.product_id, COALESCE(products.name, '') AS product_name, " +
+			"SUM(invoice_items.quantity) AS quantity, " +
+			"SUM(ROUND(" + reportLineHT + " * " + reportRate + ", 2)) AS ht").
+		Joins("LEFT JOIN products ON products.id = invoice_items.product_id").
+		Group("invoice_items.product_id, products.name").
+		Order("ht DESC, product_name").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// Compare returns the revenue of every period of the filter next to the
+// same period one year earlier.
+func (s *ReportService) Compare(userID uint, f ReportFilter) ([]RevenueComparison, error) {
+	current, err := s.Revenue(userID, f)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.Revenue(userID, f.PreviousYear())
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]RevenueComparison, len(current))
+	for i, r := range current {
+		rows[i].RevenueRow = r
+		for _, p := range previous {
+			if p.Year == r.Year-1 && p.Number == r.Number {
+				rows[i].Previous = p.HT
+			}
+		}
+	}
+	return rows, nil
+}
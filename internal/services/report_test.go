@@ -0,0 +1,190 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupReportTest returns a report service over a database holding the
+// invoices of user 1 in 2024 and 2025: euro invoices to Globex, one of them
+// partly credited, a dollar invoice to Initech, and a draft.
+func setupReportTest(t *testing.T) *ReportService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.CompanySettings{}, &models.Client{}, &models.Product{}, &models.Invoice{}, &models.InvoiceItem{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	globex := models.Client{UserID: 1, Name: "Globex"}
+	initech := models.Client{UserID: 1, Name: "Initech", Currency: models.CurrencyUSD}
+	db.Create(&globex)
+	db.Create(&initech)
+	book := models.Product{UserID: 1, Code: "BOOK", Name: "Book"}
+	db.Create(&book)
+
+	day := func(y, m, d int) time.Time { return time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC) }
+	invoices := []models.Invoice{
+		{
+			Number: "FA-2024-00001", ClientID: globex.ID, Status: models.InvoiceStatusPaid, IssueDate: day(2024, 2, 12),
+			Items: []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 40000, VATRate: 0.20}},
+		},
+		{
+			Number: "FA-2025-00001", ClientID: globex.ID, Status: models.InvoiceStatusFinal, IssueDate: day(2025, 1, 20),
+			Items: []models.InvoiceItem{
+				{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20},
+				{Description: "Book", ProductID: &book.ID, Quantity: 3, UnitPrice: 1999, VATRate: 0.055},
+			},
+		},
+		{
+			Number: "AV-2025-00001", ClientID: globex.ID, Type: models.InvoiceTypeCreditNote, Status: models.InvoiceStatusFinal,
+			IssueDate: day(2025, 2, 3),
+			Items:     []models.InvoiceItem{{Description: "Book", ProductID: &book.ID, Quantity: -1, UnitPrice: 1999, VATRate: 0.055}},
+		},
+		{
+			Number: "FA-2025-00002", ClientID: initech.ID, Status: models.InvoiceStatusFinal, IssueDate: day(2025, 5, 5),
+			Currency: models.CurrencyUSD, BaseCurrency: models.CurrencyEUR, ExchangeRate: 0.9,
+			Items: []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20}},
+		},
+		{
+			Number: "DRAFT-1", ClientID: globex.ID, Status: models.InvoiceStatusDraft, IssueDate: day(2025, 5, 6),
+			Items: []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 50000, VATRate: 0.20}},
+		},
+	}
+	for _, inv := range invoices {
+		inv.UserID = 1
+		if err := db.Create(&inv).Error; err != nil {
+			t.Fatalf("failed to create invoice: %v", err)
+		}
+	}
+
+	// Another user's invoice is never reported
+	db.Create(&models.Invoice{
+		UserID: 2, ClientID: globex.ID, Number: "FA-2025-00001", Status: models.InvoiceStatusFinal, IssueDate: day(2025, 1, 20),
+		Items: []models.InvoiceItem{{Description: "Consulting", Quantity: 1, UnitPrice: 99900, VATRate: 0.20}},
+	})
+	return NewReportService(db)
+}
+
+func TestReportService_Revenue(t *testing.T) {
+	s := setupReportTest(t)
+
+	rows, err := s.Revenue(1, YearFilter(2025, ReportQuarterly))
+	if err != nil {
+		t.Fatalf("Revenue() error = %v", err)
+	}
+	want := []struct {
+		label   string
+		ht, vat models.Money
+	}{
+		// 1000.00 + 3 × 19.99 - 19.99, VAT 200.00 + 2.20
+		{"2025-Q1", 103998, 20220},
+		// 1000.00 USD at 0.9
+		{"2025-Q2", 90000, 18000},
+		{"2025-Q3", 0, 0},
+		{"2025-Q4", 0, 0},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("Revenue() = %d rows, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		if rows[i].Label() != w.label || rows[i].HT != w.ht || rows[i].VAT != w.vat {
+			t.Errorf("row %d = %s %v %v, want %s %v %v", i, rows[i].Label(), rows[i].HT, rows[i].VAT, w.label, w.ht, w.vat)
+		}
+	}
+
+	monthly, err := s.Revenue(1, YearFilter(2025, ReportMonthly))
+	if err != nil || len(monthly) != 12 || monthly[0].Label() != "2025-01" || monthly[0].TTC() != 126327 || monthly[1].HT != -1999 {
+		t.Errorf("Revenue() monthly = %+v, %v", monthly, err)
+	}
+}
+
+func TestReportService_VATAndBreakdowns(t *testing.T) {
+	s := setupReportTest(t)
+	f := YearFilter(2025, ReportMonthly)
+
+	vat, err := s.VAT(1, f)
+	if err != nil {
+		t.Fatalf("VAT() error = %v", err)
+	}
+	if len(vat) != 2 || vat[0].Rate != 0.20 || vat[0].Base != 190000 || vat[0].VAT != 38000 ||
+		vat[1].Rate != 0.055 || vat[1].Base != 3998 || vat[1].VAT != 220 {
+		t.Errorf("VAT() = %+v", vat)
+	}
+
+	clients, err := s.ByClient(1, f)
+	if err != nil {
+		t.Fatalf("ByClient() error = %v", err)
+	}
+	if len(clients) != 2 || clients[0].ClientName != "Globex" || clients[0].Invoices != 2 || clients[0].HT != 103998 ||
+		clients[1].ClientName != "Initech" || clients[1].TTC() != 108000 {
+		t.Errorf("ByClient() = %+v", clients)
+	}
+
+	products, err := s.ByProduct(1, f)
+	if err != nil {
+		t.Fatalf("ByProduct() error = %v", err)
+	}
+	if len(products) != 2 || products[0].ProductID != nil || products[0].HT != 190000 ||
+		products[1].ProductName != "Book" || products[1].Quantity != 2 || products[1].HT != 3998 {
+		t.Errorf("ByProduct() = %+v", products)
+	}
+
+	f.ClientID = 99
+	if clients, err := s.ByClient(1, f); err != nil || len(clients) != 0 {
+		t.Errorf("ByClient() for another client = %+v, %v", clients, err)
+	}
+}
+
+func TestReportService_DiscountsAndSections(t *testing.T) {
+	s := setupReportTest(t)
+	invoice := models.Invoice{
+		UserID: 1, ClientID: 1, Number: "FA-2026-00001", Status: models.InvoiceStatusFinal,
+		IssueDate: time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+		Items: []models.InvoiceItem{
+			{Kind: models.ItemKindSection, Description: "Phase 1"},
+			{Description: "Consulting", Quantity: 3, UnitPrice: 3333, VATRate: 0.20, DiscountRate: 0.15},
+			{Description: "Travel", Quantity: 1, UnitPrice: 12050, VATRate: 0.20, DiscountAmount: 2050},
+			{Kind: models.ItemKindSubtotal},
+		},
+	}
+	s.db.Create(&invoice)
+
+	f := YearFilter(2026, ReportQuarterly)
+	rows, err := s.Revenue(1, f)
+	if err != nil {
+		t.Fatalf("Revenue() error = %v", err)
+	}
+	// 99.99 - 15.00 + 120.50 - 20.50
+	if rows[0].HT != 18499 || rows[0].HT != invoice.TotalHT() || rows[0].VAT != invoice.TotalVAT() {
+		t.Errorf("Revenue() = %+v, want %s / %s", rows[0], invoice.TotalHT(), invoice.TotalVAT())
+	}
+	// Section titles and subtotals report no rate nor product
+	if vat, _ := s.VAT(1, f); len(vat) != 1 || vat[0].Rate != 0.20 {
+		t.Errorf("VAT() = %+v", vat)
+	}
+	if products, _ := s.ByProduct(1, f); len(products) != 1 || products[0].Quantity != 4 {
+		t.Errorf("ByProduct() = %+v", products)
+	}
+}
+
+func TestReportService_Compare(t *testing.T) {
+	s := setupReportTest(t)
+
+	rows, err := s.Compare(1, YearFilter(2025, ReportQuarterly))
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if len(rows) != 4 || rows[0].Previous != 40000 || !rows[0].HasPrevious() || rows[0].Change() != 159.995 {
+		t.Errorf("Compare() Q1 = %+v", rows)
+	}
+	if rows[1].HasPrevious() {
+		t.Errorf("Compare() Q2 = %+v, want no previous revenue", rows[1])
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const sealBatchSize = 200
+
+// sealInvoice snapshots the client, the company and the products of a
+// just finalized invoice and seals it: the hash of its content, as stored,
+// is chained to the previous sealed invoice of its user. It must run in
+// the finalization transaction, and returns the sealed invoice.
+func sealInvoice(tx *gorm.DB, invoiceID uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := tx.Preload("Client").
+		Preload("Items.Product", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		First(&invoice, invoiceID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for n := range invoice.Items {
+		item := &invoice.Items[n]
+		// Credit note lines keep the product of the credited line
+		if item.Product == nil || item.ProductSnapshot != nil {
+			continue
+		}
+		item.ProductSnapshot = item.Product.Snapshot()
+		if err := tx.Model(item).Select("product_snapshot").Updates(item).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	head := models.InvoiceSealHead{UserID: invoice.UserID}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).FirstOrCreate(&head).Error; err != nil {
+		return nil, err
+	}
+
+	sealedAt := time.Now().UTC().Truncate(time.Second)
+	if invoice.Client != nil {
+		invoice.ClientSnapshot = invoice.Client.Snapshot()
+	}
+	company := companySettings(tx, invoice.UserID)
+	invoice.CompanySnapshot = company.Snapshot()
+	invoice.SealSequence = head.Sequence + 1
+	invoice.SealPrevHash = head.Hash
+	invoice.SealedAt = &sealedAt
+	invoice.SealHash = invoice.ComputeSeal()
+
+	if err := tx.Model(&invoice).Select("client_snapshot", "company_snapshot", "seal_sequence", "seal_hash", "seal_prev_hash", "sealed_at").
+		Updates(&invoice).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&head).Updates(map[string]any{"sequence": invoice.SealSequence, "hash": invoice.SealHash}).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// SealBreak is a broken seal found by SealService.Verify.
+type SealBreak struct {
+	Sequence  uint   `json:"sequence"`
+	InvoiceID uint   `json:"invoice_id,omitempty"`
+	Number    string `json:"number,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// SealReport is the outcome of the verification of a user's seal chain.
+type SealReport struct {
+	UserID uint        `json:"user_id"`
+	Sealed int         `json:"sealed"`
+	Broken []SealBreak `json:"broken"`
+}
+
+// Valid returns true if no seal is broken.
+func (r *SealReport) Valid() bool {
+	return len(r.Broken) == 0
+}
+
+// SealService verifies the seals of finalized invoices.
+type SealService struct {
+	db *gorm.DB
+}
+
+func NewSealService(db *gorm.DB) *SealService {
+	return &SealService{db: db}
+}
+
+// Verify walks the seal chain of a user's invoices and reports every
+// broken seal: an invoice whose content no longer matches its seal, or
+// that is not linked to the previous one, and sealed invoices that were
+// deleted.
+func (s *SealService) Verify(userID uint) (*SealReport, error) {
+	report := &SealReport{UserID: userID, Broken: []SealBreak{}}
+	var (
+		next     uint = 1
+		prevHash string
+		// linked is false after a missing invoice, whose hash is unknown
+		linked = true
+	)
+	for {
+		var invoices []models.Invoice
+		err := s.db.Unscoped().Where("user_id = ? AND seal_sequence >= ?", userID, next).
+			Order("seal_sequence").Order("id").Limit(sealBatchSize).
+			Preload("Items", "deleted_at IS NULL").Find(&invoices).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, inv := range invoices {
+			broken := func(reason string) {
+				report.Broken = append(report.Broken, SealBreak{Sequence: inv.SealSequence, InvoiceID: inv.ID, Number: inv.Number, Reason: reason})
+			}
+			if inv.SealSequence < next {
+				broken("sequence used twice")
+				continue
+			}
+			for ; next < inv.SealSequence; next++ {
+				report.Broken = append(report.Broken, SealBreak{Sequence: next, Reason: "invoice missing"})
+				linked = false
+			}
+
+			report.Sealed++
+			switch {
+			case inv.DeletedAt.Valid:
+				broken("invoice deleted")
+			case inv.ComputeSeal() != inv.SealHash:
+				broken("content altered")
+			case linked && inv.SealPrevHash != prevHash:
+				broken("not linked to the previous invoice")
+			}
+			prevHash, linked = inv.SealHash, true
+			next++
+		}
+		if len(invoices) < sealBatchSize {
+			break
+		}
+	}
+
+	var head models.InvoiceSealHead
+	if err := s.db.Where("user_id = ?", userID).Limit(1).Find(&head).Error; err != nil {
+		return nil, err
+	}
+	switch {
+	case head.Sequence >= next:
+		report.Broken = append(report.Broken, SealBreak{Sequence: next, Reason: "last invoices missing"})
+	case head.Sequence+1 < next || head.Hash != prevHash:
+		report.Broken = append(report.Broken, SealBreak{Sequence: next - 1, Reason: "end of the chain altered"})
+	}
+	return report, nil
+}
+
+// VerifyAll verifies the seal chains of every user.
+func (s *SealService) VerifyAll() ([]*SealReport, error) {
+	var userIDs []uint
+	if err := s.db.Model(&models.InvoiceSealHead{}).Order("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, err
+	}
+	reports := make([]*SealReport, 0, len(userIDs))
+	for _, userID := range userIDs {
+		report, err := s.Verify(userID)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupSealTest returns a seal service over a database where user 1
+// finalized three invoices and credited the second one.
+func setupSealTest(t *testing.T) (*gorm.DB, *SealService, []*models.Invoice) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.Payment{}, &models.NumberingSequence{}, &models.NumberingCounter{}, &models.InvoiceSealHead{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	db.Create(&models.CompanySettings{
+		UserID: 1, Name: "Acme SARL", Country: "France", SIRET: "12345678900012", VATNumber: "FR12345678900",
+	})
+	client := models.Client{UserID: 1, Name: "Globex", Country: "France", SIRET: "98765432100019"}
+	db.Create(&client)
+
+	numbering := NewNumberingService(db)
+	invoices := NewInvoiceService(db, numbering, NewManualRateProvider(db))
+	var sealed []*models.Invoice
+	for i := 1; i <= 3; i++ {
+		draft := models.Invoice{
+			UserID: 1, ClientID: client.ID, Number: fmt.Sprintf("DRAFT-%d", i), Status: models.InvoiceStatusDraft,
+			IssueDate: time.Date(2025, 3, i, 0, 0, 0, 0, time.UTC), DueDate: time.Date(2025, 4, i, 0, 0, 0, 0, time.UTC),
+			Items: []models.InvoiceItem{{Description: "Consulting", Quantity: float64(i), UnitPrice: 100000, VATRate: 0.20}},
+		}
+		db.Create(&draft)
+		final, err := invoices.Finalize(1, draft.ID)
+		if err != nil {
+			t.Fatalf("Finalize() error = %v", err)
+		}
+		sealed = append(sealed, final)
+	}
+	creditNote, err := NewCreditNoteService(db, numbering).Issue(1, sealed[1].ID, CreditNoteRequest{Full: true})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	return db, NewSealService(db), append(sealed, creditNote)
+}
+
+func TestSealService_Verify(t *testing.T) {
+	db, s, sealed := setupSealTest(t)
+
+	for i, inv := range sealed {
+		if inv.SealSequence != uint(i+1) || len(inv.SealHash) != 64 || inv.ClientSnapshot == nil || inv.ClientSnapshot.Name != "Globex" {
+			t.Fatalf("invoice %d seal = %d %q %+v", i, inv.SealSequence, inv.SealHash, inv.ClientSnapshot)
+		}
+		if i > 0 && inv.SealPrevHash != sealed[i-1].SealHash {
+			t.Errorf("invoice %d is not chained to the previous one", i)
+		}
+	}
+
+	// Changes made after finalization keep the seals
+	db.Model(&models.Client{}).Where("id = ?", sealed[0].ClientID).Update("name", "Globex Corporation")
+	db.Model(sealed[0]).Updates(map[string]any{"status": models.InvoiceStatusPaid, "sent_at": time.Now()})
+
+	report, err := s.Verify(1)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !report.Valid() || report.Sealed != 4 {
+		t.Fatalf("Verify() = %+v, want 4 valid seals", report)
+	}
+
+	// Altering an invoice or its items breaks its seal only
+	db.Exec("UPDATE invoice_items SET unit_price = 10 WHERE invoice_id = ?", sealed[0].ID)
+	db.Exec("UPDATE invoices SET issue_date = ? WHERE id = ?", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), sealed[2].ID)
+	report, _ = s.Verify(1)
+	if len(report.Broken) != 2 || report.Broken[0].InvoiceID != sealed[0].ID || report.Broken[1].InvoiceID != sealed[2].ID ||
+		report.Broken[0].Reason != "content altered" {
+		t.Errorf("Verify() of altered invoices = %+v", report.Broken)
+	}
+
+	// Deleting an invoice leaves a gap in the chain
+	db, s, sealed = setupSealTest(t)
+	db.Exec("DELETE FROM invoices WHERE id = ?", sealed[1].ID)
+	db.Exec("DELETE FROM invoices WHERE id = ?", sealed[3].ID)
+	report, _ = s.Verify(1)
+	if len(report.Broken) != 2 || report.Broken[0].Sequence != 2 || report.Broken[0].Reason != "invoice missing" ||
+		report.Broken[1].Reason != "last invoices missing" {
+		t.Errorf("Verify() with deleted invoices = %+v", report.Broken)
+	}
+
+	reports, err := s.VerifyAll()
+	if err != nil || len(reports) != 1 || reports[0].UserID != 1 {
+		t.Errorf("VerifyAll() = %v, %v", reports, err)
+	}
+}
+
+func TestSealInvoice_Snapshots(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CompanySettings{}, &models.Client{}, &models.Product{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.Payment{}, &models.NumberingSequence{}, &models.NumberingCounter{}, &models.InvoiceSealHead{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	company := models.CompanySettings{
+		UserID: 1, Name: "Acme SARL", Address: "1 rue de la Paix", PostalCode: "75002", City: "Paris", Country: "France",
+		SIRET: "12345678900012", VATNumber: "FR12345678900", PaymentTermDays: 30, LogoURL: "/logo.png",
+	}
+	db.Create(&company)
+	client := models.Client{UserID: 1, Name: "Globex", Address: "2 avenue Foch", City: "Lyon", Country: "France", SIRET: "98765432100019"}
+	db.Create(&client)
+	product := models.Product{UserID: 1, Code: "CONS", Name: "Consulting", UnitPrice: 100000, VATRate: 0.20}
+	db.Create(&product)
+
+	draft := models.Invoice{
+		UserID: 1, ClientID: client.ID, Number: "DRAFT-1", Status: models.InvoiceStatusDraft,
+		IssueDate: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), DueDate: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+		Items: []models.InvoiceItem{
+			{ProductID: &product.ID, Description: "Consulting", Quantity: 1, UnitPrice: 100000, VATRate: 0.20},
+			{Description: "Travel", Quantity: 1, UnitPrice: 5000, VATRate: 0.20},
+		},
+	}
+	db.Create(&draft)
+	numbering := NewNumberingService(db)
+	final, err := NewInvoiceService(db, numbering, NewManualRateProvider(db)).Finalize(1, draft.ID)
+	if err != nil {
+		t.Fatalf("Finalize() error = %v", err)
+	}
+	if final.CompanySnapshot == nil || final.CompanySnapshot.SIRET != "12345678900012" {
+		t.Fatalf("CompanySnapshot = %+v", final.CompanySnapshot)
+	}
+
+	// The client moves, the company and the product change
+	db.Model(&client).Updates(map[string]any{"name": "Globex Corporation", "address": "3 quai Perrache"})
+	db.Model(&company).Updates(map[string]any{"name": "Acme SAS", "city": "Bordeaux", "logo_url": "/new.png"})
+	db.Model(&product).Updates(map[string]any{"code": "CONSULT", "name": "Advice"})
+
+	var invoice models.Invoice
+	db.Preload("Client").Preload("Items.Product").First(&invoice, final.ID)
+	// parties returns the buyer, seller and logo printed on the PDF
+	parties := func(inv *models.Invoice) string {
+		s := NewPDFService(db)
+		seller, err := s.issuer(inv)
+		if err != nil {
+			t.Fatalf("issuer() error = %v", err)
+		}
+		d := s.data(inv, seller)
+		return d.Client.Name + " | " + d.Company.Name + " | " + d.Company.LogoURL
+	}
+	if got := parties(&invoice); got != "Globex | Acme SARL | /logo.png" {
+		t.Errorf("PDF of the final invoice = %q, want the details at finalization", got)
+	}
+	if invoice.Client.Address != "2 avenue Foch" || invoice.Items[0].Product.Code != "CONS" || invoice.Items[1].Product != nil {
+		t.Errorf("snapshots = %+v, %+v", invoice.Client, invoice.Items[0].Product)
+	}
+
+	// So does the e-invoice
+	var exported models.Invoice
+	db.Preload("Client").Preload("Items.Product").First(&exported, final.ID)
+	ubl, err := NewEInvoiceService(db).UBL(&exported)
+	if err != nil {
+		t.Fatalf("UBL() error = %v", err)
+	}
+	for _, want := range []string{">Globex<", ">Acme SARL<", ">2 avenue Foch<", ">CONS<"} {
+		if !strings.Contains(string(ubl), want) {
+			t.Errorf("UBL of the final invoice has no %q", want)
+		}
+	}
+	for _, unwanted := range []string{"Globex Corporation", "Acme SAS", "Bordeaux", "CONSULT"} {
+		if strings.Contains(string(ubl), unwanted) {
+			t.Errorf("UBL of the final invoice has the live %q", unwanted)
+		}
+	}
+
+	// Drafts follow the live records
+	var other models.Invoice
+	db.Create(&models.Invoice{UserID: 1, ClientID: client.ID, Number: "DRAFT-2", Status: models.InvoiceStatusDraft})
+	db.Preload("Client").Preload("Items.Product").Where("number = ?", "DRAFT-2").First(&other)
+	if got := parties(&other); got != "Globex Corporation | Acme SAS | /new.png" {
+		t.Errorf("PDF of a draft = %q, want the live details", got)
+	}
+
+	// Snapshots are sealed, and carried to credit notes
+	report, err := NewSealService(db).Verify(1)
+	if err != nil || !report.Valid() {
+		t.Errorf("Verify() = %+v, %v", report, err)
+	}
+	db.Exec("UPDATE invoice_items SET product_snapshot = ? WHERE id = ?", `{"code":"X","name":"X","unit_price":0,"vat_rate":0}`, invoice.Items[0].ID)
+	if report, _ := NewSealService(db).Verify(1); report.Valid() {
+		t.Error("Verify() after altering a product snapshot is valid")
+	}
+	creditNote, err := NewCreditNoteService(db, numbering).Issue(1, final.ID, CreditNoteRequest{Full: true})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if p := creditNote.Items[0].ProductSnapshot; p == nil || p.Code != "X" {
+		t.Errorf("credit note product snapshot = %+v, want the credited line's", p)
+	}
+}
@@ -0,0 +1,475 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/gorm"
+)
+
+// Webhook delivery headers. The signature is the hex HMAC-SHA256, keyed
+// with the endpoint secret, of "<timestamp>.<body>".
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// Webhook delivery policy.
+const (
+	// WebhookMaxAttempts is the number of attempts before a delivery is failed.
+	WebhookMaxAttempts = 8
+	// webhookRetryBase is the delay before the first retry; it doubles at
+	// every attempt, up to webhookRetryMax.
+	webhookRetryBase = 30 * time.Second
+	webhookRetryMax  = 6 * time.Hour
+	// webhookLease reschedules a delivery while it is being sent, so that a
+	// concurrent worker does not pick it up too.
+	webhookLease     = 2 * time.Minute
+	webhookBatchSize = 50
+)
+
+// Webhook errors.
+var (
+	ErrInvalidWebhookURL   = errors.New("webhook URL must be an absolute http or https URL")
+	ErrInvalidWebhookEvent = errors.New("unknown webhook event")
+	ErrWebhookAddress      = errors.New("webhook URL must resolve to public addresses only")
+)
+
+// WebhookPayload is the JSON body of a delivery.
+type WebhookPayload struct {
+	Event     models.WebhookEvent `json:"event"`
+	CreatedAt time.Time           `json:"created_at"`
+	Data      WebhookInvoiceData  `json:"data"`
+}
+
+// WebhookInvoiceData carries the invoice of an event, with its totals.
+type WebhookInvoiceData struct {
+	Invoice  *models.Invoice `json:"invoice"`
+	TotalHT  models.Money    `json:"total_ht"`
+	TotalVAT models.Money    `json:"total_vat"`
+	TotalTTC models.Money    `json:"total_ttc"`
+}
+
+// WebhookService manages webhook endpoints, queues invoice events for them
+// and delivers the queue.
+type WebhookService struct {
+	db     *gorm.DB
+	client *http.Client
+	// allowed reports whether endpoints may be reached at an address.
+	allowed func(net.IP) bool
+}
+
+func NewWebhookService(db *gorm.DB) *WebhookService {
+	s := &WebhookService{db: db, allowed: publicIP}
+	// Addresses are checked again when connecting, as the host may resolve
+	// differently than when the endpoint was registered. No proxy, which
+	// would connect on our behalf.
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !s.allowed(net.ParseIP(host)) {
+				return fmt.Errorf("%w: %s", ErrWebhookAddress, host)
+			}
+			return nil
+		},
+	}
+	s.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+	return s
+}
+
+// reservedPrefixes are the address ranges webhooks are not delivered to:
+// private, shared, loopback, link-local, multicast, documentation,
+// benchmarking and translation ranges, which may reach the server's own
+// networks or nothing at all.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("3fff::/20"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// publicIP reports whether ip is a public unicast address, outside of the
+// reserved ranges. IPv4-mapped IPv6 addresses are checked as IPv4.
+func publicIP(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHost resolves the host of an endpoint URL and checks that all of its
+// addresses may be reached.
+func (s *WebhookService) checkHost(host string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWebhookAddress, err)
+	}
+	for _, addr := range addrs {
+		if !s.allowed(addr.IP) {
+			return ErrWebhookAddress
+		}
+	}
+	return nil
+}
+
+// CreateEndpoint registers an endpoint with a new signing secret. No events
+// means all events.
+func (s *WebhookService) CreateEndpoint(userID uint, rawURL string, events []models.WebhookEvent) (*models.WebhookEndpoint, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+	names := make([]string, 0, len(events))
+	for _, event := range events {
+		if !event.IsValid() {
+			return nil, ErrInvalidWebhookEvent
+		}
+		names = append(names, string(event))
+	}
+	if err := s.checkHost(u.Hostname()); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	endpoint := models.WebhookEndpoint{
+		UserID: userID,
+		URL:    u.String(),
+		Secret: "whsec_" + hex.EncodeToString(secret),
+		Events: strings.Join(names, " "),
+		Active: true,
+	}
+	if err := s.db.Create(&endpoint).Error; err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// ListEndpoints returns the user's endpoints, oldest first.
+func (s *WebhookService) ListEndpoints(userID uint) ([]models.WebhookEndpoint, error) {
+	var endpoints []models.WebhookEndpoint
+	err := s.db.Where("user_id = ?", userID).Order("id").Find(&endpoints).Error
+	return endpoints, err
+}
+
+// DeleteEndpoint removes an endpoint and drops its pending deliveries.
+func (s *WebhookService) DeleteEndpoint(userID, endpointID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND user_id = ?", endpointID, userID).Delete(&models.WebhookEndpoint{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.WebhookDelivery{}).
+			Where("endpoint_id = ? AND status = ?", endpointID, models.WebhookDeliveryPending).
+			Updates(map[string]any{
+				"status":     models.WebhookDeliveryFailed,
+				"last_error": "endpoint deleted",
+			}).Error
+	})
+}
+
+// ListDeliveries returns the user's most recent deliveries, newest first,
+// with their endpoint.
+func (s *WebhookService) ListDeliveries(userID uint, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := s.db.Where("user_id = ?", userID).
+		Preload("Endpoint", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// Redeliver puts a delivery back in the queue for an immediate attempt.
+func (s *WebhookService) Redeliver(userID, deliveryID uint) error {
+	res := s.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND user_id = ? AND endpoint_id IN (?)", deliveryID, userID,
+			s.db.Model(&models.WebhookEndpoint{}).Select("id")).
+		Updates(map[string]any{
+			"status":          models.WebhookDeliveryPending,
+			"next_attempt_at": time.Now(),
+			"attempts":        0,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Emit queues an invoice event for the user's endpoints that subscribe to
+// it. It is called once the invoice change is saved: a failure to queue
+// is logged and does not undo the change.
+func (s *WebhookService) Emit(userID uint, event models.WebhookEvent, invoiceID uint) {
+	if err := s.enqueue(userID, event, invoiceID); err != nil {
+		log.Printf("webhooks: failed to queue %s for invoice %d: %v", event, invoiceID, err)
+	}
+}
+
+func (s *WebhookService) enqueue(userID uint, event models.WebhookEvent, invoiceID uint) error {
+	var endpoints []models.WebhookEndpoint
+	if err := s.db.Where("user_id = ? AND active = ?", userID, true).Find(&endpoints).Error; err != nil {
+		return err
+	}
+	var subscribed []models.WebhookEndpoint
+	for _, endpoint := range endpoints {
+		if endpoint.Accepts(event) {
+			subscribed = append(subscribed, endpoint)
+		}
+	}
+	if len(subscribed) == 0 {
+		return nil
+	}
+
+	var invoice models.Invoice
+	err := s.db.Where("id = ? AND user_id = ?", invoiceID, userID).
+		Preload("Client").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		First(&invoice).Error
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	payload, err := json.Marshal(WebhookPayload{
+		Event:     event,
+		CreatedAt: now,
+		Data: WebhookInvoiceData{
+			Invoice:  &invoice,
+			TotalHT:  invoice.TotalHT(),
+			TotalVAT: invoice.TotalVAT(),
+			TotalTTC: invoice.TotalTTC(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]models.WebhookDelivery, 0, len(subscribed))
+	for _, endpoint := range subscribed {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			UserID:        userID,
+			EndpointID:    endpoint.ID,
+			Event:         event,
+			InvoiceID:     invoiceID,
+			Payload:       string(payload),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	return s.db.Create(&deliveries).Error
+}
+
+// Run delivers the queue every interval until ctx is done.
+func (s *WebhookService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.DeliverDue(ctx); err != nil {
+			log.Printf("webhooks: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue attempts the pending deliveries that are due, and returns how
+// many were attempted.
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	var due []models.WebhookDelivery
+	err := s.db.Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, time.Now()).
+		Preload("Endpoint").
+		Order("next_attempt_at, id").
+		Limit(webhookBatchSize).
+		Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for i := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		delivery := &due[i]
+		if !s.claim(delivery) {
+			continue
+		}
+		attempted++
+		if err := s.attempt(ctx, delivery); err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, nil
+}
+
+// claim leases a delivery to this worker by moving its next attempt
+// forward. It fails if another worker got there first.
+func (s *WebhookService) claim(delivery *models.WebhookDelivery) bool {
+	res := s.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, models.WebhookDeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", time.Now().Add(webhookLease))
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// attempt sends a delivery once and records the outcome.
+func (s *WebhookService) attempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	now := time.Now()
+	updates := map[string]any{
+		"attempts":        delivery.Attempts + 1,
+		"last_attempt_at": now,
+	}
+
+	if delivery.Endpoint == nil || !delivery.Endpoint.Active {
+		// Deleted or disabled since the event was queued
+		updates["status"] = models.WebhookDeliveryFailed
+		updates["last_error"] = "endpoint inactive"
+		return s.db.Model(delivery).Updates(updates).Error
+	}
+
+	status, sendErr := s.send(ctx, delivery, now)
+	updates["response_status"] = status
+	switch {
+	case sendErr == nil:
+		updates["status"] = models.WebhookDeliveryDelivered
+		updates["last_error"] = ""
+	case delivery.Attempts+1 >= WebhookMaxAttempts:
+		updates["status"] = models.WebhookDeliveryFailed
+		updates["last_error"] = truncate(sendErr.Error(), 500)
+	default:
+		updates["next_attempt_at"] = now.Add(WebhookRetryDelay(delivery.Attempts + 1))
+		updates["last_error"] = truncate(sendErr.Error(), 500)
+	}
+	return s.db.Model(delivery).Updates(updates).Error
+}
+
+// send posts the payload to the endpoint. Any 2xx response is a success.
+func (s *WebhookService) send(ctx context.Context, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Endpoint.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-invoices-webhooks")
+	req.Header.Set(WebhookEventHeader, string(delivery.Event))
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(delivery.Endpoint.Secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the hex signature of a delivery body.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks a signature header value ("sha256=<hex>") against
+// a delivery body. Receivers in Go can use it as is.
+func VerifyWebhook(secret, timestamp string, body []byte, signature string) bool {
+	got, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	want := SignWebhook(secret, timestamp, body)
+	return hmac.Equal([]byte(got), []byte(want))
+}
+
+// WebhookRetryDelay returns the delay after the given failed attempt
+// count: 30s, 1m, 2m, 4m... capped at 6 hours.
+func WebhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookRetryMax)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
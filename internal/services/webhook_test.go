@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diewo77/go-invoices/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupWebhookTest returns a service over a database holding a draft
+// invoice of user 1.
+func setupWebhookTest(t *testing.T) (*gorm.DB, *WebhookService, *models.Invoice) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Client{}, &models.Invoice{}, &models.InvoiceItem{},
+		&models.WebhookEndpoint{}, &models.WebhookDelivery{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	client := models.Client{UserID: 1, Name: "Globex"}
+	db.Create(&client)
+	invoice := models.Invoice{
+		UserID: 1, ClientID: client.ID, Number: "DRAFT-1", Status: models.InvoiceStatusDraft,
+		IssueDate: time.Now(), DueDate: time.Now(),
+		Items: []models.InvoiceItem{{Description: "Consulting", Quantity: 2, UnitPrice: 50000, VATRate: 0.20}},
+	}
+	db.Create(&invoice)
+
+	// Receivers listen on the loopback interface
+	webhooks := NewWebhookService(db)
+	webhooks.allowed = func(net.IP) bool { return true }
+	return db, webhooks, &invoice
+}
+
+// receiver is an httptest endpoint recording what it receives.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	rec := &receiver{status: status}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rec.mu.Lock()
+		rec.requests = append(rec.requests, r)
+		rec.bodies = append(rec.bodies, body)
+		status := rec.status
+		rec.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rec.Close)
+	return rec
+}
+
+func TestWebhookService_DeliversSignedEvents(t *testing.T) {
+	db, webhooks, invoice := setupWebhookTest(t)
+	rec := newReceiver(t, http.StatusNoContent)
+
+	endpoint, err := webhooks.CreateEndpoint(1, rec.URL, nil)
+	if err != nil {
+		t.Fatalf("CreateEndpoint() error: %v", err)
+	}
+	webhooks.Emit(1, models.WebhookInvoiceCreated, invoice.ID)
+	webhooks.Emit(2, models.WebhookInvoiceCreated, invoice.ID) // no endpoint
+
+	n, err := webhooks.DeliverDue(context.Background())
+	if err != nil || n != 1 || len(rec.requests) != 1 {
+		t.Fatalf("DeliverDue() = %d, %v; received %d", n, err, len(rec.requests))
+	}
+
+	req, body := rec.requests[0], rec.bodies[0]
+	if req.Header.Get(WebhookEventHeader) != "invoice.created" {
+		t.Errorf("event header = %q", req.Header.Get(WebhookEventHeader))
+	}
+	if !VerifyWebhook(endpoint.Secret, req.Header.Get(WebhookTimestampHeader), body, req.Header.Get(WebhookSignatureHeader)) {
+		t.Errorf("signature %q does not verify", req.Header.Get(WebhookSignatureHeader))
+	}
+	if VerifyWebhook("whsec_other", req.Header.Get(WebhookTimestampHeader), body, req.Header.Get(WebhookSignatureHeader)) {
+		t.Error("signature verifies with another secret")
+	}
+
+	var payload struct {
+		Event string `json:"event"`
+		Data  struct {
+			Invoice  models.Invoice  `json:"invoice"`
+			TotalTTC json.RawMessage `json:"total_ttc"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if payload.Data.Invoice.ID != invoice.ID || len(payload.Data.Invoice.Items) != 1 || string(payload.Data.TotalTTC) != "1200.00" {
+		t.Errorf("payload = %s", body)
+	}
+
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	if delivery.Status != models.WebhookDeliveryDelivered || delivery.Attempts != 1 || delivery.ResponseStatus != http.StatusNoContent {
+		t.Errorf("delivery = %+v", delivery)
+	}
+	if n, _ := webhooks.DeliverDue(context.Background()); n != 0 {
+		t.Errorf("delivered deliveries are sent again: %d", n)
+	}
+}
+
+func TestWebhookService_RetriesWithBackoff(t *testing.T) {
+	db, webhooks, invoice := setupWebhookTest(t)
+	rec := newReceiver(t, http.StatusInternalServerError)
+	if _, err := webhooks.CreateEndpoint(1, rec.URL, nil); err != nil {
+		t.Fatalf("CreateEndpoint() error: %v", err)
+	}
+	webhooks.Emit(1, models.WebhookInvoiceFinalized, invoice.ID)
+
+	webhooks.DeliverDue(context.Background())
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	if delivery.Status != models.WebhookDeliveryPending || delivery.Attempts != 1 || delivery.ResponseStatus != 500 || delivery.LastError == "" {
+		t.Fatalf("after a failure: %+v", delivery)
+	}
+	if wait := time.Until(delivery.NextAttemptAt); wait < 25*time.Second || wait > 35*time.Second {
+		t.Errorf("next attempt in %v, want about 30s", wait)
+	}
+
+	// Not due yet
+	if n, _ := webhooks.DeliverDue(context.Background()); n != 0 {
+		t.Errorf("attempted %d deliveries before they are due", n)
+	}
+
+	// The receiver recovers
+	rec.mu.Lock()
+	rec.status = http.StatusOK
+	rec.mu.Unlock()
+	db.Model(&delivery).Update("next_attempt_at", time.Now().Add(-time.Second))
+	webhooks.DeliverDue(context.Background())
+	db.First(&delivery)
+	if delivery.Status != models.WebhookDeliveryDelivered || delivery.Attempts != 2 || delivery.LastError != "" {
+		t.Errorf("after recovery: %+v", delivery)
+	}
+}
+
+func TestWebhookService_GivesUp(t *testing.T) {
+	db, webhooks, invoice := setupWebhookTest(t)
+	rec := newReceiver(t, http.StatusBadGateway)
+	webhooks.CreateEndpoint(1, rec.URL, nil)
+	webhooks.Emit(1, models.WebhookInvoicePaid, invoice.ID)
+	db.Model(&models.WebhookDelivery{}).Where("1 = 1").Update("attempts", WebhookMaxAttempts-1)
+
+	webhooks.DeliverDue(context.Background())
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	if delivery.Status != models.WebhookDeliveryFailed || delivery.Attempts != WebhookMaxAttempts {
+		t.Fatalf("after the last attempt: %+v", delivery)
+	}
+
+	if err := webhooks.Redeliver(1, delivery.ID); err != nil {
+		t.Fatalf("Redeliver() error: %v", err)
+	}
+	if err := webhooks.Redeliver(2, delivery.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("Redeliver() by another user = %v", err)
+	}
+	if n, _ := webhooks.DeliverDue(context.Background()); n != 1 {
+		t.Errorf("redelivery attempted %d deliveries", n)
+	}
+}
+
+func TestWebhookService_EventFilter(t *testing.T) {
+	db, webhooks, invoice := setupWebhookTest(t)
+	rec := newReceiver(t, http.StatusOK)
+	if _, err := webhooks.CreateEndpoint(1, rec.URL, []models.WebhookEvent{models.WebhookInvoicePaid}); err != nil {
+		t.Fatalf("CreateEndpoint() error: %v", err)
+	}
+
+	webhooks.Emit(1, models.WebhookInvoiceCreated, invoice.ID)
+	webhooks.Emit(1, models.WebhookInvoicePaid, invoice.ID)
+
+	var deliveries []models.WebhookDelivery
+	db.Find(&deliveries)
+	if len(deliveries) != 1 || deliveries[0].Event != models.WebhookInvoicePaid {
+		t.Errorf("deliveries = %+v", deliveries)
+	}
+}
+
+func TestWebhookService_CreateEndpointValidation(t *testing.T) {
+	_, webhooks, _ := setupWebhookTest(t)
+	for _, url := range []string{"", "ftp://example.com", "/relative", "https://"} {
+		if _, err := webhooks.CreateEndpoint(1, url, nil); err != ErrInvalidWebhookURL {
+			t.Errorf("CreateEndpoint(%q) error = %v, want ErrInvalidWebhookURL", url, err)
+		}
+	}
+	if _, err := webhooks.CreateEndpoint(1, "https://example.com/hook", []models.WebhookEvent{"invoice.deleted"}); err != ErrInvalidWebhookEvent {
+		t.Errorf("unknown event: error = %v", err)
+	}
+}
+
+func TestWebhookService_RejectsInternalAddresses(t *testing.T) {
+	db, _, invoice := setupWebhookTest(t)
+	webhooks := NewWebhookService(db)
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook", "http://localhost/hook", "http://[::1]/hook", "http://0.0.0.0/hook",
+		"http://169.254.169.254/latest/meta-data", "https://10.0.0.5/hook", "https://192.168.1.1/hook", "http://[fd00::1]/hook",
+	} {
+		if _, err := webhooks.CreateEndpoint(1, url, nil); !errors.Is(err, ErrWebhookAddress) {
+			t.Errorf("CreateEndpoint(%q) error = %v, want ErrWebhookAddress", url, err)
+		}
+	}
+	for ip, want := range map[string]bool{
+		"93.184.216.34": true, "2606:2800:220:1::1": true, "::ffff:93.184.216.34": true,
+		"172.16.0.1": false, "fe80::1": false, "100.64.0.1": false, "192.0.0.170": false, "198.18.0.1": false,
+		"0.1.2.3": false, "127.1.2.3": false, "224.0.0.1": false, "255.255.255.255": false, "203.0.113.7": false,
+		"::ffff:127.0.0.1": false, "::ffff:10.0.0.1": false, "fc00::1": false, "ff02::1": false, "2001:db8::1": false,
+		"64:ff9b::a9fe:a9fe": false, "64:ff9b:1::a00:1": false, "2002:a00:1::1": false,
+	} {
+		if got := publicIP(net.ParseIP(ip)); got != want {
+			t.Errorf("publicIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	// An endpoint that resolves to an internal address once registered is
+	// not delivered to either
+	rec := newReceiver(t, http.StatusNoContent)
+	db.Create(&models.WebhookEndpoint{UserID: 1, URL: rec.URL, Secret: "whsec_test", Active: true})
+	webhooks.Emit(1, models.WebhookInvoiceCreated, invoice.ID)
+	if _, err := webhooks.DeliverDue(context.Background()); err != nil {
+		t.Fatalf("DeliverDue() error: %v", err)
+	}
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	if len(rec.requests) != 0 || !strings.Contains(delivery.LastError, ErrWebhookAddress.Error()) {
+		t.Errorf("delivery = %+v, %d requests received", delivery, len(rec.requests))
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{20, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := WebhookRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("WebhookRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
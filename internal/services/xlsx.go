@@ -0,0 +1,154 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// readXLSX reads the first worksheet of an Office Open XML workbook as
+// rows of cells. Only cell values are read: formulas give their cached
+// result, and dates their serial number.
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrImportFormat
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if err := decodeZipXML(f, &sst); err != nil {
+			return nil, err
+		}
+		for _, si := range sst.Items {
+			shared = append(shared, si.String())
+		}
+	}
+
+	sheet, ok := files[firstSheet(files)]
+	if !ok {
+		return nil, ErrImportFormat
+	}
+	var ws struct {
+		Rows []struct {
+			Index int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decodeZipXML(sheet, &ws); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range ws.Rows {
+		// Empty rows are not stored, but keep their place
+		for row.Index > len(rows)+1 {
+			rows = append(rows, nil)
+		}
+		var cells []string
+		for i, c := range row.Cells {
+			col := xlsxColumn(c.Ref, i)
+			for len(cells) < col {
+				cells = append(cells, "")
+			}
+			value := c.Value
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(shared) {
+					return nil, ErrImportFormat
+				}
+				value = shared[n]
+			case "inlineStr":
+				value = c.Inline.String()
+			}
+			cells = append(cells, value)
+		}
+		rows = append(rows, cells)
+	}
+	return rows, nil
+}
+
+// xlsxText is a string item, plain or rich text made of runs.
+type xlsxText struct {
+	Text string   `xml:"t"`
+	Runs []string `xml:"r>t"`
+}
+
+func (t xlsxText) String() string {
+	return t.Text + strings.Join(t.Runs, "")
+}
+
+// firstSheet returns the path of the first worksheet of the workbook.
+func firstSheet(files map[string]*zip.File) string {
+	const fallback = "xl/worksheets/sheet1.xml"
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	wb, ok := files["xl/workbook.xml"]
+	rf, relsOK := files["xl/_rels/workbook.xml.rels"]
+	if !ok || !relsOK || decodeZipXML(wb, &workbook) != nil || decodeZipXML(rf, &rels) != nil || len(workbook.Sheets) == 0 {
+		return fallback
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].ID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/")
+			}
+			return path.Join("xl", rel.Target)
+		}
+	}
+	return fallback
+}
+
+// xlsxColumn returns the 0-based column of a cell reference like "C7", or
+// i when the reference is missing.
+func xlsxColumn(ref string, i int) int {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+	}
+	if col == 0 {
+		return i
+	}
+	return col - 1
+}
+
+func decodeZipXML(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return ErrImportFormat
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(io.LimitReader(rc, 64<<20)).Decode(v); err != nil {
+		return ErrImportFormat
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore keeps each document as a read-only file under Dir.
+type FileStore struct {
+	Dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir}
+}
+
+// Put implements Store. The document is written to a temporary file
+// first, then linked to its key, so that a key never holds a partial
+// document.
+func (s *FileStore) Put(ctx context.Context, key string, data []byte) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o444); err != nil {
+		return err
+	}
+	// Unlike a rename, a link fails if the key exists
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return ErrExists
+		}
+		return err
+	}
+	return nil
+}
+
+// Get implements Store.
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// MemoryStore keeps documents in memory, for tests.
+type MemoryStore struct {
+	mu        sync.Mutex
+	documents map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{documents: make(map[string][]byte)}
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(ctx context.Context, key string, data []byte) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.documents[key]; ok {
+		return ErrExists
+	}
+	s.documents[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.documents[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Replace overwrites a stored document, to simulate its corruption in
+// tests.
+func (s *MemoryStore) Replace(key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.documents[key] = data
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Store keeps documents in a bucket of an S3-compatible object storage
+// (AWS S3, MinIO, Scaleway, OVH...), addressed in path style and signed
+// with AWS Signature Version 4.
+type S3Store struct {
+	// Endpoint is the base URL of the service, e.g. https://s3.fr-par.scw.cloud.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+func NewS3Store(endpoint, region, bucket, accessKey, secretKey string) *S3Store {
+	return &S3Store{Endpoint: endpoint, Region: region, Bucket: bucket, AccessKey: accessKey, SecretKey: secretKey}
+}
+
+// Put implements Store. The object is written with If-None-Match: *, so
+// the service refuses to overwrite an existing key.
+func (s *S3Store) Put(ctx context.Context, key string, data []byte) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	req, err := s.request(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("If-None-Match", "*")
+	return s.do(req, data, func(resp *http.Response) error {
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return nil
+		case http.StatusPreconditionFailed, http.StatusConflict:
+			return ErrExists
+		}
+		return s3Error(resp)
+	})
+}
+
+// Get implements Store.
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	err = s.do(req, nil, func(resp *http.Response) error {
+		switch resp.StatusCode {
+		case http.StatusOK:
+			var err error
+			data, err = io.ReadAll(resp.Body)
+			return err
+		case http.StatusNotFound:
+			return ErrNotFound
+		}
+		return s3Error(resp)
+	})
+	return data, err
+}
+
+// request returns a request on the object of key.
+func (s *S3Store) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	endpoint := strings.TrimSuffix(s.Endpoint, "/")
+	return http.NewRequestWithContext(ctx, method, endpoint+"/"+s3Escape(s.Bucket)+"/"+strings.Join(segments, "/"), bytes.NewReader(body))
+}
+
+// do signs and sends req, and hands the response to handle.
+func (s *S3Store) do(req *http.Request, body []byte, handle func(*http.Response) error) error {
+	signV4(req, body, s.AccessKey, s.SecretKey, s.Region, time.Now())
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return handle(resp)
+}
+
+// s3Error describes an unexpected response, with the error code of its
+// XML body.
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	code := ""
+	if start := bytes.Index(body, []byte("<Code>")); start >= 0 {
+		rest := body[start+len("<Code>"):]
+		if end := bytes.Index(rest, []byte("</Code>")); end >= 0 {
+			code = " " + string(rest[:end])
+		}
+	}
+	return fmt.Errorf("storage: s3 %s %s: %s%s", resp.Request.Method, resp.Request.URL.Path, resp.Status, code)
+}
+
+// signV4 signs req with AWS Signature Version 4, in the Authorization
+// header. The host and every header already set are signed.
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query parameters sorted by name, as signed.
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(name)+"="+s3Escape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes every byte but the unreserved characters of
+// RFC 3986, as AWS signatures require.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,42 @@
+// Package storage keeps the application's archived documents in a
+// pluggable Store: files on disk or an S3-compatible bucket in production,
+// memory in tests. Stored documents are immutable: a key is written once.
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when reading a key that was never stored.
+	ErrNotFound = errors.New("storage: document not found")
+	// ErrExists is returned when storing a key that is already stored.
+	ErrExists = errors.New("storage: document already exists")
+	// ErrInvalidKey is returned for empty keys and keys escaping the store.
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// Store keeps documents under slash-separated keys.
+type Store interface {
+	// Put stores data under key, and fails with ErrExists if the key is
+	// already stored.
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns the data stored under key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// validKey reports whether key is a relative slash-separated path without
+// empty, "." or ".." segments.
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.Contains(segment, "\\") {
+			return false
+		}
+	}
+	return true
+}
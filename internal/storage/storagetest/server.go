@@ -0,0 +1,108 @@
+// Package storagetest provides a fake S3-compatible server for tests, in
+// the spirit of net/http/httptest.
+package storagetest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Credentials accepted by the server.
+const (
+	AccessKey = "storagetest"
+	SecretKey = "storagetest-secret"
+)
+
+// Server is a local object storage speaking just enough S3 for
+// storage.S3Store: path-style PUT and GET of objects, with If-None-Match.
+// Requests must carry a V4 authorization of AccessKey and the SHA-256 of
+// their payload; the signature itself is not checked.
+type Server struct {
+	// URL is the endpoint of the server.
+	URL string
+
+	server  *httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewServer starts a server on a random local port, closed at the end of
+// the test.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{objects: make(map[string][]byte)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// Object returns the object stored at path, "/bucket/key".
+func (s *Server) Object(path string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[path]
+	return data, ok
+}
+
+// SetObject overwrites the object at path, to simulate its corruption.
+func (s *Server) SetObject(path string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[path] = data
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+AccessKey+"/") {
+		s3Error(w, http.StatusForbidden, "InvalidAccessKeyId")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		s3Error(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+		return
+	}
+	if strings.Count(r.URL.Path, "/") < 2 {
+		s3Error(w, http.StatusBadRequest, "InvalidRequest")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if _, ok := s.objects[r.URL.Path]; ok && r.Header.Get("If-None-Match") == "*" {
+			s3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		s.objects[r.URL.Path] = body
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	default:
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>`+code+`</Code></Error>`)
+}